@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// adtsSampleRates maps the ADTS sampling frequency index to Hz.
+var adtsSampleRates = [16]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350, 0, 0, 0}
+
+// adtsSampleFrames is how many frames aacDuration reads to learn the
+// average bitrate.
+const adtsSampleFrames = 256
+
+// aacDuration estimates the duration of a raw AAC (ADTS) stream from the
+// average bitrate of its first frames. ADTS has no header with the length,
+// and each frame holds 1024 samples per raw data block.
+func aacDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	start := skipID3v2(r, size)
+	end := trailingTagsStart(r, size)
+
+	var hdr [7]byte
+	offset := start
+	var frames, bytesSeen, samples int64
+	sampleRate := 0
+	for frames < adtsSampleFrames && offset+7 <= end {
+		if _, err := r.ReadAt(hdr[:], offset); err != nil {
+			break
+		}
+		if hdr[0] != 0xFF || hdr[1]&0xF6 != 0xF0 {
+			break
+		}
+		rate := adtsSampleRates[(hdr[2]>>2)&0x0F]
+		length := int64(hdr[3]&0x03)<<11 | int64(hdr[4])<<3 | int64(hdr[5])>>5
+		if rate == 0 || length < 7 || (sampleRate != 0 && rate != sampleRate) {
+			break
+		}
+		sampleRate = rate
+		samples += 1024 * int64(hdr[6]&0x03+1)
+		bytesSeen += length
+		frames++
+		offset += length
+	}
+	if frames == 0 {
+		return 0, errors.New("no ADTS frames")
+	}
+
+	seconds := float64(samples) / float64(sampleRate)
+	if offset < end {
+		// Extrapolate the average bitrate over the rest of the stream
+		seconds *= float64(end-start) / float64(bytesSeen)
+	}
+	return secondsToDuration(seconds), nil
+}
+
+// aacProvider estimates raw AAC durations from their bitrate. It's only as
+// good as the assumption that the bitrate is constant.
+type aacProvider struct{}
+
+func (aacProvider) Name() string { return "bitrate" }
+
+func (aacProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	if strings.ToLower(filepath.Ext(filePath)) != ".aac" {
+		return DurationEstimate{}, errors.New("not an AAC file")
+	}
+
+	d, err := readNativeDuration(filePath, aacDuration)
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+	return DurationEstimate{Duration: d, Confidence: 0.5}, nil
+}
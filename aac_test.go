@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// adtsFrame builds an ADTS frame of length bytes (including the 7 byte
+// header) at 44.1kHz holding one raw data block.
+func adtsFrame(length int) []byte {
+	b := make([]byte, length)
+	b[0] = 0xFF
+	b[1] = 0xF1
+	b[2] = 4<<2 | 0x40 // AAC LC, 44.1kHz
+	b[3] = 0x80 | byte(length>>11)&0x03
+	b[4] = byte(length >> 3)
+	b[5] = byte(length<<5) | 0x1F
+	b[6] = 0xFC
+	return b
+}
+
+func TestAACDuration(t *testing.T) {
+	frame := adtsFrame(186) // ~64kb/s
+	frameDuration := 1024 * time.Second / 44100
+
+	short := bytes.Repeat(frame, 100)
+	long := bytes.Repeat(frame, 10*adtsSampleFrames)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"every frame read", short, 100 * frameDuration, false},
+		{"extrapolated", long, 10 * adtsSampleFrames * frameDuration, false},
+		{"not adts", []byte("ID3 but not really, this is junk"), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := aacDuration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("aacDuration() = %v, want error", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("aacDuration() error = %v", err)
+			}
+			if diff := (d - tt.expected).Abs(); diff > time.Millisecond {
+				t.Errorf("aacDuration() = %v, want %v", d, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// decryptedDirName is the subdirectory the decrypted copy of an .aax file is
+// written to.
+func decryptedDirName(audioFile string) string {
+	return strings.TrimSuffix(audioFile, filepath.Ext(audioFile)) + "-decrypted"
+}
+
+// checkActivationBytes checks that s looks like Audible activation bytes:
+// four bytes, written as eight hex digits.
+func checkActivationBytes(s string) error {
+	if b, err := hex.DecodeString(s); err != nil || len(b) != 4 {
+		return fmt.Errorf("activation bytes must be 8 hex digits, e.g. 1a2b3c4d, not %q", s)
+	}
+	return nil
+}
+
+// decryptAAX replaces the .aax files in audioFiles with plain M4B copies
+// decrypted by ffmpeg with activationBytes, losslessly since AAX is AAC in
+// an encrypted MP4. Copies newer than their source are reused. The returned
+// names are relative to dir.
+func decryptAAX(dir string, audioFiles []string, activationBytes string) ([]string, error) {
+	var result []string
+	for _, filename := range audioFiles {
+		if strings.ToLower(filepath.Ext(filename)) != ".aax" {
+			result = append(result, filename)
+			continue
+		}
+
+		decrypted, err := ensureDecrypted(dir, filename, activationBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", filename, err)
+		}
+		if decrypted != "" {
+			result = append(result, decrypted)
+		}
+	}
+	return result, nil
+}
+
+// ensureDecrypted writes the decrypted copy of source unless an up to date
+// one exists, returning its path relative to dir, or "" in a dry run when
+// there's no copy yet.
+func ensureDecrypted(dir string, source string, activationBytes string) (string, error) {
+	srcPath := filepath.Join(dir, source)
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return "", err
+	}
+
+	subdir := decryptedDirName(source)
+	decrypted := filepath.Join(subdir, strings.TrimSuffix(source, filepath.Ext(source))+".m4b")
+	dstPath := filepath.Join(dir, decrypted)
+	dstInfo, err := os.Stat(dstPath)
+	if err == nil && !dstInfo.ModTime().Before(srcInfo.ModTime()) {
+		return decrypted, nil
+	}
+	if planFFmpeg(dstPath) {
+		if err != nil {
+			return "", nil
+		}
+		return decrypted, nil
+	}
+
+	if err := mkdirAll(filepath.Join(dir, subdir)); err != nil {
+		return "", err
+	}
+	// Decrypting takes a while; don't leave a half-written file that a later
+	// run would take for a finished one
+	partial := dstPath + ".partial"
+	err = runFFmpeg("-v", "error", "-y", "-activation_bytes", activationBytes, "-i", srcPath,
+		"-map", "0:a", "-c", "copy", "-f", "mp4", partial)
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	return decrypted, os.Rename(partial, dstPath)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckActivationBytes(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"1a2b3c4d", false},
+		{"1A2B3C4D", false},
+		{"1a2b3c", true},
+		{"1a2b3c4d5e", true},
+		{"not hex!", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if err := checkActivationBytes(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("checkActivationBytes(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecryptAAXReusesDecryptedCopy(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"book.aax", "bonus.mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A copy newer than its source is reused, so ffmpeg never runs
+	decrypted := filepath.Join("book-decrypted", "book.m4b")
+	if err := os.Mkdir(filepath.Join(dir, "book-decrypted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, decrypted), []byte("decrypted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, decrypted), future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := decryptAAX(dir, []string{"bonus.mp3", "book.aax"}, "1a2b3c4d")
+	if err != nil {
+		t.Fatalf("decryptAAX() error = %v", err)
+	}
+	expected := []string{"bonus.mp3", decrypted}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("decryptAAX() = %v, want %v", result, expected)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// layoutAudiobookshelf is --layout audiobookshelf: the directory is an
+// Audiobookshelf library, Author/Book or Author/Series/Book, and every book
+// in it gets a feed.
+const layoutAudiobookshelf = "audiobookshelf"
+
+// absNarratorFile names the narrator, when the book directory has no
+// {Narrator} suffix.
+const absNarratorFile = "reader.txt"
+
+// libraryBook is a book directory found in a library.
+type libraryBook struct {
+	Dir    string
+	Parent []string    // Directories between the library and the book, for URLs
+	Folder *FolderName // What the layout says about the book
+}
+
+var (
+	// "The Final Empire {Michael Kramer}"
+	absNarratorRe = regexp.MustCompile(`^(.*?)\s*\{([^{}]+)\}$`)
+	// "Vol 1 - ", "Volume 1. ", "Book 1 - ", "1 - ", "1. "
+	absVolumeRe = regexp.MustCompile(`(?i)^(?:(?:vol\.?|volume|book)\s*)?(\d{1,3}(?:\.\d+)?)(?:\s+-\s+|\.\s+)`)
+	// "2006 - ", "(2006) - "
+	absYearPrefixRe = regexp.MustCompile(`^\(?((?:1[5-9]|20)\d\d)\)?\s+-\s+`)
+)
+
+// findBooks returns the book directories under dir laid out as layout: dir
+// itself without a layout.
+func findBooks(dir string, layout string) ([]libraryBook, error) {
+	switch layout {
+	case "":
+		return []libraryBook{{Dir: dir}}, nil
+	case layoutAudiobookshelf:
+		books, err := findABSBooks(dir)
+		if err != nil {
+			return nil, fmt.Errorf("scanning library: %v", err)
+		}
+		if len(books) == 0 {
+			return nil, fmt.Errorf("No books found in library '%s'", dir)
+		}
+		return books, nil
+	}
+	return nil, fmt.Errorf("--layout must be audiobookshelf, not %q", layout)
+}
+
+// findABSBooks walks an Audiobookshelf library for book directories: the
+// ones holding audio files, at most Author/Series/Book deep. A "-merged"
+// copy made by bookast merge is left out when its source is there too.
+func findABSBooks(root string) ([]libraryBook, error) {
+	var books []libraryBook
+	var walk func(dir string, parent []string) error
+	walk = func(dir string, parent []string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		hasAudio := false
+		var subdirs []string
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			if entry.IsDir() {
+				subdirs = append(subdirs, name)
+				continue
+			}
+			ext := strings.ToLower(filepath.Ext(name))
+			if audioMIMETypes[ext] != "" || drmAudioExts[ext] {
+				hasAudio = true
+			}
+		}
+
+		if hasAudio && len(parent) > 0 {
+			folder, err := absFolder(dir, parent)
+			if err != nil {
+				return err
+			}
+			books = append(books, libraryBook{Dir: dir, Parent: parent[:len(parent)-1], Folder: folder})
+			return nil
+		}
+		if len(parent) == 3 {
+			return nil
+		}
+
+		sortFilenames(subdirs)
+		for _, name := range subdirs {
+			if source, ok := strings.CutSuffix(name, "-merged"); ok {
+				if info, err := os.Stat(filepath.Join(dir, source)); err == nil && info.IsDir() {
+					continue
+				}
+			}
+			path := append(append([]string(nil), parent...), name)
+			if err := walk(filepath.Join(dir, name), path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root, nil); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// absFolder is what an Audiobookshelf path says about the book at its end.
+// The author directory may name several authors joined with "&" or ",".
+func absFolder(dir string, path []string) (*FolderName, error) {
+	folder := parseABSBookName(path[len(path)-1])
+	switch len(path) {
+	case 3:
+		folder.Series = path[1]
+		fallthrough
+	case 2:
+		var authors []string
+		for _, author := range strings.FieldsFunc(path[0], func(r rune) bool { return r == '&' || r == ',' }) {
+			if author = strings.TrimSpace(author); author != "" {
+				authors = append(authors, author)
+			}
+		}
+		folder.Author = strings.Join(authors, "; ")
+	}
+
+	if folder.Narrator == "" {
+		content, err := os.ReadFile(filepath.Join(dir, absNarratorFile))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		folder.Narrator = strings.Join(splitNames(strings.TrimSpace(string(content))), "; ")
+	}
+	return &folder, nil
+}
+
+// parseABSBookName splits an Audiobookshelf book directory name:
+//
+//	Vol 1 - 2006 - The Final Empire {Michael Kramer}
+//	1. The Final Empire (2006)
+//	The Final Empire
+//
+// A volume number only makes sense inside a series directory, which the
+// caller fills in.
+func parseABSBookName(name string) FolderName {
+	var folder FolderName
+	name = strings.TrimSpace(name)
+
+	if m := absNarratorRe.FindStringSubmatch(name); m != nil {
+		name, folder.Narrator = m[1], strings.TrimSpace(m[2])
+	}
+	if m := absVolumeRe.FindStringSubmatchIndex(name); m != nil && m[1] < len(name) {
+		_, folder.SeriesIndex, _ = splitSeriesIndex(name[m[2]:m[3]])
+		name = name[m[1]:]
+	}
+	if m := absYearPrefixRe.FindStringSubmatchIndex(name); m != nil && m[1] < len(name) {
+		folder.Year, _ = strconv.Atoi(name[m[2]:m[3]])
+		name = name[m[1]:]
+	}
+	if m := folderYearRe.FindStringSubmatchIndex(name); m != nil && m[0] > 0 {
+		folder.Year, _ = strconv.Atoi(name[m[2]:m[3]])
+		name = name[:m[0]]
+	}
+	folder.Title = strings.TrimSpace(name)
+	return folder
+}
+
+// baseURL is the base URL the book's files are under: the library's, plus
+// the directories between the library and the book.
+func (b libraryBook) baseURL(libraryURL string) string {
+	base := strings.TrimSuffix(libraryURL, "/")
+	for _, segment := range b.Parent {
+		base += "/" + url.PathEscape(segment)
+	}
+	return base
+}
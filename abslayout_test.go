@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseABSBookName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected FolderName
+	}{
+		{"Vol 1 - 2006 - The Final Empire {Michael Kramer}", FolderName{SeriesIndex: "1", Year: 2006, Title: "The Final Empire", Narrator: "Michael Kramer"}},
+		{"Book 2.5 - The Eleventh Metal", FolderName{SeriesIndex: "2.5", Title: "The Eleventh Metal"}},
+		{"01. The Final Empire (2006)", FolderName{SeriesIndex: "1", Year: 2006, Title: "The Final Empire"}},
+		{"(1965) - Dune", FolderName{Year: 1965, Title: "Dune"}},
+		{"The Hobbit", FolderName{Title: "The Hobbit"}},
+		{"1984", FolderName{Title: "1984"}},
+		{"2001 - A Space Odyssey", FolderName{Year: 2001, Title: "A Space Odyssey"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseABSBookName(tt.name); got != tt.expected {
+				t.Errorf("parseABSBookName(%q) = %+v, want %+v", tt.name, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFindABSBooks(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{
+		"Brandon Sanderson/Mistborn/Vol 1 - The Final Empire",
+		"Brandon Sanderson/Mistborn/Vol 1 - The Final Empire-merged",
+		"Brandon Sanderson/Elantris (2005)",
+		"Neil Gaiman & Terry Pratchett/Good Omens",
+		"Frank Herbert/Dune/Vol 1 - Dune/Extras",
+		"Empty Author/Nothing Here",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{
+		"Brandon Sanderson/Mistborn/Vol 1 - The Final Empire",
+		"Brandon Sanderson/Mistborn/Vol 1 - The Final Empire-merged",
+		"Brandon Sanderson/Elantris (2005)",
+		"Neil Gaiman & Terry Pratchett/Good Omens",
+		"Frank Herbert/Dune/Vol 1 - Dune/Extras",
+	} {
+		copyFixture(t, filepath.Join(root, dir), "chapter01.mp3")
+	}
+	if err := os.WriteFile(filepath.Join(root, "Brandon Sanderson/Elantris (2005)", absNarratorFile), []byte("Jack Garrett\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := findABSBooks(root)
+	if err != nil {
+		t.Fatalf("findABSBooks() error = %v", err)
+	}
+
+	expected := []libraryBook{
+		{
+			Dir:    filepath.Join(root, "Brandon Sanderson/Elantris (2005)"),
+			Parent: []string{"Brandon Sanderson"},
+			Folder: &FolderName{Author: "Brandon Sanderson", Title: "Elantris", Year: 2005, Narrator: "Jack Garrett"},
+		},
+		{
+			Dir:    filepath.Join(root, "Brandon Sanderson/Mistborn/Vol 1 - The Final Empire"),
+			Parent: []string{"Brandon Sanderson", "Mistborn"},
+			Folder: &FolderName{Author: "Brandon Sanderson", Series: "Mistborn", SeriesIndex: "1", Title: "The Final Empire"},
+		},
+		{
+			Dir:    filepath.Join(root, "Neil Gaiman & Terry Pratchett/Good Omens"),
+			Parent: []string{"Neil Gaiman & Terry Pratchett"},
+			Folder: &FolderName{Author: "Neil Gaiman; Terry Pratchett", Title: "Good Omens"},
+		},
+	}
+	if !reflect.DeepEqual(books, expected) {
+		t.Errorf("findABSBooks() =")
+		for _, book := range books {
+			t.Errorf("  %+v %+v", book, *book.Folder)
+		}
+	}
+}
+
+func TestLibraryBookBaseURL(t *testing.T) {
+	book := libraryBook{Parent: []string{"Neil Gaiman & Terry Pratchett", "Discworld"}}
+	if got := book.baseURL("https://example.com/library/"); got != "https://example.com/library/Neil%20Gaiman%20&%20Terry%20Pratchett/Discworld" {
+		t.Errorf("baseURL() = %q", got)
+	}
+	if got := (libraryBook{}).baseURL("https://example.com/library/"); got != "https://example.com/library" {
+		t.Errorf("baseURL() without parents = %q", got)
+	}
+}
+
+func TestScanDirectoryABSLayout(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "Brandon Sanderson", "Mistborn", "Vol 1 - 2006 - The Final Empire {Michael Kramer}")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	copyFixture(t, dir, "cover.jpg")
+	if err := os.WriteFile(filepath.Join(dir, "back.jpg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "desc.txt"), []byte("Ash falls from the sky.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := findABSBooks(root)
+	if err != nil || len(books) != 1 {
+		t.Fatalf("findABSBooks() = %v, %v", books, err)
+	}
+	podcast, err := scanDirectory(books[0].Dir, Options{BaseURL: books[0].baseURL("https://example.com/library"), Folder: books[0].Folder})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+
+	if podcast.Title != "Mistborn 01: The Final Empire" {
+		t.Errorf("Title = %q", podcast.Title)
+	}
+	if podcast.Description != "Book 1 of the Mistborn series.\n\nAsh falls from the sky." {
+		t.Errorf("Description = %q", podcast.Description)
+	}
+	if podcast.Copyright != "© 2006 Brandon Sanderson" {
+		t.Errorf("Copyright = %q", podcast.Copyright)
+	}
+	if !hasPerson(podcast.People, Person{"Michael Kramer", roleNarrator}) {
+		t.Errorf("People = %v, want narrator Michael Kramer", podcast.People)
+	}
+	expectedCover := "https://example.com/library/Brandon%20Sanderson/Mistborn/Vol%201%20-%202006%20-%20The%20Final%20Empire%20%7BMichael%20Kramer%7D/cover.jpg"
+	if podcast.CoverArtURL != expectedCover {
+		t.Errorf("CoverArtURL = %q, want %q", podcast.CoverArtURL, expectedCover)
+	}
+}
+
+func hasPerson(people []Person, want Person) bool {
+	for _, p := range people {
+		if p == want {
+			return true
+		}
+	}
+	return false
+}
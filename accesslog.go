@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Access log formats of serve --access-log.
+const (
+	accessLogCommon   = "common"   // NCSA Common Log Format
+	accessLogCombined = "combined" // Common plus referer and user agent, like Apache's and nginx's default
+	accessLogJSON     = "json"     // One JSON object per request
+)
+
+// accessLogLine is what's logged about one request.
+type accessLogLine struct {
+	Time      time.Time
+	Remote    string
+	User      string
+	Method    string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	Referer   string
+	UserAgent string
+}
+
+// accessLogger writes access log lines in one format.
+type accessLogger struct {
+	format string
+	mu     sync.Mutex
+	w      io.Writer
+	json   *slog.Logger
+}
+
+// newAccessLogger returns a logger writing format to w.
+func newAccessLogger(w io.Writer, format string) (*accessLogger, error) {
+	l := &accessLogger{format: format, w: w}
+	switch format {
+	case accessLogCommon, accessLogCombined:
+	case accessLogJSON:
+		l.json = slog.New(slog.NewJSONHandler(w, nil))
+	default:
+		return nil, fmt.Errorf("--access-log must be common, combined or json, not %q", format)
+	}
+	return l, nil
+}
+
+// log writes line.
+func (l *accessLogger) log(line accessLogLine) {
+	if l.json != nil {
+		l.json.LogAttrs(context.Background(), slog.LevelInfo, "request",
+			slog.String("remote", line.Remote),
+			slog.String("user", line.User),
+			slog.String("method", line.Method),
+			slog.String("uri", line.URI),
+			slog.String("proto", line.Proto),
+			slog.Int("status", line.Status),
+			slog.Int64("bytes", line.Bytes),
+			slog.Float64("duration", line.Duration.Seconds()),
+			slog.String("referer", line.Referer),
+			slog.String("userAgent", line.UserAgent),
+		)
+		return
+	}
+
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	size := "-"
+	if line.Bytes > 0 {
+		size = strconv.FormatInt(line.Bytes, 10)
+	}
+	entry := fmt.Sprintf("%s - %s [%s] %s %d %s", dash(line.Remote), dash(line.User),
+		line.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(line.Method+" "+line.URI+" "+line.Proto), line.Status, size)
+	if l.format == accessLogCombined {
+		entry += " " + strconv.Quote(dash(line.Referer)) + " " + strconv.Quote(dash(line.UserAgent))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.w, entry)
+}
+
+// loggedResponse records the status and size of a response.
+type loggedResponse struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *loggedResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *loggedResponse) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps sendfile for audio files, which http.ServeContent copies
+// with io.Copy.
+func (w *loggedResponse) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := io.Copy(w.ResponseWriter, r)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (w *loggedResponse) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// clientAddr is the address of the client that made r: behind a proxy the
+// first X-Forwarded-For address, else the connection's.
+func clientAddr(r *http.Request) string {
+	if forwarded := forwardedHeader(r, "X-Forwarded-For"); forwarded != "" {
+		return forwarded
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// logRequests wraps h so every request is written to l once it's answered.
+func logRequests(h http.Handler, l *accessLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logged := &loggedResponse{ResponseWriter: w}
+		h.ServeHTTP(logged, r)
+
+		user, _, _ := r.BasicAuth()
+		if logged.status == 0 {
+			logged.status = http.StatusOK
+		}
+		l.log(accessLogLine{
+			Time:      start,
+			Remote:    clientAddr(r),
+			User:      user,
+			Method:    r.Method,
+			URI:       r.RequestURI,
+			Proto:     r.Proto,
+			Status:    logged.status,
+			Bytes:     logged.bytes,
+			Duration:  time.Since(start),
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		})
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLoggerFormats(t *testing.T) {
+	line := accessLogLine{
+		Time:      time.Date(2024, 3, 9, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		Remote:    "192.168.1.20",
+		User:      "alice",
+		Method:    "GET",
+		URI:       "/Book/chapter01.mp3",
+		Proto:     "HTTP/1.1",
+		Status:    206,
+		Bytes:     1048576,
+		Duration:  1500 * time.Millisecond,
+		UserAgent: "Overcast/3.0",
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{accessLogCommon, `192.168.1.20 - alice [09/Mar/2024:13:55:36 -0700] "GET /Book/chapter01.mp3 HTTP/1.1" 206 1048576` + "\n"},
+		{accessLogCombined, `192.168.1.20 - alice [09/Mar/2024:13:55:36 -0700] "GET /Book/chapter01.mp3 HTTP/1.1" 206 1048576 "-" "Overcast/3.0"` + "\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		l, err := newAccessLogger(&buf, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.log(line)
+		if buf.String() != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.format, buf.String(), tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	l, err := newAccessLogger(&buf, accessLogJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.log(line)
+	var event map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("json line %q: %v", buf.String(), err)
+	}
+	if event["msg"] != "request" || event["uri"] != "/Book/chapter01.mp3" || event["status"] != 206.0 || event["bytes"] != 1048576.0 || event["duration"] != 1.5 || event["userAgent"] != "Overcast/3.0" {
+		t.Errorf("json line = %v", event)
+	}
+
+	if _, err := newAccessLogger(&buf, "apache"); err == nil {
+		t.Error("newAccessLogger(apache) error = nil, want error")
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newAccessLogger(&buf, accessLogCombined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feeds, _ := newTestFeedServer(t)
+	server := httptest.NewServer(logRequests(feeds.Config.Handler, l))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/Book/chapter01.mp3", nil)
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set("Range", "bytes=0-99")
+	req.Header.Set("User-Agent", "AntennaPod/3.4")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	serveGet(t, server.URL+"/Book/missing.mp3")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "203.0.113.7 - alice [") || !strings.HasSuffix(lines[0], `"GET /Book/chapter01.mp3 HTTP/1.1" 206 100 "-" "AntennaPod/3.4"`) {
+		t.Errorf("ranged download logged as\n%s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "127.0.0.1 - - [") || !strings.Contains(lines[1], `"GET /Book/missing.mp3 HTTP/1.1" 404 `) {
+		t.Errorf("missing file logged as\n%s", lines[1])
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiPathPrefix is where serve --api's JSON API is.
+const apiPathPrefix = "/api/"
+
+// apiBook is a book in the API.
+type apiBook struct {
+	Path      string       `json:"path"` // In the library, "Author/Book", what /api/books/ takes
+	FeedURL   string       `json:"feedUrl"`
+	Cover     string       `json:"cover,omitempty"`
+	Metadata  *apiMetadata `json:"metadata,omitempty"`
+	Downloads int          `json:"downloads"`
+
+	// Only for one book
+	Episodes []episodeDownloads `json:"episodes,omitempty"`
+}
+
+// apiMetadata is a book's book.yaml fields that the API edits.
+type apiMetadata struct {
+	Authors   []string `json:"authors"`
+	Narrators []string `json:"narrators"`
+	Keywords  []string `json:"keywords"`
+	Language  string   `json:"language"`
+	ISBN      string   `json:"isbn"`
+	ASIN      string   `json:"asin"`
+}
+
+func newAPIMetadata(book *BookConfig) *apiMetadata {
+	return &apiMetadata{
+		Authors:   nonNil(book.Authors),
+		Narrators: nonNil(book.Narrators),
+		Keywords:  nonNil(book.Keywords),
+		Language:  book.Language,
+		ISBN:      book.ISBN,
+		ASIN:      book.ASIN,
+	}
+}
+
+// nonNil returns s, or an empty slice for nil, so JSON has [] and not null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// apiScan is what rescanning a book found.
+type apiScan struct {
+	Path     string       `json:"path"`
+	Title    string       `json:"title"`
+	Episodes int          `json:"episodes"`
+	Runtime  float64      `json:"runtime"` // Seconds
+	Size     int64        `json:"size"`    // Bytes
+	Warnings []apiWarning `json:"warnings"`
+	Skipped  []apiWarning `json:"skipped"`
+}
+
+type apiWarning struct {
+	Category string `json:"category,omitempty"`
+	File     string `json:"file"`
+	Message  string `json:"message"`
+}
+
+// apiStats is the library's totals.
+type apiStats struct {
+	Books     int      `json:"books"`
+	Episodes  int      `json:"episodes"`
+	Runtime   float64  `json:"runtime"` // Seconds
+	Size      int64    `json:"size"`    // Bytes
+	Downloads int      `json:"downloads"`
+	Failed    []string `json:"failed"` // Books that couldn't be scanned
+}
+
+// newAPI returns the handler of the JSON API, which s serves under
+// apiPathPrefix with --api.
+func (s *feedServer) newAPI() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/books", s.apiListBooks)
+	mux.HandleFunc("GET /api/books/{path...}", s.apiGetBook)
+	mux.HandleFunc("PATCH /api/books/{path...}", s.apiEditBook)
+	mux.HandleFunc("POST /api/rescan/{path...}", s.apiRescan)
+	mux.HandleFunc("POST /api/rotate-token/{path...}", s.apiRotateToken)
+	mux.HandleFunc("GET /api/tokens", s.apiListTokens)
+	mux.HandleFunc("POST /api/tokens", s.apiCreateToken)
+	mux.HandleFunc("DELETE /api/tokens/{name}", s.apiRevokeToken)
+	mux.HandleFunc("GET /api/stats", s.apiStats)
+	return mux
+}
+
+// writeAPI writes v as the JSON response.
+func writeAPI(w http.ResponseWriter, status int, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		status, data = http.StatusInternalServerError, []byte(`{"error": "encoding the response failed"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+// writeAPIError writes err as {"error": "..."}.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPI(w, status, map[string]string{"error": err.Error()})
+}
+
+// apiBookPath returns book's path in the library, as the API names it.
+func apiBookPath(book servedBook) string {
+	return strings.Trim(book.Prefix, "/")
+}
+
+// apiFindBook returns the book r's {path} names, or answers 404.
+func (s *feedServer) apiFindBook(w http.ResponseWriter, r *http.Request) (servedBook, bool) {
+	path := strings.Trim(r.PathValue("path"), "/")
+	for _, book := range s.servedBooks() {
+		if apiBookPath(book) == path {
+			return book, true
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, fmt.Errorf("no book at %q", path))
+	return servedBook{}, false
+}
+
+// apiBook returns book as the API shows it, with its metadata and
+// download counts when it can read them. Private books' URLs are their
+// secret ones.
+func (s *feedServer) apiBook(r *http.Request, book servedBook) (apiBook, *BookState) {
+	if s.private {
+		book.BasePath = "/f/" + book.Token
+	}
+	b := apiBook{Path: apiBookPath(book), FeedURL: s.feedURL(r, book)}
+	if cover := findCover(book.Dir); cover != "" {
+		b.Cover = buildURL(book.baseURL(s.requestBaseURL(r)), book.Dir, cover)
+	}
+	if config, err := loadBookConfig(book.Dir); err == nil {
+		b.Metadata = newAPIMetadata(config)
+	}
+	state, err := loadBookState(book.Dir)
+	if err != nil {
+		return b, nil
+	}
+	for _, count := range state.Downloads {
+		b.Downloads += count.Count
+	}
+	return b, state
+}
+
+func (s *feedServer) apiListBooks(w http.ResponseWriter, r *http.Request) {
+	books := []apiBook{}
+	for _, book := range s.servedBooks() {
+		b, _ := s.apiBook(r, book)
+		books = append(books, b)
+	}
+	writeAPI(w, http.StatusOK, books)
+}
+
+func (s *feedServer) apiGetBook(w http.ResponseWriter, r *http.Request) {
+	book, ok := s.apiFindBook(w, r)
+	if !ok {
+		return
+	}
+	b, state := s.apiBook(r, book)
+	if state != nil {
+		downloads, err := libraryDownloads([]libraryBook{book.libraryBook})
+		if err == nil && len(downloads) > 0 {
+			b.Episodes = downloads[0].Episodes
+		}
+	}
+	writeAPI(w, http.StatusOK, b)
+}
+
+// apiEditBook changes the fields of book.yaml in the request body, a JSON
+// object like apiMetadata's; the ones it leaves out are kept.
+func (s *feedServer) apiEditBook(w http.ResponseWriter, r *http.Request) {
+	book, ok := s.apiFindBook(w, r)
+	if !ok {
+		return
+	}
+	var patch bookConfigPatch
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON: %v", err))
+		return
+	}
+
+	s.mu.Lock()
+	config, err := loadBookConfig(book.Dir)
+	if err == nil {
+		if err = patch.apply(config); err != nil {
+			s.mu.Unlock()
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		err = saveBookConfig(book.Dir, config)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.notifyHub([]servedBook{book})
+	writeAPI(w, http.StatusOK, newAPIMetadata(config))
+}
+
+// apiRescan probes every file of the book again, throwing its cache away,
+// e.g. after retagging them in place.
+func (s *feedServer) apiRescan(w http.ResponseWriter, r *http.Request) {
+	book, ok := s.apiFindBook(w, r)
+	if !ok {
+		return
+	}
+	opts := s.opts
+	opts.BaseURL = book.baseURL(s.requestBaseURL(r))
+	opts.Folder = book.Folder
+
+	s.mu.Lock()
+	s.reloadMu.RLock()
+	cachePath, err := bookCachePath(book.Dir)
+	if err == nil {
+		if err = os.Remove(cachePath); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	var podcast *Podcast
+	if err == nil {
+		start := time.Now()
+		podcast, err = scanDirectory(book.Dir, opts)
+		s.metrics.observeScan(time.Since(start))
+	}
+	s.reloadMu.RUnlock()
+	s.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.notifyHub([]servedBook{book})
+
+	scan := apiScan{Path: apiBookPath(book), Title: podcast.Title, Episodes: len(podcast.Episodes), Warnings: []apiWarning{}, Skipped: []apiWarning{}}
+	for _, ep := range podcast.Episodes {
+		scan.Runtime += ep.Duration.Seconds()
+		scan.Size += ep.FileSize
+	}
+	for _, warning := range podcast.Warnings {
+		scan.Warnings = append(scan.Warnings, apiWarning{Category: warning.Category, File: warning.File, Message: warning.Message})
+	}
+	for _, skipped := range podcast.Skipped {
+		scan.Skipped = append(scan.Skipped, apiWarning{File: skipped.File, Message: skipped.Reason})
+	}
+	writeAPI(w, http.StatusOK, scan)
+}
+
+// apiRotateToken gives a private book a new feed token. Subscribers of its
+// old private URL lose it.
+func (s *feedServer) apiRotateToken(w http.ResponseWriter, r *http.Request) {
+	if !s.private {
+		writeAPIError(w, http.StatusConflict, errors.New("books only have feed tokens with --private"))
+		return
+	}
+	book, ok := s.apiFindBook(w, r)
+	if !ok {
+		return
+	}
+	token, err := newToken()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.mu.Lock()
+	state, err := loadBookState(book.Dir)
+	if err == nil {
+		state.FeedToken = token
+		err = saveBookState(book.Dir, state)
+	}
+	if err == nil {
+		// A new slice, like reload's: servedBooks' callers still range over
+		// the old one without the lock
+		s.reloadMu.Lock()
+		books := slices.Clone(s.books)
+		for i := range books {
+			if books[i].Dir == book.Dir {
+				books[i].Token = token
+				book = books[i]
+			}
+		}
+		s.books = books
+		s.reloadMu.Unlock()
+	}
+	s.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	b, _ := s.apiBook(r, book)
+	writeAPI(w, http.StatusOK, b)
+}
+
+func (s *feedServer) apiListTokens(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	subscribers, err := loadSubscribers(s.root)
+	s.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if subscribers == nil {
+		subscribers = []subscriber{}
+	}
+	writeAPI(w, http.StatusOK, subscribers)
+}
+
+// apiCreateToken gives the subscriber named in the body, {"name": "..."},
+// a token, as bookast token create does.
+func (s *feedServer) apiCreateToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON: %v", err))
+		return
+	}
+	if body.Name = strings.TrimSpace(body.Name); body.Name == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("name is required"))
+		return
+	}
+	s.mu.Lock()
+	created, err := createSubscriber(s.root, body.Name)
+	s.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeAPI(w, http.StatusCreated, created)
+}
+
+func (s *feedServer) apiRevokeToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	err := revokeSubscriber(s.root, r.PathValue("name"))
+	s.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiStats totals up the library as bookast stats does, scanning each book
+// (from the cache, mostly).
+func (s *feedServer) apiStats(w http.ResponseWriter, r *http.Request) {
+	stats := apiStats{Failed: []string{}}
+	for _, book := range s.servedBooks() {
+		opts := s.opts
+		opts.BaseURL = book.baseURL(s.requestBaseURL(r))
+		opts.Folder = book.Folder
+		s.mu.Lock()
+		s.reloadMu.RLock()
+		podcast, err := scanDirectory(book.Dir, opts)
+		s.reloadMu.RUnlock()
+		s.mu.Unlock()
+		if err != nil {
+			stats.Failed = append(stats.Failed, apiBookPath(book))
+			continue
+		}
+		stats.Books++
+		stats.Episodes += len(podcast.Episodes)
+		for _, ep := range podcast.Episodes {
+			stats.Runtime += ep.Duration.Seconds()
+			stats.Size += ep.FileSize
+		}
+		if state, err := loadBookState(book.Dir); err == nil {
+			for _, count := range state.Downloads {
+				stats.Downloads += count.Count
+			}
+		}
+	}
+	writeAPI(w, http.StatusOK, stats)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// apiRequest makes a request of the API and decodes its JSON response
+// into v, if it's given.
+func apiRequest(t *testing.T, method string, url string, body string, v any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+	}
+	return resp
+}
+
+func newTestAPIServer(t *testing.T, private bool) (*httptest.Server, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "Author", "Book")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"chapter01.mp3", "chapter02.mp3", "cover.jpg"} {
+		copyFixture(t, dir, name)
+	}
+	if err := os.WriteFile(filepath.Join(dir, bookConfigFile), []byte("authors: [Ursula K. Le Guin]\nlanguage: en\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newFeedServer(filepath.Dir(filepath.Dir(dir)), []libraryBook{{Dir: dir, Parent: []string{"Author"}}}, "", Options{}, feedFormats["rss"], private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.api = s.newAPI()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server, dir
+}
+
+func TestAPIBooks(t *testing.T) {
+	server, dir := newTestAPIServer(t, false)
+
+	var books []apiBook
+	if resp := apiRequest(t, "GET", server.URL+"/api/books", "", &books); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/books = %s", resp.Status)
+	}
+	if len(books) != 1 {
+		t.Fatalf("GET /api/books = %d books, want 1", len(books))
+	}
+	book := books[0]
+	if book.Path != "Author/Book" || book.FeedURL != server.URL+"/Author/Book/podcast.rss" || book.Cover != server.URL+"/Author/Book/cover.jpg" {
+		t.Errorf("book = %+v", book)
+	}
+	if book.Metadata == nil || len(book.Metadata.Authors) != 1 || book.Metadata.Language != "en" {
+		t.Errorf("metadata = %+v, want book.yaml's", book.Metadata)
+	}
+
+	var one apiBook
+	if resp := apiRequest(t, "GET", server.URL+"/api/books/Author/Book", "", &one); resp.StatusCode != http.StatusOK || one.Path != "Author/Book" {
+		t.Errorf("GET /api/books/Author/Book = %s, %+v", resp.Status, one)
+	}
+	var apiErr map[string]string
+	if resp := apiRequest(t, "GET", server.URL+"/api/books/Author/Nothing", "", &apiErr); resp.StatusCode != http.StatusNotFound || apiErr["error"] == "" {
+		t.Errorf("GET a missing book = %s, %v, want 404 with an error", resp.Status, apiErr)
+	}
+
+	var metadata apiMetadata
+	resp := apiRequest(t, "PATCH", server.URL+"/api/books/Author/Book", `{"narrators": ["Kobna Holdbrook-Smith", " "], "isbn": "9780547773742"}`, &metadata)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH = %s", resp.Status)
+	}
+	if len(metadata.Authors) != 1 || len(metadata.Narrators) != 1 || metadata.ISBN != "9780547773742" {
+		t.Errorf("metadata after PATCH = %+v", metadata)
+	}
+	config, err := loadBookConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Narrators) != 1 || config.Narrators[0] != "Kobna Holdbrook-Smith" || config.Language != "en" {
+		t.Errorf("book.yaml after PATCH = %+v", config)
+	}
+
+	for _, body := range []string{`{"language": "klingon"}`, `{"title": "x"}`, `not json`} {
+		if resp := apiRequest(t, "PATCH", server.URL+"/api/books/Author/Book", body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("PATCH %s = %s, want 400", body, resp.Status)
+		}
+	}
+}
+
+func TestAPIRescanAndStats(t *testing.T) {
+	server, dir := newTestAPIServer(t, false)
+
+	var scan apiScan
+	if resp := apiRequest(t, "POST", server.URL+"/api/rescan/Author/Book", "", &scan); resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/rescan = %s", resp.Status)
+	}
+	if scan.Episodes != 2 || scan.Size == 0 {
+		t.Errorf("rescan = %+v, want 2 episodes", scan)
+	}
+	cachePath, err := bookCachePath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Errorf("no cache after a rescan: %v", err)
+	}
+
+	var stats apiStats
+	if resp := apiRequest(t, "GET", server.URL+"/api/stats", "", &stats); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/stats = %s", resp.Status)
+	}
+	if stats.Books != 1 || stats.Episodes != 2 || stats.Size != scan.Size || len(stats.Failed) != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	if resp := apiRequest(t, "GET", server.URL+"/api/rescan/Author/Book", "", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/rescan = %s, want 405", resp.Status)
+	}
+	if resp := apiRequest(t, "GET", server.URL+"/api/nothing", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /api/nothing = %s, want 404", resp.Status)
+	}
+	// Another site's page
+	req, _ := http.NewRequest("POST", server.URL+"/api/rescan/Author/Book", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-site POST = %s, want 403", resp.Status)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	server, dir := newTestAPIServer(t, true)
+
+	var books []apiBook
+	apiRequest(t, "GET", server.URL+"/api/books", "", &books)
+	state, err := loadBookState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := state.FeedToken
+	if len(books) != 1 || books[0].FeedURL != server.URL+"/f/"+old+"/Book/podcast.rss" {
+		t.Fatalf("books = %+v, want the private feed URL", books)
+	}
+
+	var rotated apiBook
+	if resp := apiRequest(t, "POST", server.URL+"/api/rotate-token/Author/Book", "", &rotated); resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/rotate-token = %s", resp.Status)
+	}
+	if state, err = loadBookState(dir); err != nil {
+		t.Fatal(err)
+	}
+	if state.FeedToken == old || rotated.FeedURL != server.URL+"/f/"+state.FeedToken+"/Book/podcast.rss" {
+		t.Errorf("rotated = %+v, token %q (was %q)", rotated, state.FeedToken, old)
+	}
+	if resp, _ := serveGet(t, rotated.FeedURL); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET new feed URL = %s", resp.Status)
+	}
+	if resp, _ := serveGet(t, books[0].FeedURL); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET old feed URL = %s, want 404", resp.Status)
+	}
+
+	var created subscriber
+	if resp := apiRequest(t, "POST", server.URL+"/api/tokens", `{"name": "alice"}`, &created); resp.StatusCode != http.StatusCreated || created.Token == "" {
+		t.Fatalf("POST /api/tokens = %s, %+v", resp.Status, created)
+	}
+	if resp := apiRequest(t, "POST", server.URL+"/api/tokens", `{"name": "alice"}`, nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("POST /api/tokens again = %s, want 409", resp.Status)
+	}
+	var subscribers []subscriber
+	apiRequest(t, "GET", server.URL+"/api/tokens", "", &subscribers)
+	if len(subscribers) != 1 || subscribers[0].Name != "alice" {
+		t.Errorf("GET /api/tokens = %+v", subscribers)
+	}
+	if resp := apiRequest(t, "DELETE", server.URL+"/api/tokens/alice", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE /api/tokens/alice = %s", resp.Status)
+	}
+	if resp := apiRequest(t, "DELETE", server.URL+"/api/tokens/alice", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("DELETE /api/tokens/alice again = %s, want 404", resp.Status)
+	}
+}
+
+func TestAPIRotateTokenWhileServing(t *testing.T) {
+	server, _ := newTestAPIServer(t, true)
+	s := server.Config.Handler.(*feedServer)
+
+	// Requests range over the books while the token changes (go test
+	// -race). Called directly, a connection's I/O would order them
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 20 {
+			s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/f/nonsense/Book/podcast.rss", nil))
+		}
+	}()
+	for range 5 {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("POST", "/api/rotate-token/Author/Book", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("POST /api/rotate-token = %d", w.Code)
+		}
+	}
+	<-done
+}
+
+func TestAPIRotateTokenPublic(t *testing.T) {
+	server, _ := newTestAPIServer(t, false)
+	if resp := apiRequest(t, "POST", server.URL+"/api/rotate-token/Author/Book", "", nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("POST /api/rotate-token without --private = %s, want 409", resp.Status)
+	}
+}
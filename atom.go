@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+)
+
+// Atom 1.0 (RFC 4287) structures
+type AtomFeed struct {
+	XMLName   xml.Name       `xml:"feed"`
+	NS        string         `xml:"xmlns,attr"`
+	BookastNS string         `xml:"xmlns:bookast,attr,omitempty"`
+	Lang      string         `xml:"xml:lang,attr,omitempty"`
+	ID        string         `xml:"id"`
+	Title     string         `xml:"title"`
+	Subtitle  string         `xml:"subtitle,omitempty"`
+	Updated   string         `xml:"updated"`
+	Links     []AtomLink     `xml:"link"`
+	Authors   []AtomPerson   `xml:"author"`
+	Icon      string         `xml:"icon,omitempty"`
+	Logo      string         `xml:"logo,omitempty"`
+	Rights    string         `xml:"rights,omitempty"`
+	Generator string         `xml:"generator"`
+	Series    *BookastSeries `xml:"bookast:series,omitempty"`
+	Rating    string         `xml:"bookast:rating,omitempty"`
+	Entries   []AtomEntry    `xml:"entry"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Updated   string       `xml:"updated"`
+	Published string       `xml:"published"`
+	Summary   string       `xml:"summary,omitempty"`
+	Authors   []AtomPerson `xml:"author"`
+	Links     []AtomLink   `xml:"link"`
+}
+
+// generateAtom renders the podcast as an Atom feed. Episodes are entries
+// with an enclosure link; Atom has no equivalent of the iTunes and podcast
+// namespace channel elements, so those are left out.
+func generateAtom(podcast *Podcast) string {
+	now := time.Now().Format(time.RFC3339)
+
+	feed := &AtomFeed{
+		NS:        "http://www.w3.org/2005/Atom",
+		Lang:      podcast.Language,
+		ID:        podcast.FeedURL,
+		Title:     podcast.Title,
+		Subtitle:  podcast.Description,
+		Updated:   now,
+		Icon:      podcast.CoverArtURL,
+		Logo:      podcast.CoverArtURL,
+		Rights:    podcast.Copyright,
+		Generator: generatorName(),
+		Series:    bookastSeries(podcast),
+		Rating:    bookastRating(podcast),
+	}
+	if feed.Series != nil || feed.Rating != "" {
+		feed.BookastNS = bookastNS
+	}
+	if podcast.GUID != "" {
+		feed.ID = "urn:uuid:" + podcast.GUID
+	}
+
+	if podcast.FeedURL != "" {
+		feed.Links = append(feed.Links, AtomLink{Href: podcast.FeedURL, Rel: "self", Type: "application/atom+xml"})
+	}
+	if podcast.Website != "" {
+		feed.Links = append(feed.Links, AtomLink{Href: podcast.Website, Rel: "alternate", Type: "text/html"})
+	}
+	if podcast.Hub != "" {
+		feed.Links = append(feed.Links, AtomLink{Href: podcast.Hub, Rel: "hub"})
+	}
+
+	// Atom requires an author on the feed when entries don't have one
+	for _, person := range podcast.People {
+		if person.Role == roleAuthor {
+			feed.Authors = append(feed.Authors, AtomPerson{Name: person.Name})
+		}
+	}
+	if len(feed.Authors) == 0 {
+		feed.Authors = []AtomPerson{{Name: podcast.Title}}
+	}
+
+	for _, ep := range podcast.Episodes {
+		published := ep.PubDate.Format(time.RFC3339)
+		entry := AtomEntry{
+			ID:        ep.URL,
+			Title:     ep.Title,
+			Updated:   published,
+			Published: published,
+			Summary:   ep.Description,
+			Links: []AtomLink{{
+				Href:   ep.URL,
+				Rel:    "enclosure",
+				Type:   getMimeType(ep.FilePath),
+				Length: strconv.FormatInt(ep.FileSize, 10),
+			}},
+		}
+		for _, name := range ep.ItemAuthors {
+			entry.Authors = append(entry.Authors, AtomPerson{Name: name})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	output, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return ""
+	}
+
+	return xml.Header + string(output) + "\n"
+}
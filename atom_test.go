@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// normalizeAtom removes timestamps and the generator from an Atom feed for
+// comparison
+func normalizeAtom(atom string) string {
+	atom = regexp.MustCompile(`<(updated|published)>.*?</(updated|published)>`).ReplaceAllString(atom, "<$1>NORMALIZED</$1>")
+	atom = regexp.MustCompile(`<generator>.*?</generator>`).ReplaceAllString(atom, "<generator>NORMALIZED</generator>")
+	return atom
+}
+
+func TestGenerateAtomGolden(t *testing.T) {
+	baseDir := "testdata/audiobook1"
+
+	podcast, err := scanDirectory(baseDir, Options{BaseURL: "https://example.com/audiobooks", FeedFilename: "podcast.atom"})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+
+	atom := generateAtom(podcast)
+
+	goldenBytes, err := os.ReadFile(filepath.Join(baseDir, "golden.atom"))
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v\nRun ./generate_test_fixtures.sh to create it", err)
+	}
+
+	if normalizeAtom(atom) != normalizeAtom(string(goldenBytes)) {
+		t.Errorf("Generated Atom does not match golden file.\n\nGenerated:\n%s\n\nGolden:\n%s\n\nIf the change is intentional, run ./generate_test_fixtures.sh to update the golden file.", normalizeAtom(atom), normalizeAtom(string(goldenBytes)))
+	}
+}
+
+func TestGenerateAtomAuthors(t *testing.T) {
+	tests := []struct {
+		name     string
+		podcast  Podcast
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "book title stands in for a missing author",
+			podcast:  Podcast{Title: "Book"},
+			contains: []string{"<author>\n    <name>Book</name>\n  </author>"},
+		},
+		{
+			name:     "authors but not narrators",
+			podcast:  Podcast{Title: "Book", People: []Person{{"Mary Shelley", roleAuthor}, {"Dan Stevens", roleNarrator}}},
+			contains: []string{"<name>Mary Shelley</name>"},
+			excludes: []string{"<name>Book</name>", "Dan Stevens"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atom := generateAtom(&tt.podcast)
+			for _, s := range tt.contains {
+				if !strings.Contains(atom, s) {
+					t.Errorf("generateAtom() missing %q in:\n%s", s, atom)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(atom, s) {
+					t.Errorf("generateAtom() unexpectedly contains %q in:\n%s", s, atom)
+				}
+			}
+		})
+	}
+}
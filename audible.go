@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// audibleImageSizes are the cover sizes asked for, largest first.
+var audibleImageSizes = []string{"2400", "1024", "500"}
+
+// audible looks books up in Audible's catalog by ASIN (book.yaml asin),
+// which knows the narrators, series and runtime of the audiobook itself
+// rather than the printed book.
+type audible struct {
+	BaseURL string
+}
+
+func (a *audible) Name() string { return "Audible" }
+
+func (a *audible) Lookup(query BookQuery) (*BookMetadata, error) {
+	if query.ASIN == "" {
+		return nil, fmt.Errorf("needs the book's ASIN as asin in %s", bookConfigFile)
+	}
+
+	params := url.Values{
+		"response_groups": {"contributors,media,product_attrs,product_desc,series"},
+		"image_sizes":     {strings.Join(audibleImageSizes, ",")},
+	}
+	var response struct {
+		Product struct {
+			ASIN      string                  `json:"asin"`
+			Title     string                  `json:"title"`
+			Authors   []struct{ Name string } `json:"authors"`
+			Narrators []struct{ Name string } `json:"narrators"`
+			Series    []struct {
+				Title    string `json:"title"`
+				Sequence string `json:"sequence"`
+			} `json:"series"`
+			RuntimeMinutes   int               `json:"runtime_length_min"`
+			ReleaseDate      string            `json:"release_date"`
+			PublisherSummary string            `json:"publisher_summary"`
+			Images           map[string]string `json:"product_images"`
+		} `json:"product"`
+	}
+	if err := getJSON(a.BaseURL+"/1.0/catalog/products/"+url.PathEscape(query.ASIN)+"?"+params.Encode(), &response); err != nil {
+		return nil, err
+	}
+	product := response.Product
+	// Unknown ASINs come back as a product with nothing but the ASIN
+	if product.Title == "" {
+		return nil, errBookNotFound
+	}
+
+	metadata := &BookMetadata{
+		Provider:    "audible",
+		ID:          product.ASIN,
+		Title:       product.Title,
+		Runtime:     product.RuntimeMinutes,
+		Description: strings.TrimSpace(product.PublisherSummary),
+	}
+	for _, author := range product.Authors {
+		metadata.Authors = appendUnique(metadata.Authors, author.Name)
+	}
+	for _, narrator := range product.Narrators {
+		metadata.Narrators = appendUnique(metadata.Narrators, narrator.Name)
+	}
+	if len(product.Series) > 0 {
+		metadata.Series = product.Series[0].Title
+		if _, index, ok := splitSeriesIndex(product.Series[0].Sequence); ok {
+			metadata.SeriesIndex = index
+		}
+	}
+	if len(product.ReleaseDate) >= 4 {
+		metadata.Year, _ = strconv.Atoi(product.ReleaseDate[:4])
+	}
+	for _, size := range audibleImageSizes {
+		if image := product.Images[size]; image != "" {
+			metadata.CoverURL = image
+			break
+		}
+	}
+	return metadata, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAudibleLookup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.0/catalog/products/B002UZMLXM" {
+			w.Write([]byte(`{"product": {"asin": "B000000000"}}`))
+			return
+		}
+		w.Write([]byte(`{"product": {
+			"asin": "B002UZMLXM",
+			"title": "The Final Empire",
+			"authors": [{"asin": "B001IGFHW6", "name": "Brandon Sanderson"}],
+			"narrators": [{"name": "Michael Kramer"}],
+			"series": [{"asin": "B06XKG1W2G", "sequence": "1", "title": "Mistborn"}],
+			"runtime_length_min": 1485,
+			"release_date": "2009-04-14",
+			"publisher_summary": "<p>For a thousand years the ash fell.</p>",
+			"product_images": {"500": "https://m.media-amazon.com/500.jpg", "2400": "https://m.media-amazon.com/2400.jpg"}
+		}}`))
+	}))
+	defer server.Close()
+	a := &audible{BaseURL: server.URL}
+
+	got, err := a.Lookup(BookQuery{ASIN: "B002UZMLXM"})
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	expected := &BookMetadata{
+		Provider:    "audible",
+		ID:          "B002UZMLXM",
+		Title:       "The Final Empire",
+		Authors:     []string{"Brandon Sanderson"},
+		Narrators:   []string{"Michael Kramer"},
+		Series:      "Mistborn",
+		SeriesIndex: "1",
+		Year:        2009,
+		Runtime:     1485,
+		Description: "<p>For a thousand years the ash fell.</p>",
+		CoverURL:    "https://m.media-amazon.com/2400.jpg",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Lookup() = %+v, want %+v", got, expected)
+	}
+
+	if _, err := a.Lookup(BookQuery{ASIN: "B000000000"}); !errors.Is(err, errBookNotFound) {
+		t.Errorf("Lookup() of an unknown ASIN error = %v, want errBookNotFound", err)
+	}
+	if _, err := a.Lookup(BookQuery{Title: "The Final Empire"}); err == nil {
+		t.Error("Lookup() without an ASIN error = nil, want error")
+	}
+}
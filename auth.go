@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// basicAuthRealm is the realm of serve mode's Basic auth challenge.
+const basicAuthRealm = "bookast"
+
+// passwords maps user names to htpasswd password hashes, or to the
+// password itself for --auth and plain text htpasswd entries.
+type passwords map[string]string
+
+// parseAuth parses --auth user:pass.
+func parseAuth(s string) (passwords, error) {
+	user, password, ok := strings.Cut(s, ":")
+	if !ok || user == "" || password == "" {
+		return nil, fmt.Errorf("--auth must be user:password, not %q", s)
+	}
+	return passwords{user: password}, nil
+}
+
+// loadHtpasswd reads an htpasswd file. Entries made with htpasswd -B
+// (bcrypt), -m (the default, $apr1$), -s ({SHA}) and -p (plain text) are
+// understood. Other $-prefixed hashes, like crypt's $5$ and $6$, are an
+// error rather than being taken for plain text passwords.
+func loadHtpasswd(path string) (passwords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := passwords{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: not user:hash", path, lineNum)
+		}
+		switch {
+		case strings.HasPrefix(hash, "$2"):
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+			}
+		case strings.HasPrefix(hash, "$apr1$"):
+		case strings.HasPrefix(hash, "$"):
+			return nil, fmt.Errorf("%s:%d: unsupported password hash, make the entry with htpasswd -B or -m", path, lineNum)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// checkPassword reports whether password matches an htpasswd hash.
+func checkPassword(hash string, password string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		computed = apr1Crypt(password, salt)
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	default:
+		computed = password
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// apr1Crypt is Apache's variant of the MD5-based crypt, what htpasswd -m
+// and openssl passwd -apr1 make.
+func apr1Crypt(password string, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	d := md5.New()
+	d.Write([]byte(password + magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		d.Write(alt[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	// Deliberately slow
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 != 0 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out strings.Builder
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(final[g[0]])<<16|uint32(final[g[1]])<<8|uint32(final[g[2]]), 4)
+	}
+	encode(uint32(final[11]), 2)
+	return magic + salt + "$" + out.String()
+}
+
+// requireAuth wraps h so requests need Basic auth as one of users. Podcast
+// apps take user:password@ in feed URLs and send it on to the enclosures.
+func requireAuth(h http.Handler, users passwords) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if hash, known := users[user]; ok && known && checkPassword(hash, password) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, basicAuthRealm))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
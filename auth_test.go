@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestApr1Crypt(t *testing.T) {
+	// From openssl passwd -apr1 -salt
+	tests := []struct {
+		password, salt, want string
+	}{
+		{"secret", "saltsalt", "$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0"},
+		{"pässword with a long tail 12345", "ab", "$apr1$ab$D9JxWTf58hvMrY50btp/J."},
+	}
+	for _, tt := range tests {
+		if got := apr1Crypt(tt.password, tt.salt); got != tt.want {
+			t.Errorf("apr1Crypt(%q, %q) = %q, want %q", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		hash     string
+		password string
+		want     bool
+	}{
+		{"$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0", "secret", true},
+		{"$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0", "Secret", false},
+		{"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "secret", true},
+		{"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "wrong", false},
+		{"plain", "plain", true},
+		{"plain", "", false},
+	}
+	for _, tt := range tests {
+		if got := checkPassword(tt.hash, tt.password); got != tt.want {
+			t.Errorf("checkPassword(%q, %q) = %v, want %v", tt.hash, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "htpasswd")
+	content := "# family\nalice:$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0\n\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	users, err := loadHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || !checkPassword(users["alice"], "secret") || !checkPassword(users["bob"], "secret") {
+		t.Errorf("loadHtpasswd() = %v, want alice and bob with password secret", users)
+	}
+
+	// Other crypt schemes would otherwise be plain text, the hash itself
+	// the password
+	for _, hash := range []string{"$6$saltsalt$abcdefghijk", "$5$saltsalt$abcdefghijk", "$1$saltsalt$abcdefghijk", "$2y$05$tooshort"} {
+		unsupported := filepath.Join(dir, "unsupported")
+		if err := os.WriteFile(unsupported, []byte("carol:"+hash+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if users, err := loadHtpasswd(unsupported); err == nil {
+			t.Errorf("loadHtpasswd(carol:%s) = %v, want an error", hash, users)
+		}
+	}
+}
+
+func TestBcryptHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// What htpasswd -B writes
+	hash = []byte(strings.Replace(string(hash), "$2a$", "$2y$", 1))
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte("carol:"+string(hash)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	users, err := loadHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkPassword(users["carol"], "secret") || checkPassword(users["carol"], "wrong") || checkPassword(users["carol"], string(hash)) {
+		t.Errorf("bcrypt entry doesn't take exactly the password secret")
+	}
+}
+
+func TestParseAuth(t *testing.T) {
+	users, err := parseAuth("alice:pa:ss")
+	if err != nil || users["alice"] != "pa:ss" {
+		t.Errorf("parseAuth() = %v, %v, want alice with pa:ss", users, err)
+	}
+	for _, bad := range []string{"alice", ":pass", "alice:"} {
+		if _, err := parseAuth(bad); err == nil {
+			t.Errorf("parseAuth(%q) error = nil, want error", bad)
+		}
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(requireAuth(ok, passwords{"alice": "$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0"}))
+	defer server.Close()
+
+	tests := []struct {
+		user, password string
+		want           int
+	}{
+		{"alice", "secret", http.StatusOK},
+		{"alice", "wrong", http.StatusUnauthorized},
+		{"bob", "secret", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/Book/podcast.rss", nil)
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s:%s = %d, want %d", tt.user, tt.password, resp.StatusCode, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+			t.Errorf("WWW-Authenticate = %q, want a Basic challenge", resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+}
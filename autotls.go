@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newCertManager returns the autocert manager for --auto-tls's
+// comma-separated domains, which gets and renews their certificates from
+// the CA at directory, answering its tls-alpn-01 challenges on the serving
+// port. It also returns the domains, cleaned up.
+func newCertManager(domains string, email string, directory string) (*autocert.Manager, []string, error) {
+	var names []string
+	for _, domain := range strings.Split(domains, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || strings.ContainsAny(domain, "/: ") {
+			return nil, nil, fmt.Errorf("%q isn't a domain name", domain)
+		}
+		names = append(names, domain)
+	}
+	dir, err := acmeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(dir),
+		HostPolicy: autocert.HostWhitelist(names...),
+		Email:      email,
+		Client:     &acme.Client{DirectoryURL: directory},
+	}, names, nil
+}
+
+// acmeDir returns the directory the ACME account key and certificates are
+// kept in, next to the config file, so bookast cache clear doesn't throw
+// them away.
+func acmeDir() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "acme"), nil
+}
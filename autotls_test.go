@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestNewCertManager(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	m, domains, err := newCertManager(" Example.com, www.example.com", "me@example.com", acme.LetsEncryptURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"example.com", "www.example.com"}; !slices.Equal(domains, want) {
+		t.Errorf("domains = %q, want %q", domains, want)
+	}
+	if m.Email != "me@example.com" || m.Client.DirectoryURL != acme.LetsEncryptURL {
+		t.Errorf("manager email %q, directory %q", m.Email, m.Client.DirectoryURL)
+	}
+	if dir, ok := m.Cache.(autocert.DirCache); !ok || string(dir) != filepath.Join(config, "bookast", "acme") {
+		t.Errorf("Cache = %#v, want the acme directory next to the config", m.Cache)
+	}
+	for host, want := range map[string]bool{"www.example.com": true, "other.example.com": false} {
+		if err := m.HostPolicy(context.Background(), host); (err == nil) != want {
+			t.Errorf("HostPolicy(%q) = %v", host, err)
+		}
+	}
+
+	for _, bad := range []string{"", "example.com,", "https://example.com"} {
+		if _, _, err := newCertManager(bad, "", acme.LetsEncryptURL); err == nil {
+			t.Errorf("newCertManager(%q) error = nil, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// bookConfigFile is the optional per-book metadata file.
+const bookConfigFile = "book.yaml"
+
+// BookConfig is the contents of book.yaml. Every field is optional.
+//
+//	authors: Ursula K. Le Guin
+//	narrators: [Kobna Holdbrook-Smith]
+//	keywords: [fantasy, earthsea]
+//	language: en-gb
+//	isbn: 978-0-547-72202-3
+//	asin: B002V5D7B0
+//	episodes:
+//	  00-intro.mp3:
+//	    type: trailer
+type BookConfig struct {
+	Authors   []string                 `yaml:"authors"`   // Overrides the album artist/artist tags
+	Narrators []string                 `yaml:"narrators"` // Overrides the NARRATOR/composer tags
+	Keywords  []string                 `yaml:"keywords"`  // Added to the genre tags
+	Language  string                   `yaml:"language"`  // Overrides the language tags
+	ISBN      string                   `yaml:"isbn"`      // Looked up by bookast enrich
+	ASIN      string                   `yaml:"asin"`      // Looked up by bookast enrich --provider audible
+	Episodes  map[string]EpisodeConfig `yaml:"episodes"`
+}
+
+// EpisodeConfig overrides settings for one file, keyed by filename.
+type EpisodeConfig struct {
+	Type string `yaml:"type"` // full, trailer or bonus
+}
+
+// loadBookConfig reads book.yaml from dir. A missing file is not an error.
+func loadBookConfig(dir string) (*BookConfig, error) {
+	book := &BookConfig{}
+
+	content, err := os.ReadFile(filepath.Join(dir, bookConfigFile))
+	if os.IsNotExist(err) {
+		return book, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decodeYAML(string(content), book); err != nil {
+		return nil, fmt.Errorf("%s: %v", bookConfigFile, err)
+	}
+
+	for filename, ep := range book.Episodes {
+		if ep.Type != "" && !validEpisodeTypes[ep.Type] {
+			return nil, fmt.Errorf("%s: episodes.%s.type: %q is not one of full, trailer, bonus", bookConfigFile, filename, ep.Type)
+		}
+	}
+
+	return book, nil
+}
+
+var validEpisodeTypes = map[string]bool{
+	"full":    true,
+	"trailer": true,
+	"bonus":   true,
+}
+
+var (
+	// "00-intro.mp3", "0 - Preview.mp3", "Trailer.mp3", "Audible Sample.mp3"
+	trailerFilenameRe = regexp.MustCompile(`(?i)^0+\b|\b(trailer|preview|sample)\b`)
+	// "Bonus - Author Interview.mp3", "99 Extras.mp3"
+	bonusFilenameRe = regexp.MustCompile(`(?i)\b(bonus|extras?)\b`)
+)
+
+// episodeType returns the itunes:episodeType for a file: the book.yaml
+// override if there is one, otherwise a guess from the filename.
+func episodeType(filename string, book *BookConfig) string {
+	if ep, ok := book.Episodes[filename]; ok && ep.Type != "" {
+		return ep.Type
+	}
+
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	switch {
+	case trailerFilenameRe.MatchString(name):
+		return "trailer"
+	case bonusFilenameRe.MatchString(name):
+		return "bonus"
+	default:
+		return "full"
+	}
+}
+
+// bookConfigPatch changes some of book.yaml's fields, from serve's web page
+// or API. Fields left nil are kept.
+type bookConfigPatch struct {
+	Authors   *[]string `json:"authors"`
+	Narrators *[]string `json:"narrators"`
+	Keywords  *[]string `json:"keywords"`
+	Language  *string   `json:"language"`
+	ISBN      *string   `json:"isbn"`
+	ASIN      *string   `json:"asin"`
+}
+
+// apply sets book's fields from the patch, or says what's wrong with it
+// and leaves book alone.
+func (p bookConfigPatch) apply(book *BookConfig) error {
+	if p.Language != nil {
+		if language := strings.TrimSpace(*p.Language); language != "" {
+			if _, ok := normalizeLanguage(language); !ok {
+				return fmt.Errorf("language: %q is not a language code", language)
+			}
+		}
+	}
+	list := func(field *[]string, patch *[]string) {
+		if patch == nil {
+			return
+		}
+		*field = nil
+		for _, item := range *patch {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	}
+	scalar := func(field *string, patch *string) {
+		if patch != nil {
+			*field = strings.TrimSpace(*patch)
+		}
+	}
+	list(&book.Authors, p.Authors)
+	list(&book.Narrators, p.Narrators)
+	list(&book.Keywords, p.Keywords)
+	scalar(&book.Language, p.Language)
+	scalar(&book.ISBN, p.ISBN)
+	scalar(&book.ASIN, p.ASIN)
+	return nil
+}
+
+// saveBookConfig writes book to book.yaml in dir, editing the file that's
+// there so its comments, and the fields that didn't change, stay as they
+// were written.
+func saveBookConfig(dir string, book *BookConfig) error {
+	path := filepath.Join(dir, bookConfigFile)
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	data, err := encodeBookConfig(existing, book)
+	if err != nil {
+		return fmt.Errorf("%s: %v", bookConfigFile, err)
+	}
+	return writeFileIfChanged(path, data)
+}
+
+// encodeBookConfig returns the book.yaml existing with book's fields set:
+// changed ones are replaced, keeping their comments, empty ones removed
+// and new ones added in the order of BookConfig's fields.
+func encodeBookConfig(existing []byte, book *BookConfig) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(existing, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind == yaml.ScalarNode && root.ShortTag() == "!!null" {
+		root.Kind, root.Tag, root.Value = yaml.MappingNode, "!!map", ""
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping", root.Line)
+	}
+
+	set := func(key string, value any, empty bool) error {
+		at := -1
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == key {
+				at = i
+				break
+			}
+		}
+		if empty {
+			if at >= 0 {
+				root.Content = slices.Delete(root.Content, at, at+2)
+			}
+			return nil
+		}
+		if at >= 0 {
+			// Decoded from a copy, a single value checkYAMLNode makes a
+			// list of stays as written
+			old, current := *root.Content[at+1], reflect.New(reflect.TypeOf(value))
+			if checkYAMLNode(&old, current.Elem().Type()) == nil && old.Decode(current.Interface()) == nil && reflect.DeepEqual(current.Elem().Interface(), value) {
+				return nil
+			}
+		}
+		node := &yaml.Node{}
+		if err := node.Encode(value); err != nil {
+			return err
+		}
+		if node.Kind == yaml.SequenceNode {
+			node.Style = yaml.FlowStyle
+		}
+		if at < 0 {
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, node)
+			return nil
+		}
+		node.LineComment = root.Content[at+1].LineComment
+		root.Content[at+1] = node
+		return nil
+	}
+	episodes := map[string]EpisodeConfig{}
+	for filename, ep := range book.Episodes {
+		if ep.Type != "" {
+			episodes[filename] = ep
+		}
+	}
+	for _, err := range []error{
+		set("authors", book.Authors, len(book.Authors) == 0),
+		set("narrators", book.Narrators, len(book.Narrators) == 0),
+		set("keywords", book.Keywords, len(book.Keywords) == 0),
+		set("language", book.Language, book.Language == ""),
+		set("isbn", book.ISBN, book.ISBN == ""),
+		set("asin", book.ASIN, book.ASIN == ""),
+		set("episodes", episodes, len(episodes) == 0),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(root.Content) == 0 && root.HeadComment == "" && root.FootComment == "" {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadBookConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	book, err := loadBookConfig(dir)
+	if err != nil {
+		t.Fatalf("loadBookConfig() without book.yaml error = %v", err)
+	}
+	if len(book.Episodes) != 0 {
+		t.Errorf("Episodes = %v, want none", book.Episodes)
+	}
+
+	content := "episodes:\n  interview.mp3:\n    type: bonus\n"
+	if err := os.WriteFile(filepath.Join(dir, bookConfigFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	book, err = loadBookConfig(dir)
+	if err != nil {
+		t.Fatalf("loadBookConfig() error = %v", err)
+	}
+	if book.Episodes["interview.mp3"].Type != "bonus" {
+		t.Errorf("Episodes[interview.mp3].Type = %q, want %q", book.Episodes["interview.mp3"].Type, "bonus")
+	}
+
+	content = "episodes:\n  interview.mp3:\n    type: teaser\n"
+	if err := os.WriteFile(filepath.Join(dir, bookConfigFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBookConfig(dir); err == nil {
+		t.Error("loadBookConfig() with invalid episode type error = nil, want error")
+	}
+}
+
+func TestEpisodeType(t *testing.T) {
+	book := &BookConfig{Episodes: map[string]EpisodeConfig{
+		"01 - Prologue.mp3": {Type: "trailer"},
+		"00-intro.mp3":      {Type: "full"},
+	}}
+
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"chapter01.mp3", "full"},
+		{"01 - Prologue.mp3", "trailer"},
+		{"00-intro.mp3", "full"},
+		{"00 - Opening Credits.mp3", "trailer"},
+		{"Trailer.mp3", "trailer"},
+		{"Audible Sample.m4a", "trailer"},
+		{"007 Secret Mission.mp3", "full"},
+		{"Bonus - Author Interview.mp3", "bonus"},
+		{"99 Extras.mp3", "bonus"},
+		{"Extraordinary Times.mp3", "full"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			result := episodeType(tt.filename, book)
+			if result != tt.expected {
+				t.Errorf("episodeType(%q) = %q, want %q", tt.filename, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSaveBookConfig(t *testing.T) {
+	dir := t.TempDir()
+	book := &BookConfig{
+		Authors:   []string{"Ursula K. Le Guin"},
+		Narrators: []string{"Kobna Holdbrook-Smith", "Le Guin, Ursula"},
+		Keywords:  []string{"fantasy", "[earthsea]", "null", " padded"},
+		Language:  "en-gb",
+		ISBN:      "978-0-547-72202-3",
+		Episodes: map[string]EpisodeConfig{
+			"00 - Intro: The Archipelago.mp3": {Type: "trailer"},
+			"chapter01.mp3":                   {},
+		},
+	}
+	if err := saveBookConfig(dir, book); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, bookConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `authors: [Ursula K. Le Guin]
+narrators: [Kobna Holdbrook-Smith, 'Le Guin, Ursula']
+keywords: [fantasy, '[earthsea]', "null", ' padded']
+language: en-gb
+isbn: 978-0-547-72202-3
+episodes:
+  '00 - Intro: The Archipelago.mp3':
+    type: trailer
+`
+	if string(content) != want {
+		t.Errorf("book.yaml =\n%s\nwant\n%s", content, want)
+	}
+
+	got, err := loadBookConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(book.Episodes, "chapter01.mp3")
+	if !reflect.DeepEqual(got, book) {
+		t.Errorf("loadBookConfig() = %+v, want %+v", got, book)
+	}
+}
+
+func TestSaveBookConfigKeepsComments(t *testing.T) {
+	dir := t.TempDir()
+	existing := `# A Wizard of Earthsea
+authors: Ursula K. Le Guin # not the translator
+narrators: [Rob Inglis] # the 2011 recording
+language: en-gb
+
+episodes:
+  # The publisher's sample
+  00-intro.mp3:
+    type: trailer
+`
+	if err := os.WriteFile(filepath.Join(dir, bookConfigFile), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	book, err := loadBookConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book.Narrators = []string{"Kobna Holdbrook-Smith"}
+	book.Language = ""
+	book.ISBN = "9780547773742"
+	if err := saveBookConfig(dir, book); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, bookConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# A Wizard of Earthsea
+authors: Ursula K. Le Guin # not the translator
+narrators: [Kobna Holdbrook-Smith] # the 2011 recording
+episodes:
+  # The publisher's sample
+  00-intro.mp3:
+    type: trailer
+isbn: "9780547773742"
+`
+	if string(content) != want {
+		t.Errorf("book.yaml =\n%s\nwant\n%s", content, want)
+	}
+
+	got, err := loadBookConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, book) {
+		t.Errorf("loadBookConfig() = %+v, want %+v", got, book)
+	}
+}
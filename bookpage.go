@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// bookPageFile is the page --html writes next to each feed, and in the
+// library's directory with --layout.
+const bookPageFile = "index.html"
+
+const bookPageStyle = `<style>
+body { font-family: system-ui, sans-serif; margin: 2em auto; max-width: 48em; padding: 0 1em; color: #222; line-height: 1.4; }
+header { display: flex; gap: 1.5em; align-items: flex-start; flex-wrap: wrap; }
+header img { width: 14em; max-width: 100%; border-radius: 4px; }
+.subscribe { display: inline-block; background: #8e44ad; color: #fff; padding: 0.6em 1.4em; border-radius: 4px; text-decoration: none; font-weight: bold; font-size: 1.1em; }
+.feed { color: #555; font-size: 0.85em; word-break: break-all; }
+ol.episodes li { margin: 0.3em 0; }
+.duration { color: #555; font-size: 0.9em; }
+ul.books { list-style: none; padding: 0; display: grid; grid-template-columns: repeat(auto-fill, minmax(12em, 1fr)); gap: 1.5em; }
+ul.books img { width: 100%; aspect-ratio: 1; object-fit: cover; border-radius: 4px; }
+</style>`
+
+var bookPageTemplate = template.Must(template.New("book").Parse(`<!DOCTYPE html>
+<html{{with .Language}} lang="{{.}}"{{end}}>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title>
+<link rel="alternate" type="{{.FeedType}}" title="{{.Title}}" href="{{.FeedURL}}">
+` + bookPageStyle + `
+</head>
+<body>
+<header>
+{{with .Cover}}<img src="{{.}}" alt="">{{end}}
+<div>
+<h1>{{.Title}}</h1>
+{{with .Authors}}<p>By {{.}}</p>{{end}}
+{{with .Narrators}}<p>Read by {{.}}</p>{{end}}
+<p><a class="subscribe" href="{{.FeedURL}}">Subscribe</a></p>
+<p class="feed">Paste into your podcast app: {{.FeedURL}}{{with .ApplePodcasts}}<br><a href="{{.}}">Open in Apple Podcasts</a>{{end}}</p>
+</div>
+</header>
+{{.Description}}
+<h2>Episodes</h2>
+<ol class="episodes">
+{{range .Episodes}}<li><a href="{{.URL}}">{{.Title}}</a>{{with .Duration}} <span class="duration">{{.}}</span>{{end}}</li>
+{{end}}</ol>
+</body>
+</html>
+`))
+
+// bookPage is what the page shows about a book.
+type bookPage struct {
+	Title         string
+	Language      string
+	Cover         string
+	Authors       string
+	Narrators     string
+	Description   template.HTML
+	FeedURL       string
+	FeedType      string
+	ApplePodcasts template.URL // html/template would filter out the podcast:// scheme
+	Episodes      []bookPageEpisode
+}
+
+type bookPageEpisode struct {
+	Title    string
+	URL      string
+	Duration string
+}
+
+// descriptionHTML returns a channel description as HTML: README.md's is
+// already rendered (isHTML), every other source's paragraphs are escaped,
+// since metadata files and enrich providers may hold markup of their own.
+func descriptionHTML(description string, isHTML bool) template.HTML {
+	if isHTML {
+		return template.HTML(description)
+	}
+	var b strings.Builder
+	for _, paragraph := range strings.Split(description, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			b.WriteString("<p>" + strings.ReplaceAll(template.HTMLEscapeString(paragraph), "\n", "<br>\n") + "</p>\n")
+		}
+	}
+	return template.HTML(b.String())
+}
+
+// peopleNames returns the names of the people in role, comma-separated.
+func peopleNames(people []Person, role string) string {
+	var names []string
+	for _, person := range people {
+		if person.Role == role {
+			names = append(names, person.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// generateBookPage returns the index.html of podcast, whose feed is in
+// output's format.
+func generateBookPage(podcast *Podcast, output feedFormat) ([]byte, error) {
+	page := bookPage{
+		Title:       podcast.Title,
+		Language:    podcast.Language,
+		Cover:       podcast.CoverArtURL,
+		Authors:     peopleNames(podcast.People, roleAuthor),
+		Narrators:   peopleNames(podcast.People, roleNarrator),
+		Description: descriptionHTML(podcast.Description, podcast.DescriptionHTML),
+		FeedURL:     podcast.FeedURL,
+	}
+	page.FeedType, _, _ = strings.Cut(feedContentTypes[output.Filename], ";")
+	// Apple's app subscribes to podcast:// links, the rest only take
+	// pasted URLs
+	if u, err := url.Parse(podcast.FeedURL); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		u.Scheme = "podcast"
+		page.ApplePodcasts = template.URL(u.String())
+	}
+	for _, ep := range podcast.Episodes {
+		episode := bookPageEpisode{Title: ep.Title, URL: ep.URL}
+		if ep.Duration > 0 {
+			episode.Duration = formatDuration(ep.Duration)
+		}
+		page.Episodes = append(page.Episodes, episode)
+	}
+	var b bytes.Buffer
+	if err := bookPageTemplate.Execute(&b, page); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+var libraryPageTemplate = template.Must(template.New("library").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Audiobooks</title>
+` + bookPageStyle + `
+</head>
+<body>
+<h1>Audiobooks</h1>
+<ul class="books">
+{{range .}}<li><a href="{{.Page}}">{{with .Cover}}<img src="{{.}}" alt="" loading="lazy">{{end}}<strong>{{.Title}}</strong></a>{{with .Authors}}<br>{{.}}{{end}}</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// libraryPageBook is a book on the library's page.
+type libraryPageBook struct {
+	Title   string
+	Authors string
+	Cover   string
+	Page    string // Relative to the library's page
+}
+
+// newLibraryPageBook returns podcast's entry on the page of the library at
+// root, podcast being the book in dir.
+func newLibraryPageBook(root string, dir string, podcast *Podcast) libraryPageBook {
+	book := libraryPageBook{
+		Title:   podcast.Title,
+		Authors: peopleNames(podcast.People, roleAuthor),
+		Cover:   podcast.CoverArtURL,
+		Page:    bookPageFile,
+	}
+	if rel, err := filepath.Rel(root, dir); err == nil && rel != "." {
+		segments := strings.Split(filepath.ToSlash(rel), "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		book.Page = strings.Join(segments, "/") + "/" + bookPageFile
+	}
+	return book
+}
+
+// generateLibraryPage returns the index.html linking to each book's.
+func generateLibraryPage(books []libraryPageBook) ([]byte, error) {
+	var b bytes.Buffer
+	if err := libraryPageTemplate.Execute(&b, books); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateBookPage(t *testing.T) {
+	podcast := &Podcast{
+		Title:       "A Wizard of Earthsea",
+		Description: "Ged & the shadow.\n\nA <classic>.",
+		Language:    "en",
+		CoverArtURL: "https://example.com/Earthsea/cover.jpg",
+		FeedURL:     "https://example.com/Earthsea/podcast.rss",
+		People: []Person{
+			{Name: "Ursula K. Le Guin", Role: roleAuthor},
+			{Name: "Kobna Holdbrook-Smith", Role: roleNarrator},
+		},
+		Episodes: []Episode{
+			{Title: "Warriors in the Mist", URL: "https://example.com/Earthsea/01.mp3", Duration: 95*time.Minute + 7*time.Second},
+			{Title: "The Shadow", URL: "https://example.com/Earthsea/02.mp3"},
+		},
+	}
+	page, err := generateBookPage(podcast, feedFormats["rss"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<html lang="en">`,
+		`<link rel="alternate" type="application/rss&#43;xml" title="A Wizard of Earthsea" href="https://example.com/Earthsea/podcast.rss">`,
+		`<img src="https://example.com/Earthsea/cover.jpg" alt="">`,
+		`<p>By Ursula K. Le Guin</p>`,
+		`<p>Read by Kobna Holdbrook-Smith</p>`,
+		`<a class="subscribe" href="https://example.com/Earthsea/podcast.rss">Subscribe</a>`,
+		`<a href="podcast://example.com/Earthsea/podcast.rss">Open in Apple Podcasts</a>`,
+		"<p>Ged &amp; the shadow.</p>\n<p>A &lt;classic&gt;.</p>",
+		`<li><a href="https://example.com/Earthsea/01.mp3">Warriors in the Mist</a> <span class="duration">1:35:07</span></li>`,
+		`<li><a href="https://example.com/Earthsea/02.mp3">The Shadow</a></li>`,
+	} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("page doesn't contain %q:\n%s", want, page)
+		}
+	}
+
+	// Markup from metadata files or enrich providers is escaped
+	podcast.Description = `<p>Summary</p><script>alert(1)</script>`
+	page, err = generateBookPage(podcast, feedFormats["rss"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(page), "<script>") || !strings.Contains(string(page), "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Errorf("page doesn't escape a plain text description:\n%s", page)
+	}
+
+	// README.md descriptions are already HTML
+	podcast.Description = "<p>From <em>README.md</em></p>"
+	podcast.DescriptionHTML = true
+	page, err = generateBookPage(podcast, feedFormats["jsonfeed"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{podcast.Description, `type="application/feed&#43;json"`} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("page doesn't contain %q:\n%s", want, page)
+		}
+	}
+}
+
+func TestGenerateLibraryPage(t *testing.T) {
+	root := t.TempDir()
+	books := []libraryPageBook{
+		newLibraryPageBook(root, filepath.Join(root, "Ursula K. Le Guin", "Earthsea", "A Wizard of Earthsea"), &Podcast{
+			Title:       "A Wizard of Earthsea",
+			CoverArtURL: "https://example.com/cover.jpg",
+			People:      []Person{{Name: "Ursula K. Le Guin", Role: roleAuthor}},
+		}),
+		newLibraryPageBook(root, root, &Podcast{Title: "Loose Book"}),
+	}
+	page, err := generateLibraryPage(books)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<li><a href="Ursula%20K.%20Le%20Guin/Earthsea/A%20Wizard%20of%20Earthsea/index.html"><img src="https://example.com/cover.jpg" alt="" loading="lazy"><strong>A Wizard of Earthsea</strong></a><br>Ursula K. Le Guin</li>`,
+		`<li><a href="index.html"><strong>Loose Book</strong></a></li>`,
+	} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("page doesn't contain %q:\n%s", want, page)
+		}
+	}
+}
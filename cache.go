@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheDir is where bookast keeps its caches: $XDG_CACHE_HOME/bookast, else
+// the platform's user cache directory.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "bookast"), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bookast"), nil
+}
+
+// bookCachePath is the cache file for the book in dir, which remembers what
+// probing each of its audio files found so runs over an unchanged book don't
+// read every tag and duration again. Each book has its own file, named after
+// the directory and a hash of its absolute path.
+func bookCachePath(dir string) (string, error) {
+	root, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(root, fmt.Sprintf("%s-%x.json", filepath.Base(abs), sum[:8])), nil
+}
+
+// clearCache deletes every cache file.
+func clearCache() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return dir, os.RemoveAll(dir)
+}
+
+// runCache implements "bookast cache", which manages the cache directory.
+func runCache(args []string) int {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cache clear|path\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	switch fs.Arg(0) {
+	case "clear":
+		dir, err := clearCache()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Cleared %s\n", dir)
+	case "path":
+		dir, err := cacheDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Println(dir)
+	default:
+		fs.Usage()
+		return 1
+	}
+	return 0
+}
+
+// cacheVersion is bumped whenever what's cached, or how it's worked out,
+// changes. Caches written by other versions are ignored.
+const cacheVersion = 3
+
+// cacheEntry is what's known about one file. It's only valid while the
+// file's size and modification time are unchanged.
+type cacheEntry struct {
+	Size    int64    `json:"size"`
+	ModTime int64    `json:"mtime"` // Unix nanoseconds
+	Episode *Episode `json:"episode,omitempty"`
+	SHA256  string   `json:"sha256,omitempty"`
+}
+
+// fileCache is the contents of a cache file. It's safe for concurrent use.
+type fileCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*cacheEntry
+	used    map[string]bool
+	dirty   bool
+}
+
+type cacheFileContents struct {
+	Version int                    `json:"version"`
+	Entries map[string]*cacheEntry `json:"entries"`
+}
+
+// loadFileCache reads the cache file at path. A missing, unreadable or
+// outdated cache is an empty one; the cache is only ever an optimization.
+func loadFileCache(path string) *fileCache {
+	c := &fileCache{path: path, entries: map[string]*cacheEntry{}, used: map[string]bool{}}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	var contents cacheFileContents
+	if json.Unmarshal(data, &contents) == nil && contents.Version == cacheVersion && contents.Entries != nil {
+		c.entries = contents.Entries
+	}
+	return c
+}
+
+// entry returns the cache entry for key, replacing it with an empty one if
+// it was recorded for a different version of the file.
+func (c *fileCache) entry(key string, info os.FileInfo) *cacheEntry {
+	c.used[key] = true
+	e, ok := c.entries[key]
+	if !ok || e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		e = &cacheEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		c.entries[key] = e
+		c.dirty = true
+	}
+	return e
+}
+
+// cacheHits and cacheMisses count episode lookups, for serve's /metrics.
+var cacheHits, cacheMisses atomic.Int64
+
+// episode returns a copy of the probed episode cached for key.
+func (c *fileCache) episode(key string, info os.FileInfo) (*Episode, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entry(key, info)
+	if e.Episode == nil {
+		cacheMisses.Add(1)
+		return nil, false
+	}
+	cacheHits.Add(1)
+	episode := *e.Episode
+	return &episode, true
+}
+
+// storeEpisode caches what probing the file found. Fields that depend on
+// where and when the file is published rather than its contents aren't kept.
+func (c *fileCache) storeEpisode(key string, info os.FileInfo, episode *Episode) {
+	probed := *episode
+	probed.FilePath = ""
+	probed.FileSize = 0
+	probed.PubDate = time.Time{}
+	probed.URL = ""
+	probed.EpisodeNum = 0
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry(key, info).Episode = &probed
+	c.dirty = true
+}
+
+// hash returns the SHA-256 of the file at path, cached under key. A nil
+// cache hashes the file every time.
+func (c *fileCache) hash(key string, path string) (string, error) {
+	if c == nil {
+		return hashFile(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	if sum := c.entry(key, info).SHA256; sum != "" {
+		c.mu.Unlock()
+		return sum, nil
+	}
+	c.mu.Unlock()
+
+	sum, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry(key, info).SHA256 = sum
+	c.dirty = true
+	return sum, nil
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// save writes the cache back if anything changed, dropping entries for files
+// that weren't looked at (they've been deleted or renamed).
+func (c *fileCache) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if !c.used[key] {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(cacheFileContents{Version: cacheVersion, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+	if err := mkdirAll(filepath.Dir(c.path)); err != nil {
+		return err
+	}
+	if err := writeFileIfChanged(c.path, data); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// processAudioFileCached is processAudioFile, reusing what an earlier run
+// found when the file hasn't changed. A nil cache probes every time.
+func processAudioFileCached(cache *fileCache, filePath string, baseURL string, baseDir string, pubDate time.Time, episodeNum int) (*Episode, error) {
+	if cache == nil {
+		return processAudioFile(filePath, baseURL, baseDir, pubDate, episodeNum)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	relPath, err := filepath.Rel(baseDir, filePath)
+	if err != nil {
+		relPath = filepath.Base(filePath)
+	}
+	key := filepath.ToSlash(relPath)
+
+	if episode, ok := cache.episode(key, info); ok {
+		logger.Debug("read from the cache", "file", filePath)
+		episode.FilePath = filePath
+		episode.FileSize = info.Size()
+		episode.PubDate = pubDate
+		episode.URL = buildURL(baseURL, baseDir, relPath)
+		episode.EpisodeNum = episodeNum
+		// Warnings name the file the way this run was given it
+		warnings := make([]Warning, len(episode.Warnings))
+		for i, w := range episode.Warnings {
+			w.File = filePath
+			warnings[i] = w
+		}
+		episode.Warnings = warnings
+		return episode, nil
+	}
+
+	episode, err := processAudioFile(filePath, baseURL, baseDir, pubDate, episodeNum)
+	if err != nil {
+		return nil, err
+	}
+	// A file without a duration gets another chance, e.g. once ffprobe is
+	// installed
+	if episode.Duration > 0 {
+		cache.storeEpisode(key, info, episode)
+	}
+	return episode, nil
+}
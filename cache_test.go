@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// countingProvider counts how often it is asked for a duration.
+type countingProvider struct {
+	calls *int32
+}
+
+func (p countingProvider) Name() string { return "counting" }
+
+func (p countingProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	atomic.AddInt32(p.calls, 1)
+	return DurationEstimate{Duration: time.Minute, Confidence: 1}, nil
+}
+
+func copyFixture(t *testing.T, dir string, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "audiobook1", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProcessAudioFileCached(t *testing.T) {
+	var calls int32
+	saved := durationProviders
+	defer func() { durationProviders = saved }()
+	durationProviders = []DurationProvider{countingProvider{&calls}}
+
+	dir := t.TempDir()
+	path := copyFixture(t, dir, "chapter01.mp3")
+	cachePath := filepath.Join(dir, "cache.json")
+
+	hits, misses := cacheHits.Load(), cacheMisses.Load()
+	cache := loadFileCache(cachePath)
+	first, err := processAudioFileCached(cache, path, "https://example.com", dir, time.Unix(100, 0), 1)
+	if err != nil {
+		t.Fatalf("processAudioFileCached() error = %v", err)
+	}
+	if err := cache.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	// A new run reads the cache file instead of probing
+	cache = loadFileCache(cachePath)
+	second, err := processAudioFileCached(cache, path, "https://example.com", dir, time.Unix(200, 0), 2)
+	if err != nil {
+		t.Fatalf("processAudioFileCached() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("probed %d times, want 1", calls)
+	}
+	if cacheHits.Load()-hits != 1 || cacheMisses.Load()-misses != 1 {
+		t.Errorf("counted %d cache hits and %d misses, want 1 each", cacheHits.Load()-hits, cacheMisses.Load()-misses)
+	}
+	if second.Title != first.Title || second.Duration != first.Duration || second.URL != first.URL {
+		t.Errorf("cached episode = %+v, want it to match %+v", second, first)
+	}
+	if second.EpisodeNum != 2 || !second.PubDate.Equal(time.Unix(200, 0)) || second.FilePath != path {
+		t.Errorf("cached episode kept the old run's number, date or path: %+v", second)
+	}
+
+	// Touching the file invalidates its entry
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processAudioFileCached(cache, path, "https://example.com", dir, time.Unix(300, 0), 1); err != nil {
+		t.Fatalf("processAudioFileCached() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("probed %d times after the file changed, want 2", calls)
+	}
+}
+
+func TestFileCacheSavePrunes(t *testing.T) {
+	dir := t.TempDir()
+	path := copyFixture(t, dir, "chapter01.mp3")
+	cachePath := filepath.Join(dir, "cache.json")
+
+	cache := loadFileCache(cachePath)
+	if _, err := cache.hash("chapter01.mp3", path); err != nil {
+		t.Fatalf("hash() error = %v", err)
+	}
+	if _, err := cache.hash("gone.mp3", path); err != nil {
+		t.Fatalf("hash() error = %v", err)
+	}
+	if err := cache.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	// Only entries used during a run survive it
+	cache = loadFileCache(cachePath)
+	sum, err := cache.hash("chapter01.mp3", path)
+	if err != nil {
+		t.Fatalf("hash() error = %v", err)
+	}
+	if err := cache.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	cache = loadFileCache(cachePath)
+	if _, ok := cache.entries["gone.mp3"]; ok {
+		t.Error("entry for an unused file survived save()")
+	}
+	if e, ok := cache.entries["chapter01.mp3"]; !ok || e.SHA256 != sum || len(sum) != 64 {
+		t.Errorf("entry = %+v, want the cached hash %q", e, sum)
+	}
+}
+
+func TestLoadFileCacheIgnoresOtherVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(path, []byte(`{"version": 0, "entries": {"a.mp3": {"size": 1}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cache := loadFileCache(path); len(cache.entries) != 0 {
+		t.Errorf("loadFileCache() kept %d entries from another version", len(cache.entries))
+	}
+}
+
+func TestBookCachePath(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", root)
+
+	a, err := bookCachePath("/books/Dune")
+	if err != nil {
+		t.Fatalf("bookCachePath() error = %v", err)
+	}
+	b, _ := bookCachePath("/other/Dune")
+	if filepath.Dir(a) != filepath.Join(root, "bookast") {
+		t.Errorf("bookCachePath() = %q, want it under $XDG_CACHE_HOME/bookast", a)
+	}
+	if a == b || !strings.HasPrefix(filepath.Base(a), "Dune-") {
+		t.Errorf("bookCachePath() = %q and %q, want distinct Dune-<hash> files", a, b)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(a, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clearCache(); err != nil {
+		t.Fatalf("clearCache() error = %v", err)
+	}
+	if _, err := os.Stat(a); !os.IsNotExist(err) {
+		t.Errorf("cache file still exists after clearCache(): %v", err)
+	}
+}
+
+func TestScanDirectoryNoCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+
+	if _, err := scanDirectory(dir, Options{BaseURL: "https://example.com", NoCache: true}); err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+	path, _ := bookCachePath(dir)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("--no-cache wrote %s", path)
+	}
+
+	if _, err := scanDirectory(dir, Options{BaseURL: "https://example.com"}); err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("cache file not written: %v", err)
+	}
+}
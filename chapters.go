@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// chaptersMimeType is the Podcasting 2.0 type for chapters JSON files.
+const chaptersMimeType = "application/json+chapters"
+
+// Chapter is a chapter marker inside an audio file.
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration
+	Title string
+}
+
+// readChapters returns the chapter markers in filePath: ID3v2 CHAP frames or
+// OverDrive MediaMarkers from metadata if it has any, otherwise whatever
+// ffprobe finds (m4b chapter atoms, Matroska/Ogg chapters). metadata may be
+// nil.
+func readChapters(filePath string, metadata tag.Metadata) ([]Chapter, error) {
+	for _, read := range []func(tag.Metadata) ([]Chapter, error){id3Chapters, overDriveChapters} {
+		chapters, err := read(metadata)
+		if err != nil || len(chapters) > 0 {
+			return chapters, err
+		}
+	}
+	return ffprobeChapters(filePath)
+}
+
+// ffprobeChapters asks ffprobe for the chapter markers in filePath.
+func ffprobeChapters(filePath string) ([]Chapter, error) {
+	output, err := runProbe(false, ffprobePath, "-v", "quiet", "-show_chapters", "-of", "json", filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+	return parseFFprobeChapters(output)
+}
+
+// parseFFprobeChapters reads the output of ffprobe -show_chapters -of json.
+func parseFFprobeChapters(data []byte) ([]Chapter, error) {
+	var out struct {
+		Chapters []struct {
+			StartTime string            `json:"start_time"`
+			EndTime   string            `json:"end_time"`
+			Tags      map[string]string `json:"tags"`
+		} `json:"chapters"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe chapters: %v", err)
+	}
+
+	chapters := make([]Chapter, 0, len(out.Chapters))
+	for i, c := range out.Chapters {
+		start, err := strconv.ParseFloat(c.StartTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chapter %d: invalid start time %q", i+1, c.StartTime)
+		}
+		end, err := strconv.ParseFloat(c.EndTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chapter %d: invalid end time %q", i+1, c.EndTime)
+		}
+		title := strings.TrimSpace(c.Tags["title"])
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		chapters = append(chapters, Chapter{
+			Start: secondsToDuration(start),
+			End:   secondsToDuration(end),
+			Title: title,
+		})
+	}
+	return chapters, nil
+}
+
+// chaptersJSON renders chapters in the Podcasting 2.0 JSON chapters format.
+func chaptersJSON(chapters []Chapter) ([]byte, error) {
+	type jsonChapter struct {
+		StartTime float64 `json:"startTime"`
+		EndTime   float64 `json:"endTime,omitempty"`
+		Title     string  `json:"title"`
+	}
+	doc := struct {
+		Version  string        `json:"version"`
+		Chapters []jsonChapter `json:"chapters"`
+	}{Version: "1.2.0"}
+
+	for _, c := range chapters {
+		doc.Chapters = append(doc.Chapters, jsonChapter{
+			StartTime: c.Start.Seconds(),
+			EndTime:   c.End.Seconds(),
+			Title:     c.Title,
+		})
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// chaptersFilename is the chapters file published next to an audio file.
+func chaptersFilename(audioFile string) string {
+	return strings.TrimSuffix(audioFile, filepath.Ext(audioFile)) + ".chapters.json"
+}
+
+// writeChaptersFile writes the chapters JSON for the audio file at path and
+// returns its filename.
+func writeChaptersFile(path string, chapters []Chapter) (string, error) {
+	data, err := chaptersJSON(chapters)
+	if err != nil {
+		return "", err
+	}
+
+	filename := chaptersFilename(filepath.Base(path))
+	if err := writeFileIfChanged(filepath.Join(filepath.Dir(path), filename), data); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFFprobeChapters(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Chapter
+		wantErr  bool
+	}{
+		{
+			name:     "no chapters",
+			input:    `{"chapters": []}`,
+			expected: []Chapter{},
+		},
+		{
+			name: "titled and untitled chapters",
+			input: `{"chapters": [
+				{"id": 0, "time_base": "1/1000", "start": 0, "start_time": "0.000000", "end": 61500, "end_time": "61.500000", "tags": {"title": "Opening Credits"}},
+				{"id": 1, "time_base": "1/1000", "start": 61500, "start_time": "61.500000", "end": 900000, "end_time": "900.000000"}
+			]}`,
+			expected: []Chapter{
+				{Start: 0, End: 61500 * time.Millisecond, Title: "Opening Credits"},
+				{Start: 61500 * time.Millisecond, End: 900 * time.Second, Title: "Chapter 2"},
+			},
+		},
+		{
+			name:    "bad start time",
+			input:   `{"chapters": [{"start_time": "soon", "end_time": "1.0"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			input:   `chapters`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseFFprobeChapters([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFFprobeChapters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("parseFFprobeChapters() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChaptersJSON(t *testing.T) {
+	data, err := chaptersJSON([]Chapter{
+		{Start: 0, End: 90 * time.Second, Title: "Prologue"},
+		{Start: 90 * time.Second, End: 1234500 * time.Millisecond, Title: `The "Other" Side`},
+	})
+	if err != nil {
+		t.Fatalf("chaptersJSON() error = %v", err)
+	}
+
+	expected := `{
+  "version": "1.2.0",
+  "chapters": [
+    {
+      "startTime": 0,
+      "endTime": 90,
+      "title": "Prologue"
+    },
+    {
+      "startTime": 90,
+      "endTime": 1234.5,
+      "title": "The \"Other\" Side"
+    }
+  ]
+}
+`
+	if string(data) != expected {
+		t.Errorf("chaptersJSON() =\n%s\nwant\n%s", data, expected)
+	}
+}
+
+func TestWriteChaptersFile(t *testing.T) {
+	dir := t.TempDir()
+	audioPath := filepath.Join(dir, "book.m4b")
+	chapters := []Chapter{{Start: 0, End: time.Minute, Title: "One"}}
+
+	filename, err := writeChaptersFile(audioPath, chapters)
+	if err != nil {
+		t.Fatalf("writeChaptersFile() error = %v", err)
+	}
+	if filename != "book.chapters.json" {
+		t.Errorf("writeChaptersFile() = %q, want book.chapters.json", filename)
+	}
+
+	// Rewriting identical chapters leaves the file untouched
+	path := filepath.Join(dir, filename)
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeChaptersFile(audioPath, chapters); err != nil {
+		t.Fatalf("writeChaptersFile() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("writeChaptersFile() rewrote an unchanged file (mtime %v, want %v)", info.ModTime(), past)
+	}
+}
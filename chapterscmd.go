@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runChapters implements "bookast chapters", which prints the chapters
+// bookast detects in a file.
+func runChapters(args []string) int {
+	fs := flag.NewFlagSet("chapters", flag.ContinueOnError)
+	format := fs.String("format", "text", "Output format: text, json (Podcasting 2.0 chapters) or ffmetadata")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s chapters [flags] <file>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	write, ok := chapterWriters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: --format must be text, json or ffmetadata, not %q\n", *format)
+		return 1
+	}
+
+	path := fs.Arg(0)
+	chapters, err := detectChapters(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(chapters) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no chapters found in %s\n", path)
+		return 1
+	}
+
+	// Chapters that run to the end of the file need its duration
+	if last := &chapters[len(chapters)-1]; last.End <= last.Start {
+		if duration, _, err := resolveDuration(path, readTags(path), durationProviders); err == nil {
+			last.End = duration.Duration
+		}
+	}
+
+	if err := write(os.Stdout, chapters); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// detectChapters finds the chapters of the audio file at path the way feed
+// generation does: a cue sheet next to it first, then its chapter markers.
+func detectChapters(path string) ([]Chapter, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	dir, filename := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	cues, err := readCueSheets(dir, []string{filename})
+	if err != nil {
+		return nil, err
+	}
+	if chapters, ok := cues[filename]; ok {
+		return chapters, nil
+	}
+
+	return readChapters(path, readTags(path))
+}
+
+var chapterWriters = map[string]func(io.Writer, []Chapter) error{
+	"text":       writeChaptersText,
+	"json":       writeChaptersJSON,
+	"ffmetadata": writeFFMetadata,
+}
+
+// writeChaptersText prints one "start  title" line per chapter.
+func writeChaptersText(w io.Writer, chapters []Chapter) error {
+	for _, c := range chapters {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", formatTimestamp(c.Start), c.Title); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeChaptersJSON(w io.Writer, chapters []Chapter) error {
+	data, err := chaptersJSON(chapters)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeFFMetadata prints chapters in ffmpeg's metadata file format, ready
+// for ffmpeg -i audio -i chapters.txt -map_chapters 1.
+func writeFFMetadata(w io.Writer, chapters []Chapter) error {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, c := range chapters {
+		fmt.Fprintf(&b, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			c.Start.Milliseconds(), c.End.Milliseconds(), escapeFFMetadata(c.Title))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escapeFFMetadata backslash-escapes the characters ffmpeg's metadata format
+// treats specially.
+func escapeFFMetadata(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("=;#\\\n", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// formatTimestamp formats d as H:MM:SS.mmm.
+func formatTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testChapters = []Chapter{
+	{Start: 0, End: 61500 * time.Millisecond, Title: "Opening Credits"},
+	{Start: 61500 * time.Millisecond, End: 2*time.Hour + 5*time.Second, Title: "Part 1; The = Sign"},
+}
+
+func TestChapterWriters(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"text", "0:00:00.000  Opening Credits\n0:01:01.500  Part 1; The = Sign\n"},
+		{"ffmetadata", ";FFMETADATA1\n" +
+			"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=61500\ntitle=Opening Credits\n" +
+			"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=61500\nEND=7205000\ntitle=Part 1\\; The \\= Sign\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := chapterWriters[tt.format](&out, testChapters); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("%s output =\n%s\nwant\n%s", tt.format, out.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestDetectChaptersPrefersCueSheet(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "book.flac"), []byte("not really flac"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cue := "FILE \"book.flac\" WAVE\nTRACK 01 AUDIO\nTITLE \"One\"\nINDEX 01 00:00:00\nTRACK 02 AUDIO\nTITLE \"Two\"\nINDEX 01 01:00:00\n"
+	if err := os.WriteFile(filepath.Join(dir, "book.cue"), []byte(cue), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chapters, err := detectChapters(filepath.Join(dir, "book.flac"))
+	if err != nil {
+		t.Fatalf("detectChapters() error = %v", err)
+	}
+	expected := []Chapter{{Start: 0, End: time.Minute, Title: "One"}, {Start: time.Minute, Title: "Two"}}
+	if !reflect.DeepEqual(chapters, expected) {
+		t.Errorf("detectChapters() = %+v, want %+v", chapters, expected)
+	}
+
+	if _, err := detectChapters(filepath.Join(dir, "missing.flac")); err == nil {
+		t.Error("detectChapters() of a missing file error = nil, want error")
+	}
+}
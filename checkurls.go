@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rssImage is an <itunes:image href> or an RSS <image><url>.
+type rssImage struct {
+	Href string `xml:"href,attr"`
+	URL  string `xml:"url"`
+}
+
+func (i rssImage) url() string {
+	if i.Href != "" {
+		return i.Href
+	}
+	return i.URL
+}
+
+// linkedFeed is the part of an RSS feed that links to media.
+type linkedFeed struct {
+	Channel struct {
+		Images []rssImage `xml:"image"`
+		Items  []struct {
+			Title     []rssText  `xml:"title"`
+			Images    []rssImage `xml:"image"`
+			Enclosure *struct {
+				URL    string `xml:"url,attr"`
+				Length string `xml:"length,attr"`
+				Type   string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// linkedURL is a URL a feed expects to be served.
+type linkedURL struct {
+	Where  string // Like Issue.Where
+	URL    string
+	Image  bool
+	Length int64  // Declared by the enclosure, -1 if it isn't
+	Type   string // Declared by the enclosure
+}
+
+// runCheckURLs implements "bookast check-urls", which makes sure every
+// enclosure and image a feed links to is served as the feed describes it.
+func runCheckURLs(args []string) int {
+	fs := flag.NewFlagSet("check-urls", flag.ContinueOnError)
+	jobs := fs.Int("jobs", 8, "Number of requests to make at once")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s check-urls [flags] <feed file or URL>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	content, err := readFeedSource(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	links, err := feedLinks(content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Checking %s\n", plural(len(links), "URL"))
+	results := make([][]Issue, len(links))
+	runParallel(len(links), *jobs, func(i int) {
+		results[i] = checkLink(links[i])
+	})
+	var issues []Issue
+	for _, result := range results {
+		issues = append(issues, result...)
+	}
+	printIssues(os.Stdout, issues)
+	for _, issue := range issues {
+		if issue.Severity == severityError {
+			return 1
+		}
+	}
+	return 0
+}
+
+// feedLinks returns the images and enclosures of an RSS feed in document
+// order, each image once.
+func feedLinks(content []byte) ([]linkedURL, error) {
+	var feed linkedFeed
+	if err := xml.Unmarshal(content, &feed); err != nil {
+		return nil, fmt.Errorf("not an RSS feed: %v", err)
+	}
+
+	var links []linkedURL
+	seen := map[string]bool{}
+	addImages := func(where string, images []rssImage) {
+		for _, image := range images {
+			if u := image.url(); u != "" && !seen[u] {
+				seen[u] = true
+				links = append(links, linkedURL{Where: where, URL: u, Image: true, Length: -1})
+			}
+		}
+	}
+
+	addImages("channel", feed.Channel.Images)
+	for i, item := range feed.Channel.Items {
+		where := fmt.Sprintf("item %d", i+1)
+		if title := plain(item.Title); title != "" {
+			where = fmt.Sprintf("item %d (%s)", i+1, title)
+		}
+		if enclosure := item.Enclosure; enclosure != nil && enclosure.URL != "" {
+			length, err := strconv.ParseInt(enclosure.Length, 10, 64)
+			if err != nil {
+				length = -1
+			}
+			links = append(links, linkedURL{Where: where, URL: enclosure.URL, Length: length, Type: enclosure.Type})
+		}
+		addImages(where, item.Images)
+	}
+	return links, nil
+}
+
+// checkLink makes a HEAD request for link and compares the response with
+// what the feed declares. Servers that don't allow HEAD get a GET, whose
+// body is left unread.
+func checkLink(link linkedURL) []Issue {
+	var issues []Issue
+	add := func(severity, format string, args ...any) {
+		issues = append(issues, Issue{severity, link.Where, link.URL + ": " + fmt.Sprintf(format, args...)})
+	}
+
+	resp, err := httpRequest(http.MethodHead, link.URL)
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = httpRequest(http.MethodGet, link.URL)
+	}
+	if err != nil {
+		add(severityError, "%v", err)
+		return issues
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		add(severityError, "%s", resp.Status)
+		return issues
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if link.Image {
+		if !strings.HasPrefix(contentType, "image/") {
+			add(severityError, "served as %q, not an image", contentType)
+		}
+		return issues
+	}
+
+	switch {
+	case link.Type != "" && contentType == "":
+		add(severityWarning, "served without a Content-Type")
+	case link.Type != "" && contentType != link.Type:
+		add(severityError, "served as %s, the enclosure says %s", contentType, link.Type)
+	}
+	switch {
+	case link.Length < 0:
+	case resp.ContentLength < 0:
+		add(severityWarning, "served without a Content-Length")
+	case resp.ContentLength != link.Length:
+		add(severityError, "served as %d bytes, the enclosure says %d", resp.ContentLength, link.Length)
+	}
+	return issues
+}
+
+// httpRequest makes a request identifying itself as bookast.
+func httpRequest(method string, url string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", generatorName())
+	return httpClient.Do(req)
+}
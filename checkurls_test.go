@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFeedLinks(t *testing.T) {
+	content, err := os.ReadFile("testdata/audiobook1/golden.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := feedLinks(content)
+	if err != nil {
+		t.Fatalf("feedLinks() error = %v", err)
+	}
+
+	expected := []linkedURL{
+		{"channel", "https://example.com/audiobooks/audiobook1/cover.jpg", true, -1, ""},
+		{"item 1 (Chapter One)", "https://example.com/audiobooks/audiobook1/chapter01.mp3", false, 17164, "audio/mpeg"},
+		{"item 2 (Chapter Two)", "https://example.com/audiobooks/audiobook1/chapter02.mp3", false, 33249, "audio/mpeg"},
+		{"item 3 (Chapter Three)", "https://example.com/audiobooks/audiobook1/chapter03.m4a", false, 49728, "audio/mp4"},
+	}
+	if len(links) != len(expected) {
+		t.Fatalf("feedLinks() = %+v, want %+v", links, expected)
+	}
+	for i := range expected {
+		if links[i] != expected[i] {
+			t.Errorf("links[%d] = %+v, want %+v", i, links[i], expected[i])
+		}
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	dir := t.TempDir()
+	copyFixture(t, dir, "chapter01.mp3")
+	copyFixture(t, dir, "cover.jpg")
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+	info, err := os.Stat(filepath.Join(dir, "chapter01.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		link     linkedURL
+		expected string
+	}{
+		{"ok", linkedURL{URL: server.URL + "/chapter01.mp3", Length: info.Size(), Type: "audio/mpeg"}, ""},
+		{"image", linkedURL{URL: server.URL + "/cover.jpg", Image: true, Length: -1}, ""},
+		{"missing", linkedURL{URL: server.URL + "/chapter02.mp3", Length: 10, Type: "audio/mpeg"}, "404 Not Found"},
+		{"length", linkedURL{URL: server.URL + "/chapter01.mp3", Length: 10, Type: "audio/mpeg"}, "the enclosure says 10"},
+		{"type", linkedURL{URL: server.URL + "/chapter01.mp3", Length: info.Size(), Type: "audio/mp4"}, "served as audio/mpeg, the enclosure says audio/mp4"},
+		{"not an image", linkedURL{URL: server.URL + "/chapter01.mp3", Image: true, Length: -1}, `served as "audio/mpeg", not an image`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := checkLink(tt.link)
+			if tt.expected == "" {
+				if len(issues) > 0 {
+					t.Errorf("checkLink() = %+v, want no issues", issues)
+				}
+				return
+			}
+			if len(issues) != 1 || issues[0].Severity != severityError || !strings.Contains(issues[0].Message, tt.expected) {
+				t.Errorf("checkLink() = %+v, want an error containing %q", issues, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the contents of the user's config file, settings that belong to
+// the person running bookast rather than to any one book. Every field is
+// optional; flags override it.
+//
+//	activation-bytes: 1a2b3c4d
+//	mime-types:
+//	  .mpc: audio/musepack
+//	google-books-api-key: AIza...
+//	shelf: /home/me/goodreads_library_export.csv
+type Config struct {
+	ActivationBytes   string            `yaml:"activation-bytes"`     // Audible key for decrypting .aax files
+	MIMETypes         map[string]string `yaml:"mime-types"`           // Extra audio extensions, or other enclosure types for built-in ones
+	GoogleBooksAPIKey string            `yaml:"google-books-api-key"` // For bookast enrich --provider googlebooks
+	Shelf             string            `yaml:"shelf"`                // Goodreads/StoryGraph export, like --shelf
+}
+
+// configPath is the user's config file: $XDG_CONFIG_HOME/bookast/config.yaml,
+// else the platform's user config directory.
+func configPath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "bookast", "config.yaml"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bookast", "config.yaml"), nil
+}
+
+// loadConfig reads the user's config file. A missing file, or no config
+// directory at all, is an empty config.
+func loadConfig() (*Config, error) {
+	config := &Config{}
+
+	path, err := configPath()
+	if err != nil {
+		return config, nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decodeYAML(string(content), config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	// Extensions are matched lowercase with the dot, however they're written
+	types := make(map[string]string, len(config.MIMETypes))
+	for ext, mimeType := range config.MIMETypes {
+		key := "." + strings.ToLower(strings.TrimPrefix(ext, "."))
+		if key == "." || strings.ContainsAny(key[1:], "./\\ ") {
+			return nil, fmt.Errorf("%s: mime-types: %q is not a file extension", path, ext)
+		}
+		if kind, sub, ok := strings.Cut(mimeType, "/"); !ok || kind == "" || sub == "" || strings.ContainsAny(mimeType, " ;") {
+			return nil, fmt.Errorf("%s: mime-types.%s: %q is not a MIME type like audio/mpeg", path, ext, mimeType)
+		}
+		types[key] = mimeType
+	}
+	config.MIMETypes = types
+	return config, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() without a config file error = %v", err)
+	}
+	if config.ActivationBytes != "" {
+		t.Errorf("ActivationBytes = %q, want empty", config.ActivationBytes)
+	}
+
+	path := filepath.Join(dir, "bookast", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("# Audible\nactivation-bytes: 1a2b3c4d\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if config.ActivationBytes != "1a2b3c4d" {
+		t.Errorf("ActivationBytes = %q, want 1a2b3c4d", config.ActivationBytes)
+	}
+
+	if err := os.WriteFile(path, []byte("activation-byte: 1a2b3c4d\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(); err == nil {
+		t.Error("loadConfig() error = nil, want an error for an unknown key")
+	}
+}
+
+func TestLoadConfigMIMETypes(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	path := filepath.Join(dir, "bookast", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{"extensions normalized", "mime-types:\n  .MPC: audio/musepack\n  opus: audio/opus\n", map[string]string{".mpc": "audio/musepack", ".opus": "audio/opus"}, false},
+		{"not a MIME type", "mime-types:\n  .mpc: musepack\n", nil, true},
+		{"not an extension", "mime-types:\n  a/b: audio/x-b\n", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := loadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("loadConfig() = %v, want error", config.MIMETypes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(config.MIMETypes, tt.expected) {
+				t.Errorf("MIMETypes = %v, want %v", config.MIMETypes, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// cueTrack is a TRACK entry in a cue sheet.
+type cueTrack struct {
+	Number int
+	Title  string
+	Start  time.Duration // INDEX 01
+}
+
+// cueFile is a FILE entry in a cue sheet and its tracks.
+type cueFile struct {
+	Name   string
+	Tracks []cueTrack
+}
+
+// parseCueSheet reads the FILE, TRACK, TITLE and INDEX 01 commands of a cue
+// sheet and ignores the rest.
+func parseCueSheet(content string) ([]cueFile, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	if !utf8.ValidString(content) {
+		// Cue sheets from Windows rippers are often Latin-1
+		runes := make([]rune, 0, len(content))
+		for i := 0; i < len(content); i++ {
+			runes = append(runes, rune(content[i]))
+		}
+		content = string(runes)
+	}
+
+	var files []cueFile
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		command, args := splitCueLine(scanner.Text())
+		switch command {
+		case "FILE":
+			if len(args) < 1 {
+				return nil, fmt.Errorf("line %d: FILE without a filename", lineNum)
+			}
+			files = append(files, cueFile{Name: args[0]})
+		case "TRACK":
+			if len(files) == 0 {
+				return nil, fmt.Errorf("line %d: TRACK before FILE", lineNum)
+			}
+			if len(args) < 1 {
+				return nil, fmt.Errorf("line %d: TRACK without a number", lineNum)
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad track number %q", lineNum, args[0])
+			}
+			f := &files[len(files)-1]
+			f.Tracks = append(f.Tracks, cueTrack{Number: n, Start: -1})
+		case "TITLE":
+			// A TITLE before the first TRACK is the album's
+			if track := lastCueTrack(files); track != nil && len(args) > 0 {
+				track.Title = args[0]
+			}
+		case "INDEX":
+			track := lastCueTrack(files)
+			if track == nil || len(args) < 2 || args[0] != "01" {
+				continue
+			}
+			start, err := parseCueTime(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			track.Start = start
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		for _, track := range f.Tracks {
+			if track.Start < 0 {
+				return nil, fmt.Errorf("track %d has no INDEX 01", track.Number)
+			}
+		}
+	}
+	return files, nil
+}
+
+func lastCueTrack(files []cueFile) *cueTrack {
+	if len(files) == 0 || len(files[len(files)-1].Tracks) == 0 {
+		return nil
+	}
+	tracks := files[len(files)-1].Tracks
+	return &tracks[len(tracks)-1]
+}
+
+// splitCueLine splits a cue sheet line into its command and arguments, which
+// may be double-quoted.
+func splitCueLine(line string) (string, []string) {
+	var fields []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				fields = append(fields, line[1:])
+				break
+			}
+			fields = append(fields, line[1:end+1])
+			line = strings.TrimSpace(line[end+2:])
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			fields = append(fields, line)
+			break
+		}
+		fields = append(fields, line[:end])
+		line = strings.TrimSpace(line[end:])
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToUpper(fields[0]), fields[1:]
+}
+
+// parseCueTime parses an "mm:ss:ff" cue time, with 75 frames per second.
+func parseCueTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("bad cue time %q", s)
+	}
+	var v [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("bad cue time %q", s)
+		}
+		v[i] = n
+	}
+	if v[1] >= 60 || v[2] >= 75 {
+		return 0, fmt.Errorf("bad cue time %q", s)
+	}
+	return time.Duration(v[0])*time.Minute + time.Duration(v[1])*time.Second + time.Duration(v[2])*time.Second/75, nil
+}
+
+// readCueSheets parses the .cue files in dir and returns the tracks of each
+// audio file they describe, as chapters keyed by filename. A FILE entry that
+// names a missing file matches an audio file with the same base name, since
+// rippers write "Book.wav" and the FLAC comes later.
+func readCueSheets(dir string, audioFiles []string) (map[string][]Chapter, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byBase := map[string]string{}
+	present := map[string]bool{}
+	for _, filename := range audioFiles {
+		present[filename] = true
+		byBase[strings.TrimSuffix(filename, filepath.Ext(filename))] = filename
+	}
+
+	result := map[string][]Chapter{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.ToLower(filepath.Ext(entry.Name())) != ".cue" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files, err := parseCueSheet(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+
+		for _, f := range files {
+			// Sheets made on Windows may name the file with a full path
+			name := filepath.Base(strings.ReplaceAll(f.Name, `\`, "/"))
+			if !present[name] {
+				name = byBase[strings.TrimSuffix(name, filepath.Ext(name))]
+			}
+			if name == "" || len(f.Tracks) == 0 {
+				continue
+			}
+			result[name] = cueChapters(f.Tracks)
+		}
+	}
+	return result, nil
+}
+
+// cueChapters turns cue tracks into chapters, each ending where the next
+// starts.
+func cueChapters(tracks []cueTrack) []Chapter {
+	chapters := make([]Chapter, len(tracks))
+	for i, track := range tracks {
+		title := strings.TrimSpace(track.Title)
+		if title == "" {
+			title = fmt.Sprintf("Track %d", track.Number)
+		}
+		chapters[i] = Chapter{Start: track.Start, Title: title}
+		if i > 0 {
+			chapters[i-1].End = track.Start
+		}
+	}
+	return chapters
+}
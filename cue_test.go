@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testCueSheet = `REM GENRE Audiobook
+PERFORMER "Jules Verne"
+TITLE "Twenty Thousand Leagues"
+FILE "C:\Rips\Leagues.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "A Shifting Reef"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Pro and Con"
+    INDEX 00 12:29:70
+    INDEX 01 12:30:37
+  TRACK 03 AUDIO
+    INDEX 01 75:00:00
+`
+
+func TestParseCueSheet(t *testing.T) {
+	files, err := parseCueSheet(testCueSheet)
+	if err != nil {
+		t.Fatalf("parseCueSheet() error = %v", err)
+	}
+
+	expected := []cueFile{{
+		Name: `C:\Rips\Leagues.wav`,
+		Tracks: []cueTrack{
+			{Number: 1, Title: "A Shifting Reef", Start: 0},
+			{Number: 2, Title: "Pro and Con", Start: 12*time.Minute + 30*time.Second + 37*time.Second/75},
+			{Number: 3, Start: 75 * time.Minute},
+		},
+	}}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("parseCueSheet() = %+v, want %+v", files, expected)
+	}
+}
+
+func TestParseCueSheetErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		sheet string
+	}{
+		{"track before file", "TRACK 01 AUDIO\n"},
+		{"missing index", "FILE \"a.flac\" WAVE\nTRACK 01 AUDIO\nTITLE \"One\"\n"},
+		{"bad time", "FILE \"a.flac\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:61:00\n"},
+		{"bad track number", "FILE \"a.flac\" WAVE\nTRACK one AUDIO\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseCueSheet(tt.sheet); err == nil {
+				t.Error("parseCueSheet() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestParseCueSheetLatin1(t *testing.T) {
+	files, err := parseCueSheet("FILE \"a.flac\" WAVE\nTRACK 01 AUDIO\nTITLE \"Caf\xe9\"\nINDEX 01 00:00:00\n")
+	if err != nil {
+		t.Fatalf("parseCueSheet() error = %v", err)
+	}
+	if title := files[0].Tracks[0].Title; title != "Café" {
+		t.Errorf("Title = %q, want %q", title, "Café")
+	}
+}
+
+func TestReadCueSheets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Leagues.cue"), []byte(testCueSheet), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sheet names Leagues.wav, the directory has Leagues.flac
+	cues, err := readCueSheets(dir, []string{"Leagues.flac", "Other.flac"})
+	if err != nil {
+		t.Fatalf("readCueSheets() error = %v", err)
+	}
+
+	second := 12*time.Minute + 30*time.Second + 37*time.Second/75
+	expected := map[string][]Chapter{
+		"Leagues.flac": {
+			{Start: 0, End: second, Title: "A Shifting Reef"},
+			{Start: second, End: 75 * time.Minute, Title: "Pro and Con"},
+			{Start: 75 * time.Minute, Title: "Track 3"},
+		},
+	}
+	if !reflect.DeepEqual(cues, expected) {
+		t.Errorf("readCueSheets() = %+v, want %+v", cues, expected)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// copySuffixRe matches the names file managers and browsers give copies:
+// "chapter5 (1)", "chapter5 - Copy", "chapter5 copy 2".
+var copySuffixRe = regexp.MustCompile(`(?i)(\s*\(\d{1,2}\)|(\s+-)?\s+copy(\s+\d+)?)$`)
+
+// isCopyName reports whether filename looks like a copy of another file.
+func isCopyName(filename string) bool {
+	base := filepath.Base(filename)
+	return copySuffixRe.MatchString(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// findDuplicates finds the files in audioFiles (relative to dir) with the
+// same content as another, returning a map from the index of each duplicate
+// to the index of the file kept in its place. Only files of equal size are
+// hashed. Of a set of duplicates the first whose name doesn't look like a
+// copy is kept. episodes are the probed files, nil where probing failed.
+func findDuplicates(cache *fileCache, dir string, audioFiles []string, episodes []*Episode) map[int]int {
+	bySize := map[int64][]int{}
+	for i, episode := range episodes {
+		if episode != nil {
+			bySize[episode.FileSize] = append(bySize[episode.FileSize], i)
+		}
+	}
+
+	dups := map[int]int{}
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+		byHash := map[string][]int{}
+		var hashes []string
+		for _, i := range group {
+			sum, err := cache.hash(filepath.ToSlash(audioFiles[i]), filepath.Join(dir, audioFiles[i]))
+			if err != nil {
+				continue
+			}
+			if byHash[sum] == nil {
+				hashes = append(hashes, sum)
+			}
+			byHash[sum] = append(byHash[sum], i)
+		}
+
+		for _, sum := range hashes {
+			same := byHash[sum]
+			kept := same[0]
+			for _, i := range same {
+				if !isCopyName(audioFiles[i]) {
+					kept = i
+					break
+				}
+			}
+			for _, i := range same {
+				if i != kept {
+					dups[i] = kept
+				}
+			}
+		}
+	}
+	return dups
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsCopyName(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected bool
+	}{
+		{"chapter5.mp3", false},
+		{"chapter5 (1).mp3", true},
+		{"chapter5 - Copy.mp3", true},
+		{"chapter5 copy 2.mp3", true},
+		{"Chapter 1 (2019).mp3", false},
+		{"The Copyist.mp3", false},
+		{"Photocopy.mp3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := isCopyName(tt.filename); got != tt.expected {
+				t.Errorf("isCopyName(%q) = %v, want %v", tt.filename, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScanDirectoryDuplicates(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	copyFixture(t, dir, "chapter02.mp3")
+	// Sorts before the original, which should still be the one kept
+	data, err := os.ReadFile(filepath.Join(dir, "chapter02.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "chapter02 (1).mp3"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, noCache := range []bool{true, false} {
+		podcast, err := scanDirectory(dir, Options{BaseURL: "https://example.com", NoCache: noCache})
+		if err != nil {
+			t.Fatalf("scanDirectory() error = %v", err)
+		}
+		if len(podcast.Episodes) != 2 {
+			t.Fatalf("got %d episodes, want 2", len(podcast.Episodes))
+		}
+		if got := filepath.Base(podcast.Episodes[1].FilePath); got != "chapter02.mp3" || podcast.Episodes[1].EpisodeNum != 2 {
+			t.Errorf("second episode is %s numbered %d, want chapter02.mp3 numbered 2", got, podcast.Episodes[1].EpisodeNum)
+		}
+
+		var dups []Warning
+		for _, w := range podcast.Warnings {
+			if w.Category == warnDuplicateFile {
+				dups = append(dups, w)
+			}
+		}
+		if len(dups) != 1 || filepath.Base(dups[0].File) != "chapter02 (1).mp3" {
+			t.Errorf("duplicate warnings = %+v, want one for chapter02 (1).mp3", dups)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// diffItem is what a feed diff compares of an item.
+type diffItem struct {
+	Title       string
+	GUID        string
+	URL         string
+	Length      int64
+	Type        string
+	Duration    string
+	Description string
+}
+
+// diffChannel is what a feed diff compares of a feed.
+type diffChannel struct {
+	Title string
+	Image string
+	Items []diffItem
+}
+
+// parseDiffFeed reads the channel and items of an RSS feed.
+func parseDiffFeed(content []byte) (*diffChannel, error) {
+	var feed struct {
+		Channel struct {
+			Title  []rssText  `xml:"title"`
+			Images []rssImage `xml:"image"`
+			Items  []struct {
+				Title       []rssText `xml:"title"`
+				GUID        string    `xml:"guid"`
+				Description string    `xml:"description"`
+				Duration    string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+				Enclosure   struct {
+					URL    string `xml:"url,attr"`
+					Length string `xml:"length,attr"`
+					Type   string `xml:"type,attr"`
+				} `xml:"enclosure"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(content, &feed); err != nil {
+		return nil, fmt.Errorf("not an RSS feed: %v", err)
+	}
+
+	channel := &diffChannel{Title: plain(feed.Channel.Title)}
+	if len(feed.Channel.Images) > 0 {
+		channel.Image = feed.Channel.Images[0].url()
+	}
+	for _, item := range feed.Channel.Items {
+		length, _ := strconv.ParseInt(item.Enclosure.Length, 10, 64)
+		channel.Items = append(channel.Items, diffItem{
+			Title:       plain(item.Title),
+			GUID:        item.GUID,
+			URL:         item.Enclosure.URL,
+			Length:      length,
+			Type:        item.Enclosure.Type,
+			Duration:    item.Duration,
+			Description: item.Description,
+		})
+	}
+	return channel, nil
+}
+
+// FeedDiff is what changes for subscribers between two versions of a feed.
+type FeedDiff struct {
+	Channel     []string // Changes to the channel, `title "a" -> "b"`
+	Added       []diffItem
+	Removed     []diffItem
+	GUIDChanged [][2]diffItem // Old and new: the same episode under a new GUID, which apps download again
+	Changed     []string      // "Chapter One: title ..., length ..."
+	OldSize     int64
+	NewSize     int64
+}
+
+// Empty reports whether the feeds' episodes and channel are the same.
+func (d *FeedDiff) Empty() bool {
+	return len(d.Channel) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.GUIDChanged) == 0 && len(d.Changed) == 0
+}
+
+// diffFeeds compares two feeds. Items are matched by GUID, then items left
+// over by enclosure URL and then by title, which are GUID changes.
+func diffFeeds(before, after *diffChannel) *FeedDiff {
+	d := &FeedDiff{}
+	if before.Title != after.Title {
+		d.Channel = append(d.Channel, fmt.Sprintf("title %q -> %q", before.Title, after.Title))
+	}
+	if before.Image != after.Image {
+		d.Channel = append(d.Channel, fmt.Sprintf("image %s -> %s", before.Image, after.Image))
+	}
+	for _, item := range before.Items {
+		d.OldSize += item.Length
+	}
+	for _, item := range after.Items {
+		d.NewSize += item.Length
+	}
+
+	matched := make([]bool, len(before.Items))
+	match := func(same func(o, n diffItem) bool, n diffItem) int {
+		for i, o := range before.Items {
+			if !matched[i] && same(o, n) {
+				matched[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+	byGUID := func(o, n diffItem) bool { return o.GUID != "" && o.GUID == n.GUID }
+	byURL := func(o, n diffItem) bool { return o.URL != "" && o.URL == n.URL }
+	byTitle := func(o, n diffItem) bool { return o.Title != "" && o.Title == n.Title }
+
+	pairs := make([]int, len(after.Items))
+	for j, n := range after.Items {
+		pairs[j] = match(byGUID, n)
+	}
+	for j, n := range after.Items {
+		if pairs[j] >= 0 {
+			continue
+		}
+		if i := match(byURL, n); i >= 0 {
+			pairs[j] = i
+		} else if i := match(byTitle, n); i >= 0 {
+			pairs[j] = i
+		}
+	}
+
+	for j, n := range after.Items {
+		i := pairs[j]
+		if i < 0 {
+			d.Added = append(d.Added, n)
+			continue
+		}
+		o := before.Items[i]
+		if o.GUID != n.GUID {
+			d.GUIDChanged = append(d.GUIDChanged, [2]diffItem{o, n})
+		}
+		if changes := itemChanges(o, n); len(changes) > 0 {
+			d.Changed = append(d.Changed, fmt.Sprintf("%s: %s", n.Title, strings.Join(changes, ", ")))
+		}
+	}
+	for i, o := range before.Items {
+		if !matched[i] {
+			d.Removed = append(d.Removed, o)
+		}
+	}
+	return d
+}
+
+// itemChanges describes how an item changed, apart from its GUID.
+func itemChanges(o, n diffItem) []string {
+	var changes []string
+	if o.Title != n.Title {
+		changes = append(changes, fmt.Sprintf("title %q -> %q", o.Title, n.Title))
+	}
+	if o.URL != n.URL {
+		changes = append(changes, fmt.Sprintf("url %s -> %s", o.URL, n.URL))
+	}
+	if o.Length != n.Length {
+		changes = append(changes, fmt.Sprintf("length %d -> %d (%s)", o.Length, n.Length, formatSizeDelta(n.Length-o.Length)))
+	}
+	if o.Type != n.Type {
+		changes = append(changes, fmt.Sprintf("type %s -> %s", o.Type, n.Type))
+	}
+	if o.Duration != n.Duration {
+		changes = append(changes, fmt.Sprintf("duration %s -> %s", o.Duration, n.Duration))
+	}
+	if o.Description != n.Description {
+		changes = append(changes, "description")
+	}
+	return changes
+}
+
+// formatSizeDelta formats a change in bytes with its sign, "+2.2K".
+func formatSizeDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + formatByteSize(-delta)
+	}
+	return "+" + formatByteSize(delta)
+}
+
+// Print writes the diff, one section per kind of change.
+func (d *FeedDiff) Print(w io.Writer) {
+	if d.Empty() {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+	for _, change := range d.Channel {
+		fmt.Fprintf(w, "Channel %s\n", change)
+	}
+	if len(d.Added) > 0 {
+		fmt.Fprintf(w, "Added (%d):\n", len(d.Added))
+		for _, item := range d.Added {
+			fmt.Fprintf(w, "  + %s (%s)\n", item.Title, formatByteSize(item.Length))
+		}
+	}
+	if len(d.Removed) > 0 {
+		fmt.Fprintf(w, "Removed (%d):\n", len(d.Removed))
+		for _, item := range d.Removed {
+			fmt.Fprintf(w, "  - %s (%s)\n", item.Title, formatByteSize(item.Length))
+		}
+	}
+	if len(d.GUIDChanged) > 0 {
+		fmt.Fprintf(w, "GUID changed, subscribers get these again (%d):\n", len(d.GUIDChanged))
+		for _, pair := range d.GUIDChanged {
+			fmt.Fprintf(w, "  ! %s: %s -> %s\n", pair[1].Title, pair[0].GUID, pair[1].GUID)
+		}
+	}
+	if len(d.Changed) > 0 {
+		fmt.Fprintf(w, "Changed (%d):\n", len(d.Changed))
+		for _, change := range d.Changed {
+			fmt.Fprintf(w, "  ~ %s\n", change)
+		}
+	}
+	fmt.Fprintf(w, "Size: %s -> %s (%s)\n", formatByteSize(d.OldSize), formatByteSize(d.NewSize), formatSizeDelta(d.NewSize-d.OldSize))
+}
+
+// diffFeedContents compares the RSS feed in old with the one in updated.
+func diffFeedContents(old, updated []byte) (*FeedDiff, error) {
+	oldChannel, err := parseDiffFeed(old)
+	if err != nil {
+		return nil, fmt.Errorf("old feed: %v", err)
+	}
+	newChannel, err := parseDiffFeed(updated)
+	if err != nil {
+		return nil, fmt.Errorf("new feed: %v", err)
+	}
+	return diffFeeds(oldChannel, newChannel), nil
+}
+
+// printFeedDiff prints how content differs from the feed at feedFile, under
+// the feed's path. A feed that doesn't exist yet has every item added.
+func printFeedDiff(w io.Writer, feedFile string, content []byte) error {
+	old, err := os.ReadFile(feedFile)
+	if os.IsNotExist(err) {
+		old = []byte("<rss><channel></channel></rss>")
+	} else if err != nil {
+		return err
+	}
+	d, err := diffFeedContents(old, content)
+	if err != nil {
+		return fmt.Errorf("--diff: %s: %v", feedFile, err)
+	}
+	fmt.Fprintf(w, "%s:\n", feedFile)
+	d.Print(w)
+	fmt.Fprintln(w)
+	return nil
+}
+
+// runDiff implements "bookast diff", which summarizes what changes between
+// two versions of an RSS feed.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff <old feed> <new feed>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 1
+	}
+
+	var contents [2][]byte
+	for i, source := range fs.Args() {
+		content, err := readFeedSource(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		contents[i] = content
+	}
+	d, err := diffFeedContents(contents[0], contents[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	d.Print(os.Stdout)
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffFeeds(t *testing.T) {
+	before := &diffChannel{Title: "Dune", Image: "https://example.com/dune/cover.jpg", Items: []diffItem{
+		{Title: "Chapter 1", GUID: "a", URL: "https://example.com/dune/01.mp3", Length: 1000},
+		{Title: "Chapter 2", GUID: "b", URL: "https://example.com/dune/02.mp3", Length: 2000},
+		{Title: "Chapter 3", GUID: "c", URL: "https://example.com/dune/03.mp3", Length: 3000},
+		{Title: "Chapter 4", GUID: "d", URL: "https://example.com/dune/04.mp3", Length: 4000},
+	}}
+	after := &diffChannel{Title: "Dune", Image: "https://example.com/dune/cover.jpg", Items: []diffItem{
+		{Title: "Chapter 1", GUID: "a", URL: "https://example.com/dune/01.mp3", Length: 1000},
+		{Title: "Chapter Two", GUID: "b", URL: "https://example.com/dune/02.mp3", Length: 2500},
+		{Title: "Chapter 3", GUID: "c2", URL: "https://example.com/dune/03.mp3", Length: 3000},
+		{Title: "Chapter 5", GUID: "e", URL: "https://example.com/dune/05.mp3", Length: 5000},
+	}}
+
+	var b strings.Builder
+	diffFeeds(before, after).Print(&b)
+	expected := `Added (1):
+  + Chapter 5 (4.9K)
+Removed (1):
+  - Chapter 4 (3.9K)
+GUID changed, subscribers get these again (1):
+  ! Chapter 3: c -> c2
+Changed (1):
+  ~ Chapter Two: title "Chapter 2" -> "Chapter Two", length 2000 -> 2500 (+500)
+Size: 9.8K -> 11.2K (+1.5K)
+`
+	if b.String() != expected {
+		t.Errorf("Print() =\n%s\nwant\n%s", b.String(), expected)
+	}
+}
+
+func TestDiffFeedsUnchanged(t *testing.T) {
+	content, err := os.ReadFile("testdata/audiobook1/golden.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := diffFeedContents(content, content)
+	if err != nil {
+		t.Fatalf("diffFeedContents() error = %v", err)
+	}
+	if !d.Empty() {
+		t.Errorf("diffFeedContents() of a feed with itself = %+v", d)
+	}
+}
+
+func TestPrintFeedDiffNewFeed(t *testing.T) {
+	content, err := os.ReadFile("testdata/audiobook1/golden.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedFile := filepath.Join(t.TempDir(), "podcast.rss")
+
+	var b strings.Builder
+	if err := printFeedDiff(&b, feedFile, content); err != nil {
+		t.Fatalf("printFeedDiff() error = %v", err)
+	}
+	if !strings.Contains(b.String(), "Added (3):\n  + Chapter One (16.8K)\n") {
+		t.Errorf("printFeedDiff() without a feed =\n%s", b.String())
+	}
+}
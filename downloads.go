@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// minDownloadRange is the least a ranged request from byte 0 must ask for
+// to count as a download. Apps probe with bytes=0-1 before downloading.
+const minDownloadRange = 64 << 10
+
+// DownloadCount is how often serve mode sent one of a book's files.
+type DownloadCount struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// countsAsDownload reports whether a request for an audio file starts a
+// download, rather than seeking within one or probing it: a GET for the
+// whole file, or a range from its start.
+func countsAsDownload(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	header := r.Header.Get("Range")
+	if header == "" {
+		return true
+	}
+	spec, ok := strings.CutPrefix(header, "bytes=0-")
+	if !ok || strings.Contains(spec, ",") {
+		return false
+	}
+	if spec == "" {
+		return true
+	}
+	end, err := strconv.ParseInt(spec, 10, 64)
+	return err == nil && end+1 >= minDownloadRange
+}
+
+// recordDownload counts a download of file, a slash-separated path in the
+// book in dir, in the book's state file.
+func recordDownload(dir string, file string, now time.Time) error {
+	state, err := loadBookState(dir)
+	if err != nil {
+		return err
+	}
+	if state.Downloads == nil {
+		state.Downloads = map[string]*DownloadCount{}
+	}
+	count := state.Downloads[file]
+	if count == nil {
+		count = &DownloadCount{}
+		state.Downloads[file] = count
+	}
+	count.Count++
+	count.Last = now.UTC().Truncate(time.Second)
+	return saveBookState(dir, state)
+}
+
+// bookDownloads is a book's download counts, for stats --downloads and
+// serve's /downloads.json.
+type bookDownloads struct {
+	Book      string             `json:"book"` // Path in the library, "Author/Book"
+	Downloads int                `json:"downloads"`
+	Last      time.Time          `json:"last"`
+	Episodes  []episodeDownloads `json:"episodes"`
+}
+
+type episodeDownloads struct {
+	File      string    `json:"file"`
+	Downloads int       `json:"downloads"`
+	Last      time.Time `json:"last"`
+}
+
+// libraryDownloads reads the download counts of books from their state
+// files, most downloaded first. Books never downloaded are left out.
+func libraryDownloads(books []libraryBook) ([]bookDownloads, error) {
+	var all []bookDownloads
+	for _, book := range books {
+		state, err := loadBookState(book.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", book.Dir, err)
+		}
+		if len(state.Downloads) == 0 {
+			continue
+		}
+		b := bookDownloads{Book: strings.Join(append(append([]string{}, book.Parent...), filepath.Base(filepath.Clean(book.Dir))), "/")}
+		for file, count := range state.Downloads {
+			b.Episodes = append(b.Episodes, episodeDownloads{File: file, Downloads: count.Count, Last: count.Last})
+			b.Downloads += count.Count
+			if count.Last.After(b.Last) {
+				b.Last = count.Last
+			}
+		}
+		sort.Slice(b.Episodes, func(i, j int) bool { return naturalLess(b.Episodes[i].File, b.Episodes[j].File) })
+		all = append(all, b)
+	}
+	slices.SortStableFunc(all, func(a, b bookDownloads) int { return b.Downloads - a.Downloads })
+	return all, nil
+}
+
+// writeDownloads prints a table of each book's downloads and its
+// episodes'.
+func writeDownloads(w io.Writer, books []bookDownloads) error {
+	if len(books) == 0 {
+		_, err := fmt.Fprintln(w, "Nothing downloaded from bookast serve yet")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOWNLOADS\tLAST\tBOOK")
+	total := 0
+	for _, book := range books {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", book.Downloads, book.Last.Local().Format("2006-01-02 15:04"), book.Book)
+		for _, episode := range book.Episodes {
+			fmt.Fprintf(tw, "%d\t%s\t  %s\n", episode.Downloads, episode.Last.Local().Format("2006-01-02 15:04"), episode.File)
+		}
+		total += book.Downloads
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%s of %s\n", plural(total, "download"), plural(len(books), "book"))
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountsAsDownload(t *testing.T) {
+	tests := []struct {
+		method string
+		rng    string
+		want   bool
+	}{
+		{http.MethodGet, "", true},
+		{http.MethodGet, "bytes=0-", true},
+		{http.MethodGet, "bytes=0-1048575", true},
+		{http.MethodGet, "bytes=0-1", false}, // Probe
+		{http.MethodGet, "bytes=1048576-", false},
+		{http.MethodGet, "bytes=0-99999,200000-", false},
+		{http.MethodHead, "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/Book/chapter01.mp3", nil)
+		if tt.rng != "" {
+			r.Header.Set("Range", tt.rng)
+		}
+		if got := countsAsDownload(r); got != tt.want {
+			t.Errorf("countsAsDownload(%s %q) = %v, want %v", tt.method, tt.rng, got, tt.want)
+		}
+	}
+}
+
+func TestLibraryDownloads(t *testing.T) {
+	root := t.TempDir()
+	dune := filepath.Join(root, "Frank Herbert", "Dune")
+	hobbit := filepath.Join(root, "J.R.R. Tolkien", "The Hobbit")
+	unread := filepath.Join(root, "Unread")
+	for _, dir := range []string{dune, hobbit, unread} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	when := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+	for _, d := range []struct {
+		dir, file string
+	}{
+		{hobbit, "chapter01.mp3"},
+		{dune, "part10.mp3"},
+		{dune, "part2.mp3"},
+		{dune, "part2.mp3"},
+	} {
+		if err := recordDownload(d.dir, d.file, when); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	books := []libraryBook{
+		{Dir: hobbit, Parent: []string{"J.R.R. Tolkien"}},
+		{Dir: dune, Parent: []string{"Frank Herbert"}},
+		{Dir: unread},
+	}
+	downloads, err := libraryDownloads(books)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloads) != 2 || downloads[0].Book != "Frank Herbert/Dune" || downloads[0].Downloads != 3 || downloads[1].Downloads != 1 {
+		t.Fatalf("libraryDownloads() = %+v, want Dune (3) then The Hobbit (1)", downloads)
+	}
+	episodes := downloads[0].Episodes
+	if len(episodes) != 2 || episodes[0].File != "part2.mp3" || episodes[0].Downloads != 2 || !episodes[0].Last.Equal(when) {
+		t.Errorf("Dune episodes = %+v, want part2.mp3 (2) first", episodes)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDownloads(&buf, downloads); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Frank Herbert/Dune", "  part10.mp3", "4 downloads of 2 books"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("writeDownloads() =\n%s\nwant %q", buf.String(), want)
+		}
+	}
+}
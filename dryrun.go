@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// dryRun collects the files --dry-run would have written instead of writing
+// them. It's nil, and files are written, on a normal run.
+var dryRun *dryRunPlan
+
+// plannedWrite is a file a dry run would have written.
+type plannedWrite struct {
+	Path   string
+	Size   int
+	New    bool // The file doesn't exist yet, rather than changing
+	FFmpeg bool // ffmpeg would make it, Size isn't known
+}
+
+type dryRunPlan struct {
+	mu     sync.Mutex
+	writes []plannedWrite
+}
+
+// add records that path would be written with size bytes.
+func (p *dryRunPlan) add(path string, size int) {
+	_, err := os.Stat(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writes = append(p.writes, plannedWrite{Path: path, Size: size, New: os.IsNotExist(err)})
+}
+
+// addFFmpeg records that ffmpeg would write path.
+func (p *dryRunPlan) addFFmpeg(path string) {
+	_, err := os.Stat(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writes = append(p.writes, plannedWrite{Path: path, New: os.IsNotExist(err), FFmpeg: true})
+}
+
+// Print lists the files that would have been written, in order.
+func (p *dryRunPlan) Print(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.writes) == 0 {
+		fmt.Fprintf(w, "\nDry run, every file is up to date\n")
+		return
+	}
+	fmt.Fprintf(w, "\nDry run, nothing was written. Would write %s:\n", plural(len(p.writes), "file"))
+	for _, write := range p.writes {
+		change := "changed"
+		if write.New {
+			change = "new"
+		}
+		if write.FFmpeg {
+			fmt.Fprintf(w, "  %s (%s, by ffmpeg)\n", write.Path, change)
+			continue
+		}
+		fmt.Fprintf(w, "  %s (%s, %s)\n", write.Path, change, formatByteSize(int64(write.Size)))
+	}
+}
+
+// planFFmpeg records that ffmpeg would write path in a dry run, and reports
+// whether this is one. ffmpeg isn't run then; the scan goes on with whatever
+// is at path already, and leaves the file out if there's nothing.
+func planFFmpeg(path string) bool {
+	if dryRun == nil {
+		return false
+	}
+	dryRun.addFFmpeg(path)
+	return true
+}
+
+// mkdirAll is os.MkdirAll, except in a dry run, whose files aren't written
+// anyway.
+func mkdirAll(path string) error {
+	if dryRun != nil {
+		return nil
+	}
+	return os.MkdirAll(path, 0755)
+}
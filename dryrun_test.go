@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFileIfChangedDryRun(t *testing.T) {
+	dryRun = &dryRunPlan{}
+	defer func() { dryRun = nil }()
+
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.json")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unchanged := filepath.Join(dir, "unchanged.json")
+	if err := os.WriteFile(unchanged, []byte("same"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, data := range map[string]string{
+		existing:                           "new",
+		unchanged:                          "same",
+		filepath.Join(dir, "missing.json"): "created",
+	} {
+		if err := writeFileIfChanged(path, []byte(data)); err != nil {
+			t.Fatalf("writeFileIfChanged(%s) error = %v", path, err)
+		}
+	}
+
+	if data, _ := os.ReadFile(existing); string(data) != "old" {
+		t.Errorf("%s = %q, want it left alone", existing, data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("missing.json was written in a dry run")
+	}
+
+	planned := map[string]bool{}
+	for _, write := range dryRun.writes {
+		planned[filepath.Base(write.Path)] = write.New
+	}
+	want := map[string]bool{"existing.json": false, "missing.json": true}
+	if !reflect.DeepEqual(planned, want) {
+		t.Errorf("planned writes = %v, want %v (new or not)", planned, want)
+	}
+}
+
+func TestPublishFeedDryRun(t *testing.T) {
+	dryRun = &dryRunPlan{}
+	defer func() { dryRun = nil }()
+
+	dir := t.TempDir()
+	copyFixture(t, dir, "chapter01.mp3")
+	copyFixture(t, dir, "chapter02.mp3")
+	before, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var diff bytes.Buffer
+	podcast, feedFile, err := publishFeed(dir, Options{Jobs: 1, NoCache: true}, feedFormats["rss"], time.Minute, &diff)
+	if err != nil {
+		t.Fatalf("publishFeed() error = %v", err)
+	}
+	if len(podcast.Episodes) != 2 {
+		t.Errorf("got %d episodes, want 2", len(podcast.Episodes))
+	}
+	if !strings.Contains(diff.String(), "Added (2)") {
+		t.Errorf("diff = %q, want both episodes added", diff.String())
+	}
+
+	// Neither the feed nor its lock is written
+	after, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("directory has %d entries after a dry run, want %d", len(after), len(before))
+	}
+
+	var out bytes.Buffer
+	dryRun.Print(&out)
+	if !strings.Contains(out.String(), feedFile+" (new, ") {
+		t.Errorf("Print() = %q, want %s listed as new", out.String(), feedFile)
+	}
+}
+
+func TestRunFFmpegDryRun(t *testing.T) {
+	dryRun = &dryRunPlan{}
+	defer func() { dryRun = nil }()
+
+	out := filepath.Join(t.TempDir(), "out.mp3")
+	err := runFFmpeg("-i", "in.mp3", out)
+	if err == nil || !strings.Contains(err.Error(), out) {
+		t.Errorf("runFFmpeg() error = %v, want one naming %s", err, out)
+	}
+}
+
+func TestFFmpegOutputsDryRun(t *testing.T) {
+	dryRun = &dryRunPlan{}
+	defer func() { dryRun = nil }()
+
+	dir := t.TempDir()
+	for _, name := range []string{"01.mp3", "book.aax"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A trailer older than its source is stale, but a dry run leaves it
+	// alone and publishes it as it is
+	trailer := filepath.Join(dir, trailerBaseName+".mp3")
+	if err := os.WriteFile(trailer, []byte("old trailer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(trailer, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := addTrailer(dir, []string{"01.mp3"}, time.Minute, "Book", &BookConfig{})
+	if err != nil {
+		t.Fatalf("addTrailer() error = %v", err)
+	}
+	if want := []string{trailerBaseName + ".mp3", "01.mp3"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("addTrailer() = %v, want %v", files, want)
+	}
+	if data, err := os.ReadFile(trailer); err != nil || string(data) != "old trailer" {
+		t.Errorf("stale trailer = %q, %v after a dry run, want it left alone", data, err)
+	}
+
+	// Files ffmpeg hasn't made yet are left out
+	segments, err := ensureSegments(dir, "01.mp3", "01-chapters", []Chapter{{Title: "One", End: time.Minute}, {Title: "Two", Start: time.Minute}})
+	if err != nil || len(segments) != 0 {
+		t.Errorf("ensureSegments() = %v, %v, want none", segments, err)
+	}
+	files, err = decryptAAX(dir, []string{"01.mp3", "book.aax"}, "1a2b3c4d")
+	if err != nil || !reflect.DeepEqual(files, []string{"01.mp3"}) {
+		t.Errorf("decryptAAX() = %v, %v, want [01.mp3]", files, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("directory has %d entries after a dry run, want 3", len(entries))
+	}
+	var out bytes.Buffer
+	dryRun.Print(&out)
+	for _, want := range []string{
+		trailer + " (changed, by ffmpeg)",
+		filepath.Join(dir, "01-chapters", segmentFilename(2, "Two", ".mp3")) + " (new, by ffmpeg)",
+		filepath.Join(dir, "book-decrypted", "book.m4b") + " (new, by ffmpeg)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Print() = %q, want it to list %q", out.String(), want)
+		}
+	}
+}
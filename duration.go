@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// DurationEstimate is a provider's answer for how long a file is, along with
+// how much that answer should be trusted (0 to 1).
+type DurationEstimate struct {
+	Duration   time.Duration
+	Confidence float64
+	Source     string
+}
+
+// DurationProvider is one way of finding out how long an audio file is.
+type DurationProvider interface {
+	Name() string
+	Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error)
+}
+
+// durationProviders are consulted in order until one is trusted; otherwise
+// the most confident answer wins. The native parsers come first so ffprobe
+// only runs for files they can't read with confidence.
+var durationProviders = []DurationProvider{
+	mp3Provider{},
+	mp4Provider{},
+	flacProvider{},
+	oggProvider{},
+	wavProvider{},
+	ffprobeProvider{},
+	ffmpegInfoProvider{},
+	aacProvider{},
+	tagLengthProvider{},
+}
+
+// nativeDurationProviders never shell out to ffprobe (--native-durations).
+var nativeDurationProviders = []DurationProvider{
+	mp3Provider{},
+	mp4Provider{},
+	flacProvider{},
+	oggProvider{},
+	wavProvider{},
+	aacProvider{},
+	tagLengthProvider{},
+}
+
+// requireDuration makes a file whose duration no provider can find an error
+// (--require-duration). By default it's published without itunes:duration.
+var requireDuration = false
+
+// trustedConfidence is the confidence at which resolveDuration stops asking
+// further providers.
+const trustedConfidence = 0.85
+
+// discrepancyThreshold is how far apart (as a fraction of the chosen
+// duration) two providers can be before the file is flagged.
+const discrepancyThreshold = 0.05
+
+// resolveDuration asks the providers in turn for the file's duration, until
+// one answers with trustedConfidence, and returns the most confident
+// estimate, along with all successful estimates so callers can report when
+// sources disagree.
+func resolveDuration(filePath string, metadata tag.Metadata, providers []DurationProvider) (DurationEstimate, []DurationEstimate, error) {
+	var best DurationEstimate
+	var candidates []DurationEstimate
+	var errs durationErrors
+
+	for _, p := range providers {
+		est, err := p.Duration(filePath, metadata)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		est.Source = p.Name()
+		candidates = append(candidates, est)
+		if len(candidates) == 1 || est.Confidence > best.Confidence {
+			best = est
+		}
+		if best.Confidence >= trustedConfidence {
+			break
+		}
+	}
+
+	if len(candidates) == 0 {
+		return DurationEstimate{}, nil, errs
+	}
+	return best, candidates, nil
+}
+
+// durationErrors is why each provider found no duration. errors.Is sees
+// through it, e.g. to a missing ffprobe.
+type durationErrors []error
+
+func (e durationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e durationErrors) Unwrap() []error { return e }
+
+// durationDiscrepancies describes the candidates that disagree with the
+// chosen estimate by more than discrepancyThreshold.
+func durationDiscrepancies(best DurationEstimate, candidates []DurationEstimate) []string {
+	var out []string
+	for _, c := range candidates {
+		if c.Source == best.Source {
+			continue
+		}
+		diff := (c.Duration - best.Duration).Abs()
+		if best.Duration > 0 && float64(diff)/float64(best.Duration) > discrepancyThreshold {
+			out = append(out, fmt.Sprintf("%s says %s, %s says %s", best.Source, formatDuration(best.Duration), c.Source, formatDuration(c.Duration)))
+		}
+	}
+	return out
+}
+
+// readNativeDuration opens the file at path and runs a native duration
+// parser over it.
+func readNativeDuration(path string, parse func(r io.ReaderAt, size int64) (time.Duration, error)) (time.Duration, error) {
+	defer timePhase(phaseNative)()
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return parse(f, info.Size())
+}
+
+// ffprobeProvider asks ffprobe, which decodes the container and is right for
+// just about everything.
+type ffprobeProvider struct{}
+
+func (ffprobeProvider) Name() string { return "ffprobe" }
+
+func (ffprobeProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	d, err := getDurationWithFFmpeg(filePath)
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+	return DurationEstimate{Duration: d, Confidence: 0.9}, nil
+}
+
+// ffmpegInfoProvider parses the "Duration:" line ffmpeg prints when asked
+// about a file, for systems with ffmpeg but no ffprobe.
+type ffmpegInfoProvider struct{}
+
+func (ffmpegInfoProvider) Name() string { return "ffmpeg" }
+
+func (ffmpegInfoProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return DurationEstimate{}, err
+	}
+	// Without an output file ffmpeg always exits with an error, after
+	// printing the input's details
+	output, err := runProbe(true, "ffmpeg", "-hide_banner", "-i", filePath)
+	if errors.Is(err, errProbeTimeout) {
+		return DurationEstimate{}, err
+	}
+	d, err := parseFFmpegDuration(string(output))
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+	return DurationEstimate{Duration: d, Confidence: 0.7}, nil
+}
+
+// parseFFmpegDuration finds the "Duration: HH:MM:SS.ss" of the first input
+// in ffmpeg's log output.
+func parseFFmpegDuration(output string) (time.Duration, error) {
+	i := strings.Index(output, "Duration: ")
+	if i < 0 {
+		return 0, errors.New("no duration in ffmpeg output")
+	}
+	value := output[i+len("Duration: "):]
+	if end := strings.IndexAny(value, ", \n"); end >= 0 {
+		value = value[:end]
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("unknown duration %q", value)
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, fmt.Errorf("unknown duration %q", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + secondsToDuration(seconds), nil
+}
+
+// tagLengthProvider reads the ID3v2 TLEN frame (milliseconds). Taggers often
+// leave it stale after re-encoding, so it's only a last resort.
+type tagLengthProvider struct{}
+
+func (tagLengthProvider) Name() string { return "tag" }
+
+func (tagLengthProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	if metadata == nil {
+		return DurationEstimate{}, errors.New("no tags")
+	}
+
+	raw := metadata.Raw()
+	for _, key := range []string{"TLEN", "TLE"} {
+		value, ok := raw[key].(string)
+		if !ok {
+			continue
+		}
+		ms, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || ms <= 0 {
+			return DurationEstimate{}, fmt.Errorf("invalid %s frame %q", key, value)
+		}
+		return DurationEstimate{Duration: time.Duration(ms) * time.Millisecond, Confidence: 0.4}, nil
+	}
+
+	return DurationEstimate{}, errors.New("no length tag")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+type fakeProvider struct {
+	name string
+	est  DurationEstimate
+	err  error
+}
+
+func (p fakeProvider) Name() string { return p.name }
+
+func (p fakeProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	return p.est, p.err
+}
+
+// fakeMetadata overrides Raw() and Format(); calling any other method panics.
+type fakeMetadata struct {
+	tag.Metadata
+	format tag.Format
+	raw    map[string]interface{}
+}
+
+func (m fakeMetadata) Raw() map[string]interface{} { return m.raw }
+func (m fakeMetadata) Format() tag.Format          { return m.format }
+
+func TestResolveDuration(t *testing.T) {
+	tests := []struct {
+		name           string
+		providers      []DurationProvider
+		expected       time.Duration
+		expectedSource string
+		candidates     int
+		wantErr        bool
+	}{
+		{
+			name: "most confident wins",
+			providers: []DurationProvider{
+				fakeProvider{name: "low", est: DurationEstimate{Duration: time.Minute, Confidence: 0.2}},
+				fakeProvider{name: "high", est: DurationEstimate{Duration: 2 * time.Minute, Confidence: 0.9}},
+			},
+			expected:       2 * time.Minute,
+			expectedSource: "high",
+			candidates:     2,
+		},
+		{
+			name: "failing providers are skipped",
+			providers: []DurationProvider{
+				fakeProvider{name: "broken", err: errors.New("boom")},
+				fakeProvider{name: "ok", est: DurationEstimate{Duration: time.Minute, Confidence: 0.5}},
+			},
+			expected:       time.Minute,
+			expectedSource: "ok",
+			candidates:     1,
+		},
+		{
+			name: "first wins ties",
+			providers: []DurationProvider{
+				fakeProvider{name: "first", est: DurationEstimate{Duration: time.Minute, Confidence: 0.5}},
+				fakeProvider{name: "second", est: DurationEstimate{Duration: time.Hour, Confidence: 0.5}},
+			},
+			expected:       time.Minute,
+			expectedSource: "first",
+			candidates:     2,
+		},
+		{
+			name: "trusted answer stops the search",
+			providers: []DurationProvider{
+				fakeProvider{name: "native", est: DurationEstimate{Duration: time.Minute, Confidence: trustedConfidence}},
+				fakeProvider{name: "ffprobe", est: DurationEstimate{Duration: time.Hour, Confidence: 0.9}},
+			},
+			expected:       time.Minute,
+			expectedSource: "native",
+			candidates:     1,
+		},
+		{
+			name: "all providers fail",
+			providers: []DurationProvider{
+				fakeProvider{name: "a", err: errors.New("a failed")},
+				fakeProvider{name: "b", err: errors.New("b failed")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			best, candidates, err := resolveDuration("file.mp3", nil, tt.providers)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("resolveDuration() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveDuration() error = %v", err)
+			}
+			if best.Duration != tt.expected {
+				t.Errorf("Duration = %v, want %v", best.Duration, tt.expected)
+			}
+			if best.Source != tt.expectedSource {
+				t.Errorf("Source = %q, want %q", best.Source, tt.expectedSource)
+			}
+			if len(candidates) != tt.candidates {
+				t.Errorf("len(candidates) = %d, want %d", len(candidates), tt.candidates)
+			}
+		})
+	}
+}
+
+func TestDurationDiscrepancies(t *testing.T) {
+	best := DurationEstimate{Duration: 100 * time.Second, Source: "ffprobe"}
+	candidates := []DurationEstimate{
+		best,
+		{Duration: 102 * time.Second, Source: "close"},
+		{Duration: 130 * time.Second, Source: "tag"},
+	}
+
+	result := durationDiscrepancies(best, candidates)
+	if len(result) != 1 {
+		t.Fatalf("durationDiscrepancies() = %v, want 1 entry", result)
+	}
+	expected := "ffprobe says 1:40, tag says 2:10"
+	if result[0] != expected {
+		t.Errorf("durationDiscrepancies()[0] = %q, want %q", result[0], expected)
+	}
+}
+
+func TestTagLengthProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      map[string]interface{}
+		expected time.Duration
+		wantErr  bool
+	}{
+		{
+			name:     "ID3v2.3 TLEN",
+			raw:      map[string]interface{}{"TLEN": "61500"},
+			expected: 61500 * time.Millisecond,
+		},
+		{
+			name:     "ID3v2.2 TLE",
+			raw:      map[string]interface{}{"TLE": "1000"},
+			expected: time.Second,
+		},
+		{
+			name:    "missing",
+			raw:     map[string]interface{}{"TIT2": "Title"},
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			raw:     map[string]interface{}{"TLEN": "about an hour"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			est, err := tagLengthProvider{}.Duration("file.mp3", fakeMetadata{raw: tt.raw})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Duration() = %v, want error", est.Duration)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Duration() error = %v", err)
+			}
+			if est.Duration != tt.expected {
+				t.Errorf("Duration() = %v, want %v", est.Duration, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseFFmpegDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{
+			name:     "mp3",
+			output:   "Input #0, mp3, from 'chapter01.mp3':\n  Duration: 01:02:03.45, start: 0.025057, bitrate: 64 kb/s\nAt least one output file must be specified\n",
+			expected: time.Hour + 2*time.Minute + 3450*time.Millisecond,
+		},
+		{name: "unknown", output: "  Duration: N/A, bitrate: N/A\n", wantErr: true},
+		{name: "not a media file", output: "chapter01.mp3: Invalid data found when processing input\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := parseFFmpegDuration(tt.output)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseFFmpegDuration() = %v, want error", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFFmpegDuration() error = %v", err)
+			}
+			if d != tt.expected {
+				t.Errorf("parseFFmpegDuration() = %v, want %v", d, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMissingDuration(t *testing.T) {
+	saved := durationProviders
+	defer func() {
+		durationProviders = saved
+		requireDuration = false
+	}()
+	durationProviders = []DurationProvider{fakeProvider{name: "ffprobe", err: errors.New("not installed")}}
+
+	filePath := "testdata/audiobook1/chapter01.mp3"
+	episode, err := processAudioFile(filePath, "https://example.com", "testdata/audiobook1", time.Now(), 1)
+	if err != nil {
+		t.Fatalf("processAudioFile() error = %v", err)
+	}
+	if episode.Duration != 0 {
+		t.Errorf("Duration = %v, want 0", episode.Duration)
+	}
+	found := false
+	for _, w := range episode.Warnings {
+		found = found || w.Category == warnMissingDuration
+	}
+	if !found {
+		t.Errorf("Warnings = %v, want a %s warning", episode.Warnings, warnMissingDuration)
+	}
+
+	requireDuration = true
+	if _, err := processAudioFile(filePath, "https://example.com", "testdata/audiobook1", time.Now(), 1); err == nil {
+		t.Error("processAudioFile() with --require-duration error = nil, want error")
+	}
+}
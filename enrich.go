@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metadataFile holds what "bookast enrich" found out about a book in an
+// online catalog, so feed generation never has to go online.
+const metadataFile = ".bookast-metadata.json"
+
+// BookQuery is what's known locally to look a book up by.
+type BookQuery struct {
+	Title    string
+	Authors  []string
+	ISBN     string // Digits only, "" if book.yaml has none
+	ASIN     string // Audible's product ID, "" if book.yaml has none
+	Language string // ISO 639-1 code from book.yaml, "" if it has none
+}
+
+// BookMetadata is a catalog's record of a book, the contents of
+// metadataFile.
+type BookMetadata struct {
+	Provider    string   `json:"provider"`
+	ID          string   `json:"id,omitempty"` // The book's key in the catalog
+	Title       string   `json:"title,omitempty"`
+	Authors     []string `json:"authors,omitempty"`
+	Narrators   []string `json:"narrators,omitempty"`
+	Series      string   `json:"series,omitempty"`
+	SeriesIndex string   `json:"seriesIndex,omitempty"`
+	Year        int      `json:"year,omitempty"`
+	Runtime     int      `json:"runtimeMinutes,omitempty"`
+	Description string   `json:"description,omitempty"`
+	CoverURL    string   `json:"coverUrl,omitempty"`
+}
+
+// overFolder returns folder with what the catalog knows instead, which is
+// more reliable than a directory name. A nil m changes nothing.
+func (m *BookMetadata) overFolder(folder FolderName) FolderName {
+	if m == nil {
+		return folder
+	}
+	if m.Title != "" {
+		folder.Title = m.Title
+	}
+	if len(m.Authors) > 0 {
+		folder.Author = strings.Join(m.Authors, "; ")
+	}
+	if m.Series != "" {
+		folder.Series = m.Series
+		folder.SeriesIndex = m.SeriesIndex
+	}
+	if m.Year > 0 {
+		folder.Year = m.Year
+	}
+	return folder
+}
+
+// runtimeMismatch describes how far the episodes' total duration is from
+// the catalog's runtime, "" if they're within 5% (or either is unknown).
+// A big difference means missing files or a different edition.
+func (m *BookMetadata) runtimeMismatch(episodes []Episode) string {
+	if m == nil || m.Runtime <= 0 {
+		return ""
+	}
+	var total time.Duration
+	for _, ep := range episodes {
+		if ep.Duration <= 0 {
+			return ""
+		}
+		if ep.EpisodeType != "trailer" {
+			total += ep.Duration
+		}
+	}
+	runtime := time.Duration(m.Runtime) * time.Minute
+	if diff := total - runtime; diff < -runtime/20 || diff > runtime/20 {
+		return fmt.Sprintf("episodes add up to %s, %s says the book runs %s", formatDuration(total), m.Provider, formatDuration(runtime))
+	}
+	return ""
+}
+
+// MetadataProvider is an online catalog books can be looked up in.
+type MetadataProvider interface {
+	Name() string
+	Lookup(query BookQuery) (*BookMetadata, error)
+}
+
+// metadataProviders are the catalogs "bookast enrich --provider" can use.
+var metadataProviders = map[string]MetadataProvider{
+	"openlibrary": &openLibrary{BaseURL: "https://openlibrary.org", CoversURL: "https://covers.openlibrary.org"},
+	"audible":     &audible{BaseURL: "https://api.audible.com"},
+	"googlebooks": &googleBooks{BaseURL: "https://www.googleapis.com/books/v1"},
+}
+
+var errBookNotFound = errors.New("book not found")
+
+// httpClient makes the catalog requests.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// httpGet fetches url, turning any status but 200 into an error
+// (errBookNotFound for 404).
+func httpGet(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Catalogs ask clients to identify themselves
+	req.Header.Set("User-Agent", generatorName())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errBookNotFound
+		}
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// getJSON decodes the JSON document at url into v.
+func getJSON(url string, v any) error {
+	resp, err := httpGet(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %v", url, err)
+	}
+	return nil
+}
+
+// loadBookMetadata reads the metadata file from dir. It returns nil if the
+// book hasn't been enriched.
+func loadBookMetadata(dir string) (*BookMetadata, error) {
+	content, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &BookMetadata{}
+	if err := json.Unmarshal(content, metadata); err != nil {
+		return nil, fmt.Errorf("%s: %v", metadataFile, err)
+	}
+	return metadata, nil
+}
+
+// saveBookMetadata writes the metadata file to dir.
+func saveBookMetadata(dir string, metadata *BookMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileIfChanged(filepath.Join(dir, metadataFile), append(data, '\n'))
+}
+
+// bookQuery builds the lookup for the book in dir: the title from the
+// directory name, the authors from book.yaml, the first file's tags or the
+// directory name, and the ISBN, ASIN and language from book.yaml. A
+// metadata.json or .nfo sidecar fills in for book.yaml and the directory name.
+func bookQuery(dir string, book *BookConfig) (BookQuery, error) {
+	sidecar, err := loadSidecar(dir)
+	if err != nil {
+		return BookQuery{}, err
+	}
+	sidecar.fillBook(book)
+	folder := sidecar.overFolder(parseFolderName(filepath.Base(filepath.Clean(dir))))
+	query := BookQuery{Title: folder.Title, Authors: book.Authors, ISBN: normalizeISBN(book.ISBN), ASIN: strings.ToUpper(strings.TrimSpace(book.ASIN))}
+	if lang, ok := normalizeLanguage(book.Language); ok {
+		query.Language, _, _ = strings.Cut(lang, "-")
+	}
+
+	if len(query.Authors) == 0 {
+		audioFiles, err := listAudioFiles(dir)
+		if err != nil {
+			return query, err
+		}
+		if len(audioFiles) > 0 {
+			if metadata := readTags(filepath.Join(dir, audioFiles[0])); metadata != nil {
+				query.Authors = tagAuthors(metadata)
+			}
+		}
+	}
+	if len(query.Authors) == 0 && folder.Author != "" {
+		query.Authors = splitNames(folder.Author)
+	}
+	return query, nil
+}
+
+// normalizeISBN drops the hyphens and spaces from an ISBN.
+func normalizeISBN(isbn string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		if r == 'x' || r == 'X' {
+			return 'X'
+		}
+		return -1
+	}, isbn)
+}
+
+// hasCoverImage reports whether dir has an image feed generation would use as
+// the cover.
+func hasCoverImage(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && coverImageExts[strings.ToLower(filepath.Ext(entry.Name()))] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// downloadCover saves the image at url as cover.jpg or cover.png in dir and
+// returns its name.
+func downloadCover(dir string, url string) (string, error) {
+	resp, err := httpGet(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var name string
+	switch resp.Header.Get("Content-Type") {
+	case "image/jpeg":
+		name = "cover.jpg"
+	case "image/png":
+		name = "cover.png"
+	default:
+		return "", fmt.Errorf("%s is %q, not a JPEG or PNG image", url, resp.Header.Get("Content-Type"))
+	}
+
+	// Written to a temporary name so a failed download isn't published
+	path := filepath.Join(dir, name)
+	partial := path + ".partial"
+	file, err := os.Create(partial)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	return name, os.Rename(partial, path)
+}
+
+// runEnrich implements "bookast enrich", which looks the book up in an online
+// catalog and keeps what it finds (metadataFile, and the cover unless the
+// book has one) for feed generation.
+func runEnrich(args []string) int {
+	fs := flag.NewFlagSet("enrich", flag.ContinueOnError)
+	var names []string
+	for name := range metadataProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	providerName := fs.String("provider", "openlibrary", "Catalog to look the book up in: "+strings.Join(names, ", "))
+	force := fs.Bool("force", false, "Look the book up again even if it was already enriched")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s enrich [flags] <directory>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	provider, ok := metadataProviders[*providerName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: --provider must be one of %s, not %q\n", strings.Join(names, ", "), *providerName)
+		return 1
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if gb, ok := provider.(*googleBooks); ok && gb.APIKey == "" {
+		configured := *gb
+		configured.APIKey = config.GoogleBooksAPIKey
+		provider = &configured
+	}
+
+	directory := fs.Arg(0)
+	if _, err := os.Stat(directory); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: Directory '%s' does not exist\n", directory)
+		return 1
+	}
+
+	existing, err := loadBookMetadata(directory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if existing != nil && !*force {
+		fmt.Printf("Already enriched from %s, use --force to look it up again\n", existing.Provider)
+		return 0
+	}
+
+	book, err := loadBookConfig(directory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	query, err := bookQuery(directory, book)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		return 1
+	}
+
+	metadata, err := provider.Lookup(query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", provider.Name(), err)
+		return 1
+	}
+	if err := saveBookMetadata(directory, metadata); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Found %q on %s, saved to %s\n", metadata.Title, provider.Name(), filepath.Join(directory, metadataFile))
+
+	if metadata.CoverURL == "" {
+		return 0
+	}
+	hasCover, err := hasCoverImage(directory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if hasCover {
+		fmt.Println("Kept the existing cover image")
+		return 0
+	}
+	cover, err := downloadCover(directory, metadata.CoverURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error downloading the cover: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Saved the cover as %s\n", filepath.Join(directory, cover))
+	return 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := map[string]string{
+		"978-0-547-92822-7": "9780547928227",
+		"0 261 10221 x":     "026110221X",
+		"":                  "",
+	}
+	for isbn, expected := range tests {
+		if got := normalizeISBN(isbn); got != expected {
+			t.Errorf("normalizeISBN(%q) = %q, want %q", isbn, got, expected)
+		}
+	}
+}
+
+func TestRunEnrich(t *testing.T) {
+	catalog := fakeOpenLibrary(t)
+	covers := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg"))
+	}))
+	defer covers.Close()
+
+	saved := metadataProviders["openlibrary"]
+	metadataProviders["openlibrary"] = &openLibrary{BaseURL: catalog.URL, CoversURL: covers.URL}
+	defer func() { metadataProviders["openlibrary"] = saved }()
+
+	dir := filepath.Join(t.TempDir(), "J.R.R. Tolkien - The Hobbit")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runEnrich([]string{dir}); code != 0 {
+		t.Fatalf("runEnrich() = %d, want 0", code)
+	}
+	metadata, err := loadBookMetadata(dir)
+	if err != nil || metadata == nil {
+		t.Fatalf("loadBookMetadata() = %v, %v", metadata, err)
+	}
+	if metadata.Description != "In a hole in the ground there lived a hobbit." {
+		t.Errorf("description = %q", metadata.Description)
+	}
+	if cover, err := os.ReadFile(filepath.Join(dir, "cover.jpg")); err != nil || string(cover) != "jpeg" {
+		t.Errorf("cover.jpg = %q, %v", cover, err)
+	}
+
+	// The feed uses the description when there's no description.txt
+	copyFixture(t, dir, "chapter01.mp3")
+	podcast, err := scanDirectory(dir, Options{BaseURL: "https://example.com", NoCache: true})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+	if podcast.Description != metadata.Description {
+		t.Errorf("Description = %q, want the enriched one", podcast.Description)
+	}
+
+	// Enriched books aren't looked up again, unknown ones are an error
+	metadataProviders["openlibrary"] = &openLibrary{BaseURL: "http://127.0.0.1:1"}
+	if code := runEnrich([]string{dir}); code != 0 {
+		t.Errorf("runEnrich() of an enriched book = %d, want 0", code)
+	}
+	if code := runEnrich([]string{"--force", dir}); code == 0 {
+		t.Error("runEnrich() --force with an unreachable catalog = 0, want failure")
+	}
+	if code := runEnrich([]string{"--provider", "nope", dir}); code == 0 {
+		t.Error("runEnrich() with an unknown provider = 0, want failure")
+	}
+}
+
+func TestBookMetadataOverFolder(t *testing.T) {
+	folder := parseFolderName("Sanderson - Mistborn 01 - Final Empire (2006)")
+
+	var none *BookMetadata
+	if got := none.overFolder(folder); got != folder {
+		t.Errorf("nil overFolder() = %+v, want %+v", got, folder)
+	}
+
+	metadata := &BookMetadata{Title: "The Final Empire", Authors: []string{"Brandon Sanderson"}}
+	expected := FolderName{Author: "Brandon Sanderson", Series: "Mistborn", SeriesIndex: "1", Title: "The Final Empire", Year: 2006}
+	if got := metadata.overFolder(folder); got != expected {
+		t.Errorf("overFolder() = %+v, want %+v", got, expected)
+	}
+}
+
+func TestBookMetadataRuntimeMismatch(t *testing.T) {
+	metadata := &BookMetadata{Provider: "audible", Runtime: 100}
+	episodes := []Episode{{Duration: 50 * time.Minute}, {Duration: 48 * time.Minute}}
+	if got := metadata.runtimeMismatch(episodes); got != "" {
+		t.Errorf("runtimeMismatch() within 5%% = %q, want none", got)
+	}
+
+	episodes = episodes[:1]
+	if got := metadata.runtimeMismatch(episodes); got != "episodes add up to 50:00, audible says the book runs 1:40:00" {
+		t.Errorf("runtimeMismatch() = %q", got)
+	}
+
+	episodes = append(episodes, Episode{})
+	if got := metadata.runtimeMismatch(episodes); got != "" {
+		t.Errorf("runtimeMismatch() with an unknown duration = %q, want none", got)
+	}
+}
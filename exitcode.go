@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Exit codes of feed generation. They're stable, so scripts can tell
+// failures apart without reading stderr.
+const (
+	exitOK          = 0
+	exitError       = 1 // Anything not listed below
+	exitNoAudio     = 2 // No audio files to publish, or every one was left out
+	exitSkipped     = 3 // Feeds were written, but --skip-errors left out files that couldn't be read
+	exitMissingTool = 4 // ffprobe or ffmpeg is needed and isn't installed
+	exitUnreadable  = 5 // An audio file couldn't be read (without --skip-errors)
+	exitLocked      = 6 // Another host holds the feed lock
+	exitUsage       = 7 // Bad flags or arguments
+)
+
+var (
+	errNoAudio    = errors.New("No audio files found")
+	errProcessing = errors.New("failed to process")
+)
+
+// exitCode returns the exit code for a failure to publish a feed.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return exitMissingTool
+	case errors.Is(err, errNoAudio):
+		return exitNoAudio
+	case errors.Is(err, errFeedLocked):
+		return exitLocked
+	case errors.Is(err, errProcessing):
+		return exitUnreadable
+	}
+	return exitError
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	noFFprobe := durationErrors{
+		errors.New("native: no frames"),
+		fmt.Errorf("ffprobe: ffprobe failed: %w", &exec.Error{Name: "ffprobe", Err: exec.ErrNotFound}),
+	}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"no audio", fmt.Errorf("%w in directory 'book'", errNoAudio), exitNoAudio},
+		{"unreadable", fmt.Errorf("scanning directory: %w", fmt.Errorf("%w a.mp3: %w", errProcessing, errCorrupt)), exitUnreadable},
+		{"ffprobe missing", fmt.Errorf("scanning directory: %w", fmt.Errorf("%w a.wma: %w", errProcessing, fmt.Errorf("failed to get duration: %w", noFFprobe))), exitMissingTool},
+		{"ffmpeg missing", fmt.Errorf("failed to split a.m4b: %w", &exec.Error{Name: "ffmpeg", Err: exec.ErrNotFound}), exitMissingTool},
+		{"locked", fmt.Errorf("%w: host (pid 1) holds podcast.rss.lock", errFeedLocked), exitLocked},
+		{"other", errors.New("permission denied"), exitError},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDurationErrorsMessage(t *testing.T) {
+	err := durationErrors{errors.New("native: no frames"), errors.New("ffprobe: not found")}
+	if got, want := err.Error(), "native: no frames; ffprobe: not found"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
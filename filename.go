@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// filenameMarkers find chapter and part numbers in filenames, wherever the
+// ripper put them.
+var filenameMarkers = []struct {
+	re    *regexp.Regexp
+	label string
+}{
+	// "BookTitle_Ch07", "Chap. 7", "chapter-07"
+	{regexp.MustCompile(`(?i)(?:^|[\s._-])(?:ch|chap|chapter)\.?[\s._-]*(\d{1,4})(?:$|[\s._-])`), "Chapter"},
+	// "Part 2 of 12", "Pt02", "book_part_2"
+	{regexp.MustCompile(`(?i)(?:^|[\s._-])(?:pt|part)\.?[\s._-]*(\d{1,4})(?:[\s._-]*of[\s._-]*\d{1,4})?(?:$|[\s._-])`), "Part"},
+}
+
+// titleFromFilename makes an episode title from the name of an untagged
+// file. Underscores become spaces, and a chapter or part marker becomes
+// "Chapter 7"/"Part 2", dropping whatever came before it (usually the book
+// title), unless a title follows it. Leading track numbers are left for
+// cleanTitle.
+func titleFromFilename(filename string) string {
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	name = strings.Join(strings.Fields(strings.ReplaceAll(name, "_", " ")), " ")
+
+	for _, marker := range filenameMarkers {
+		m := marker.re.FindStringSubmatchIndex(name)
+		if m == nil {
+			continue
+		}
+		if rest := strings.TrimLeft(name[m[1]:], " -–—._:"); rest != "" && !isDigits(rest) {
+			return rest
+		}
+		n, _ := strconv.Atoi(name[m[2]:m[3]])
+		return fmt.Sprintf("%s %d", marker.label, n)
+	}
+	return name
+}
+
+// naturalLess orders filenames with runs of digits compared as numbers, so
+// "Part 2 of 12" comes before "Part 10 of 12" even without zero padding.
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x := strings.TrimLeft(a[si:i], "0")
+			y := strings.TrimLeft(b[sj:j], "0")
+			if len(x) != len(y) {
+				return len(x) < len(y)
+			}
+			if x != y {
+				return x < y
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	// Equal apart from zero padding
+	return a < b
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// sortFilenames sorts filenames in natural order.
+func sortFilenames(filenames []string) {
+	sort.Slice(filenames, func(i, j int) bool { return naturalLess(filenames[i], filenames[j]) })
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTitleFromFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"01 - The Beginning.mp3", "01 - The Beginning"},
+		{"BookTitle_Ch07.mp3", "Chapter 7"},
+		{"Mistborn - Chapter 12 - The Well of Ascension.mp3", "The Well of Ascension"},
+		{"Chap. 3.m4a", "Chapter 3"},
+		{"Part 2 of 12.mp3", "Part 2"},
+		{"the_hobbit_pt03.mp3", "Part 3"},
+		{"The_Long_Road.mp3", "The Long Road"},
+		{"Chapterhouse Dune.mp3", "Chapterhouse Dune"},
+		{"Particle Physics.mp3", "Particle Physics"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := titleFromFilename(tt.filename); got != tt.expected {
+				t.Errorf("titleFromFilename(%q) = %q, want %q", tt.filename, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSortFilenames(t *testing.T) {
+	filenames := []string{"Part 10 of 12.mp3", "Part 2 of 12.mp3", "Part 1 of 12.mp3", "Book_Ch10.mp3", "Book_Ch9.mp3", "01.mp3", "1.mp3", "intro.mp3"}
+	sortFilenames(filenames)
+
+	expected := []string{"01.mp3", "1.mp3", "Book_Ch9.mp3", "Book_Ch10.mp3", "Part 1 of 12.mp3", "Part 2 of 12.mp3", "Part 10 of 12.mp3", "intro.mp3"}
+	if !reflect.DeepEqual(filenames, expected) {
+		t.Errorf("sortFilenames() = %v, want %v", filenames, expected)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteSizeUnits are the suffixes parseByteSize understands, in powers of
+// 1024 like ls -h and du -h.
+var byteSizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+}
+
+// parseByteSize parses a size such as 512, 100k, 1.5M or 2GB.
+func parseByteSize(s string) (int64, error) {
+	lower := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "b")
+	number := strings.TrimRight(lower, "kmg")
+	unit, ok := byteSizeUnits[lower[len(number):]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// formatByteSize formats n the way parseByteSize reads it back: 512, 100K,
+// 1.5M, 2.1G.
+func formatByteSize(n int64) string {
+	for _, unit := range []string{"g", "m", "k"} {
+		if size := byteSizeUnits[unit]; n >= size {
+			return strconv.FormatFloat(float64(n)/float64(size), 'f', 1, 64) + strings.ToUpper(unit)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// tooSmall is why a file of size bytes is left out under --min-size, or ""
+// if it isn't.
+func tooSmall(size int64, minSize int64) string {
+	if minSize <= 0 || size >= minSize {
+		return ""
+	}
+	return fmt.Sprintf("%s, smaller than --min-size %d", plural(int(size), "byte"), minSize)
+}
+
+// tooShort is why an episode lasting d is left out under --min-duration, or
+// "" if it isn't. Files whose duration is unknown are kept.
+func tooShort(d time.Duration, minDuration time.Duration) string {
+	if minDuration <= 0 || d <= 0 || d >= minDuration {
+		return ""
+	}
+	return fmt.Sprintf("%s long, shorter than --min-duration %s", d.Round(time.Millisecond), minDuration)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{"512", 512, false},
+		{"100k", 100 << 10, false},
+		{"1.5M", 3 << 19, false},
+		{"2GB", 2 << 30, false},
+		{"10kb", 10 << 10, false},
+		{"", 0, true},
+		{"k", 0, true},
+		{"-1k", 0, true},
+		{"5 tons", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			size, err := parseByteSize(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseByteSize(%q) = %d, want error", tt.input, size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseByteSize(%q) error = %v", tt.input, err)
+			}
+			if size != tt.expected {
+				t.Errorf("parseByteSize(%q) = %d, want %d", tt.input, size, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	tests := map[int64]string{
+		0:             "0",
+		512:           "512",
+		100 << 10:     "100.0K",
+		3 << 19:       "1.5M",
+		2<<30 + 1<<28: "2.2G",
+	}
+	for n, expected := range tests {
+		if got := formatByteSize(n); got != expected {
+			t.Errorf("formatByteSize(%d) = %q, want %q", n, got, expected)
+		}
+	}
+}
+
+func TestScanDirectoryMinimums(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	copyFixture(t, dir, "chapter02.mp3")
+	copyFixture(t, dir, "chapter03.m4a")
+	if err := os.WriteFile(filepath.Join(dir, "chapter00.mp3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	podcast, err := scanDirectory(dir, Options{BaseURL: "https://example.com", NoCache: true, MinSize: 1, MinDuration: 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+
+	skipped := map[string]bool{}
+	for _, s := range podcast.Skipped {
+		skipped[filepath.Base(s.File)] = true
+	}
+	if len(skipped) != 2 || !skipped["chapter00.mp3"] || !skipped["chapter01.mp3"] {
+		t.Errorf("Skipped = %+v, want the empty file and the 1s chapter", podcast.Skipped)
+	}
+	if len(podcast.Episodes) != 2 || podcast.Episodes[0].EpisodeNum != 1 {
+		t.Errorf("got %d episodes, the first numbered %d; want 2, numbered from 1", len(podcast.Episodes), podcast.Episodes[0].EpisodeNum)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// flacDuration reads the STREAMINFO block every FLAC stream starts with,
+// which records the sample rate and total number of samples.
+func flacDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	// Some taggers put ID3v2 in front of the fLaC marker
+	offset := skipID3v2(r, size)
+
+	var hdr [8]byte
+	if _, err := r.ReadAt(hdr[:], offset); err != nil {
+		return 0, err
+	}
+	if string(hdr[:4]) != "fLaC" {
+		return 0, errors.New("no fLaC marker")
+	}
+	// The first metadata block must be STREAMINFO (type 0), 34 bytes
+	if hdr[4]&0x7F != 0 {
+		return 0, errors.New("first metadata block is not STREAMINFO")
+	}
+
+	var info [34]byte
+	if _, err := r.ReadAt(info[:], offset+8); err != nil {
+		return 0, err
+	}
+	sampleRate := uint64(info[10])<<12 | uint64(info[11])<<4 | uint64(info[12])>>4
+	samples := uint64(info[13]&0x0F)<<32 | uint64(info[14])<<24 | uint64(info[15])<<16 | uint64(info[16])<<8 | uint64(info[17])
+	if sampleRate == 0 {
+		return 0, errors.New("STREAMINFO has no sample rate")
+	}
+	// Encoders streaming to a pipe can't go back and fill in the count
+	if samples == 0 {
+		return 0, errors.New("STREAMINFO has no sample count")
+	}
+	return secondsToDuration(float64(samples) / float64(sampleRate)), nil
+}
+
+// flacProvider is the native FLAC parser exposed as a DurationProvider.
+type flacProvider struct{}
+
+func (flacProvider) Name() string { return "native" }
+
+func (flacProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	if strings.ToLower(filepath.Ext(filePath)) != ".flac" {
+		return DurationEstimate{}, errors.New("not a FLAC file")
+	}
+
+	d, err := readNativeDuration(filePath, flacDuration)
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+	return DurationEstimate{Duration: d, Confidence: 0.9}, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// flacStream builds a fLaC marker and STREAMINFO block.
+func flacStream(sampleRate uint32, samples uint64) []byte {
+	info := make([]byte, 34)
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	info[12] = byte(sampleRate<<4) | 0x02 // 2 channels
+	info[13] = 0xF0 | byte(samples>>32)   // 16 bits per sample
+	info[14] = byte(samples >> 24)
+	info[15] = byte(samples >> 16)
+	info[16] = byte(samples >> 8)
+	info[17] = byte(samples)
+
+	b := []byte("fLaC")
+	b = append(b, 0x80, 0, 0, 34) // last block, STREAMINFO, 34 bytes
+	return append(b, info...)
+}
+
+func TestFLACDuration(t *testing.T) {
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x0A"), make([]byte, 10)...)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"44.1kHz", flacStream(44100, 44100*125), 125 * time.Second, false},
+		{"long 96kHz", flacStream(96000, 96000*3600*20), 20 * time.Hour, false},
+		{"after ID3v2", append(id3, flacStream(48000, 24000)...), 500 * time.Millisecond, false},
+		{"unknown length", flacStream(44100, 0), 0, true},
+		{"not flac", []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00"), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := flacDuration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("flacDuration() = %v, want error", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("flacDuration() error = %v", err)
+			}
+			if d != tt.expected {
+				t.Errorf("flacDuration() = %v, want %v", d, tt.expected)
+			}
+		})
+	}
+}
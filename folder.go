@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FolderName is what a book directory's name says about the book, in the
+// "Author - Series 01 - Title (Year)" convention most library managers use.
+// Fields the name doesn't have are empty.
+type FolderName struct {
+	Author      string
+	Series      string
+	SeriesIndex string // "1", "2.5"; leading zeros dropped
+	Title       string
+	Year        int
+	Narrator    string // Only library layouts name narrators
+}
+
+var (
+	// "The Final Empire (2006)", "The Final Empire [2006]"
+	folderYearRe = regexp.MustCompile(`\s*[(\[]((?:1[5-9]|20)\d\d)[)\]]$`)
+	// "Mistborn 01", "Mistborn, Book 1", "Mistborn #2.5", "Mistborn Vol. 3"
+	seriesIndexRe = regexp.MustCompile(`(?i)^(.*?)[\s,]*(?:\b(?:book|vol\.?|volume)\s*|#\s*)?(\d{1,3}(?:\.\d+)?)$`)
+)
+
+// parseFolderName splits a directory name into its parts:
+//
+//	Brandon Sanderson - Mistborn 01 - The Final Empire (2006)
+//	Brandon Sanderson - Mistborn - 01 - The Final Empire
+//	Mistborn 01 - The Final Empire
+//	Brandon Sanderson - The Final Empire
+//	The Final Empire
+//
+// Two parts are "Author - Title" unless the first ends in a number, which
+// makes it a series. Underscores count as spaces.
+func parseFolderName(name string) FolderName {
+	var folder FolderName
+	name = strings.Join(strings.Fields(strings.ReplaceAll(name, "_", " ")), " ")
+
+	if m := folderYearRe.FindStringSubmatchIndex(name); m != nil && m[0] > 0 {
+		folder.Year, _ = strconv.Atoi(name[m[2]:m[3]])
+		name = name[:m[0]]
+	}
+
+	var parts []string
+	for _, part := range strings.Split(name, " - ") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		return folder
+	case 1:
+		folder.Title = parts[0]
+		return folder
+	case 2:
+		folder.Title = parts[1]
+		if series, index, ok := splitSeriesIndex(parts[0]); ok && series != "" {
+			folder.Series, folder.SeriesIndex = series, index
+		} else {
+			folder.Author = parts[0]
+		}
+		return folder
+	}
+
+	folder.Author = parts[0]
+	folder.Title = parts[len(parts)-1]
+	series := strings.Join(parts[1:len(parts)-1], " ")
+	if s, index, ok := splitSeriesIndex(series); ok {
+		series = s
+		folder.SeriesIndex = index
+	}
+	folder.Series = series
+	return folder
+}
+
+// splitSeriesIndex splits "Mistborn 01" into "Mistborn" and "1".
+func splitSeriesIndex(s string) (series, index string, ok bool) {
+	m := seriesIndexRe.FindStringSubmatch(s)
+	if m == nil {
+		return s, "", false
+	}
+	index = strings.TrimLeft(m[2], "0")
+	if index == "" || index[0] == '.' {
+		index = "0" + index
+	}
+	return strings.TrimSpace(m[1]), index, true
+}
+
+// folderCopyright is the default copyright notice, "© 2006 Brandon
+// Sanderson", when the directory name has the year and the book has authors.
+func folderCopyright(year int, people []Person) string {
+	var authors []string
+	for _, p := range people {
+		if p.Role == roleAuthor {
+			authors = append(authors, p.Name)
+		}
+	}
+	if year == 0 || len(authors) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("© %d %s", year, strings.Join(authors, ", "))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseFolderName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected FolderName
+	}{
+		{"Brandon Sanderson - Mistborn 01 - The Final Empire (2006)", FolderName{Author: "Brandon Sanderson", Series: "Mistborn", SeriesIndex: "1", Title: "The Final Empire", Year: 2006}},
+		{"Brandon Sanderson - Mistborn - 01 - The Final Empire", FolderName{Author: "Brandon Sanderson", Series: "Mistborn", SeriesIndex: "1", Title: "The Final Empire"}},
+		{"Brandon Sanderson - Mistborn, Book 2.5 - The Eleventh Metal [2011]", FolderName{Author: "Brandon Sanderson", Series: "Mistborn", SeriesIndex: "2.5", Title: "The Eleventh Metal", Year: 2011}},
+		{"Frank Herbert - Dune Chronicles #3 - Children of Dune", FolderName{Author: "Frank Herbert", Series: "Dune Chronicles", SeriesIndex: "3", Title: "Children of Dune"}},
+		{"Ursula K. Le Guin - Earthsea - A Wizard of Earthsea", FolderName{Author: "Ursula K. Le Guin", Series: "Earthsea", Title: "A Wizard of Earthsea"}},
+		{"Mistborn 01 - The Final Empire", FolderName{Series: "Mistborn", SeriesIndex: "1", Title: "The Final Empire"}},
+		{"George Orwell - 1984", FolderName{Author: "George Orwell", Title: "1984"}},
+		{"The_Hobbit (1937)", FolderName{Title: "The Hobbit", Year: 1937}},
+		{"audiobook1", FolderName{Title: "audiobook1"}},
+		{"(2006)", FolderName{Title: "(2006)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseFolderName(tt.name); got != tt.expected {
+				t.Errorf("parseFolderName(%q) = %+v, want %+v", tt.name, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFolderCopyright(t *testing.T) {
+	people := []Person{{"Michael Kramer", roleNarrator}, {"Brandon Sanderson", roleAuthor}}
+	if got := folderCopyright(2006, people); got != "© 2006 Brandon Sanderson" {
+		t.Errorf("folderCopyright() = %q", got)
+	}
+	if got := folderCopyright(0, people); got != "" {
+		t.Errorf("folderCopyright() without a year = %q, want none", got)
+	}
+	if got := folderCopyright(2006, people[:1]); got != "" {
+		t.Errorf("folderCopyright() without authors = %q, want none", got)
+	}
+}
@@ -15,8 +15,16 @@ go build -o bookast
 # Move the generated RSS to golden file
 mv testdata/audiobook1/podcast.rss testdata/audiobook1/golden.rss
 
-echo "Golden file created: testdata/audiobook1/golden.rss"
-echo "Review the file to ensure it's correct, then commit it."
+# Same book as Atom
+./bookast --base-url https://example.com/audiobooks --format atom testdata/audiobook1
+mv testdata/audiobook1/podcast.atom testdata/audiobook1/golden.atom
+
+# And as JSON Feed
+./bookast --base-url https://example.com/audiobooks --format jsonfeed testdata/audiobook1
+mv testdata/audiobook1/podcast.json testdata/audiobook1/golden.json
+
+echo "Golden files created: testdata/audiobook1/golden.rss, golden.atom and golden.json"
+echo "Review the files to ensure they're correct, then commit them."
 
 # Clean up binary
 rm bookast
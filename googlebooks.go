@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// googleBooksImageSizes are the imageLinks keys of a volume, largest first.
+var googleBooksImageSizes = []string{"extraLarge", "large", "medium", "small", "thumbnail"}
+
+// googleBooks looks books up in Google Books, which covers more non-English
+// editions than Open Library. The API key (google-books-api-key in the
+// config file) is optional but raises the quota.
+type googleBooks struct {
+	BaseURL string
+	APIKey  string
+}
+
+func (g *googleBooks) Name() string { return "Google Books" }
+
+func (g *googleBooks) Lookup(query BookQuery) (*BookMetadata, error) {
+	var q string
+	switch {
+	case query.ISBN != "":
+		q = "isbn:" + query.ISBN
+	case query.Title != "":
+		q = "intitle:" + query.Title
+		if len(query.Authors) > 0 {
+			q += " inauthor:" + query.Authors[0]
+		}
+	default:
+		return nil, fmt.Errorf("no title or ISBN to look up")
+	}
+
+	params := url.Values{"q": {q}, "maxResults": {"1"}}
+	if query.Language != "" && query.ISBN == "" {
+		params.Set("langRestrict", query.Language)
+	}
+	var search struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	if err := getJSON(g.url("/volumes", params), &search); err != nil {
+		return nil, err
+	}
+	if len(search.Items) == 0 {
+		return nil, errBookNotFound
+	}
+
+	// Search results only link thumbnails, the volume has the large covers
+	var volume struct {
+		ID   string `json:"id"`
+		Info struct {
+			Title         string            `json:"title"`
+			Authors       []string          `json:"authors"`
+			PublishedDate string            `json:"publishedDate"`
+			Description   string            `json:"description"`
+			ImageLinks    map[string]string `json:"imageLinks"`
+		} `json:"volumeInfo"`
+	}
+	if err := getJSON(g.url("/volumes/"+url.PathEscape(search.Items[0].ID), url.Values{}), &volume); err != nil {
+		return nil, err
+	}
+
+	metadata := &BookMetadata{
+		Provider:    "googlebooks",
+		ID:          volume.ID,
+		Title:       volume.Info.Title,
+		Authors:     volume.Info.Authors,
+		Description: strings.TrimSpace(volume.Info.Description),
+	}
+	if len(volume.Info.PublishedDate) >= 4 {
+		metadata.Year, _ = strconv.Atoi(volume.Info.PublishedDate[:4])
+	}
+	for _, size := range googleBooksImageSizes {
+		if image := volume.Info.ImageLinks[size]; image != "" {
+			// Google links covers over plain http, which it serves over https too
+			metadata.CoverURL = strings.Replace(image, "http://", "https://", 1)
+			break
+		}
+	}
+	return metadata, nil
+}
+
+// url builds an API URL, adding the key if there is one.
+func (g *googleBooks) url(path string, params url.Values) string {
+	if g.APIKey != "" {
+		params.Set("key", g.APIKey)
+	}
+	if len(params) == 0 {
+		return g.BaseURL + path
+	}
+	return g.BaseURL + path + "?" + params.Encode()
+}
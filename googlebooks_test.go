@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGoogleBooksLookup(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		switch r.URL.Path {
+		case "/volumes":
+			q := r.URL.Query().Get("q")
+			if q == "isbn:9783608938289" || q == "intitle:Der Hobbit inauthor:J.R.R. Tolkien" {
+				w.Write([]byte(`{"totalItems": 1, "items": [{"id": "vol1", "volumeInfo": {"title": "Der Hobbit"}}]}`))
+				return
+			}
+			w.Write([]byte(`{"totalItems": 0}`))
+		case "/volumes/vol1":
+			w.Write([]byte(`{"id": "vol1", "volumeInfo": {
+				"title": "Der Hobbit",
+				"authors": ["J.R.R. Tolkien"],
+				"publishedDate": "2012-11",
+				"description": "Bilbo Beutlin ist ein Hobbit.",
+				"imageLinks": {"thumbnail": "http://books.google.com/t.jpg", "large": "http://books.google.com/l.jpg"}
+			}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	g := &googleBooks{BaseURL: server.URL, APIKey: "secret"}
+
+	expected := &BookMetadata{
+		Provider:    "googlebooks",
+		ID:          "vol1",
+		Title:       "Der Hobbit",
+		Authors:     []string{"J.R.R. Tolkien"},
+		Year:        2012,
+		Description: "Bilbo Beutlin ist ein Hobbit.",
+		CoverURL:    "https://books.google.com/l.jpg",
+	}
+	for _, query := range []BookQuery{
+		{ISBN: "9783608938289"},
+		{Title: "Der Hobbit", Authors: []string{"J.R.R. Tolkien"}, Language: "de"},
+	} {
+		got, err := g.Lookup(query)
+		if err != nil {
+			t.Fatalf("Lookup(%+v) error = %v", query, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Lookup(%+v) = %+v, want %+v", query, got, expected)
+		}
+	}
+
+	// The title search is limited to the book's language, and every request
+	// carries the key
+	expectedQueries := []string{
+		"key=secret&maxResults=1&q=isbn%3A9783608938289",
+		"key=secret",
+		"key=secret&langRestrict=de&maxResults=1&q=intitle%3ADer+Hobbit+inauthor%3AJ.R.R.+Tolkien",
+		"key=secret",
+	}
+	if !reflect.DeepEqual(queries, expectedQueries) {
+		t.Errorf("queries = %q, want %q", queries, expectedQueries)
+	}
+
+	if _, err := g.Lookup(BookQuery{Title: "Nothing Like It"}); !errors.Is(err, errBookNotFound) {
+		t.Errorf("Lookup() of an unknown book error = %v, want errBookNotFound", err)
+	}
+}
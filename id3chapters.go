@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/dhowden/tag"
+)
+
+// id3Chapter is a parsed ID3v2 CHAP frame.
+type id3Chapter struct {
+	ID    string
+	Start time.Duration
+	End   time.Duration
+	Title string
+}
+
+// id3TOC is a parsed ID3v2 CTOC frame.
+type id3TOC struct {
+	ID       string
+	TopLevel bool
+	Children []string
+}
+
+// id3Chapters reads the ID3v2 chapter frames (CHAP, ordered by CTOC when
+// there is one) from metadata. It returns nil for other tag formats.
+func id3Chapters(metadata tag.Metadata) ([]Chapter, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	format := metadata.Format()
+	if format != tag.ID3v2_3 && format != tag.ID3v2_4 {
+		return nil, nil
+	}
+
+	byID := map[string]id3Chapter{}
+	var chaps []id3Chapter
+	var tocs []id3TOC
+	for key, value := range metadata.Raw() {
+		data, ok := value.([]byte)
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "CHAP" || strings.HasPrefix(key, "CHAP_"):
+			c, err := parseCHAP(data, format)
+			if err != nil {
+				return nil, err
+			}
+			byID[c.ID] = c
+			chaps = append(chaps, c)
+		case key == "CTOC" || strings.HasPrefix(key, "CTOC_"):
+			toc, err := parseCTOC(data)
+			if err != nil {
+				return nil, err
+			}
+			tocs = append(tocs, toc)
+		}
+	}
+	if len(chaps) == 0 {
+		return nil, nil
+	}
+
+	// The top-level table of contents gives the order; without one (or when
+	// it doesn't list every chapter) fall back to start times
+	var ordered []id3Chapter
+	for _, toc := range tocs {
+		if !toc.TopLevel {
+			continue
+		}
+		for _, id := range toc.Children {
+			if c, ok := byID[id]; ok {
+				ordered = append(ordered, c)
+			}
+		}
+	}
+	if len(ordered) != len(chaps) {
+		ordered = chaps
+		sort.SliceStable(ordered, func(i, j int) bool {
+			if ordered[i].Start != ordered[j].Start {
+				return ordered[i].Start < ordered[j].Start
+			}
+			return ordered[i].ID < ordered[j].ID
+		})
+	}
+
+	chapters := make([]Chapter, 0, len(ordered))
+	for i, c := range ordered {
+		title := c.Title
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		chapters = append(chapters, Chapter{Start: c.Start, End: c.End, Title: title})
+	}
+	return chapters, nil
+}
+
+// parseCHAP parses the body of a CHAP frame: element ID, start and end times
+// in milliseconds, byte offsets, then embedded frames (TIT2 is the title).
+func parseCHAP(data []byte, format tag.Format) (id3Chapter, error) {
+	id, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || len(rest) < 16 {
+		return id3Chapter{}, fmt.Errorf("CHAP frame too short")
+	}
+
+	c := id3Chapter{
+		ID:    string(id),
+		Start: time.Duration(binary.BigEndian.Uint32(rest[0:4])) * time.Millisecond,
+		End:   time.Duration(binary.BigEndian.Uint32(rest[4:8])) * time.Millisecond,
+	}
+
+	sub := rest[16:]
+	for len(sub) >= 10 && sub[0] != 0 {
+		name := string(sub[0:4])
+		var size int
+		if format == tag.ID3v2_4 {
+			size = int(sub[4])<<21 | int(sub[5])<<14 | int(sub[6])<<7 | int(sub[7])
+		} else {
+			size = int(binary.BigEndian.Uint32(sub[4:8]))
+		}
+		if size > len(sub)-10 {
+			return id3Chapter{}, fmt.Errorf("CHAP %q: %s sub-frame overruns the frame", c.ID, name)
+		}
+		body := sub[10 : 10+size]
+		sub = sub[10+size:]
+
+		if name == "TIT2" {
+			title, err := decodeID3Text(body)
+			if err != nil {
+				return id3Chapter{}, fmt.Errorf("CHAP %q: %v", c.ID, err)
+			}
+			c.Title = strings.TrimSpace(title)
+		}
+	}
+	return c, nil
+}
+
+// parseCTOC parses the body of a CTOC frame: element ID, flags, entry count
+// and the child element IDs.
+func parseCTOC(data []byte) (id3TOC, error) {
+	id, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || len(rest) < 2 {
+		return id3TOC{}, fmt.Errorf("CTOC frame too short")
+	}
+
+	toc := id3TOC{ID: string(id), TopLevel: rest[0]&0x02 != 0}
+	count := int(rest[1])
+	rest = rest[2:]
+	for i := 0; i < count; i++ {
+		child, more, ok := bytes.Cut(rest, []byte{0})
+		if !ok && len(child) == 0 {
+			return id3TOC{}, fmt.Errorf("CTOC %q lists %d entries but has %d", toc.ID, count, i)
+		}
+		toc.Children = append(toc.Children, string(child))
+		rest = more
+	}
+	return toc, nil
+}
+
+// decodeID3Text decodes the body of an ID3v2 text frame: an encoding byte
+// followed by the (possibly NUL-terminated) text.
+func decodeID3Text(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", nil
+	}
+
+	text := b[1:]
+	switch b[0] {
+	case 0: // ISO-8859-1
+		runes := make([]rune, 0, len(text))
+		for _, c := range text {
+			if c == 0 {
+				break
+			}
+			runes = append(runes, rune(c))
+		}
+		return string(runes), nil
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		order := binary.ByteOrder(binary.BigEndian)
+		if b[0] == 1 && len(text) >= 2 {
+			if text[0] == 0xff && text[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			if (text[0] == 0xff && text[1] == 0xfe) || (text[0] == 0xfe && text[1] == 0xff) {
+				text = text[2:]
+			}
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			u := order.Uint16(text[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units)), nil
+	case 3: // UTF-8
+		s, _, _ := bytes.Cut(text, []byte{0})
+		return string(s), nil
+	default:
+		return "", fmt.Errorf("unknown text encoding %d", b[0])
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// id3Frame builds an ID3v2.3 frame.
+func id3Frame(id string, body []byte) []byte {
+	frame := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(body)))
+	return append(frame, body...)
+}
+
+// chapFrame builds an ID3v2.3 CHAP frame with a Latin-1 TIT2 title.
+func chapFrame(id string, start, end time.Duration, title string) []byte {
+	body := append([]byte(id), 0)
+	times := make([]byte, 16)
+	binary.BigEndian.PutUint32(times[0:], uint32(start.Milliseconds()))
+	binary.BigEndian.PutUint32(times[4:], uint32(end.Milliseconds()))
+	binary.BigEndian.PutUint32(times[8:], 0xFFFFFFFF)
+	binary.BigEndian.PutUint32(times[12:], 0xFFFFFFFF)
+	body = append(body, times...)
+	if title != "" {
+		body = append(body, id3Frame("TIT2", append([]byte{0}, title...))...)
+	}
+	return id3Frame("CHAP", body)
+}
+
+// ctocFrame builds a top-level, ordered ID3v2.3 CTOC frame.
+func ctocFrame(id string, children ...string) []byte {
+	body := append([]byte(id), 0, 0x03, byte(len(children)))
+	for _, child := range children {
+		body = append(append(body, child...), 0)
+	}
+	return id3Frame("CTOC", body)
+}
+
+// id3v2Tag wraps frames in a padded ID3v2.3 tag followed by a few MP3
+// frames. (Without padding the tag library drops the last frame.)
+func id3v2Tag(frames ...[]byte) []byte {
+	body := append(bytes.Join(frames, nil), make([]byte, 32)...)
+	out := append(id3v2Header(len(body)), body...)
+	for i := 0; i < 4; i++ {
+		out = append(out, mp3FrameBytes(9)...)
+	}
+	return out
+}
+
+func TestID3Chapters(t *testing.T) {
+	tests := []struct {
+		name     string
+		frames   [][]byte
+		expected []Chapter
+	}{
+		{
+			name:   "no chapters",
+			frames: [][]byte{id3Frame("TIT2", []byte("\x00Book"))},
+		},
+		{
+			name: "ordered by CTOC",
+			frames: [][]byte{
+				chapFrame("ch0", 0, 90*time.Second, "Intro"),
+				chapFrame("ch1", 90*time.Second, 200*time.Second, "Listed last"),
+				chapFrame("ch2", 200*time.Second, 300*time.Second, ""),
+				ctocFrame("toc", "ch0", "ch2", "ch1"),
+			},
+			expected: []Chapter{
+				{Start: 0, End: 90 * time.Second, Title: "Intro"},
+				{Start: 200 * time.Second, End: 300 * time.Second, Title: "Chapter 2"},
+				{Start: 90 * time.Second, End: 200 * time.Second, Title: "Listed last"},
+			},
+		},
+		{
+			name: "start times without CTOC",
+			frames: [][]byte{
+				chapFrame("b", 60*time.Second, 120*time.Second, "Two"),
+				chapFrame("a", 0, 60*time.Second, "One"),
+			},
+			expected: []Chapter{
+				{Start: 0, End: 60 * time.Second, Title: "One"},
+				{Start: 60 * time.Second, End: 120 * time.Second, Title: "Two"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := tag.ReadFrom(bytes.NewReader(id3v2Tag(tt.frames...)))
+			if err != nil {
+				t.Fatalf("tag.ReadFrom() error = %v", err)
+			}
+			chapters, err := id3Chapters(metadata)
+			if err != nil {
+				t.Fatalf("id3Chapters() error = %v", err)
+			}
+			if !reflect.DeepEqual(chapters, tt.expected) {
+				t.Errorf("id3Chapters() = %+v, want %+v", chapters, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCHAPErrors(t *testing.T) {
+	if _, err := parseCHAP([]byte("ch1\x00short"), tag.ID3v2_3); err == nil {
+		t.Error("parseCHAP() of a truncated frame error = nil, want error")
+	}
+
+	overrun := chapFrame("ch1", 0, time.Second, "Title")[10:]
+	overrun = overrun[:len(overrun)-2]
+	if _, err := parseCHAP(overrun, tag.ID3v2_3); err == nil {
+		t.Error("parseCHAP() with an overrunning sub-frame error = nil, want error")
+	}
+}
+
+func TestDecodeID3Text(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"empty", nil, ""},
+		{"latin-1", []byte("\x00Caf\xe9\x00"), "Café"},
+		{"utf-16 little endian BOM", []byte("\x01\xff\xfeC\x00a\x00f\x00\xe9\x00\x00\x00"), "Café"},
+		{"utf-16 big endian BOM", []byte("\x01\xfe\xff\x00C\x00a\x00f\x00\xe9"), "Café"},
+		{"utf-16be", []byte("\x02\x00C\x00a\x00f\x00\xe9"), "Café"},
+		{"utf-8", []byte("\x03Caf\xc3\xa9\x00"), "Café"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeID3Text(tt.input)
+			if err != nil {
+				t.Fatalf("decodeID3Text() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("decodeID3Text() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := decodeID3Text([]byte("\x07text")); err == nil {
+		t.Error("decodeID3Text() with an unknown encoding error = nil, want error")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// indexSchema creates the catalog's tables. Books are keyed by their
+// absolute directory, so indexing a book again replaces its rows.
+const indexSchema = `CREATE TABLE IF NOT EXISTS books (
+	id INTEGER PRIMARY KEY,
+	dir TEXT NOT NULL UNIQUE,
+	title TEXT NOT NULL,
+	series TEXT,
+	series_index TEXT,
+	authors TEXT,
+	narrators TEXT,
+	language TEXT,
+	feed_url TEXT NOT NULL,
+	cover_url TEXT,
+	duration_ms INTEGER NOT NULL,
+	episode_count INTEGER NOT NULL,
+	indexed_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS episodes (
+	book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+	number INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	file TEXT NOT NULL,
+	url TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	duration_ms INTEGER,
+	duration_source TEXT,
+	sha256 TEXT NOT NULL,
+	PRIMARY KEY (book_id, number)
+);
+`
+
+// indexedBook is a scanned book with the file and SHA-256 of each of its
+// episodes.
+type indexedBook struct {
+	Dir     string // Absolute
+	Podcast *Podcast
+	Files   []string // By episode, relative to Dir with forward slashes
+	Hashes  []string // By episode
+}
+
+// runIndex implements "bookast index", which writes a catalog of books,
+// episodes, durations, hashes and feed URLs to a SQLite database.
+func runIndex(args []string) int {
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	db := fs.String("db", "", "SQLite database to write the catalog to (required)")
+	baseURL := fs.String("base-url", "", "Base URL the files are hosted under, for the feed and episode URLs (required)")
+	format := fs.String("format", "rss", "Feed format whose URL is recorded: rss, atom or jsonfeed")
+	layout := fs.String("layout", "", "Index every book in a library laid out like audiobookshelf (Author/[Series/]Book)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s index --db <file> --base-url <url> <directory>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 || *db == "" || *baseURL == "" {
+		fs.Usage()
+		return 1
+	}
+	output, ok := feedFormats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: --format must be rss, atom or jsonfeed, not %q\n", *format)
+		return 1
+	}
+	books, err := findBooks(fs.Arg(0), *layout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var indexed []indexedBook
+	for _, book := range books {
+		opts := Options{BaseURL: book.baseURL(*baseURL), FeedFilename: output.Filename, Folder: book.Folder}
+		entry, err := indexBook(book.Dir, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", book.Dir, err)
+			return 1
+		}
+		indexed = append(indexed, entry)
+	}
+
+	if err := writeIndex(*db, indexed, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *db, err)
+		return 1
+	}
+	var episodes int
+	for _, book := range indexed {
+		episodes += len(book.Podcast.Episodes)
+	}
+	fmt.Printf("Indexed %s (%s) into %s\n", plural(len(indexed), "book"), plural(episodes, "episode"), *db)
+	return 0
+}
+
+// indexBook scans the book in dir and hashes its episodes, through the cache
+// the scan just filled where it could.
+func indexBook(dir string, opts Options) (indexedBook, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return indexedBook{}, err
+	}
+	podcast, err := scanDirectory(dir, opts)
+	if err != nil {
+		return indexedBook{}, err
+	}
+
+	cachePath, err := bookCachePath(dir)
+	if err != nil {
+		return indexedBook{}, err
+	}
+	cache := loadFileCache(cachePath)
+	book := indexedBook{Dir: abs, Podcast: podcast}
+	for _, episode := range podcast.Episodes {
+		rel, err := filepath.Rel(dir, episode.FilePath)
+		if err != nil {
+			return indexedBook{}, err
+		}
+		sum, err := cache.hash(filepath.ToSlash(rel), episode.FilePath)
+		if err != nil {
+			return indexedBook{}, err
+		}
+		book.Files = append(book.Files, filepath.ToSlash(rel))
+		book.Hashes = append(book.Hashes, sum)
+	}
+	if err := cache.save(); err != nil {
+		return indexedBook{}, err
+	}
+	return book, nil
+}
+
+// writeIndex brings the catalog at db up to date with books, in one
+// transaction: each book's row is replaced and its episodes rewritten,
+// while books that weren't indexed this time are left alone.
+func writeIndex(db string, books []indexedBook, indexedAt string) error {
+	conn, err := sql.Open("sqlite", db)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// PRAGMAs are per connection
+	conn.SetMaxOpenConns(1)
+	if _, err := conn.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		return err
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(indexSchema); err != nil {
+		return err
+	}
+	insertEpisode, err := tx.Prepare("INSERT INTO episodes (book_id, number, title, file, url, size, duration_ms, duration_source, sha256)\n" +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertEpisode.Close()
+
+	for _, book := range books {
+		podcast := book.Podcast
+		var authors, narrators []string
+		for _, p := range podcast.People {
+			if p.Role == roleAuthor {
+				authors = append(authors, p.Name)
+			} else {
+				narrators = append(narrators, p.Name)
+			}
+		}
+		var total int64
+		for _, episode := range podcast.Episodes {
+			total += episode.Duration.Milliseconds()
+		}
+
+		if _, err := tx.Exec("DELETE FROM episodes WHERE book_id = (SELECT id FROM books WHERE dir = ?)", book.Dir); err != nil {
+			return err
+		}
+		var bookID int64
+		err := tx.QueryRow("INSERT INTO books (dir, title, series, series_index, authors, narrators, language, feed_url, cover_url, duration_ms, episode_count, indexed_at)\n"+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)\n"+
+			"ON CONFLICT (dir) DO UPDATE SET title = excluded.title, series = excluded.series, series_index = excluded.series_index, "+
+			"authors = excluded.authors, narrators = excluded.narrators, language = excluded.language, feed_url = excluded.feed_url, "+
+			"cover_url = excluded.cover_url, duration_ms = excluded.duration_ms, episode_count = excluded.episode_count, indexed_at = excluded.indexed_at\n"+
+			"RETURNING id",
+			book.Dir, podcast.Title, nullText(podcast.Series), nullText(podcast.SeriesIndex),
+			nullText(strings.Join(authors, "; ")), nullText(strings.Join(narrators, "; ")), nullText(podcast.Language),
+			podcast.FeedURL, nullText(podcast.CoverArtURL), total, len(podcast.Episodes), indexedAt).Scan(&bookID)
+		if err != nil {
+			return err
+		}
+
+		for i, episode := range podcast.Episodes {
+			duration := sql.NullInt64{Int64: episode.Duration.Milliseconds(), Valid: episode.Duration > 0}
+			if _, err := insertEpisode.Exec(bookID, episode.EpisodeNum, episode.Title, book.Files[i], episode.URL,
+				episode.FileSize, duration, nullText(episode.DurationSource), book.Hashes[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// nullText is s for an optional column, NULL if it's empty.
+func nullText(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// queryIndex returns a function running a query against the catalog at db,
+// giving its rows like the sqlite3 shell: columns joined by |, rows by
+// newlines.
+func queryIndex(t *testing.T, db string) func(query string) string {
+	conn, err := sql.Open("sqlite", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return func(query string) string {
+		t.Helper()
+		rows, err := conn.Query(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		defer rows.Close()
+		columns, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			pointers := make([]any, len(columns))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			if err := rows.Scan(pointers...); err != nil {
+				t.Fatal(err)
+			}
+			fields := make([]string, len(values))
+			for i, value := range values {
+				fields[i] = value.String
+			}
+			lines = append(lines, strings.Join(fields, "|"))
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(lines, "\n")
+	}
+}
+
+func TestRunIndex(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := filepath.Join(t.TempDir(), "Ender's Game")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	copyFixture(t, dir, "chapter02.mp3")
+	db := filepath.Join(t.TempDir(), "library.db")
+
+	// Indexing again replaces the book's rows rather than adding to them
+	for range 2 {
+		if code := runIndex([]string{"--db", db, "--base-url", "https://example.com/audiobooks", dir}); code != 0 {
+			t.Fatalf("runIndex() = %d", code)
+		}
+	}
+
+	query := queryIndex(t, db)
+	if got := query("SELECT title, feed_url, episode_count FROM books"); got != "Ender's Game|https://example.com/audiobooks/Ender%27s%20Game/podcast.rss|2" {
+		t.Errorf("books = %q", got)
+	}
+	if got := query("SELECT number, file, length(sha256) FROM episodes ORDER BY number"); got != "1|chapter01.mp3|64\n2|chapter02.mp3|64" {
+		t.Errorf("episodes = %q", got)
+	}
+	if got := query("SELECT count(*) FROM books b JOIN episodes e ON e.book_id = b.id WHERE e.duration_ms > 0 AND b.duration_ms > 0"); got != "2" {
+		t.Errorf("episodes with durations = %s, want 2", got)
+	}
+}
+
+func TestWriteIndexEmptyTitles(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "library.db")
+	books := []indexedBook{{
+		Dir:     "/library/Untitled",
+		Podcast: &Podcast{FeedURL: "https://example.com/Untitled/podcast.rss", Episodes: []Episode{{EpisodeNum: 1, URL: "https://example.com/Untitled/01.mp3"}}},
+		Files:   []string{"01.mp3"},
+		Hashes:  []string{strings.Repeat("0", 64)},
+	}}
+	if err := writeIndex(db, books, "2024-01-01T00:00:00Z"); err != nil {
+		t.Fatalf("writeIndex() error = %v", err)
+	}
+	query := queryIndex(t, db)
+	got := query("SELECT b.title, e.title, b.series IS NULL, e.duration_ms IS NULL FROM books b JOIN episodes e ON e.book_id = b.id")
+	if want := "||1|1"; got != want {
+		t.Errorf("rows = %q, want %q: empty titles, NULL series and duration", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Problems that make a file impossible to publish, as opposed to ones the
+// tag reader happened to trip over.
+var (
+	errDRMProtected = errors.New("DRM-protected, cannot publish")
+	errCorrupt      = errors.New("corrupt or truncated")
+)
+
+// drmAudioExts are formats that are always encrypted. They're listed with the
+// supported ones so they're decrypted (.aax, with --activation-bytes) or
+// reported rather than silently left out.
+var drmAudioExts = map[string]bool{
+	".aax": true,
+	".aa":  true,
+}
+
+// mp4ProtectedEntries maps the sample entry types of encrypted MP4 audio to
+// who encrypted it.
+var mp4ProtectedEntries = map[string]string{
+	"drms": "FairPlay (iTunes Store)",
+	"aavd": "Audible AAX encryption, give --activation-bytes to decrypt it",
+	"enca": "encrypted audio track",
+}
+
+// checkAudioFile looks for problems that would otherwise surface as a
+// confusing tag or duration error, or worse, as an episode nobody can play:
+// empty files, DRM, and MP4 files cut off partway through.
+func checkAudioFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%w: empty file", errCorrupt)
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".aa" {
+		return fmt.Errorf("%w: Audible AA files can't be decrypted, download the AAX version", errDRMProtected)
+	}
+	switch ext {
+	case ".m4a", ".m4b", ".mp4", ".aax":
+		return checkMP4(f, info.Size())
+	}
+	return nil
+}
+
+// checkMP4 checks that an MP4 file's top-level boxes are all there and that
+// none of its tracks are encrypted.
+func checkMP4(r io.ReaderAt, size int64) error {
+	var hdr [16]byte
+	var moov, moovSize int64 = -1, 0
+	for offset := int64(0); offset < size; {
+		if offset+8 > size {
+			return fmt.Errorf("%w: %d stray bytes at the end of the file", errCorrupt, size-offset)
+		}
+		if _, err := r.ReadAt(hdr[:8], offset); err != nil {
+			return err
+		}
+		name := string(hdr[4:8])
+		boxSize := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if _, err := r.ReadAt(hdr[8:16], offset+8); err != nil {
+				return fmt.Errorf("%w: the file ends inside the %q box header", errCorrupt, name)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize {
+			return fmt.Errorf("%w: bad %q box size at offset %d", errCorrupt, name, offset)
+		}
+		if offset+boxSize > size {
+			return fmt.Errorf("%w: the %q box at offset %d needs %d bytes but the file ends after %d (incomplete download?)", errCorrupt, name, offset, boxSize, size-offset)
+		}
+
+		if offset == 0 && name == "ftyp" && boxSize >= 12 {
+			if _, err := r.ReadAt(hdr[8:12], offset+8); err == nil && string(hdr[8:12]) == "aax " {
+				return fmt.Errorf("%w: Audible AAX encryption, give --activation-bytes to decrypt it", errDRMProtected)
+			}
+		}
+		if name == "moov" {
+			moov, moovSize = offset+headerSize, boxSize-headerSize
+		}
+		offset += boxSize
+	}
+	if moov < 0 {
+		return fmt.Errorf("%w: no moov box, the file is incomplete or not MP4", errCorrupt)
+	}
+
+	if scheme := mp4Protection(r, moov, moov+moovSize); scheme != "" {
+		return fmt.Errorf("%w: %s", errDRMProtected, scheme)
+	}
+	return nil
+}
+
+// mp4Protection returns who encrypted the first protected track under moov,
+// or "" if none are.
+func mp4Protection(r io.ReaderAt, start int64, end int64) string {
+	for offset := start; offset < end; {
+		trak, trakSize, err := findMP4Box(r, offset, end, "trak")
+		if err != nil {
+			return ""
+		}
+		offset = trak + trakSize
+
+		stsd, stsdSize, err := findMP4Path(r, trak, trak+trakSize, "mdia", "minf", "stbl", "stsd")
+		if err != nil || stsdSize < 16 {
+			continue
+		}
+		// Version, flags and entry count come before the sample entries
+		var entry [4]byte
+		if _, err := r.ReadAt(entry[:], stsd+12); err != nil {
+			continue
+		}
+		if scheme, ok := mp4ProtectedEntries[string(entry[:])]; ok {
+			return scheme
+		}
+	}
+	return ""
+}
+
+// findMP4Path follows a path of nested boxes from the box spanning start to
+// end, returning the payload of the last one.
+func findMP4Path(r io.ReaderAt, start int64, end int64, names ...string) (int64, int64, error) {
+	for _, name := range names {
+		offset, size, err := findMP4Box(r, start, end, name)
+		if err != nil {
+			return 0, 0, err
+		}
+		start, end = offset, offset+size
+	}
+	return start, end - start, nil
+}
+
+// diagnoseAudioFile explains why the tags of a file couldn't be read when
+// the reason is that it isn't the audio its extension promises. Otherwise
+// it returns err unchanged.
+func diagnoseAudioFile(path string, err error) error {
+	f, openErr := os.Open(path)
+	if openErr != nil {
+		return err
+	}
+	defer f.Close()
+	info, statErr := f.Stat()
+	if statErr != nil {
+		return err
+	}
+	size := info.Size()
+
+	var magic [4]byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		s := &mp3Stream{r: f, start: skipID3v2(f, size), end: trailingTagsStart(f, size)}
+		if _, _, ok := s.sync(s.start, mp3SyncSearchLimit, 1); !ok {
+			return fmt.Errorf("%w: no MPEG audio frames found (%v)", errCorrupt, err)
+		}
+	case ".flac":
+		if _, readErr := f.ReadAt(magic[:], skipID3v2(f, size)); readErr != nil || string(magic[:]) != "fLaC" {
+			return fmt.Errorf("%w: no FLAC stream marker (%v)", errCorrupt, err)
+		}
+	case ".ogg", ".oga", ".opus":
+		if _, readErr := f.ReadAt(magic[:], 0); readErr != nil || string(magic[:]) != "OggS" {
+			return fmt.Errorf("%w: no Ogg page at the start of the file (%v)", errCorrupt, err)
+		}
+	}
+	return err
+}
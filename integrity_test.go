@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// audioTrak builds a track whose only sample entry has the given type.
+func audioTrak(entry string) []byte {
+	stsd := mp4Box("stsd", make([]byte, 8), mp4Box(entry, make([]byte, 28)))
+	return mp4Box("trak", mp4Box("mdia", mp4Box("minf", mp4Box("stbl", stsd))))
+}
+
+func TestCheckMP4(t *testing.T) {
+	ftyp := mp4Box("ftyp", []byte("M4B \x00\x00\x00\x00"))
+	mdat := mp4Box("mdat", make([]byte, 64))
+	moov := mp4Box("moov", mvhdV0(1000, 5000), audioTrak("mp4a"))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"plain", bytes.Join([][]byte{ftyp, moov, mdat}, nil), nil},
+		{"FairPlay", bytes.Join([][]byte{ftyp, mp4Box("moov", mvhdV0(1000, 5000), audioTrak("drms")), mdat}, nil), errDRMProtected},
+		{"second track encrypted", bytes.Join([][]byte{ftyp, mp4Box("moov", mvhdV0(1000, 5000), audioTrak("text"), audioTrak("enca")), mdat}, nil), errDRMProtected},
+		{"AAX brand", bytes.Join([][]byte{mp4Box("ftyp", []byte("aax \x00\x00\x00\x00")), moov, mdat}, nil), errDRMProtected},
+		{"truncated mdat", bytes.Join([][]byte{ftyp, moov, mdat[:40]}, nil), errCorrupt},
+		{"no moov", bytes.Join([][]byte{ftyp, mdat}, nil), errCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMP4(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("checkMP4() = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessAudioFileProblems(t *testing.T) {
+	dir := t.TempDir()
+	truncated, err := os.ReadFile("testdata/audiobook1/chapter03.m4a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftyp := mp4Box("ftyp", []byte("M4B \x00\x00\x00\x00"))
+
+	tests := []struct {
+		filename string
+		data     []byte
+		expected error
+	}{
+		{"empty.mp3", nil, errCorrupt},
+		{"junk.mp3", []byte("<html>404 Not Found</html>"), errCorrupt},
+		{"junk.flac", []byte("<html>404 Not Found</html>"), errCorrupt},
+		{"truncated.m4a", truncated[:len(truncated)/2], errCorrupt},
+		{"fairplay.m4b", bytes.Join([][]byte{ftyp, mp4Box("moov", mvhdV0(1000, 5000), audioTrak("drms"))}, nil), errDRMProtected},
+		{"book.aa", []byte("\x00\x00\x00\x00\x57\x90\x75\x36"), errDRMProtected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			path := filepath.Join(dir, tt.filename)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := processAudioFile(path, "https://example.com", dir, time.Now(), 1)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("processAudioFile() error = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ipFilter is serve's --allow and --deny: a client in a deny range is
+// refused, and with allow ranges so is one in none of them.
+type ipFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// parseCIDRs parses a comma-separated list of CIDR ranges, where a bare
+// address is a range of one.
+func parseCIDRs(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(field); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't an IP address or CIDR range", field)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// permits reports whether addr may connect.
+func (f ipFilter) permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range f.deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, prefix := range f.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredAddr is the client address --allow and --deny apply to: the
+// connection's, unless it comes from this machine (a proxy, maybe on a unix
+// socket), then the last X-Forwarded-For address, the one the proxy added.
+// Unlike clientAddr it never trusts what a remote client says.
+func filteredAddr(r *http.Request) (netip.Addr, bool) {
+	addr, ok := peerAddr(r)
+	if ok && !addr.Unmap().IsLoopback() {
+		return addr, true
+	}
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return addr, ok
+	}
+	fields := strings.Split(forwarded[len(forwarded)-1], ",")
+	proxied, perr := netip.ParseAddr(strings.TrimSpace(fields[len(fields)-1]))
+	return proxied, perr == nil
+}
+
+// peerAddr is the address of the connection's other end, false for a unix
+// socket.
+func peerAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr, err == nil
+}
+
+// fromProxy reports whether r came from this machine, over loopback or a
+// unix socket, so its X-Forwarded headers were set by a reverse proxy
+// rather than made up by a client. filteredAddr applies the same rule.
+func fromProxy(r *http.Request) bool {
+	addr, ok := peerAddr(r)
+	return !ok || addr.Unmap().IsLoopback()
+}
+
+// filterClients wraps h so clients f doesn't permit get 403 Forbidden.
+func filterClients(h http.Handler, f ipFilter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, ok := filteredAddr(r); !ok || !f.permits(addr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
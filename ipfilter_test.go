@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	got, err := parseCIDRs("192.168.1.0/24, 10.8.0.7/24,fd00::/8,203.0.113.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.168.1.0/24", "10.8.0.0/24", "fd00::/8", "203.0.113.9/32"}
+	if len(got) != len(want) {
+		t.Fatalf("parseCIDRs = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	if got, err := parseCIDRs(""); err != nil || len(got) != 0 {
+		t.Errorf("parseCIDRs(\"\") = %v, %v; want none", got, err)
+	}
+	for _, bad := range []string{"lan", "192.168.1.0/33", "192.168.1.300"} {
+		if _, err := parseCIDRs(bad); err == nil {
+			t.Errorf("parseCIDRs(%q) error = nil, want error", bad)
+		}
+	}
+}
+
+func TestIPFilterPermits(t *testing.T) {
+	allow, _ := parseCIDRs("192.168.1.0/24,10.8.0.0/24")
+	deny, _ := parseCIDRs("192.168.1.13")
+	tests := []struct {
+		filter ipFilter
+		addr   string
+		want   bool
+	}{
+		{ipFilter{allow: allow}, "192.168.1.20", true},
+		{ipFilter{allow: allow}, "10.8.0.5", true},
+		{ipFilter{allow: allow}, "::ffff:192.168.1.20", true},
+		{ipFilter{allow: allow}, "203.0.113.9", false},
+		{ipFilter{allow: allow, deny: deny}, "192.168.1.13", false},
+		{ipFilter{deny: deny}, "192.168.1.13", false},
+		{ipFilter{deny: deny}, "203.0.113.9", true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.permits(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("permits(%s) with allow %v deny %v = %v, want %v", tt.addr, tt.filter.allow, tt.filter.deny, got, tt.want)
+		}
+	}
+}
+
+func TestFilterClients(t *testing.T) {
+	allow, _ := parseCIDRs("192.168.1.0/24")
+	h := filterClients(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), ipFilter{allow: allow})
+	tests := []struct {
+		remote    string
+		forwarded []string
+		want      int
+	}{
+		{"192.168.1.20:5000", nil, http.StatusOK},
+		{"203.0.113.9:5000", nil, http.StatusForbidden},
+		// A remote client can't talk its way in
+		{"203.0.113.9:5000", []string{"192.168.1.20"}, http.StatusForbidden},
+		// A proxy on this machine appends the client's address to whatever
+		// the client sent
+		{"127.0.0.1:9000", []string{"192.168.1.20"}, http.StatusOK},
+		{"127.0.0.1:9000", []string{"192.168.1.20, 203.0.113.9"}, http.StatusForbidden},
+		{"127.0.0.1:9000", []string{"203.0.113.9", "192.168.1.20"}, http.StatusOK},
+		{"[::1]:9000", []string{"192.168.1.20"}, http.StatusOK},
+		// On a unix socket the remote address is empty
+		{"", []string{"192.168.1.20"}, http.StatusOK},
+		{"", nil, http.StatusForbidden},
+		{"127.0.0.1:9000", nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/Book/podcast.rss", nil)
+		r.RemoteAddr = tt.remote
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%q forwarded for %q: status %d, want %d", tt.remote, tt.forwarded, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JSON Feed 1.1 (https://jsonfeed.org/version/1.1) structures
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Hubs        []JSONFeedHub    `json:"hubs,omitempty"`
+	Bookast     *JSONFeedBookast `json:"_bookast,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type JSONFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title"`
+	ContentText   string               `json:"content_text"`
+	DatePublished string               `json:"date_published"`
+	Authors       []JSONFeedAuthor     `json:"authors,omitempty"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+type JSONFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	SizeInBytes       int64   `json:"size_in_bytes,omitempty"`
+	DurationInSeconds float64 `json:"duration_in_seconds,omitempty"`
+}
+
+// generateJSONFeed renders the podcast as a JSON Feed, one item per episode
+// with the audio file as its attachment.
+func generateJSONFeed(podcast *Podcast) string {
+	feed := &JSONFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       podcast.Title,
+		HomePageURL: podcast.Website,
+		FeedURL:     podcast.FeedURL,
+		Description: podcast.Description,
+		Icon:        podcast.CoverArtURL,
+		Language:    podcast.Language,
+		Items:       []JSONFeedItem{},
+	}
+
+	if podcast.Hub != "" {
+		feed.Hubs = []JSONFeedHub{{Type: "WebSub", URL: podcast.Hub}}
+	}
+
+	if podcast.Series != "" || podcast.Rating > 0 {
+		feed.Bookast = &JSONFeedBookast{About: bookastNS, Series: podcast.Series, SeriesIndex: podcast.SeriesIndex, Rating: podcast.Rating}
+	}
+
+	for _, person := range podcast.People {
+		if person.Role == roleAuthor {
+			feed.Authors = append(feed.Authors, JSONFeedAuthor{Name: person.Name})
+		}
+	}
+
+	for _, ep := range podcast.Episodes {
+		var authors []JSONFeedAuthor
+		for _, name := range ep.ItemAuthors {
+			authors = append(authors, JSONFeedAuthor{Name: name})
+		}
+		feed.Items = append(feed.Items, JSONFeedItem{
+			ID:            ep.URL,
+			URL:           ep.URL,
+			Title:         ep.Title,
+			ContentText:   ep.Description,
+			DatePublished: ep.PubDate.Format(time.RFC3339),
+			Authors:       authors,
+			Attachments: []JSONFeedAttachment{{
+				URL:               ep.URL,
+				MimeType:          getMimeType(ep.FilePath),
+				SizeInBytes:       ep.FileSize,
+				DurationInSeconds: ep.Duration.Round(time.Millisecond).Seconds(),
+			}},
+		})
+	}
+
+	output, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return ""
+	}
+
+	return string(output) + "\n"
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// normalizeJSONFeed removes timestamps from a JSON Feed for comparison
+func normalizeJSONFeed(feed string) string {
+	return regexp.MustCompile(`"date_published": ".*?"`).ReplaceAllString(feed, `"date_published": "NORMALIZED"`)
+}
+
+func TestGenerateJSONFeedGolden(t *testing.T) {
+	baseDir := "testdata/audiobook1"
+
+	podcast, err := scanDirectory(baseDir, Options{BaseURL: "https://example.com/audiobooks", FeedFilename: "podcast.json"})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+
+	feed := generateJSONFeed(podcast)
+
+	goldenBytes, err := os.ReadFile(filepath.Join(baseDir, "golden.json"))
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v\nRun ./generate_test_fixtures.sh to create it", err)
+	}
+
+	if normalizeJSONFeed(feed) != normalizeJSONFeed(string(goldenBytes)) {
+		t.Errorf("Generated JSON Feed does not match golden file.\n\nGenerated:\n%s\n\nGolden:\n%s\n\nIf the change is intentional, run ./generate_test_fixtures.sh to update the golden file.", normalizeJSONFeed(feed), normalizeJSONFeed(string(goldenBytes)))
+	}
+}
+
+func TestGenerateJSONFeedEmpty(t *testing.T) {
+	// items is required by the spec, even when there are none
+	var feed map[string]any
+	if err := json.Unmarshal([]byte(generateJSONFeed(&Podcast{Title: "Book"})), &feed); err != nil {
+		t.Fatalf("generateJSONFeed() is not valid JSON: %v", err)
+	}
+	if items, ok := feed["items"].([]any); !ok || len(items) != 0 {
+		t.Errorf("items = %v, want an empty list", feed["items"])
+	}
+}
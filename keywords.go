@@ -0,0 +1,33 @@
+package main
+
+import "strings"
+
+// splitKeywords splits a genre tag such as "Fantasy; Science Fiction" or
+// "Fiction/Classics" into keywords.
+func splitKeywords(s string) []string {
+	var keywords []string
+	for _, k := range strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune(";/,\x00", r) }) {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+// bookKeywords returns the channel's itunes:keywords: book.yaml's keywords
+// followed by every distinct genre in the episodes' tags. "Audiobook" is
+// left out, every feed bookast makes is one.
+func bookKeywords(episodes []Episode, book *BookConfig) []string {
+	var keywords []string
+	for _, k := range book.Keywords {
+		keywords = appendUnique(keywords, splitKeywords(k)...)
+	}
+	for _, ep := range episodes {
+		for _, genre := range ep.Genres {
+			if !strings.EqualFold(genre, "audiobook") && !strings.EqualFold(genre, "audiobooks") {
+				keywords = appendUnique(keywords, genre)
+			}
+		}
+	}
+	return keywords
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitKeywords(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"Fantasy", []string{"Fantasy"}},
+		{"Fantasy; Science Fiction", []string{"Fantasy", "Science Fiction"}},
+		{"Fiction/Classics, Gothic", []string{"Fiction", "Classics", "Gothic"}},
+		{" ; ", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := splitKeywords(tt.input); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("splitKeywords(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBookKeywords(t *testing.T) {
+	episodes := []Episode{
+		{Genres: []string{"Audiobook", "Fantasy"}},
+		{Genres: []string{"fantasy", "Young Adult"}},
+	}
+	book := &BookConfig{Keywords: []string{"earthsea", "wizards, dragons"}}
+
+	expected := []string{"earthsea", "wizards", "dragons", "Fantasy", "Young Adult"}
+	if got := bookKeywords(episodes, book); !reflect.DeepEqual(got, expected) {
+		t.Errorf("bookKeywords() = %q, want %q", got, expected)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/dhowden/tag"
+)
+
+// defaultLanguage is the channel language when nothing says otherwise.
+const defaultLanguage = "en-us"
+
+// languageCodes maps ISO 639-2 codes (as in the ID3 TLAN frame) and English
+// language names to the ISO 639-1 codes RSS uses.
+var languageCodes = map[string]string{
+	"eng": "en", "english": "en",
+	"ger": "de", "deu": "de", "german": "de", "deutsch": "de",
+	"fre": "fr", "fra": "fr", "french": "fr", "français": "fr", "francais": "fr",
+	"spa": "es", "spanish": "es", "español": "es", "espanol": "es",
+	"ita": "it", "italian": "it", "italiano": "it",
+	"dut": "nl", "nld": "nl", "dutch": "nl", "nederlands": "nl",
+	"por": "pt", "portuguese": "pt", "português": "pt",
+	"swe": "sv", "swedish": "sv", "svenska": "sv",
+	"dan": "da", "danish": "da", "dansk": "da",
+	"nor": "no", "nob": "nb", "norwegian": "no", "norsk": "no",
+	"fin": "fi", "finnish": "fi", "suomi": "fi",
+	"pol": "pl", "polish": "pl", "polski": "pl",
+	"rus": "ru", "russian": "ru",
+	"jpn": "ja", "japanese": "ja",
+	"chi": "zh", "zho": "zh", "chinese": "zh",
+}
+
+// languageTagRe matches an RFC 5646 style tag such as "de", "en-US" or
+// "pt_BR".
+var languageTagRe = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})*$`)
+
+// normalizeLanguage turns a language tag, ISO 639-2 code or language name
+// into the lowercase form used in the feed ("de", "en-us"). ok is false when
+// the value isn't recognized.
+func normalizeLanguage(s string) (lang string, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return "", false
+	}
+	if code, ok := languageCodes[s]; ok {
+		return code, true
+	}
+	if len(s) == 3 || !languageTagRe.MatchString(s) {
+		// Three letter codes other than the ones above are more often junk
+		// like "xxx" or "und" than a language
+		return "", false
+	}
+	return strings.ReplaceAll(s, "_", "-"), true
+}
+
+// tagLanguage reads the language from an audio file's tags: the ID3 TLAN
+// frame or a LANGUAGE user text tag.
+func tagLanguage(metadata tag.Metadata) string {
+	raw := metadata.Raw()
+	for _, key := range []string{"TLAN", "TLA"} {
+		value, ok := raw[key].(string)
+		if !ok {
+			continue
+		}
+		// TLAN may hold several codes, the first is the main language
+		if codes := strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == '\x00' || r == ';' }); len(codes) > 0 {
+			if lang, ok := normalizeLanguage(codes[0]); ok {
+				return lang
+			}
+		}
+	}
+	if lang, ok := normalizeLanguage(userTextTag(metadata, "LANGUAGE")); ok {
+		return lang
+	}
+	return ""
+}
+
+// stopwords are frequent short words of each language detectLanguage tells
+// apart. Words shared between languages ("a", "in", "de", "en") are left out.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "was", "that", "with", "for", "his", "her", "chapter", "part", "book"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "sich", "dem", "den", "ein", "eine", "kapitel", "teil", "von", "zu", "auf"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "dans", "qui", "pas", "pour", "sur", "chapitre", "partie", "du", "au"},
+	"es": {"el", "los", "las", "y", "es", "que", "por", "para", "capítulo", "su", "lo", "como"},
+	"it": {"il", "gli", "e", "di", "che", "è", "della", "per", "capitolo", "sono", "non", "nel"},
+	"nl": {"het", "een", "van", "dat", "niet", "met", "zijn", "hoofdstuk", "deel", "voor", "ik", "je"},
+}
+
+// detectLanguage guesses the language of text by counting stopwords. It only
+// answers when one language clearly wins, since titles are short.
+func detectLanguage(text string) (string, bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	counts := map[string]int{}
+	for _, word := range words {
+		for lang, list := range stopwords {
+			for _, stopword := range list {
+				if word == stopword {
+					counts[lang]++
+				}
+			}
+		}
+	}
+
+	best, bestCount, second := "", 0, 0
+	for lang, count := range counts {
+		switch {
+		case count > bestCount || count == bestCount && lang < best:
+			best, bestCount, second = lang, count, bestCount
+		case count > second:
+			second = count
+		}
+	}
+
+	if bestCount < 3 || bestCount < 2*second {
+		return "", false
+	}
+	return best, true
+}
+
+// bookLanguage picks the channel language: book.yaml's, the most common
+// language in the episodes' tags, a guess from the text when detect is set,
+// or defaultLanguage.
+func bookLanguage(podcast *Podcast, book *BookConfig, detect bool) (string, error) {
+	if book.Language != "" {
+		lang, ok := normalizeLanguage(book.Language)
+		if !ok {
+			return "", fmt.Errorf("%s: language: %q is not a language code", bookConfigFile, book.Language)
+		}
+		return lang, nil
+	}
+
+	counts := map[string]int{}
+	best := ""
+	for _, ep := range podcast.Episodes {
+		if ep.Language == "" {
+			continue
+		}
+		counts[ep.Language]++
+		if best == "" || counts[ep.Language] > counts[best] {
+			best = ep.Language
+		}
+	}
+	if best != "" {
+		return best, nil
+	}
+
+	if detect {
+		text := []string{podcast.Title, podcast.Description}
+		for _, ep := range podcast.Episodes {
+			text = append(text, ep.Title, ep.Description)
+		}
+		if lang, ok := detectLanguage(strings.Join(text, "\n")); ok {
+			return lang, nil
+		}
+	}
+
+	return defaultLanguage, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"de", "de", true},
+		{"en-US", "en-us", true},
+		{"pt_BR", "pt-br", true},
+		{"ger", "de", true},
+		{"fra", "fr", true},
+		{"French", "fr", true},
+		{"und", "", false},
+		{"xxx", "", false},
+		{"Klingon!", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			lang, ok := normalizeLanguage(tt.input)
+			if lang != tt.expected || ok != tt.ok {
+				t.Errorf("normalizeLanguage(%q) = %q, %v, want %q, %v", tt.input, lang, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTagLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata fakeMetadata
+		expected string
+	}{
+		{"no tags", fakeMetadata{raw: map[string]interface{}{}}, ""},
+		{"TLAN", fakeMetadata{raw: map[string]interface{}{"TLAN": "ger"}}, "de"},
+		{"TLAN with several languages", fakeMetadata{raw: map[string]interface{}{"TLAN": "fre/eng"}}, "fr"},
+		{"empty TLAN", fakeMetadata{raw: map[string]interface{}{"TLAN": ""}}, ""},
+		{"user text tag", fakeMetadata{format: tag.ID3v2_3, raw: map[string]interface{}{"TXXX": &tag.Comm{Description: "LANGUAGE", Text: "Deutsch"}}}, "de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tagLanguage(tt.metadata); got != tt.expected {
+				t.Errorf("tagLanguage() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+		ok       bool
+	}{
+		{"Der Herr der Ringe. Kapitel 1: Ein langerwartetes Fest", "de", true},
+		{"Le Petit Prince. Chapitre 1. Il était une fois un petit prince qui habitait une planète", "fr", true},
+		{"The Hobbit. Chapter 1: An Unexpected Party. In a hole in the ground there lived a hobbit", "en", true},
+		{"Harry Potter", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			lang, ok := detectLanguage(tt.text)
+			if lang != tt.expected || ok != tt.ok {
+				t.Errorf("detectLanguage(%q) = %q, %v, want %q, %v", tt.text, lang, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBookLanguage(t *testing.T) {
+	german := &Podcast{Title: "Der Prozess", Episodes: []Episode{
+		{Title: "Kapitel 1: Verhaftung", Description: "Jemand mußte Josef K. verleumdet haben, denn ohne daß er etwas Böses getan hätte, wurde er eines Morgens verhaftet. Die Köchin der Frau Grubach"},
+	}}
+	tagged := &Podcast{Episodes: []Episode{{Language: "fr"}, {Language: "fr"}, {Language: "en"}}}
+
+	tests := []struct {
+		name     string
+		podcast  *Podcast
+		book     *BookConfig
+		detect   bool
+		expected string
+		wantErr  bool
+	}{
+		{"default", &Podcast{}, &BookConfig{}, false, defaultLanguage, false},
+		{"book.yaml", tagged, &BookConfig{Language: "en-GB"}, false, "en-gb", false},
+		{"invalid book.yaml", tagged, &BookConfig{Language: "Elvish!"}, false, "", true},
+		{"most common tag", tagged, &BookConfig{}, false, "fr", false},
+		{"detection is opt-in", german, &BookConfig{}, false, defaultLanguage, false},
+		{"detected", german, &BookConfig{}, true, "de", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang, err := bookLanguage(tt.podcast, tt.book, tt.detect)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bookLanguage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if lang != tt.expected {
+				t.Errorf("bookLanguage() = %q, want %q", lang, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runList implements "bookast list", which prints the episodes a feed for
+// the directory would have, for checking ordering and titles before
+// publishing.
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	format := fs.String("format", "text", "Output format: text, json (the whole scanned podcast), tsv or csv (one row per episode)")
+	baseURL := fs.String("base-url", "", "Base URL for hosting the files, to fill in the URLs in json output")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s list [flags] <directory>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	write, ok := listWriters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: --format must be text, json, tsv or csv, not %q\n", *format)
+		return 1
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for ext, mimeType := range config.MIMETypes {
+		audioMIMETypes[ext] = mimeType
+	}
+
+	directory := fs.Arg(0)
+	podcast, err := scanDirectory(directory, Options{BaseURL: *baseURL})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		return 1
+	}
+	if len(podcast.Episodes) == 0 && len(podcast.Skipped) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No audio files found in directory '%s'\n", directory)
+		return 1
+	}
+
+	if err := write(os.Stdout, directory, podcast); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+var listWriters = map[string]func(w io.Writer, dir string, podcast *Podcast) error{
+	"text": writeListText,
+	"json": writeListJSON,
+	"tsv":  writeListTSV,
+	"csv":  writeListCSV,
+}
+
+// listColumns are the columns of tsv and csv output.
+var listColumns = []string{"path", "title", "duration_seconds", "size", "mimetype"}
+
+// writeListText prints a table of the episodes in feed order, a total line,
+// and the files that were left out.
+func writeListText(w io.Writer, dir string, podcast *Podcast) error {
+	fmt.Fprintf(w, "%s\n\n", podcast.Title)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tDURATION\tSIZE\tTITLE\tFILE")
+	var total time.Duration
+	var size int64
+	for _, episode := range podcast.Episodes {
+		duration := "?"
+		if episode.Duration > 0 {
+			duration = formatDuration(episode.Duration)
+		}
+		total += episode.Duration
+		size += episode.FileSize
+		file, err := filepath.Rel(dir, episode.FilePath)
+		if err != nil {
+			file = episode.FilePath
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", episode.EpisodeNum, duration, formatByteSize(episode.FileSize), episode.Title, file)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\n%s, %s, %s\n", plural(len(podcast.Episodes), "episode"), formatDuration(total), formatByteSize(size))
+	for _, s := range podcast.Skipped {
+		fmt.Fprintf(w, "Skipped %s: %s\n", s.File, s.Reason)
+	}
+	return nil
+}
+
+// writeListJSON prints the podcast as scanned, every field of it and its
+// episodes under their Go names. Durations are in nanoseconds.
+func writeListJSON(w io.Writer, dir string, podcast *Podcast) error {
+	data, err := json.MarshalIndent(podcast, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// listRow is an episode's tsv/csv row. The duration is empty when it's
+// unknown.
+func listRow(episode Episode) []string {
+	duration := ""
+	if episode.Duration > 0 {
+		duration = strconv.FormatFloat(episode.Duration.Seconds(), 'f', 3, 64)
+	}
+	return []string{episode.FilePath, episode.Title, duration, strconv.FormatInt(episode.FileSize, 10), getMimeType(episode.FilePath)}
+}
+
+// writeListTSV prints a header line and a line per episode, tab-separated
+// for cut and awk. Tabs and newlines in values become spaces.
+func writeListTSV(w io.Writer, dir string, podcast *Podcast) error {
+	clean := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+	var b strings.Builder
+	b.WriteString(strings.Join(listColumns, "\t") + "\n")
+	for _, episode := range podcast.Episodes {
+		row := listRow(episode)
+		for i := range row {
+			row[i] = clean.Replace(row[i])
+		}
+		b.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeListCSV prints the same rows as writeListTSV as RFC 4180 CSV.
+func writeListCSV(w io.Writer, dir string, podcast *Podcast) error {
+	cw := csv.NewWriter(w)
+	cw.Write(listColumns)
+	for _, episode := range podcast.Episodes {
+		cw.Write(listRow(episode))
+	}
+	cw.Flush()
+	return cw.Error()
+}
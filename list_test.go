@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteListText(t *testing.T) {
+	dir := "testdata/audiobook1"
+	podcast, err := scanDirectory(dir, Options{})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+
+	var b strings.Builder
+	if err := writeListText(&b, dir, podcast); err != nil {
+		t.Fatal(err)
+	}
+	expected := `audiobook1
+
+#  DURATION  SIZE   TITLE          FILE
+1  0:01      16.8K  Chapter One    chapter01.mp3
+2  0:02      32.5K  Chapter Two    chapter02.mp3
+3  0:03      48.6K  Chapter Three  chapter03.m4a
+
+3 episodes, 0:06, 97.8K
+`
+	if b.String() != expected {
+		t.Errorf("writeListText() =\n%s\nwant\n%s", b.String(), expected)
+	}
+}
+
+func TestWriteListJSON(t *testing.T) {
+	dir := "testdata/audiobook1"
+	podcast, err := scanDirectory(dir, Options{BaseURL: "https://example.com/audiobooks"})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+
+	var b strings.Builder
+	if err := writeListJSON(&b, dir, podcast); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Podcast
+	if err := json.Unmarshal([]byte(b.String()), &decoded); err != nil {
+		t.Fatalf("output isn't a Podcast: %v", err)
+	}
+	if len(decoded.Episodes) != 3 || decoded.Episodes[1].Title != podcast.Episodes[1].Title || decoded.Episodes[1].Duration != podcast.Episodes[1].Duration {
+		t.Errorf("Episodes[1] = %+v, want %+v", decoded.Episodes[1], podcast.Episodes[1])
+	}
+	if decoded.CoverArtURL != "https://example.com/audiobooks/audiobook1/cover.jpg" {
+		t.Errorf("CoverArtURL = %q", decoded.CoverArtURL)
+	}
+}
+
+func TestWriteListTSV(t *testing.T) {
+	podcast := &Podcast{Episodes: []Episode{
+		{FilePath: "book/01.mp3", Title: "Prologue:\tThe Well", Duration: 1500 * time.Millisecond, FileSize: 2048},
+		{FilePath: "book/02.m4a", Title: "Chapter 1", FileSize: 4096},
+	}}
+
+	var b strings.Builder
+	if err := writeListTSV(&b, "book", podcast); err != nil {
+		t.Fatal(err)
+	}
+	expected := "path\ttitle\tduration_seconds\tsize\tmimetype\n" +
+		"book/01.mp3\tPrologue: The Well\t1.500\t2048\taudio/mpeg\n" +
+		"book/02.m4a\tChapter 1\t\t4096\taudio/mp4\n"
+	if b.String() != expected {
+		t.Errorf("writeListTSV() = %q, want %q", b.String(), expected)
+	}
+
+	b.Reset()
+	podcast.Episodes[0].Title = `"Prologue", The Well`
+	if err := writeListCSV(&b, "book", podcast); err != nil {
+		t.Fatal(err)
+	}
+	expected = "path,title,duration_seconds,size,mimetype\n" +
+		"book/01.mp3,\"\"\"Prologue\"\", The Well\",1.500,2048,audio/mpeg\n" +
+		"book/02.m4a,Chapter 1,,4096,audio/mp4\n"
+	if b.String() != expected {
+		t.Errorf("writeListCSV() = %q, want %q", b.String(), expected)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A feed lock is a lease file written next to the feed (podcast.rss.lock).
+// When several machines regenerate feeds into the same shared target (an NFS
+// export, a synced bucket mount, ...) the lease keeps them from clobbering
+// each other. Leases expire after a TTL so a crashed host can't wedge the feed
+// forever.
+
+var errFeedLocked = errors.New("feed is locked by another host")
+
+type lockLease struct {
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+type feedLock struct {
+	path  string
+	ttl   time.Duration
+	lease lockLease
+}
+
+// acquireFeedLock takes the lease at path, replacing it if the previous
+// holder's lease has expired.
+func acquireFeedLock(path string, ttl time.Duration) (*feedLock, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	now := time.Now()
+	lock := &feedLock{
+		path: path,
+		ttl:  ttl,
+		lease: lockLease{
+			Host:     host,
+			PID:      os.Getpid(),
+			Acquired: now,
+			Expires:  now.Add(ttl),
+		},
+	}
+
+	// Two attempts: the second one runs after clearing an expired lease
+	for attempt := 0; attempt < 2; attempt++ {
+		err := lock.create()
+		if err == nil {
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		current, err := readLease(path)
+		switch {
+		case os.IsNotExist(err):
+			// Released since
+			continue
+		case err == nil && now.Before(current.Expires):
+			return nil, fmt.Errorf("%w: %s (pid %d) holds %s until %s", errFeedLocked,
+				current.Host, current.PID, path, current.Expires.Format(time.RFC3339))
+		case err != nil:
+			// Unreadable: maybe being written, only an old one is abandoned
+			info, statErr := os.Stat(path)
+			if statErr == nil && now.Sub(info.ModTime()) < ttl {
+				return nil, fmt.Errorf("%w: %s is unreadable but was written %s ago: %v", errFeedLocked,
+					path, now.Sub(info.ModTime()).Round(time.Second), err)
+			}
+		}
+
+		// Expired, take it over
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w: lost the race for %s", errFeedLocked, path)
+}
+
+// create writes the lease unless there already is one. It's written in
+// full to a temporary file first and linked into place, which fails if the
+// path exists, so no other host ever reads half a lease.
+func (l *feedLock) create() error {
+	temp, err := l.writeTemp()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp)
+	return os.Link(temp, l.path)
+}
+
+// writeTemp writes the lease to a new temporary file next to the lock and
+// returns its path.
+func (l *feedLock) writeTemp() (string, error) {
+	content, err := json.Marshal(l.lease)
+	if err != nil {
+		return "", err
+	}
+	// Hidden and .partial so --watch ignores it
+	f, err := os.CreateTemp(filepath.Dir(l.path), "."+filepath.Base(l.path)+"-*.partial")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(append(content, '\n')); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Refresh checks the lease is still ours and extends it by the TTL. Call it
+// right before writing the feed; an error means another host took over and
+// the write must be abandoned.
+func (l *feedLock) Refresh() error {
+	if err := l.verify(); err != nil {
+		return err
+	}
+
+	l.lease.Expires = time.Now().Add(l.ttl)
+	temp, err := l.writeTemp()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp, l.path); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+// Release removes the lease if we still hold it.
+func (l *feedLock) Release() error {
+	if err := l.verify(); err != nil {
+		return err
+	}
+	return os.Remove(l.path)
+}
+
+func (l *feedLock) verify() error {
+	current, err := readLease(l.path)
+	if err != nil {
+		return fmt.Errorf("%w: lease %s is gone: %v", errFeedLocked, l.path, err)
+	}
+	if current.Host != l.lease.Host || current.PID != l.lease.PID || !current.Acquired.Equal(l.lease.Acquired) {
+		return fmt.Errorf("%w: %s (pid %d) took over %s", errFeedLocked, current.Host, current.PID, l.path)
+	}
+	return nil
+}
+
+func readLease(path string) (lockLease, error) {
+	var lease lockLease
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return lease, err
+	}
+	err = json.Unmarshal(content, &lease)
+	return lease, err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFeedLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podcast.rss.lock")
+
+	lock, err := acquireFeedLock(path, time.Minute)
+	if err != nil {
+		t.Fatalf("acquireFeedLock() error = %v", err)
+	}
+
+	if _, err := acquireFeedLock(path, time.Minute); !errors.Is(err, errFeedLocked) {
+		t.Errorf("second acquireFeedLock() error = %v, want errFeedLocked", err)
+	}
+
+	if err := lock.Refresh(); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists after Release()")
+	}
+}
+
+func TestFeedLockTakesOverExpiredLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podcast.rss.lock")
+
+	stale := lockLease{
+		Host:     "other-host",
+		PID:      1234,
+		Acquired: time.Now().Add(-time.Hour),
+		Expires:  time.Now().Add(-time.Minute),
+	}
+	content, _ := json.Marshal(stale)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireFeedLock(path, time.Minute)
+	if err != nil {
+		t.Fatalf("acquireFeedLock() error = %v, want takeover of expired lease", err)
+	}
+	defer lock.Release()
+
+	current, err := readLease(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.PID != os.Getpid() {
+		t.Errorf("lease PID = %d, want %d", current.PID, os.Getpid())
+	}
+}
+
+func TestFeedLockUnreadableLease(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "podcast.rss.lock")
+
+	// Another host's lease, caught half written
+	if err := os.WriteFile(path, []byte(`{"host": "other-ho`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireFeedLock(path, time.Minute); !errors.Is(err, errFeedLocked) {
+		t.Errorf("acquireFeedLock() over a fresh unreadable lease error = %v, want errFeedLocked", err)
+	}
+
+	// Nobody's written it for longer than a lease lasts
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := acquireFeedLock(path, time.Minute)
+	if err != nil {
+		t.Fatalf("acquireFeedLock() over an abandoned unreadable lease error = %v", err)
+	}
+	if err := lock.Refresh(); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("directory has %v after Release(), want nothing", entries)
+	}
+}
+
+func TestFeedLockDetectsTakeover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podcast.rss.lock")
+
+	lock, err := acquireFeedLock(path, time.Minute)
+	if err != nil {
+		t.Fatalf("acquireFeedLock() error = %v", err)
+	}
+
+	// Simulate another host replacing our lease after it expired
+	other := lockLease{Host: "other-host", PID: 1234, Acquired: time.Now(), Expires: time.Now().Add(time.Minute)}
+	content, _ := json.Marshal(other)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lock.Refresh(); !errors.Is(err, errFeedLocked) {
+		t.Errorf("Refresh() error = %v, want errFeedLocked", err)
+	}
+	if err := lock.Release(); !errors.Is(err, errFeedLocked) {
+		t.Errorf("Release() error = %v, want errFeedLocked", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Release() removed another host's lease")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Log formats (--log-format).
+const (
+	logFormatText = "text"
+	logFormatJSON = "json" // One object per line, for log pipelines
+)
+
+// logger reports what a feed generation run is doing, on stderr at the
+// level picked with -q, -v and -vv. Outside of runs, and in tests, it
+// discards everything.
+var logger = slog.New(slog.DiscardHandler)
+
+// logLevel returns the level for the verbosity flags: errors only with -q,
+// then warnings, each file processed with -v and how every field was
+// resolved with -vv.
+func logLevel(quiet, verbose, veryVerbose bool) (slog.Level, error) {
+	switch {
+	case quiet && (verbose || veryVerbose):
+		return 0, errors.New("-q can't be combined with -v or -vv")
+	case quiet:
+		return slog.LevelError, nil
+	case veryVerbose:
+		return slog.LevelDebug, nil
+	case verbose:
+		return slog.LevelInfo, nil
+	}
+	return slog.LevelWarn, nil
+}
+
+// newLogger returns a logger writing lines at level and above to w, in a
+// --log-format. Text lines are key=value pairs without a timestamp, since
+// they're read as they're written; json lines keep theirs.
+func newLogger(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	switch format {
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})), nil
+	}
+	return nil, fmt.Errorf("--log-format must be text or json, not %q", format)
+}
+
+// logSummary logs what Summary.Print prints, for json logs: a warning
+// event per warning, then the totals at info level.
+func logSummary(s *Summary) {
+	for _, warning := range s.Warnings {
+		logger.Warn("warning", "category", warning.Category, "file", warning.File, "message", warning.Message)
+	}
+	logger.Info("finished", "books", s.Books, "episodes", s.Episodes, "warnings", len(s.Warnings), "skipped", len(s.Skipped))
+}
+
+// logResolved logs, at debug level, where the value of a field of a book or
+// episode came from, e.g. a title from the tag or the filename.
+func logResolved(file string, field string, value any, source string) {
+	logger.Debug("resolved", "file", file, "field", field, "value", value, "source", source)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		quiet, verbose, veryVerbose bool
+		want                        slog.Level
+	}{
+		{false, false, false, slog.LevelWarn},
+		{true, false, false, slog.LevelError},
+		{false, true, false, slog.LevelInfo},
+		{false, false, true, slog.LevelDebug},
+		{false, true, true, slog.LevelDebug},
+	}
+	for _, tt := range tests {
+		got, err := logLevel(tt.quiet, tt.verbose, tt.veryVerbose)
+		if err != nil || got != tt.want {
+			t.Errorf("logLevel(%v, %v, %v) = %v, %v, want %v", tt.quiet, tt.verbose, tt.veryVerbose, got, err, tt.want)
+		}
+	}
+
+	if _, err := logLevel(true, true, false); err == nil {
+		t.Error("logLevel(-q -v) error = nil, want error")
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var out bytes.Buffer
+	l, err := newLogger(&out, slog.LevelInfo, logFormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("hidden")
+	l.Info("processing", "file", "a b.mp3")
+
+	if got, want := out.String(), "level=INFO msg=processing file=\"a b.mp3\"\n"; got != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestNewLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	l, err := newLogger(&out, slog.LevelWarn, logFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Warn("warning", "category", warnMissingCover, "file", "/books/a")
+
+	var event map[string]any
+	if err := json.Unmarshal(out.Bytes(), &event); err != nil {
+		t.Fatalf("logged %q, not JSON: %v", out.String(), err)
+	}
+	for key, want := range map[string]string{"level": "WARN", "msg": "warning", "category": warnMissingCover, "file": "/books/a"} {
+		if event[key] != want {
+			t.Errorf("%s = %v, want %q", key, event[key], want)
+		}
+	}
+	if _, ok := event["time"]; !ok {
+		t.Error("json log line has no time")
+	}
+
+	if _, err := newLogger(&out, slog.LevelWarn, "yaml"); err == nil {
+		t.Error("newLogger(yaml) error = nil, want error")
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	var out bytes.Buffer
+	saved := logger
+	defer func() { logger = saved }()
+	logger, _ = newLogger(&out, slog.LevelInfo, logFormatJSON)
+
+	logSummary(&Summary{Books: 1, Episodes: 3, Warnings: []Warning{{warnMissingCover, "/books/a", "no cover image found"}}})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want a warning and the totals: %q", len(lines), out.String())
+	}
+	var finished struct {
+		Msg      string
+		Books    int
+		Episodes int
+		Warnings int
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &finished); err != nil {
+		t.Fatal(err)
+	}
+	if finished.Msg != "finished" || finished.Books != 1 || finished.Episodes != 3 || finished.Warnings != 1 {
+		t.Errorf("totals = %+v, want 1 book, 3 episodes, 1 warning", finished)
+	}
+}
+
+func TestProcessAudioFileLogsResolution(t *testing.T) {
+	var out bytes.Buffer
+	saved := logger
+	defer func() { logger = saved }()
+	logger, _ = newLogger(&out, slog.LevelDebug, logFormatText)
+
+	if _, err := processAudioFile("testdata/audiobook1/chapter01.mp3", "", "testdata/audiobook1", time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`field=title value="Chapter One" source=tag`,
+		`field=description value="The beginning of our story" source="comment tag"`,
+		`field=duration`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("log = %q, want it to contain %q", out.String(), want)
+		}
+	}
+}
@@ -1,17 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
+	"runtime"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dhowden/tag"
 )
@@ -21,49 +28,182 @@ type Episode struct {
 	Description string
 	FilePath    string
 	Duration    time.Duration
-	FileSize    int64
-	PubDate     time.Time
-	URL         string
-	EpisodeNum  int
+	// DurationSource names the DurationProvider whose estimate was used
+	DurationSource string
+	FileSize       int64
+	PubDate        time.Time
+	URL            string
+	EpisodeNum     int
+	Album          string
+	Track          int
+	EpisodeType    string // full, trailer or bonus
+	Chapters       []Chapter
+	ChaptersURL    string // Podcasting 2.0 chapters JSON, if the file has chapters
+	Transcripts    []Transcript
+	Lyrics         string // Embedded lyrics (USLT), often the chapter's text
+	Authors        []string
+	Artists        []string // The artist tag, each story's author in an anthology
+	ItemAuthors    []string // Credited on the item, set when the artists vary
+	Narrators      []string
+	Genres         []string
+	Language       string // From the tags, normalized by normalizeLanguage
+	Warnings       []Warning
 }
 
 type Podcast struct {
-	Title        string
-	Description  string
-	Episodes     []Episode
-	CoverArtURL  string
+	Title           string
+	Description     string
+	DescriptionHTML bool // Rendered from README.md, every other source is plain text
+	Episodes        []Episode
+	CoverArtURL     string
+	FeedURL         string
+	Website         string
+	Copyright       string
+	OwnerEmail      string
+	TTL             int // Minutes, 0 to omit
+	Block           bool
+	Complete        bool
+	Locked          bool
+	GUID            string // podcast:guid
+	FundingURL      string
+	FundingText     string
+	Hub             string // WebSub hub announced for push updates
+	People          []Person
+	Keywords        []string
+	Language        string
+	Series          string // From the directory name, "" if it isn't part of one
+	SeriesIndex     string
+	Rating          float64 // Stars out of 5 from the --shelf export, 0 if unrated
+	Warnings        []Warning
+	Skipped         []Skipped // Files left out by --skip-errors, --min-size or --min-duration
+}
+
+// Options controls how a directory is turned into a podcast.
+type Options struct {
+	BaseURL         string
+	FeedURL         string // Defaults to the FeedFilename URL under BaseURL
+	FeedFilename    string // Defaults to podcast.rss
+	Website         string // Defaults to the directory URL under BaseURL
+	Copyright       string
+	OwnerEmail      string
+	TTL             time.Duration
+	Block           bool          // Keep the feed out of Apple's directory
+	Complete        bool          // No more episodes will be added
+	Locked          bool          // Hosting platforms must not import the feed
+	SplitChapters   bool          // Publish each chapter of a chaptered file as an episode
+	MaxPartDuration time.Duration // Cut longer files into parts at silences (0 = never)
+	FundingURL      string
+	FundingText     string
+	Hub             string        // WebSub hub to announce in the feed and ping
+	KeepGUID        bool          // FeedURL is the real public one, save the podcast:guid derived from it
+	Trailer         time.Duration // Clip this much of the first chapter into a trailer
+	TitleTemplate   *template.Template
+	RawTitles       bool // Skip the built-in title cleanup
+	DetectLanguage  bool // Guess the language from the titles and description
+	Jobs            int  // Files probed at once (less than 1 means 1)
+	NoCache         bool // Probe every file even if the cache knows it
+	Progress        *progressMeter
+	SkipErrors      bool          // Leave out files that can't be read instead of failing
+	ActivationBytes string        // Audible key for decrypting .aax files, "" leaves them encrypted
+	MinSize         int64         // Leave out smaller files (bytes), 0 keeps everything
+	MinDuration     time.Duration // Leave out shorter episodes, 0 keeps everything
+	FolderName      string        // Read for author, series, title and year instead of the directory's name
+	Folder          *FolderName   // Already known from the library layout, FolderName isn't parsed
+	Shelf           *Shelf        // The user's Goodreads/StoryGraph export, nil for none
 }
 
 // RSS XML structures
 type RSS struct {
-	XMLName  xml.Name `xml:"rss"`
-	Version  string   `xml:"version,attr"`
-	ITunesNS string   `xml:"xmlns:itunes,attr"`
-	Channel  *Channel `xml:"channel"`
+	XMLName   xml.Name `xml:"rss"`
+	Version   string   `xml:"version,attr"`
+	ITunesNS  string   `xml:"xmlns:itunes,attr"`
+	AtomNS    string   `xml:"xmlns:atom,attr"`
+	PodcastNS string   `xml:"xmlns:podcast,attr"`
+	BookastNS string   `xml:"xmlns:bookast,attr,omitempty"`
+	Channel   *Channel `xml:"channel"`
 }
 
 type Channel struct {
-	Title         string        `xml:"title"`
-	Description   string        `xml:"description"`
-	Language      string        `xml:"language"`
-	ItunesType    string        `xml:"itunes:type"`
-	ItunesImage   *ItunesImage  `xml:"itunes:image,omitempty"`
-	LastBuildDate string        `xml:"lastBuildDate"`
-	Items         []Item        `xml:"item"`
+	Title          string          `xml:"title"`
+	Link           string          `xml:"link"`
+	Description    string          `xml:"description"`
+	AtomLinks      []AtomLink      `xml:"atom:link"`
+	Language       string          `xml:"language"`
+	ItunesType     string          `xml:"itunes:type"`
+	Keywords       string          `xml:"itunes:keywords,omitempty"`
+	Medium         string          `xml:"podcast:medium"`
+	GUID           string          `xml:"podcast:guid,omitempty"`
+	Series         *BookastSeries  `xml:"bookast:series,omitempty"`
+	Rating         string          `xml:"bookast:rating,omitempty"`
+	Persons        []PodcastPerson `xml:"podcast:person"`
+	Locked         *PodcastLocked  `xml:"podcast:locked,omitempty"`
+	Funding        *PodcastFunding `xml:"podcast:funding,omitempty"`
+	ItunesImage    *ItunesImage    `xml:"itunes:image,omitempty"`
+	Copyright      string          `xml:"copyright,omitempty"`
+	Editor         string          `xml:"managingEditor,omitempty"`
+	ItunesOwner    *ItunesOwner    `xml:"itunes:owner,omitempty"`
+	ItunesBlock    string          `xml:"itunes:block,omitempty"`
+	ItunesComplete string          `xml:"itunes:complete,omitempty"`
+	LastBuildDate  string          `xml:"lastBuildDate"`
+	Generator      string          `xml:"generator"`
+	TTL            int             `xml:"ttl,omitempty"`
+	Items          []Item          `xml:"item"`
+}
+
+type PodcastPerson struct {
+	Role  string `xml:"role,attr"`
+	Group string `xml:"group,attr,omitempty"`
+	Name  string `xml:",chardata"`
+}
+
+type PodcastLocked struct {
+	Owner string `xml:"owner,attr"`
+	Value string `xml:",chardata"`
+}
+
+type PodcastFunding struct {
+	URL  string `xml:"url,attr"`
+	Text string `xml:",chardata"`
 }
 
 type ItunesImage struct {
 	Href string `xml:"href,attr"`
 }
 
+type ItunesOwner struct {
+	Email string `xml:"itunes:email"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
 type Item struct {
-	Title          string     `xml:"title"`
-	Description    string     `xml:"description"`
-	PubDate        string     `xml:"pubDate"`
-	ItunesEpisode  int        `xml:"itunes:episode"`
-	ItunesDuration string     `xml:"itunes:duration,omitempty"`
-	Enclosure      *Enclosure `xml:"enclosure"`
-	GUID           string     `xml:"guid"`
+	Title          string              `xml:"title"`
+	Description    string              `xml:"description"`
+	PubDate        string              `xml:"pubDate"`
+	ItunesAuthor   string              `xml:"itunes:author,omitempty"`
+	ItunesEpisode  int                 `xml:"itunes:episode,omitempty"`
+	EpisodeType    string              `xml:"itunes:episodeType,omitempty"`
+	ItunesDuration string              `xml:"itunes:duration,omitempty"`
+	Enclosure      *Enclosure          `xml:"enclosure"`
+	GUID           string              `xml:"guid"`
+	Chapters       *PodcastChapters    `xml:"podcast:chapters,omitempty"`
+	Transcripts    []PodcastTranscript `xml:"podcast:transcript"`
+}
+
+type PodcastTranscript struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type PodcastChapters struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
 }
 
 type Enclosure struct {
@@ -72,120 +212,1052 @@ type Enclosure struct {
 	Type   string `xml:"type,attr"`
 }
 
+// feedFormat is an output format selected with --format.
+type feedFormat struct {
+	Filename string
+	Generate func(*Podcast) string
+}
+
+var feedFormats = map[string]feedFormat{
+	"rss":      {"podcast.rss", generateRSS},
+	"atom":     {"podcast.atom", generateAtom},
+	"jsonfeed": {"podcast.json", generateJSONFeed},
+}
+
+// defaultFundingText is the podcast:funding link text when --funding-text
+// isn't given.
+const defaultFundingText = "Support this audiobook"
+
+// audioMIMETypes are the extensions published as episodes and their
+// enclosure types. The config file's mime-types add to and override it.
+var audioMIMETypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".m4b":  "audio/mp4",
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".wma":  "audio/x-ms-wma",
+	".webm": "audio/webm",
+	".mka":  "audio/x-matroska",
+}
+
+// coverImageExts are the extensions of images used as cover art.
+var coverImageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+}
+
+// unknownMIMEType is the enclosure type of a file whose extension isn't in
+// audioMIMETypes. Claiming audio/mpeg would make apps try to play it as MP3.
+const unknownMIMEType = "application/octet-stream"
+
+// subcommands run instead of feed generation when named by the first
+// argument, e.g. "bookast transcribe <directory>".
+var subcommands = map[string]func(args []string) int{
+	"transcribe": runTranscribe,
+	"chapters":   runChapters,
+	"merge":      runMerge,
+	"cache":      runCache,
+	"enrich":     runEnrich,
+	"index":      runIndex,
+	"list":       runList,
+	"stats":      runStats,
+	"validate":   runValidate,
+	"check-urls": runCheckURLs,
+	"diff":       runDiff,
+	"serve":      runServe,
+	"token":      runToken,
+}
+
 func main() {
-	var baseURL string
-	flag.StringVar(&baseURL, "base-url", "", "Base URL for hosting the files (required)")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+	os.Exit(run())
+}
+
+// run generates the feed and returns the process exit code. It's split out of
+// main so deferred cleanup (like releasing the feed lock) runs before exiting.
+func run() int {
+	var opts Options
+	var titleTemplate string
+	var lockTTL time.Duration
+	var nativeDurations bool
+	var showVersion bool
+	var format string
+	var progress string
+	var profile string
+	var shelfPath string
+	var layout string
+	var showDiff bool
+	var dryRunFlag bool
+	var quiet, verbose, veryVerbose bool
+	var logFormat string
+	var html bool
+	var watch bool
+	var qr bool
+	var qrPNG string
+	flag.StringVar(&opts.BaseURL, "base-url", "", "Base URL for hosting the files (required)")
+	flag.StringVar(&opts.FeedURL, "feed-url", "", "Public URL of the generated feed (default: <base-url>/<directory>/podcast.rss, podcast.atom or podcast.json depending on --format)")
+	flag.StringVar(&format, "format", "rss", "Feed format: rss, atom or jsonfeed")
+	flag.StringVar(&opts.Website, "website", "", "Website for the channel <link> element (default: <base-url>/<directory>/)")
+	flag.StringVar(&opts.Copyright, "copyright", "", "Copyright notice for the channel, e.g. '© 1954 J.R.R. Tolkien'")
+	flag.StringVar(&opts.OwnerEmail, "owner-email", "", "Owner contact emitted as managingEditor and itunes:owner (required by some directories)")
+	flag.DurationVar(&opts.TTL, "ttl", 0, "How long aggregators may cache the feed before polling again, e.g. 24h (emitted as <ttl> in minutes)")
+	flag.BoolVar(&opts.Block, "block", false, "Emit itunes:block so Apple Podcasts keeps the feed out of its directory")
+	flag.BoolVar(&opts.Complete, "complete", false, "Emit itunes:complete to signal the book is finished and no episodes will be added")
+	flag.BoolVar(&opts.Locked, "locked", false, "Emit podcast:locked so hosting platforms refuse to import the feed without the --owner-email owner's consent")
+	flag.StringVar(&opts.FundingURL, "funding-url", "", "Donation page emitted as podcast:funding, e.g. https://librivox.org/pages/how-to-donate/")
+	flag.StringVar(&opts.FundingText, "funding-text", "", "Link text for --funding-url (default: "+defaultFundingText+")")
+	flag.StringVar(&opts.Hub, "hub", "", "WebSub hub to announce in the feed and ping when it changes, so apps get new books at once, e.g. https://pubsubhubbub.appspot.com/")
+	flag.BoolVar(&opts.SplitChapters, "split-chapters", false, "Losslessly cut files with chapter markers (e.g. a single .m4b) into one episode per chapter with ffmpeg")
+	flag.DurationVar(&opts.MaxPartDuration, "max-part-duration", 0, "Cut files longer than this (e.g. 3h) into parts at silences with ffmpeg, for apps that choke on huge enclosures")
+	flag.DurationVar(&opts.Trailer, "trailer", 0, "Clip the first N of chapter one (e.g. 90s) into a trailer episode, needs ffmpeg")
+	flag.StringVar(&titleTemplate, "title-template", "", "Go template for episode titles, e.g. '{{.Number}}. {{.Title}}' (fields: Title, RawTitle, Number, Track, Book, Filename)")
+	flag.BoolVar(&opts.DetectLanguage, "detect-language", false, "Guess the channel language from the titles and description when neither book.yaml nor the tags set one")
+	flag.BoolVar(&opts.RawTitles, "raw-titles", false, "Don't strip track numbers, book titles and \"Track 07\" junk from episode titles")
+	flag.DurationVar(&lockTTL, "lock-ttl", 10*time.Minute, "Lease duration of the podcast.rss.lock file that stops hosts sharing a target from regenerating the feed at the same time (0 disables locking)")
+	flag.BoolVar(&nativeDurations, "native-durations", false, "Only use the built-in duration parsers, never run ffprobe")
+	flag.StringVar(&ffprobePath, "ffprobe-path", ffprobePath, "ffprobe binary to run (default: $FFPROBE, else ffprobe on PATH)")
+	flag.IntVar(&opts.Jobs, "jobs", runtime.NumCPU(), "Number of files to read tags and durations from at once")
+	flag.BoolVar(&opts.NoCache, "no-cache", false, "Probe every file again instead of trusting the cache (e.g. after retagging files in place)")
+	flag.StringVar(&progress, "progress", progressAuto, "Progress output on stderr: auto (a bar on terminals), bar, json (one event per line) or none")
+	flag.DurationVar(&probeTimeout, "ffprobe-timeout", probeTimeout, "Kill ffprobe runs that take longer than this, e.g. on a corrupt file (0 disables the limit)")
+	flag.BoolVar(&opts.SkipErrors, "skip-errors", false, "Leave out audio files that can't be read and list them at the end, instead of failing")
+	flag.Func("min-size", "Leave out audio files smaller than this, e.g. 100k or 1M (zero-byte files, broken downloads)", func(s string) error {
+		size, err := parseByteSize(s)
+		opts.MinSize = size
+		return err
+	})
+	flag.DurationVar(&opts.MinDuration, "min-duration", 0, "Leave out episodes shorter than this, e.g. 10s (\"This is Audible\" stubs, silence tracks)")
+	flag.BoolVar(&showDiff, "diff", false, "Before writing podcast.rss, print what changes for subscribers compared with the one already there")
+	flag.BoolVar(&dryRunFlag, "dry-run", false, "Scan and generate everything, but only list the feeds, sidecars and caches that would be written, without writing them")
+	flag.StringVar(&layout, "layout", "", "Treat the directory as a library of books laid out like audiobookshelf (Author/[Series/]Book) and write a feed for every book")
+	flag.StringVar(&shelfPath, "shelf", "", "Goodreads or StoryGraph CSV export to take series, ratings and reviews from (default: shelf in the config file)")
+	flag.StringVar(&opts.ActivationBytes, "activation-bytes", "", "Audible activation bytes (8 hex digits) for decrypting .aax files with ffmpeg (default: activation-bytes in the config file)")
+	flag.BoolVar(&requireDuration, "require-duration", false, "Fail instead of leaving out itunes:duration when a file's duration can't be found")
+	flag.BoolVar(&html, "html", false, "Also write an index.html next to each feed, with the cover, description, episodes and a Subscribe link, and one listing the books with --layout")
+	flag.BoolVar(&watch, "watch", false, "After generating, keep watching the directory and regenerate the feeds of books whose files change, or that are added to the library")
+	flag.BoolVar(&qr, "qr", false, "Print a QR code of each feed's URL, to subscribe on a phone with its camera")
+	flag.StringVar(&qrPNG, "qr-png", "", "Write each feed's QR code to a PNG in this directory, named after the book")
+	flag.StringVar(&profile, "profile", "", "Write a cpu, mem or trace profile to the current directory and print where the time went")
+	flag.BoolVar(&quiet, "q", false, "Only print errors, not the summary")
+	flag.BoolVar(&verbose, "v", false, "Log each file as it's processed and each file left out")
+	flag.BoolVar(&veryVerbose, "vv", false, "Also log where every title, description and duration came from (tag, filename, metadata file...)")
+	flag.StringVar(&logFormat, "log-format", logFormatText, "Log format on stderr: text or json (one object per line, which also replaces the summary)")
+	flag.BoolVar(&showVersion, "version", false, "Print the version and exit")
+	// Parse errors exit with exitUsage, not the flag package's 2
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err == flag.ErrHelp {
+		return exitOK
+	} else if err != nil {
+		return exitUsage
+	}
 
-	if baseURL == "" {
+	if showVersion {
+		fmt.Println(generatorName())
+		return exitOK
+	}
+
+	if opts.BaseURL == "" {
 		fmt.Fprintf(os.Stderr, "Error: --base-url is required\n")
-		os.Exit(1)
+		return exitUsage
 	}
+	opts.KeepGUID = true
 
 	if flag.NArg() != 1 {
 		fmt.Fprintf(os.Stderr, "Usage: %s --base-url <url> <directory>\n", os.Args[0])
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "       %s --base-url <url> --layout audiobookshelf <library>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s transcribe [flags] <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s list [flags] <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s stats [flags] <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s validate [flags] <feed>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s check-urls [flags] <feed>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s diff <old feed> <new feed>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s serve [flags] <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s token create|list|revoke [flags] [<name>] <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s chapters [flags] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s merge [flags] <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s index --db <file> --base-url <url> <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s enrich [flags] <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s cache clear|path\n", os.Args[0])
+		return exitUsage
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if opts.ActivationBytes == "" {
+		opts.ActivationBytes = config.ActivationBytes
+	}
+	for ext, mimeType := range config.MIMETypes {
+		audioMIMETypes[ext] = mimeType
+	}
+	if shelfPath == "" {
+		shelfPath = config.Shelf
+	}
+	if shelfPath != "" {
+		opts.Shelf, err = loadShelf(shelfPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --shelf: %v\n", err)
+			return exitError
+		}
+	}
+	if opts.ActivationBytes != "" {
+		if err := checkActivationBytes(opts.ActivationBytes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	output, ok := feedFormats[format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: --format must be rss, atom or jsonfeed, not %q\n", format)
+		return exitUsage
+	}
+	opts.FeedFilename = output.Filename
+	if showDiff && format != "rss" {
+		fmt.Fprintf(os.Stderr, "Error: --diff only compares rss feeds\n")
+		return exitUsage
+	}
+	var diffOutput io.Writer
+	if showDiff {
+		diffOutput = os.Stdout
+	}
+	if dryRunFlag {
+		dryRun = &dryRunPlan{}
+		defer func() { dryRun = nil }()
+	}
+
+	if watch && dryRunFlag {
+		fmt.Fprintf(os.Stderr, "Error: --watch can't be used with --dry-run\n")
+		return exitUsage
+	}
+
+	if opts.MaxPartDuration < 0 || (opts.MaxPartDuration > 0 && opts.MaxPartDuration < minPartDuration) {
+		fmt.Fprintf(os.Stderr, "Error: --max-part-duration must be at least %s\n", minPartDuration)
+		return exitUsage
+	}
+
+	if profile != "" {
+		stop, err := startProfile(profile, os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer stop()
+	}
+
+	level, err := logLevel(quiet, verbose, veryVerbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	// A json log replaces the summary, so it includes the feeds written
+	if logFormat == logFormatJSON && level == slog.LevelWarn {
+		level = slog.LevelInfo
+	}
+	logger, err = newLogger(os.Stderr, level, logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	// The progress bar would be torn up by the lines -v logs for each file
+	if level <= slog.LevelInfo && progress == progressAuto {
+		progress = progressNone
+	}
+
+	meter, err := newProgressMeter(progress, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	opts.Progress = meter
+
+	if opts.Jobs < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --jobs must be at least 1\n")
+		return exitUsage
+	}
+
+	if opts.TTL < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --ttl must not be negative\n")
+		return exitUsage
+	}
+
+	if opts.OwnerEmail != "" && !strings.Contains(opts.OwnerEmail, "@") {
+		fmt.Fprintf(os.Stderr, "Error: --owner-email %q is not an email address\n", opts.OwnerEmail)
+		return exitUsage
+	}
+
+	if opts.Locked && opts.OwnerEmail == "" {
+		fmt.Fprintf(os.Stderr, "Error: --locked needs --owner-email, platforms verify ownership through it\n")
+		return exitUsage
+	}
+
+	if opts.FundingText != "" && opts.FundingURL == "" {
+		fmt.Fprintf(os.Stderr, "Error: --funding-text needs --funding-url\n")
+		return exitUsage
+	}
+
+	if opts.FundingURL != "" {
+		if u, err := url.Parse(opts.FundingURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: --funding-url %q is not an http(s) URL\n", opts.FundingURL)
+			return exitUsage
+		}
+	}
+
+	if opts.Hub != "" {
+		if u, err := url.Parse(opts.Hub); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: --hub %q is not an http(s) URL\n", opts.Hub)
+			return exitUsage
+		}
 	}
 
+	// Podcasting 2.0 asks apps to truncate anything longer
+	if utf8.RuneCountInString(opts.FundingText) > 128 {
+		fmt.Fprintf(os.Stderr, "Error: --funding-text must be at most 128 characters\n")
+		return exitUsage
+	}
+
+	if nativeDurations {
+		durationProviders = nativeDurationProviders
+	} else if ffprobePath != "ffprobe" {
+		// A configured ffprobe that isn't there is a mistake, not a missing
+		// optional tool
+		if _, err := exec.LookPath(ffprobePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: ffprobe %q not found: %v\n", ffprobePath, err)
+			return exitMissingTool
+		}
+	}
+
+	tmpl, err := parseTitleTemplate(titleTemplate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --title-template: %v\n", err)
+		return exitUsage
+	}
+	opts.TitleTemplate = tmpl
+
 	directory := flag.Arg(0)
 	if _, err := os.Stat(directory); os.IsNotExist(err) {
 		fmt.Fprintf(os.Stderr, "Error: Directory '%s' does not exist\n", directory)
-		os.Exit(1)
+		return exitUsage
 	}
 
-	podcast, err := scanDirectory(directory, baseURL)
+	if layout != "" && (opts.FeedURL != "" || opts.Website != "") {
+		fmt.Fprintf(os.Stderr, "Error: --feed-url and --website name one feed, they can't be used with --layout\n")
+		return exitUsage
+	}
+	books, err := findBooks(directory, layout)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCode(err)
 	}
 
-	if len(podcast.Episodes) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: No audio files found in directory '%s'\n", directory)
-		os.Exit(1)
+	// publish writes the feed of book, and its page with --html, adding it
+	// to summary
+	libraryPage := map[string]libraryPageBook{}
+	publish := func(book libraryBook, summary *Summary) error {
+		bookOpts := opts
+		bookOpts.BaseURL = book.baseURL(opts.BaseURL)
+		bookOpts.Folder = book.Folder
+		logger.Info("publishing", "dir", book.Dir)
+		podcast, feedFile, err := publishFeed(book.Dir, bookOpts, output, lockTTL, diffOutput)
+		if err != nil {
+			return err
+		}
+		logger.Info("generated", "feed", feedFile, "episodes", len(podcast.Episodes))
+		summary.Add(podcast, feedFile)
+		// The feed is written, a hub that's down only delays the apps
+		if opts.Hub != "" && dryRun == nil {
+			if pinged, err := notifyHub(book.Dir, podcast); err != nil {
+				logger.Warn("WebSub ping failed", "hub", opts.Hub, "feed", podcast.FeedURL, "error", err)
+			} else if pinged {
+				logger.Info("pinged hub", "hub", opts.Hub, "feed", podcast.FeedURL)
+			}
+		}
+		if html {
+			page, err := generateBookPage(podcast, output)
+			if err == nil {
+				err = writeFileIfChanged(filepath.Join(book.Dir, bookPageFile), page)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", bookPageFile, err)
+			}
+			libraryPage[book.Dir] = newLibraryPageBook(directory, book.Dir, podcast)
+		}
+		return nil
+	}
+	// writeLibraryPage writes the --html page of a --layout library's books
+	writeLibraryPage := func(books []libraryBook) error {
+		var entries []libraryPageBook
+		for _, book := range books {
+			if entry, ok := libraryPage[book.Dir]; ok {
+				entries = append(entries, entry)
+			}
+		}
+		if layout == "" || len(entries) == 0 {
+			return nil
+		}
+		page, err := generateLibraryPage(entries)
+		if err == nil {
+			err = writeFileIfChanged(filepath.Join(directory, bookPageFile), page)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", bookPageFile, err)
+		}
+		return nil
 	}
 
-	rssContent := generateRSS(podcast)
-	rssFile := filepath.Join(directory, "podcast.rss")
+	// One broken book shouldn't keep the rest of a library from its feeds,
+	// nor one that's still being copied in from being watched
+	summary := &Summary{}
+	failed := 0
+	failedCode := exitOK
+	for _, book := range books {
+		if err := publish(book, summary); err != nil {
+			if layout == "" && !watch && logFormat == logFormatText {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitCode(err)
+			}
+			logger.Error("publishing failed", "dir", book.Dir, "error", err)
+			if layout == "" && !watch {
+				return exitCode(err)
+			}
+			// Books failing differently fail the library with exitError
+			if code := exitCode(err); failed == 0 {
+				failedCode = code
+			} else if code != failedCode {
+				failedCode = exitError
+			}
+			failed++
+		}
+	}
+	if err := writeLibraryPage(books); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	switch {
+	case logFormat == logFormatJSON:
+		logSummary(summary)
+	case !quiet:
+		summary.Print(os.Stdout)
+	}
+	if qr || qrPNG != "" {
+		var terminal io.Writer
+		if qr {
+			terminal = os.Stdout
+		}
+		if err := writeFeedQRCodes(terminal, summary.Feeds, directory, qrPNG); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: QR codes: %v\n", err)
+			return exitError
+		}
+	}
+	if dryRun != nil {
+		dryRun.Print(os.Stdout)
+	}
+	if watch {
+		return watchAndPublish(directory, layout, publish, writeLibraryPage, quiet, logFormat)
+	}
+	if failed > 0 && logFormat == logFormatJSON {
+		logger.Error("books failed", "failed", failed, "books", len(books))
+		return failedCode
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s of %d failed\n", plural(failed, "book"), len(books))
+		return failedCode
+	}
+	if summary.Unreadable() > 0 {
+		return exitSkipped
+	}
+	return exitOK
+}
 
-	err = os.WriteFile(rssFile, []byte(rssContent), 0644)
+// publishFeed generates the feed for the book in directory and writes it
+// next to the audio, holding the feed lock (unless lockTTL is 0) meanwhile.
+// With a diff writer, how the feed differs from the one it replaces is
+// printed there first. It returns the podcast and the feed's path.
+func publishFeed(directory string, opts Options, output feedFormat, lockTTL time.Duration, diff io.Writer) (*Podcast, string, error) {
+	feedFile := filepath.Join(directory, output.Filename)
+
+	var lock *feedLock
+	if lockTTL > 0 && dryRun == nil {
+		var err error
+		lock, err = acquireFeedLock(feedFile+".lock", lockTTL)
+		if err != nil {
+			return nil, "", err
+		}
+		defer lock.Release()
+	}
+
+	podcast, err := scanDirectory(directory, opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing RSS file: %v\n", err)
-		os.Exit(1)
+		return nil, "", fmt.Errorf("scanning directory: %w", err)
 	}
 
-	fmt.Printf("Generated RSS feed: %s\n", rssFile)
-	fmt.Printf("Found %d episodes\n", len(podcast.Episodes))
+	if len(podcast.Episodes) == 0 {
+		if len(podcast.Skipped) > 0 {
+			var msg strings.Builder
+			fmt.Fprintf(&msg, "all %s in directory '%s' were skipped:", plural(len(podcast.Skipped), "audio file"), directory)
+			for _, s := range podcast.Skipped {
+				fmt.Fprintf(&msg, "\n  %s: %s", s.File, s.Reason)
+			}
+			return nil, "", fmt.Errorf("%w: %s", errNoAudio, msg.String())
+		}
+		return nil, "", fmt.Errorf("%w in directory '%s'", errNoAudio, directory)
+	}
+
+	feedContent := output.Generate(podcast)
+
+	if diff != nil {
+		if err := printFeedDiff(diff, feedFile, []byte(feedContent)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if lock != nil {
+		if err := lock.Refresh(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	done := timePhase(phaseWriting)
+	if dryRun != nil {
+		dryRun.add(feedFile, len(feedContent))
+	} else {
+		err = os.WriteFile(feedFile, []byte(feedContent), 0644)
+	}
+	done()
+	if err != nil {
+		return nil, "", fmt.Errorf("writing feed file: %v", err)
+	}
+	return podcast, feedFile, nil
 }
 
-func scanDirectory(dir string, baseURL string) (*Podcast, error) {
+func scanDirectory(dir string, opts Options) (*Podcast, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
 
+	folderName := opts.FolderName
+	if folderName == "" {
+		folderName = filepath.Base(filepath.Clean(dir))
+	}
+	book, err := loadBookConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := loadBookMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+	sidecar, err := loadSidecar(dir)
+	if err != nil {
+		return nil, err
+	}
+	sidecar.fillBook(book)
+	folder := parseFolderName(folderName)
+	if opts.Folder != nil {
+		folder = *opts.Folder
+	}
+	shelfAuthors := book.Authors
+	if len(shelfAuthors) == 0 {
+		shelfAuthors = splitNames(folder.Author)
+	}
+	shelfBook := opts.Shelf.find(folder.Title, shelfAuthors, normalizeISBN(book.ISBN))
+	folder = sidecar.overFolder(metadata.overFolder(shelfBook.overFolder(folder)))
+	if folder.Title == "" {
+		folder.Title = folderName
+	}
+	titleSource := "directory name"
+	if sidecar != nil && sidecar.Title != "" {
+		titleSource = sidecar.File
+	} else if metadata != nil && metadata.Title != "" {
+		titleSource = metadataFile
+	}
+	logResolved(dir, "title", folder.Title, titleSource)
 	podcast := &Podcast{
-		Title:       filepath.Base(dir),
-		Description: fmt.Sprintf("Audiobook podcast for %s", filepath.Base(dir)),
+		Title:       folder.Title,
+		Description: fmt.Sprintf("Audiobook podcast for %s", folder.Title),
 		Episodes:    []Episode{},
+		Series:      folder.Series,
+		SeriesIndex: folder.SeriesIndex,
 	}
 
-	var audioFiles []string
-	var coverArtFile string
-	supportedAudioExts := map[string]bool{
-		".mp3":  true,
-		".m4a":  true,
-		".m4b":  true,
-		".aac":  true,
-		".flac": true,
-		".ogg":  true,
+	description, descriptionHTML, err := readDescription(dir)
+	if err != nil {
+		return nil, err
+	}
+	podcast.DescriptionHTML = descriptionHTML
+	descriptionSource := "description file"
+	if description == "" && sidecar != nil {
+		description, descriptionSource = sidecar.Description, sidecar.File
+	}
+	if description == "" && metadata != nil {
+		description, descriptionSource = metadata.Description, metadataFile
 	}
-	supportedImageExts := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
+	if description == "" && shelfBook != nil {
+		description, descriptionSource = shelfBook.Review, "shelf review"
+	}
+	if shelfBook != nil {
+		podcast.Rating = shelfBook.Rating
+	}
+	if description != "" {
+		podcast.Description = description
+		logResolved(dir, "description", description, descriptionSource)
+	} else {
+		podcast.Warnings = append(podcast.Warnings, Warning{warnGenericDescription, dir, "no description.txt, README.md or bookast enrich description, using a generic description"})
 	}
 
+	var audioFiles []string
+	var coverArtFile string
+
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 
 		ext := strings.ToLower(filepath.Ext(entry.Name()))
-		if supportedAudioExts[ext] {
+		if audioMIMETypes[ext] != "" || drmAudioExts[ext] {
+			if opts.MinSize > 0 {
+				info, err := entry.Info()
+				if err != nil {
+					return nil, err
+				}
+				if reason := tooSmall(info.Size(), opts.MinSize); reason != "" {
+					podcast.Skipped = append(podcast.Skipped, Skipped{File: filepath.Join(dir, entry.Name()), Reason: reason})
+					logger.Info("skipped", "file", filepath.Join(dir, entry.Name()), "reason", reason)
+					continue
+				}
+			}
 			audioFiles = append(audioFiles, entry.Name())
-		} else if supportedImageExts[ext] && coverArtFile == "" {
+		} else if coverImageExts[ext] && (coverArtFile == "" || !isCoverName(coverArtFile) && isCoverName(entry.Name())) {
 			coverArtFile = entry.Name()
 		}
 	}
 
-	sort.Strings(audioFiles)
+	sortFilenames(audioFiles)
+
+	if opts.ActivationBytes != "" {
+		audioFiles, err = decryptAAX(dir, audioFiles, opts.ActivationBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	cues, err := readCueSheets(dir, audioFiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(cues) > 0 || opts.SplitChapters {
+		audioFiles, err = splitChapters(dir, audioFiles, cues, opts.SplitChapters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.MaxPartDuration > 0 {
+		audioFiles, err = splitLongFiles(dir, audioFiles, opts.MaxPartDuration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Trailer > 0 {
+		audioFiles, err = addTrailer(dir, audioFiles, opts.Trailer, podcast.Title, book)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Trailers aren't numbered, numbers count the book's chapters
+	epTypes := make([]string, len(audioFiles))
+	nums := make([]int, len(audioFiles))
+	episodeNum := 0
+	for i, filename := range audioFiles {
+		epTypes[i] = episodeType(filename, book)
+		if epTypes[i] != "trailer" {
+			episodeNum++
+			nums[i] = episodeNum
+		}
+	}
+
+	// Probing is the slow part, everything after it is cheap and in order
 	now := time.Now()
+	var cache *fileCache
+	if !opts.NoCache {
+		cachePath, err := bookCachePath(dir)
+		if err != nil {
+			return nil, err
+		}
+		cache = loadFileCache(cachePath)
+	}
+	episodes := make([]*Episode, len(audioFiles))
+	errs := make([]error, len(audioFiles))
+	opts.Progress.Start(len(audioFiles))
+	runParallel(len(audioFiles), opts.Jobs, func(i int) {
+		logger.Info("processing", "file", filepath.Join(dir, audioFiles[i]))
+		opts.Progress.Begin(audioFiles[i])
+		episodes[i], errs[i] = processAudioFileCached(cache, filepath.Join(dir, audioFiles[i]), opts.BaseURL, dir, now.Add(time.Duration(i)*time.Second), nums[i])
+		opts.Progress.Done(audioFiles[i])
+	})
+	opts.Progress.Finish()
+	dups := findDuplicates(cache, dir, audioFiles, episodes)
+	if err := cache.save(); err != nil {
+		return nil, fmt.Errorf("failed to save the cache: %v", err)
+	}
+
 	for i, filename := range audioFiles {
+		if errs[i] != nil {
+			if !opts.SkipErrors {
+				return nil, fmt.Errorf("%w %s: %w", errProcessing, filename, errs[i])
+			}
+			podcast.Skipped = append(podcast.Skipped, Skipped{File: filepath.Join(dir, filename), Reason: errs[i].Error(), Unreadable: true})
+			logger.Info("skipped", "file", filepath.Join(dir, filename), "reason", errs[i])
+			continue
+		}
 		fullPath := filepath.Join(dir, filename)
-		episode, err := processAudioFile(fullPath, baseURL, dir, now.Add(time.Duration(i)*time.Second), i+1)
-		if err != nil {
-			return nil, fmt.Errorf("failed to process %s: %v", filename, err)
+		if kept, ok := dups[i]; ok {
+			podcast.Warnings = append(podcast.Warnings, Warning{warnDuplicateFile, fullPath, "same audio as " + audioFiles[kept] + ", not published"})
+			continue
+		}
+		episode := episodes[i]
+		if reason := tooShort(episode.Duration, opts.MinDuration); reason != "" {
+			podcast.Skipped = append(podcast.Skipped, Skipped{File: fullPath, Reason: reason})
+			logger.Info("skipped", "file", fullPath, "reason", reason)
+			continue
+		}
+		episode.EpisodeType = epTypes[i]
+		if len(episode.Chapters) > 0 {
+			chaptersFile, err := writeChaptersFile(fullPath, episode.Chapters)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write chapters for %s: %v", filename, err)
+			}
+			episode.ChaptersURL = buildURL(opts.BaseURL, dir, chaptersFile)
+		}
+		episode.Transcripts = findTranscripts(opts.BaseURL, dir, filename)
+		if episode.Lyrics != "" && !hasTranscriptType(episode.Transcripts, "text/plain") {
+			lyricsFile, err := writeLyricsTranscript(fullPath, episode.Lyrics)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write lyrics transcript for %s: %v", filename, err)
+			}
+			episode.Transcripts = append(episode.Transcripts, Transcript{URL: buildURL(opts.BaseURL, dir, lyricsFile), Type: "text/plain"})
 		}
 		podcast.Episodes = append(podcast.Episodes, *episode)
+		podcast.Warnings = append(podcast.Warnings, episode.Warnings...)
+	}
+
+	// Close the gaps skipped and duplicate files left in the numbering
+	episodeNum = 0
+	for i := range podcast.Episodes {
+		if podcast.Episodes[i].EpisodeType != "trailer" {
+			episodeNum++
+			podcast.Episodes[i].EpisodeNum = episodeNum
+		}
+	}
+
+	var folderAuthors []string
+	if folder.Author != "" {
+		folderAuthors = splitNames(folder.Author)
+	}
+	fallbackNarrators := splitNames(folder.Narrator)
+	if metadata != nil && len(metadata.Narrators) > 0 {
+		fallbackNarrators = metadata.Narrators
+	}
+	podcast.People = bookPeople(podcast.Episodes, book, folderAuthors, fallbackNarrators)
+	if mismatch := metadata.runtimeMismatch(podcast.Episodes); mismatch != "" {
+		podcast.Warnings = append(podcast.Warnings, Warning{warnRuntimeMismatch, dir, mismatch})
+	}
+	setItemAuthors(podcast.Episodes)
+	podcast.Keywords = bookKeywords(podcast.Episodes, book)
+	podcast.Language, err = bookLanguage(podcast, book, opts.DetectLanguage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyTitles(podcast, opts); err != nil {
+		return nil, err
 	}
+	applySeries(podcast)
 
 	// Set cover art URL if image file found
 	if coverArtFile != "" {
-		dirName := filepath.Base(dir)
-		escapedDir := url.PathEscape(dirName)
-		escapedFile := url.PathEscape(coverArtFile)
-		podcast.CoverArtURL = strings.TrimSuffix(baseURL, "/") + "/" + escapedDir + "/" + escapedFile
+		podcast.CoverArtURL = buildURL(opts.BaseURL, dir, coverArtFile)
+	} else {
+		podcast.Warnings = append(podcast.Warnings, Warning{warnMissingCover, dir, "no cover image found"})
+	}
+
+	podcast.FeedURL = opts.FeedURL
+	if podcast.FeedURL == "" {
+		feedFilename := opts.FeedFilename
+		if feedFilename == "" {
+			feedFilename = "podcast.rss"
+		}
+		podcast.FeedURL = buildURL(opts.BaseURL, dir, feedFilename)
 	}
 
+	state, err := loadBookState(dir)
+	if err != nil {
+		return nil, err
+	}
+	podcast.GUID = state.PodcastGUID
+	if podcast.GUID == "" {
+		// Only a feed being published at its real URL gets to fix the GUID,
+		// not bookast list or the Host of serve's first request
+		podcast.GUID = podcastGUID(podcast.FeedURL)
+		if opts.KeepGUID {
+			state.PodcastGUID = podcast.GUID
+			if err := saveBookState(dir, state); err != nil {
+				return nil, fmt.Errorf("failed to save %s: %v", stateFile, err)
+			}
+		}
+	}
+
+	podcast.Website = opts.Website
+	if podcast.Website == "" {
+		podcast.Website = buildURL(opts.BaseURL, dir, "")
+	}
+
+	podcast.Copyright = opts.Copyright
+	if podcast.Copyright == "" {
+		podcast.Copyright = folderCopyright(folder.Year, podcast.People)
+	}
+	podcast.OwnerEmail = opts.OwnerEmail
+	podcast.TTL = int((opts.TTL + time.Minute - 1) / time.Minute)
+	podcast.Block = opts.Block
+	podcast.Complete = opts.Complete
+	podcast.Locked = opts.Locked
+	podcast.FundingURL = opts.FundingURL
+	podcast.FundingText = opts.FundingText
+	if podcast.FundingURL != "" && podcast.FundingText == "" {
+		podcast.FundingText = defaultFundingText
+	}
+	podcast.Hub = opts.Hub
+
 	return podcast, nil
 }
 
+// writeFileIfChanged writes data to path unless the file already holds it, so
+// generated sidecars keep modification times that are useful to web servers.
+func writeFileIfChanged(path string, data []byte) error {
+	defer timePhase(phaseWriting)()
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	if dryRun != nil {
+		dryRun.add(path, len(data))
+		return nil
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// writeSecretFileIfChanged is writeFileIfChanged for files holding feed
+// tokens: only the owner may read them, and they're replaced by renaming a
+// finished temporary file over them, so a reader never sees half of one.
+func writeSecretFileIfChanged(path string, data []byte) error {
+	defer timePhase(phaseWriting)()
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		// Written world-readable by an older version
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0600 && dryRun == nil {
+			return os.Chmod(path, 0600)
+		}
+		return nil
+	}
+	if dryRun != nil {
+		dryRun.add(path, len(data))
+		return nil
+	}
+	// Made 0600, hidden and .partial so --watch ignores it
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.partial")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readTags returns the tags of the file at path, or nil if it can't be read.
+func readTags(path string) tag.Metadata {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	defer timePhase(phaseTags)()
+	metadata, err := tag.ReadFrom(file)
+	if err != nil {
+		if hasProbedTags(path) {
+			return probeTags(path)
+		}
+		return nil
+	}
+	return metadata
+}
+
+// listAudioFiles returns the sorted names of the audio files in dir.
+func listAudioFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var audioFiles []string
+	for _, entry := range entries {
+		if !entry.IsDir() && audioMIMETypes[strings.ToLower(filepath.Ext(entry.Name()))] != "" {
+			audioFiles = append(audioFiles, entry.Name())
+		}
+	}
+	sortFilenames(audioFiles)
+	return audioFiles, nil
+}
+
+// addTrailer generates the trailer from the first full episode and moves it
+// to the front of audioFiles.
+func addTrailer(dir string, audioFiles []string, length time.Duration, bookTitle string, book *BookConfig) ([]string, error) {
+	var rest []string
+	source := ""
+	for _, filename := range audioFiles {
+		if strings.HasPrefix(filename, trailerBaseName+".") {
+			continue
+		}
+		if source == "" && episodeType(filename, book) == "full" {
+			source = filename
+		}
+		rest = append(rest, filename)
+	}
+	if source == "" {
+		return nil, fmt.Errorf("--trailer: no full episode to clip a trailer from")
+	}
+
+	trailer, err := ensureTrailer(dir, source, length, bookTitle)
+	if err != nil || trailer == "" {
+		return rest, err
+	}
+	return append([]string{trailer}, rest...), nil
+}
+
+// readDescription returns the channel description from description.txt (used
+// verbatim) or README.md (rendered to HTML, and then isHTML is true). It
+// returns "" if neither exists.
+func readDescription(dir string) (description string, isHTML bool, err error) {
+	candidates := []struct {
+		name     string
+		markdown bool
+	}{
+		{"description.txt", false},
+		{"README.md", true},
+		{"readme.md", true},
+		{"desc.txt", false}, // audiobookshelf's
+	}
+
+	for _, c := range candidates {
+		content, err := os.ReadFile(filepath.Join(dir, c.name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+
+		text := strings.TrimSpace(string(content))
+		if text == "" {
+			continue
+		}
+		if c.markdown {
+			description, err := renderMarkdown(text)
+			if err != nil {
+				return "", false, fmt.Errorf("%s: %v", c.name, err)
+			}
+			return description, true, nil
+		}
+		return text, false, nil
+	}
+
+	return "", false, nil
+}
+
+// isCoverName reports whether an image is named cover.jpg, cover.png...,
+// which wins over other images in the directory (back covers, inlays).
+func isCoverName(name string) bool {
+	return strings.EqualFold(strings.TrimSuffix(name, filepath.Ext(name)), "cover")
+}
+
+// buildURL returns the public URL of filename inside dir, escaping both path
+// segments.
+// buildURL returns the URL of filename, a path relative to dir.
+func buildURL(baseURL string, dir string, filename string) string {
+	segments := strings.Split(filepath.ToSlash(filename), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escapedDir := url.PathEscape(filepath.Base(dir))
+	return strings.TrimSuffix(baseURL, "/") + "/" + escapedDir + "/" + strings.Join(segments, "/")
+}
+
+// ffprobePath is the ffprobe binary to run: --ffprobe-path, else $FFPROBE,
+// else the one on PATH.
+var ffprobePath = defaultFFprobePath()
+
+func defaultFFprobePath() string {
+	if path := os.Getenv("FFPROBE"); path != "" {
+		return path
+	}
+	return "ffprobe"
+}
+
+// probeTimeout bounds every ffprobe (and ffmpeg -i) run, 0 means no limit.
+// A corrupt file can make them hang forever.
+var probeTimeout = 2 * time.Minute
+
+var errProbeTimeout = errors.New("timed out")
+
+// runProbe runs a probing command and returns its output (including stderr
+// when combined), killing it after probeTimeout.
+func runProbe(combined bool, name string, args ...string) ([]byte, error) {
+	defer timePhase(phaseProbe)()
+	ctx := context.Background()
+	if probeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	// Don't wait on pipes held open by anything the killed process left behind
+	cmd.WaitDelay = time.Second
+	var output []byte
+	var err error
+	if combined {
+		output, err = cmd.CombinedOutput()
+	} else {
+		output, err = cmd.Output()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("%s %w after %s", filepath.Base(name), errProbeTimeout, probeTimeout)
+	}
+	return output, err
+}
+
 func getDurationWithFFmpeg(filePath string) (time.Duration, error) {
-	cmd := exec.Command("ffprobe", "-v", "quiet", "-show_entries", "format=duration", "-of", "csv=p=0", filePath)
-	output, err := cmd.Output()
+	output, err := runProbe(false, ffprobePath, "-v", "quiet", "-show_entries", "format=duration", "-of", "csv=p=0", filePath)
 	if err != nil {
-		return 0, fmt.Errorf("ffprobe failed: %v", err)
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
 	}
 
 	durationStr := strings.TrimSpace(string(output))
@@ -202,6 +1274,10 @@ func getDurationWithFFmpeg(filePath string) (time.Duration, error) {
 }
 
 func processAudioFile(filePath string, baseURL string, baseDir string, pubDate time.Time, episodeNum int) (*Episode, error) {
+	if err := checkAudioFile(filePath); err != nil {
+		return nil, err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
@@ -213,45 +1289,82 @@ func processAudioFile(filePath string, baseURL string, baseDir string, pubDate t
 		return nil, err
 	}
 
+	done := timePhase(phaseTags)
 	metadata, err := tag.ReadFrom(file)
+	done()
+	if err != nil && hasProbedTags(filePath) {
+		metadata, err = probeTags(filePath), nil
+	}
 	if err != nil {
-		return nil, err
+		return nil, diagnoseAudioFile(filePath, err)
 	}
 
 	filename := filepath.Base(filePath)
-	dirName := filepath.Base(baseDir)
+	relPath, err := filepath.Rel(baseDir, filePath)
+	if err != nil {
+		relPath = filename
+	}
+	fileURL := buildURL(baseURL, baseDir, relPath)
 
-	escapedDir := url.PathEscape(dirName)
-	escapedFile := url.PathEscape(filename)
-	fileURL := strings.TrimSuffix(baseURL, "/") + "/" + escapedDir + "/" + escapedFile
+	var warnings []Warning
 
 	title := metadata.Title()
 	if title == "" {
-		title = strings.TrimSuffix(filename, filepath.Ext(filename))
+		title = titleFromFilename(filename)
+		warnings = append(warnings, Warning{warnMissingTitle, filePath, "no title tag, using the filename"})
+		logResolved(filePath, "title", title, "filename")
+	} else {
+		logResolved(filePath, "title", title, "tag")
 	}
 
 	description := ""
 	comment := metadata.Comment()
 	if comment != "" && comment != "iTunPGAP" {
 		description = comment
+		logResolved(filePath, "description", description, "comment tag")
 	} else {
 		description = title
+		logResolved(filePath, "description", description, "title")
 	}
 
-	duration, err := getDurationWithFFmpeg(filePath)
+	duration, candidates, err := resolveDuration(filePath, metadata, durationProviders)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get duration: %v", err)
+		if requireDuration {
+			return nil, fmt.Errorf("failed to get duration: %w", err)
+		}
+		warnings = append(warnings, Warning{warnMissingDuration, filePath, "no duration, itunes:duration left out (" + err.Error() + ")"})
+	} else {
+		logResolved(filePath, "duration", duration.Duration, duration.Source)
+	}
+	for _, d := range durationDiscrepancies(duration, candidates) {
+		warnings = append(warnings, Warning{warnDurationMismatch, filePath, "duration sources disagree: " + d})
 	}
 
+	// Chapters are optional, a file whose chapters can't be read just has none
+	chapters, _ := readChapters(filePath, metadata)
+
+	track, _ := metadata.Track()
+
 	episode := &Episode{
-		Title:       title,
-		Description: description,
-		FilePath:    filePath,
-		Duration:    duration,
-		FileSize:    fileInfo.Size(),
-		PubDate:     pubDate,
-		URL:         fileURL,
-		EpisodeNum:  episodeNum,
+		Title:          title,
+		Description:    description,
+		FilePath:       filePath,
+		Duration:       duration.Duration,
+		DurationSource: duration.Source,
+		FileSize:       fileInfo.Size(),
+		PubDate:        pubDate,
+		URL:            fileURL,
+		EpisodeNum:     episodeNum,
+		Album:          metadata.Album(),
+		Track:          track,
+		Chapters:       chapters,
+		Lyrics:         strings.TrimSpace(metadata.Lyrics()),
+		Authors:        tagAuthors(metadata),
+		Artists:        splitNames(metadata.Artist()),
+		Narrators:      tagNarrators(metadata),
+		Genres:         splitKeywords(metadata.Genre()),
+		Language:       tagLanguage(metadata),
+		Warnings:       warnings,
 	}
 
 	return episode, nil
@@ -265,7 +1378,9 @@ func generateRSS(podcast *Podcast) string {
 			Title:         ep.Title,
 			Description:   ep.Description,
 			PubDate:       ep.PubDate.Format(time.RFC1123Z),
+			ItunesAuthor:  strings.Join(ep.ItemAuthors, ", "),
 			ItunesEpisode: ep.EpisodeNum,
+			EpisodeType:   ep.EpisodeType,
 			Enclosure: &Enclosure{
 				URL:    ep.URL,
 				Length: ep.FileSize,
@@ -274,6 +1389,14 @@ func generateRSS(podcast *Podcast) string {
 			GUID: ep.URL,
 		}
 
+		if ep.ChaptersURL != "" {
+			item.Chapters = &PodcastChapters{URL: ep.ChaptersURL, Type: chaptersMimeType}
+		}
+
+		for _, t := range ep.Transcripts {
+			item.Transcripts = append(item.Transcripts, PodcastTranscript{URL: t.URL, Type: t.Type, Rel: t.Rel})
+		}
+
 		if ep.Duration > 0 {
 			item.ItunesDuration = formatDuration(ep.Duration)
 		}
@@ -281,16 +1404,67 @@ func generateRSS(podcast *Podcast) string {
 		items = append(items, item)
 	}
 
+	var persons []PodcastPerson
+	for _, person := range podcast.People {
+		p := PodcastPerson{Role: person.Role, Name: person.Name}
+		if person.Role == roleAuthor {
+			p.Group = "writing"
+		}
+		persons = append(persons, p)
+	}
+
 	// Build channel
 	channel := &Channel{
 		Title:         podcast.Title,
+		Link:          podcast.Website,
 		Description:   podcast.Description,
-		Language:      "en-us",
+		Language:      podcast.Language,
 		ItunesType:    "serial",
+		Keywords:      strings.Join(podcast.Keywords, ","),
+		Medium:        "audiobook",
+		GUID:          podcast.GUID,
+		Series:        bookastSeries(podcast),
+		Rating:        bookastRating(podcast),
+		Persons:       persons,
+		Copyright:     podcast.Copyright,
 		LastBuildDate: time.Now().Format(time.RFC1123Z),
+		Generator:     generatorName(),
+		TTL:           podcast.TTL,
 		Items:         items,
 	}
 
+	if podcast.FeedURL != "" {
+		channel.AtomLinks = append(channel.AtomLinks, AtomLink{
+			Href: podcast.FeedURL,
+			Rel:  "self",
+			Type: "application/rss+xml",
+		})
+	}
+	if podcast.Hub != "" {
+		channel.AtomLinks = append(channel.AtomLinks, AtomLink{Href: podcast.Hub, Rel: "hub"})
+	}
+
+	if podcast.Block {
+		channel.ItunesBlock = "Yes"
+	}
+
+	if podcast.Complete {
+		channel.ItunesComplete = "Yes"
+	}
+
+	if podcast.OwnerEmail != "" {
+		channel.Editor = podcast.OwnerEmail
+		channel.ItunesOwner = &ItunesOwner{Email: podcast.OwnerEmail}
+	}
+
+	if podcast.Locked {
+		channel.Locked = &PodcastLocked{Owner: podcast.OwnerEmail, Value: "yes"}
+	}
+
+	if podcast.FundingURL != "" {
+		channel.Funding = &PodcastFunding{URL: podcast.FundingURL, Text: podcast.FundingText}
+	}
+
 	if podcast.CoverArtURL != "" {
 		channel.ItunesImage = &ItunesImage{
 			Href: podcast.CoverArtURL,
@@ -299,9 +1473,14 @@ func generateRSS(podcast *Podcast) string {
 
 	// Build RSS
 	rss := &RSS{
-		Version:  "2.0",
-		ITunesNS: "http://www.itunes.com/dtds/podcast-1.0.dtd",
-		Channel:  channel,
+		Version:   "2.0",
+		ITunesNS:  itunesNS,
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		PodcastNS: "https://podcastindex.org/namespace/1.0",
+		Channel:   channel,
+	}
+	if channel.Series != nil || channel.Rating != "" {
+		rss.BookastNS = bookastNS
 	}
 
 	// Marshal to XML
@@ -314,21 +1493,10 @@ func generateRSS(podcast *Podcast) string {
 }
 
 func getMimeType(filePath string) string {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	switch ext {
-	case ".mp3":
-		return "audio/mpeg"
-	case ".m4a", ".m4b":
-		return "audio/mp4"
-	case ".aac":
-		return "audio/aac"
-	case ".flac":
-		return "audio/flac"
-	case ".ogg":
-		return "audio/ogg"
-	default:
-		return "audio/mpeg"
+	if mimeType, ok := audioMIMETypes[strings.ToLower(filepath.Ext(filePath))]; ok {
+		return mimeType
 	}
+	return unknownMIMEType
 }
 
 func formatDuration(d time.Duration) string {
@@ -340,4 +1508,4 @@ func formatDuration(d time.Duration) string {
 		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
 	}
 	return fmt.Sprintf("%d:%02d", minutes, seconds)
-}
\ No newline at end of file
+}
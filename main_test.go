@@ -1,13 +1,29 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
 
+// TestMain keeps scanDirectory's cache out of the user's cache directory.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "bookast-test-cache-")
+	if err != nil {
+		panic(err)
+	}
+	// Keep the user's cache and config file out of the tests
+	os.Setenv("XDG_CACHE_HOME", dir)
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestFormatDuration(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -71,6 +87,30 @@ func TestFormatDuration(t *testing.T) {
 	}
 }
 
+func TestBuildURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseURL  string
+		dir      string
+		filename string
+		expected string
+	}{
+		{"plain", "https://x.com/books", "/srv/hp1", "01.mp3", "https://x.com/books/hp1/01.mp3"},
+		{"trailing slash", "https://x.com/books/", "hp1", "01.mp3", "https://x.com/books/hp1/01.mp3"},
+		{"escaping", "https://x.com", "/srv/My Book", "01 #1?.mp3", "https://x.com/My%20Book/01%20%231%3F.mp3"},
+		{"subdirectory", "https://x.com", "book", "book-chapters/001 - One.m4b", "https://x.com/book/book-chapters/001%20-%20One.m4b"},
+		{"directory", "https://x.com", "book", "", "https://x.com/book/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildURL(tt.baseURL, tt.dir, tt.filename); got != tt.expected {
+				t.Errorf("buildURL(%q, %q, %q) = %q, want %q", tt.baseURL, tt.dir, tt.filename, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestGetMimeType(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -113,9 +153,34 @@ func TestGetMimeType(t *testing.T) {
 			expected: "audio/ogg",
 		},
 		{
-			name:     "unknown extension defaults to mpeg",
+			name:     "opus file",
+			filePath: "chapter.opus",
+			expected: "audio/ogg",
+		},
+		{
+			name:     "wav file",
+			filePath: "chapter.wav",
+			expected: "audio/wav",
+		},
+		{
+			name:     "wma file",
+			filePath: "chapter.wma",
+			expected: "audio/x-ms-wma",
+		},
+		{
+			name:     "webm file",
+			filePath: "chapter.webm",
+			expected: "audio/webm",
+		},
+		{
+			name:     "mka file",
+			filePath: "chapter.mka",
+			expected: "audio/x-matroska",
+		},
+		{
+			name:     "unknown extension isn't claimed to be audio",
 			filePath: "audio.xyz",
-			expected: "audio/mpeg",
+			expected: "application/octet-stream",
 		},
 		{
 			name:     "file with path",
@@ -145,14 +210,14 @@ func TestProcessAudioFile(t *testing.T) {
 	pubDate := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
 
 	tests := []struct {
-		name           string
-		filename       string
-		expectedTitle  string
-		expectedDesc   string
-		expectedURL    string
-		episodeNum     int
-		checkDuration  bool
-		minDuration    time.Duration
+		name          string
+		filename      string
+		expectedTitle string
+		expectedDesc  string
+		expectedURL   string
+		episodeNum    int
+		checkDuration bool
+		minDuration   time.Duration
 	}{
 		{
 			name:          "chapter01 with full metadata",
@@ -227,6 +292,10 @@ func TestProcessAudioFile(t *testing.T) {
 			if tt.checkDuration && episode.Duration < tt.minDuration {
 				t.Errorf("Duration = %v, want >= %v", episode.Duration, tt.minDuration)
 			}
+
+			if episode.DurationSource == "" {
+				t.Errorf("DurationSource is empty, want the provider that was used")
+			}
 		})
 	}
 }
@@ -235,7 +304,7 @@ func TestScanDirectory(t *testing.T) {
 	baseURL := "https://example.com/audiobooks"
 	baseDir := "testdata/audiobook1"
 
-	podcast, err := scanDirectory(baseDir, baseURL)
+	podcast, err := scanDirectory(baseDir, Options{BaseURL: baseURL})
 	if err != nil {
 		t.Fatalf("scanDirectory() error = %v", err)
 	}
@@ -256,6 +325,18 @@ func TestScanDirectory(t *testing.T) {
 		t.Errorf("CoverArtURL = %q, want %q", podcast.CoverArtURL, expectedCoverURL)
 	}
 
+	// Check feed URL
+	expectedFeedURL := "https://example.com/audiobooks/audiobook1/podcast.rss"
+	if podcast.FeedURL != expectedFeedURL {
+		t.Errorf("FeedURL = %q, want %q", podcast.FeedURL, expectedFeedURL)
+	}
+
+	// Check website defaults to the directory URL
+	expectedWebsite := "https://example.com/audiobooks/audiobook1/"
+	if podcast.Website != expectedWebsite {
+		t.Errorf("Website = %q, want %q", podcast.Website, expectedWebsite)
+	}
+
 	// Check episode count
 	if len(podcast.Episodes) != 3 {
 		t.Fatalf("len(Episodes) = %d, want 3", len(podcast.Episodes))
@@ -286,12 +367,194 @@ func TestScanDirectory(t *testing.T) {
 	}
 }
 
+func TestReadDescription(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+		isHTML   bool
+	}{
+		{
+			name:     "no description files",
+			files:    map[string]string{},
+			expected: "",
+		},
+		{
+			name:     "description.txt is used verbatim",
+			files:    map[string]string{"description.txt": "  A *plain* description.\n"},
+			expected: "A *plain* description.",
+		},
+		{
+			name:     "description.txt starting with markup is still text",
+			files:    map[string]string{"description.txt": "<b>Bold</b> claims"},
+			expected: "<b>Bold</b> claims",
+		},
+		{
+			name:     "README.md is rendered",
+			files:    map[string]string{"README.md": "# About\n\nA **great** book."},
+			expected: "<h1>About</h1>\n<p>A <strong>great</strong> book.</p>",
+			isHTML:   true,
+		},
+		{
+			name: "description.txt wins over README.md",
+			files: map[string]string{
+				"description.txt": "From txt",
+				"README.md":       "From markdown",
+			},
+			expected: "From txt",
+		},
+		{
+			name: "empty description.txt falls through",
+			files: map[string]string{
+				"description.txt": "\n",
+				"README.md":       "From markdown",
+			},
+			expected: "<p>From markdown</p>",
+			isHTML:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, isHTML, err := readDescription(dir)
+			if err != nil {
+				t.Fatalf("readDescription() error = %v", err)
+			}
+			if result != tt.expected || isHTML != tt.isHTML {
+				t.Errorf("readDescription() = %q, %v, want %q, %v", result, isHTML, tt.expected, tt.isHTML)
+			}
+		})
+	}
+}
+
+func TestGenerateRSSChannelOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		podcast  Podcast
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "no optional fields",
+			podcast:  Podcast{Title: "Book"},
+			excludes: []string{"<copyright>", "<managingEditor>", "<itunes:owner>", "<ttl>", "<itunes:block>", "<itunes:complete>", "<podcast:funding", "<podcast:person", "<podcast:locked", "<itunes:keywords>", "xmlns:bookast", "<bookast:series"},
+		},
+		{
+			name:     "block and complete",
+			podcast:  Podcast{Title: "Book", Block: true, Complete: true},
+			contains: []string{"<itunes:block>Yes</itunes:block>", "<itunes:complete>Yes</itunes:complete>"},
+		},
+		{
+			name:     "ttl",
+			podcast:  Podcast{Title: "Book", TTL: 1440},
+			contains: []string{"<ttl>1440</ttl>"},
+		},
+		{
+			name:     "copyright",
+			podcast:  Podcast{Title: "Book", Copyright: "© 1954 Someone"},
+			contains: []string{"<copyright>© 1954 Someone</copyright>"},
+		},
+		{
+			name:    "owner email",
+			podcast: Podcast{Title: "Book", OwnerEmail: "me@example.com"},
+			contains: []string{
+				"<managingEditor>me@example.com</managingEditor>",
+				"<itunes:owner>\n      <itunes:email>me@example.com</itunes:email>\n    </itunes:owner>",
+			},
+		},
+		{
+			name:    "people",
+			podcast: Podcast{Title: "Book", People: []Person{{"Ursula K. Le Guin", roleAuthor}, {"Kobna Holdbrook-Smith", roleNarrator}}},
+			contains: []string{
+				`<podcast:person role="author" group="writing">Ursula K. Le Guin</podcast:person>`,
+				`<podcast:person role="narrator">Kobna Holdbrook-Smith</podcast:person>`,
+			},
+		},
+		{
+			name:     "keywords",
+			podcast:  Podcast{Title: "Book", Keywords: []string{"Fantasy", "Young Adult"}},
+			contains: []string{"<itunes:keywords>Fantasy,Young Adult</itunes:keywords>"},
+		},
+		{
+			name:     "guid",
+			podcast:  Podcast{Title: "Book", GUID: "917393e3-1b1e-5cef-ace4-edaa54e1f810"},
+			contains: []string{"<podcast:guid>917393e3-1b1e-5cef-ace4-edaa54e1f810</podcast:guid>"},
+		},
+		{
+			name:     "series",
+			podcast:  Podcast{Title: "Book", Series: "Mistborn", SeriesIndex: "1"},
+			contains: []string{`xmlns:bookast="` + bookastNS + `"`, `<bookast:series index="1">Mistborn</bookast:series>`},
+		},
+		{
+			name:     "rating",
+			podcast:  Podcast{Title: "Book", Rating: 4.5},
+			contains: []string{`xmlns:bookast="` + bookastNS + `"`, `<bookast:rating>4.5</bookast:rating>`},
+		},
+		{
+			name:     "locked",
+			podcast:  Podcast{Title: "Book", OwnerEmail: "me@example.com", Locked: true},
+			contains: []string{`<podcast:locked owner="me@example.com">yes</podcast:locked>`},
+		},
+		{
+			name:     "funding",
+			podcast:  Podcast{Title: "Book", FundingURL: "https://librivox.org/pages/how-to-donate/", FundingText: "Donate to LibriVox"},
+			contains: []string{`<podcast:funding url="https://librivox.org/pages/how-to-donate/">Donate to LibriVox</podcast:funding>`},
+		},
+		{
+			name:     "episode author",
+			podcast:  Podcast{Title: "Book", Episodes: []Episode{{Title: "One", URL: "https://x.com/b/1.mp3", ItemAuthors: []string{"Ted Chiang"}}}},
+			contains: []string{"<itunes:author>Ted Chiang</itunes:author>"},
+		},
+		{
+			name:     "episode chapters",
+			podcast:  Podcast{Title: "Book", Episodes: []Episode{{Title: "One", URL: "https://x.com/b/1.m4b", ChaptersURL: "https://x.com/b/1.chapters.json"}}},
+			contains: []string{`<podcast:chapters url="https://x.com/b/1.chapters.json" type="application/json+chapters"></podcast:chapters>`},
+		},
+		{
+			name: "episode transcripts",
+			podcast: Podcast{Title: "Book", Episodes: []Episode{{Title: "One", URL: "https://x.com/b/1.mp3", Transcripts: []Transcript{
+				{URL: "https://x.com/b/1.vtt", Type: "text/vtt", Rel: "captions"},
+				{URL: "https://x.com/b/1.txt", Type: "text/plain"},
+			}}}},
+			contains: []string{
+				`<podcast:transcript url="https://x.com/b/1.vtt" type="text/vtt" rel="captions"></podcast:transcript>`,
+				`<podcast:transcript url="https://x.com/b/1.txt" type="text/plain"></podcast:transcript>`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rss := generateRSS(&tt.podcast)
+			for _, s := range tt.contains {
+				if !strings.Contains(rss, s) {
+					t.Errorf("generateRSS() missing %q in:\n%s", s, rss)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(rss, s) {
+					t.Errorf("generateRSS() unexpectedly contains %q in:\n%s", s, rss)
+				}
+			}
+		})
+	}
+}
+
 // normalizeRSS removes timestamps from RSS feed for comparison
 func normalizeRSS(rss string) string {
 	// Remove lastBuildDate (changes every time)
 	rss = regexp.MustCompile(`<lastBuildDate>.*?</lastBuildDate>`).ReplaceAllString(rss, "<lastBuildDate>NORMALIZED</lastBuildDate>")
 	// Remove pubDate (changes every time)
 	rss = regexp.MustCompile(`<pubDate>.*?</pubDate>`).ReplaceAllString(rss, "<pubDate>NORMALIZED</pubDate>")
+	// Remove generator (version differs between builds)
+	rss = regexp.MustCompile(`<generator>.*?</generator>`).ReplaceAllString(rss, "<generator>NORMALIZED</generator>")
 	return rss
 }
 
@@ -300,7 +563,7 @@ func TestGenerateRSSGolden(t *testing.T) {
 	baseDir := "testdata/audiobook1"
 
 	// Scan directory
-	podcast, err := scanDirectory(baseDir, baseURL)
+	podcast, err := scanDirectory(baseDir, Options{BaseURL: baseURL})
 	if err != nil {
 		t.Fatalf("scanDirectory() error = %v", err)
 	}
@@ -325,3 +588,66 @@ func TestGenerateRSSGolden(t *testing.T) {
 		t.Errorf("Generated RSS does not match golden file.\n\nGenerated:\n%s\n\nGolden:\n%s\n\nIf the change is intentional, run ./generate_test_fixtures.sh to update the golden file.", normalizedRSS, normalizedGolden)
 	}
 }
+
+func TestDefaultFFprobePath(t *testing.T) {
+	t.Setenv("FFPROBE", "")
+	if got := defaultFFprobePath(); got != "ffprobe" {
+		t.Errorf("defaultFFprobePath() = %q, want ffprobe", got)
+	}
+
+	t.Setenv("FFPROBE", "/volume1/@appstore/ffmpeg/bin/ffprobe")
+	if got := defaultFFprobePath(); got != "/volume1/@appstore/ffmpeg/bin/ffprobe" {
+		t.Errorf("defaultFFprobePath() = %q, want $FFPROBE", got)
+	}
+}
+
+func TestRunProbeTimeout(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "hung-ffprobe")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := probeTimeout
+	defer func() { probeTimeout = saved }()
+	probeTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := runProbe(false, script, "book.mp3")
+	if !errors.Is(err, errProbeTimeout) {
+		t.Fatalf("runProbe() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runProbe() took %v to give up", elapsed)
+	}
+}
+
+func TestScanDirectorySkipErrors(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	copyFixture(t, dir, "chapter02.mp3")
+	// Sorts between the two good files, so numbering has a gap to close
+	if err := os.WriteFile(filepath.Join(dir, "chapter01b.mp3"), []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := scanDirectory(dir, Options{BaseURL: "https://example.com", NoCache: true}); err == nil {
+		t.Fatal("scanDirectory() error = nil, want an error for the unreadable file")
+	}
+
+	podcast, err := scanDirectory(dir, Options{BaseURL: "https://example.com", NoCache: true, SkipErrors: true})
+	if err != nil {
+		t.Fatalf("scanDirectory() with SkipErrors error = %v", err)
+	}
+	if len(podcast.Episodes) != 2 || len(podcast.Skipped) != 1 {
+		t.Fatalf("got %d episodes and %d skipped, want 2 and 1", len(podcast.Episodes), len(podcast.Skipped))
+	}
+	if podcast.Skipped[0].File != filepath.Join(dir, "chapter01b.mp3") || podcast.Skipped[0].Reason == "" {
+		t.Errorf("Skipped = %+v", podcast.Skipped)
+	}
+	if podcast.Episodes[1].EpisodeNum != 2 {
+		t.Errorf("second episode is number %d, want 2", podcast.Episodes[1].EpisodeNum)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "single paragraph",
+			input:    "A story about a boy.",
+			expected: "<p>A story about a boy.</p>",
+		},
+		{
+			name:     "paragraph lines are one paragraph",
+			input:    "First line\nsecond line",
+			expected: "<p>First line\nsecond line</p>",
+		},
+		{
+			name:     "multiple paragraphs",
+			input:    "One.\n\nTwo.",
+			expected: "<p>One.</p>\n<p>Two.</p>",
+		},
+		{
+			name:     "headings",
+			input:    "# Title\n## Subtitle ##",
+			expected: "<h1>Title</h1>\n<h2>Subtitle</h2>",
+		},
+		{
+			name:     "unordered list",
+			input:    "- one\n- two\n- three",
+			expected: "<ul>\n<li>one</li>\n<li>two</li>\n<li>three</li>\n</ul>",
+		},
+		{
+			name:     "ordered list",
+			input:    "1. one\n2. two",
+			expected: "<ol>\n<li>one</li>\n<li>two</li>\n</ol>",
+		},
+		{
+			name:     "list item continuation",
+			input:    "- one\n  continued",
+			expected: "<ul>\n<li>one\ncontinued</li>\n</ul>",
+		},
+		{
+			name:     "emphasis",
+			input:    "**bold** and *italic* and _also italic_",
+			expected: "<p><strong>bold</strong> and <em>italic</em> and <em>also italic</em></p>",
+		},
+		{
+			name:     "snake_case is not italic",
+			input:    "some_file_name",
+			expected: "<p>some_file_name</p>",
+		},
+		{
+			name:     "link",
+			input:    "Read on [LibriVox](https://librivox.org/?a=1&b=2).",
+			expected: `<p>Read on <a href="https://librivox.org/?a=1&amp;b=2">LibriVox</a>.</p>`,
+		},
+		{
+			name:     "relative and mailto links",
+			input:    "[Notes](notes.html) or [mail](mailto:me@example.com)",
+			expected: `<p><a href="notes.html">Notes</a> or <a href="mailto:me@example.com">mail</a></p>`,
+		},
+		{
+			name:     "script links are text",
+			input:    "[x](javascript:alert(1)) [y](JavaScript:alert) [z](data:text/html,hi)",
+			expected: "<p>x y z</p>",
+		},
+		{
+			name:     "code span is not formatted",
+			input:    "Run `**not bold**` now",
+			expected: "<p>Run <code>**not bold**</code> now</p>",
+		},
+		{
+			name:     "html is escaped",
+			input:    "Tom & Jerry < 3",
+			expected: "<p>Tom &amp; Jerry &lt; 3</p>",
+		},
+		{
+			name:     "raw html is left out",
+			input:    "Tom <script>alert(1)</script>\n\n<div onclick=\"x()\">hi</div>",
+			expected: "<p>Tom <!-- raw HTML omitted -->alert(1)<!-- raw HTML omitted --></p>\n<!-- raw HTML omitted -->",
+		},
+		{
+			name:     "emphasis isn't applied inside link targets",
+			input:    "[x](https://e.com/_a_/b)",
+			expected: `<p><a href="https://e.com/_a_/b">x</a></p>`,
+		},
+		{
+			name:     "link target with parentheses",
+			input:    "[Dune](https://en.wikipedia.org/wiki/Dune_(novel))",
+			expected: `<p><a href="https://en.wikipedia.org/wiki/Dune_(novel)">Dune</a></p>`,
+		},
+		{
+			name:     "script autolinks and images are text",
+			input:    "<javascript:alert(1)> ![cover](javascript:alert(1))",
+			expected: "<p>javascript:alert(1) cover</p>",
+		},
+		{
+			name:     "fenced code block",
+			input:    "```\n**not bold** <b>\n```",
+			expected: "<pre><code>**not bold** &lt;b&gt;\n</code></pre>",
+		},
+		{
+			name:     "blockquote",
+			input:    "> A wizard is never late.",
+			expected: "<blockquote>\n<p>A wizard is never late.</p>\n</blockquote>",
+		},
+		{
+			name:     "horizontal rule",
+			input:    "one\n\n---\n\ntwo",
+			expected: "<p>one</p>\n<hr>\n<p>two</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderMarkdown(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.expected {
+				t.Errorf("renderMarkdown(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
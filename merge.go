@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mergeSidecars are copied next to the merged file so the one-episode feed
+// keeps the book's title, credits, description and cover.
+var mergeSidecars = []string{bookConfigFile, metadataFile, absMetadataFile, "description.txt", "README.md"}
+
+// mergeDirName is the default directory "bookast merge" writes to, a sibling
+// of dir so it is served under the same --base-url.
+func mergeDirName(dir string) string {
+	return filepath.Clean(dir) + "-merged"
+}
+
+// mergeChapters builds one chapter per file, titled like the feed would title
+// the episode and starting where the previous file ends.
+func mergeChapters(dir string, audioFiles []string) ([]Chapter, error) {
+	name := filepath.Base(filepath.Clean(dir))
+	bookTitles := []string{name, parseFolderName(name).Title}
+	var chapters []Chapter
+	var start time.Duration
+	for i, filename := range audioFiles {
+		episode, err := processAudioFile(filepath.Join(dir, filename), "", dir, time.Time{}, i+1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process %s: %v", filename, err)
+		}
+		if episode.Duration <= 0 {
+			return nil, fmt.Errorf("%s: no duration, can't place the chapters after it", filename)
+		}
+		end := start + episode.Duration
+		chapters = append(chapters, Chapter{Start: start, End: end, Title: cleanTitle(episode.Title, bookTitles, i+1)})
+		start = end
+	}
+	return chapters, nil
+}
+
+// concatList renders an ffmpeg concat demuxer script for paths.
+func concatList(paths []string) string {
+	var b strings.Builder
+	b.WriteString("ffconcat version 1.0\n")
+	for _, path := range paths {
+		fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(path, "'", `'\''`))
+	}
+	return b.String()
+}
+
+// mergeAudio concatenates audioFiles (in dir) into dst as AAC with chapters.
+// The result is written to a temporary file and renamed into place, so an
+// interrupted merge never publishes a truncated book.
+func mergeAudio(dir string, audioFiles []string, chapters []Chapter, dst string, bitrate string) error {
+	scratch, err := os.MkdirTemp(filepath.Dir(dst), ".bookast-merge-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+
+	var paths []string
+	for _, filename := range audioFiles {
+		path, err := filepath.Abs(filepath.Join(dir, filename))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+	listPath := filepath.Join(scratch, "files.txt")
+	if err := os.WriteFile(listPath, []byte(concatList(paths)), 0644); err != nil {
+		return err
+	}
+
+	metadataPath := filepath.Join(scratch, "chapters.txt")
+	metadata, err := os.Create(metadataPath)
+	if err != nil {
+		return err
+	}
+	err = writeFFMetadata(metadata, chapters)
+	if closeErr := metadata.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Tags come from the first file, which holds the album-level ones
+	args := []string{"-v", "error", "-y", "-f", "concat", "-safe", "0", "-i", listPath,
+		"-i", metadataPath, "-i", paths[0],
+		"-map", "0:a", "-map_chapters", "1", "-map_metadata", "2",
+		"-metadata", "title=" + filepath.Base(filepath.Clean(dir)), "-metadata", "track=",
+		"-c:a", "aac", "-b:a", bitrate, "-movflags", "+faststart",
+		"-f", "ipod", filepath.Join(scratch, "merged.m4b")}
+	if err := runFFmpeg(args...); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(scratch, "merged.m4b"), dst)
+}
+
+// mergeUpToDate reports whether dst is newer than every file in audioFiles.
+func mergeUpToDate(dir string, audioFiles []string, dst string) bool {
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return false
+	}
+	for _, filename := range audioFiles {
+		info, err := os.Stat(filepath.Join(dir, filename))
+		if err != nil || info.ModTime().After(dstInfo.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+// copySidecars copies the book's metadata files and cover from dir to outDir,
+// leaving any that already exist there alone.
+func copySidecars(dir string, outDir string) error {
+	names := append([]string{}, mergeSidecars...)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (ext == ".jpg" || ext == ".jpeg" || ext == ".png") {
+			names = append(names, entry.Name())
+		}
+	}
+
+	for _, name := range names {
+		dst := filepath.Join(outDir, name)
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMerge implements "bookast merge", which joins a directory of chapter
+// files into one chaptered .m4b and optionally publishes it.
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	outDir := fs.String("output", "", "Directory to write the merged book and its feed to (default: <directory>-merged)")
+	bitrate := fs.String("bitrate", "64k", "AAC bitrate of the merged file")
+	baseURL := fs.String("base-url", "", "Base URL for hosting the files; when set, podcast.rss is generated for the merged book")
+	force := fs.Bool("force", false, "Merge again even if the merged file is newer than every chapter")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s merge [flags] <directory>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: ffmpeg not found, merging needs it\n")
+		return 1
+	}
+
+	directory := fs.Arg(0)
+	audioFiles, err := listAudioFiles(directory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		return 1
+	}
+	if len(audioFiles) < 2 {
+		fmt.Fprintf(os.Stderr, "Error: merging needs at least 2 audio files in '%s'\n", directory)
+		return 1
+	}
+
+	if *outDir == "" {
+		*outDir = mergeDirName(directory)
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	bookTitle := filepath.Base(filepath.Clean(directory))
+	dst := filepath.Join(*outDir, bookTitle+".m4b")
+
+	if *force || !mergeUpToDate(directory, audioFiles, dst) {
+		chapters, err := mergeChapters(directory, audioFiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+
+		fmt.Printf("Merging %s into %s\n", plural(len(audioFiles), "file"), dst)
+		if err := mergeAudio(directory, audioFiles, chapters, dst, *bitrate); err != nil {
+			fmt.Fprintf(os.Stderr, "Error merging: %v\n", err)
+			return 1
+		}
+	}
+
+	if err := copySidecars(directory, *outDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *baseURL == "" {
+		fmt.Printf("Merged into %s, run bookast on %s to publish it\n", dst, *outDir)
+		return 0
+	}
+
+	// The feed is the source book's, not the output directory's
+	podcast, err := scanDirectory(*outDir, Options{BaseURL: *baseURL, FeedFilename: feedFormats["rss"].Filename, FolderName: bookTitle, KeepGUID: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		return 1
+	}
+
+	feedFile := filepath.Join(*outDir, feedFormats["rss"].Filename)
+	if err := os.WriteFile(feedFile, []byte(generateRSS(podcast)), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing feed file: %v\n", err)
+		return 1
+	}
+
+	summary := &Summary{}
+	summary.Add(podcast, feedFile)
+	summary.Print(os.Stdout)
+	return 0
+}
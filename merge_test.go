@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeChapters(t *testing.T) {
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not installed")
+	}
+
+	dir := filepath.Join("testdata", "audiobook1")
+	chapters, err := mergeChapters(dir, []string{"chapter01.mp3", "chapter02.mp3", "chapter03.m4a"})
+	if err != nil {
+		t.Fatalf("mergeChapters() error = %v", err)
+	}
+	if len(chapters) != 3 {
+		t.Fatalf("mergeChapters() returned %d chapters, want 3", len(chapters))
+	}
+	if chapters[0].Start != 0 {
+		t.Errorf("first chapter starts at %v, want 0", chapters[0].Start)
+	}
+	for i := 1; i < len(chapters); i++ {
+		if chapters[i].Start != chapters[i-1].End {
+			t.Errorf("chapter %d starts at %v, want the previous end %v", i+1, chapters[i].Start, chapters[i-1].End)
+		}
+		if chapters[i].End <= chapters[i].Start {
+			t.Errorf("chapter %d ends at %v, before its start %v", i+1, chapters[i].End, chapters[i].Start)
+		}
+	}
+}
+
+func TestConcatList(t *testing.T) {
+	got := concatList([]string{"/books/01.mp3", "/books/Ender's Game/02.mp3"})
+	expected := "ffconcat version 1.0\nfile '/books/01.mp3'\nfile '/books/Ender'\\''s Game/02.mp3'\n"
+	if got != expected {
+		t.Errorf("concatList() =\n%s\nwant\n%s", got, expected)
+	}
+}
+
+func TestMergeUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"01.mp3", "02.mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := filepath.Join(dir, "book.m4b")
+	files := []string{"01.mp3", "02.mp3"}
+
+	if mergeUpToDate(dir, files, dst) {
+		t.Error("mergeUpToDate() = true without a merged file")
+	}
+
+	if err := os.WriteFile(dst, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !mergeUpToDate(dir, files, dst) {
+		t.Error("mergeUpToDate() = false for a merged file newer than its sources")
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "02.mp3"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if mergeUpToDate(dir, files, dst) {
+		t.Error("mergeUpToDate() = true after a source changed")
+	}
+}
+
+func TestCopySidecars(t *testing.T) {
+	dir := t.TempDir()
+	outDir := t.TempDir()
+	for name, content := range map[string]string{
+		"book.yaml":       "authors: Someone\n",
+		"description.txt": "A book.",
+		"cover.jpg":       "jpeg",
+		"01.mp3":          "audio",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "description.txt"), []byte("Edited."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copySidecars(dir, outDir); err != nil {
+		t.Fatalf("copySidecars() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if expected := []string{"book.yaml", "cover.jpg", "description.txt"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("copied %v, want %v", names, expected)
+	}
+	if data, _ := os.ReadFile(filepath.Join(outDir, "description.txt")); string(data) != "Edited." {
+		t.Errorf("existing description.txt was overwritten with %q", data)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scanDurationBuckets are the upper bounds, in seconds, of the scan
+// duration histogram: cached books take milliseconds, a first scan of a
+// big one with ffprobe a minute or more.
+var scanDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// serveMetrics is what serve mode exposes at /metrics for Prometheus. Each
+// server has its own registry, not the global one.
+type serveMetrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec // By method and status code
+	bytes    prometheus.Counter
+	streams  prometheus.Gauge // Audio file downloads in progress
+	scans    prometheus.Histogram
+	handler  http.Handler // Serves them all
+}
+
+// newServeMetrics registers serve mode's metrics, with books counting the
+// books served.
+func newServeMetrics(books func() int) *serveMetrics {
+	m := &serveMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "bookast_http_requests_total",
+			Help: "HTTP requests answered, by method and status code.",
+		}, []string{"method", "code"}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "bookast_http_response_bytes_total",
+			Help: "Bytes of response bodies sent.",
+		}),
+		streams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "bookast_active_streams",
+			Help: "Audio file downloads in progress.",
+		}),
+		scans: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "bookast_scan_duration_seconds",
+			Help:    "How long scanning a book for its feed took.",
+			Buckets: scanDurationBuckets,
+		}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.bytes,
+		m.streams,
+		m.scans,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "bookast_cache_hits_total",
+			Help: "Audio files whose tags and duration were read from the cache.",
+		}, func() float64 { return float64(cacheHits.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "bookast_cache_misses_total",
+			Help: "Audio files that had to be probed.",
+		}, func() float64 { return float64(cacheMisses.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "bookast_books",
+			Help: "Books being served.",
+		}, func() float64 { return float64(books()) }),
+	)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// observeScan records how long scanning a book took.
+func (m *serveMetrics) observeScan(d time.Duration) {
+	m.scans.Observe(d.Seconds())
+}
+
+// instrument wraps h to count its requests and the bytes sent.
+func (m *serveMetrics) instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counted := &loggedResponse{ResponseWriter: w}
+		h.ServeHTTP(counted, r)
+
+		method := r.Method
+		if method != http.MethodGet && method != http.MethodHead {
+			method = "other" // Bounded label values
+		}
+		status := counted.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.bytes.Add(float64(counted.bytes))
+		m.requests.WithLabelValues(method, strconv.Itoa(status)).Inc()
+	})
+}
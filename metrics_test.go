@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestServeMetrics(t *testing.T) {
+	m := newServeMetrics(func() int { return 2 })
+	m.observeScan(30 * time.Millisecond)
+	m.observeScan(2 * time.Second)
+	m.requests.WithLabelValues("GET", "404").Inc()
+	m.requests.WithLabelValues("GET", "200").Add(3)
+	m.bytes.Add(1234)
+
+	rec := httptest.NewRecorder()
+	m.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE bookast_http_requests_total counter\n" +
+			`bookast_http_requests_total{code="200",method="GET"} 3` + "\n" +
+			`bookast_http_requests_total{code="404",method="GET"} 1` + "\n",
+		"bookast_http_response_bytes_total 1234\n",
+		"bookast_active_streams 0\n",
+		`bookast_scan_duration_seconds_bucket{le="0.05"} 1` + "\n",
+		`bookast_scan_duration_seconds_bucket{le="1"} 1` + "\n",
+		`bookast_scan_duration_seconds_bucket{le="2.5"} 2` + "\n",
+		`bookast_scan_duration_seconds_bucket{le="+Inf"} 2` + "\n",
+		"bookast_scan_duration_seconds_sum 2.03\n",
+		"bookast_scan_duration_seconds_count 2\n",
+		"bookast_books 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics don't contain\n%s\ngot\n%s", want, out)
+		}
+	}
+}
+
+func TestFeedServerMetrics(t *testing.T) {
+	feeds, _ := newTestFeedServer(t)
+	s := feeds.Config.Handler.(*feedServer)
+	server := httptest.NewServer(s.metrics.instrument(s))
+	defer server.Close()
+
+	serveGet(t, server.URL+"/Book/podcast.rss")
+	resp, audio := serveGet(t, server.URL+"/Book/chapter01.mp3")
+	serveGet(t, server.URL+"/Book/missing.mp3")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET chapter01.mp3 = %s", resp.Status)
+	}
+
+	resp, out := serveGet(t, server.URL+"/metrics")
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`bookast_http_requests_total{code="200",method="GET"} 2` + "\n",
+		`bookast_http_requests_total{code="404",method="GET"} 1` + "\n",
+		"bookast_scan_duration_seconds_count 1\n",
+		"bookast_active_streams 0\n",
+		"bookast_books 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, out)
+		}
+	}
+	// The feed, the file and the 404 page
+	if sent := testutil.ToFloat64(s.metrics.bytes); sent <= float64(len(audio)) {
+		t.Errorf("bytes sent = %g, want more than the %d of chapter01.mp3", sent, len(audio))
+	}
+}
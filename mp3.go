@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// Native MP3 duration parsing. Real-world rips are messy: ID3 tags with
+// wrong sizes, junk between frames, truncated tails and VBR files without a
+// Xing header. The parser resyncs past anything that doesn't look like a
+// frame and, when there is no Xing/VBRI header to trust, estimates the
+// duration by sampling frames across the file.
+
+const (
+	// Files with less audio than this are walked frame by frame; larger ones
+	// are sampled.
+	mp3FullScanLimit = 16 << 20
+	// How far to look for the first frame before giving up.
+	mp3SyncSearchLimit = 1 << 20
+	// Sampling: how many places to look and how many frames to read at each.
+	mp3SamplePoints    = 16
+	mp3FramesPerSample = 32
+)
+
+var (
+	mp3BitratesV1 = [3][16]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0}, // Layer I
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},    // Layer II
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},     // Layer III
+	}
+	mp3BitratesV2 = [3][16]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0}, // Layer I
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Layer II
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Layer III
+	}
+	mp3SampleRates = map[int][3]int{
+		1:  {44100, 48000, 32000},
+		2:  {22050, 24000, 16000},
+		25: {11025, 12000, 8000},
+	}
+)
+
+type mp3Frame struct {
+	version    int // 1, 2 or 25 (MPEG 2.5)
+	layer      int // 1, 2 or 3
+	bitrate    int // bits per second
+	sampleRate int
+	mono       bool
+	size       int // bytes, including the header
+	samples    int // samples per frame
+}
+
+func (f mp3Frame) duration() float64 {
+	return float64(f.samples) / float64(f.sampleRate)
+}
+
+// sameStream reports whether two frames could come from the same stream.
+// Bitrate may differ (VBR), the rest may not.
+func (f mp3Frame) sameStream(o mp3Frame) bool {
+	return f.version == o.version && f.layer == o.layer && f.sampleRate == o.sampleRate
+}
+
+// parseMP3Frame decodes a 4-byte MPEG audio frame header.
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+
+	var f mp3Frame
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		f.version = 25
+	case 2:
+		f.version = 2
+	case 3:
+		f.version = 1
+	default:
+		return mp3Frame{}, false
+	}
+
+	layerBits := (b[1] >> 1) & 0x03
+	if layerBits == 0 {
+		return mp3Frame{}, false
+	}
+	f.layer = 4 - int(layerBits)
+
+	bitrateIdx := b[2] >> 4
+	sampleRateIdx := (b[2] >> 2) & 0x03
+	if bitrateIdx == 0 || bitrateIdx == 15 || sampleRateIdx == 3 {
+		// Free-format and reserved values
+		return mp3Frame{}, false
+	}
+	if f.version == 1 {
+		f.bitrate = mp3BitratesV1[f.layer-1][bitrateIdx] * 1000
+	} else {
+		f.bitrate = mp3BitratesV2[f.layer-1][bitrateIdx] * 1000
+	}
+	f.sampleRate = mp3SampleRates[f.version][sampleRateIdx]
+
+	padding := int(b[2]>>1) & 0x01
+	f.mono = (b[3] >> 6) == 3
+
+	switch {
+	case f.layer == 1:
+		f.samples = 384
+		f.size = (12*f.bitrate/f.sampleRate + padding) * 4
+	case f.layer == 3 && f.version != 1:
+		f.samples = 576
+		f.size = 72*f.bitrate/f.sampleRate + padding
+	default:
+		f.samples = 1152
+		f.size = 144*f.bitrate/f.sampleRate + padding
+	}
+
+	return f, f.size > 4
+}
+
+// mp3Stream holds the audio region of an MP3 file (tags excluded).
+type mp3Stream struct {
+	r     io.ReaderAt
+	start int64 // first byte after leading ID3v2 tags
+	end   int64 // first byte of trailing ID3v1/APE tags
+}
+
+// mp3DurationResult is how a duration was worked out, which decides how much
+// it can be trusted.
+type mp3DurationResult struct {
+	duration time.Duration
+	method   string // "xing", "vbri", "frames", "cbr" or "sampled"
+}
+
+// mp3Duration works out the duration of an MP3 file by parsing its frames.
+func mp3Duration(r io.ReaderAt, size int64) (mp3DurationResult, error) {
+	s := &mp3Stream{r: r, start: skipID3v2(r, size), end: trailingTagsStart(r, size)}
+	if s.end <= s.start {
+		return mp3DurationResult{}, errors.New("no audio data")
+	}
+
+	offset, first, ok := s.sync(s.start, mp3SyncSearchLimit, 1)
+	if !ok || offset != s.start {
+		// The ID3 size may be lying in either direction. Look again from the
+		// top of the file, insisting on a longer run of frames so data inside
+		// the tag (cover art, say) can't pass for audio.
+		if o, f, found := s.sync(0, mp3SyncSearchLimit, 4); found && (!ok || o < offset) {
+			offset, first, ok = o, f, true
+		}
+	}
+	if !ok {
+		return mp3DurationResult{}, errors.New("no MPEG audio frames found")
+	}
+
+	if d, method, ok := s.headerDuration(offset, first); ok {
+		return mp3DurationResult{duration: d, method: method}, nil
+	}
+
+	if s.end-offset <= mp3FullScanLimit {
+		seconds, frames := s.walk(offset, first, -1, nil)
+		if frames == 0 {
+			return mp3DurationResult{}, errors.New("no MPEG audio frames found")
+		}
+		return mp3DurationResult{duration: secondsToDuration(seconds), method: "frames"}, nil
+	}
+
+	return s.sample(offset, first)
+}
+
+// sync finds the first frame at or after from that is followed by run more
+// frames of the same stream, which rules out false syncs in garbage.
+func (s *mp3Stream) sync(from int64, limit int64, run int) (int64, mp3Frame, bool) {
+	const chunkSize = 64 << 10
+	buf := make([]byte, chunkSize+4)
+
+	stop := min(s.end, from+limit)
+	for pos := from; pos < stop; pos += chunkSize {
+		n, _ := s.r.ReadAt(buf, pos)
+		for i := 0; i+4 <= n && pos+int64(i) < stop; i++ {
+			if buf[i] != 0xFF {
+				continue
+			}
+			f, ok := parseMP3Frame(buf[i : i+4])
+			if !ok {
+				continue
+			}
+			at := pos + int64(i)
+			if s.confirm(at, f, run) {
+				return at, f, true
+			}
+		}
+	}
+	return 0, mp3Frame{}, false
+}
+
+// confirm reports whether the frame at offset is followed by run compatible
+// frame headers (or the end of the audio).
+func (s *mp3Stream) confirm(offset int64, f mp3Frame, run int) bool {
+	var hdr [4]byte
+	for ; run > 0; run-- {
+		offset += int64(f.size)
+		if offset == s.end {
+			return true
+		}
+		if _, err := s.r.ReadAt(hdr[:], offset); err != nil {
+			return false
+		}
+		next, ok := parseMP3Frame(hdr[:])
+		if !ok || !next.sameStream(f) {
+			return false
+		}
+		f = next
+	}
+	return true
+}
+
+// headerDuration reads a Xing/Info or VBRI header from the first frame.
+func (s *mp3Stream) headerDuration(offset int64, f mp3Frame) (time.Duration, string, bool) {
+	buf := make([]byte, min(f.size, 256))
+	if _, err := s.r.ReadAt(buf, offset); err != nil {
+		return 0, "", false
+	}
+
+	// Xing/Info lives right after the side information
+	sideInfo := 32
+	switch {
+	case f.version == 1 && f.mono:
+		sideInfo = 17
+	case f.version != 1 && f.mono:
+		sideInfo = 9
+	case f.version != 1:
+		sideInfo = 17
+	}
+	if x := 4 + sideInfo; x+12 <= len(buf) {
+		magic := string(buf[x : x+4])
+		flags := binary.BigEndian.Uint32(buf[x+4:])
+		if (magic == "Xing" || magic == "Info") && flags&0x1 != 0 {
+			frames := binary.BigEndian.Uint32(buf[x+8:])
+			if frames > 0 {
+				return secondsToDuration(float64(frames) * f.duration()), "xing", true
+			}
+		}
+	}
+
+	// VBRI is always 32 bytes after the header
+	if v := 4 + 32; v+18 <= len(buf) && string(buf[v:v+4]) == "VBRI" {
+		frames := binary.BigEndian.Uint32(buf[v+14:])
+		if frames > 0 {
+			return secondsToDuration(float64(frames) * f.duration()), "vbri", true
+		}
+	}
+
+	return 0, "", false
+}
+
+// walk follows frames from offset, resyncing past corrupt data, and returns
+// the total playing time and number of frames. max limits the number of
+// frames (-1 for all); visit, if not nil, is called for every frame.
+func (s *mp3Stream) walk(offset int64, f mp3Frame, maxFrames int, visit func(mp3Frame)) (float64, int) {
+	var seconds float64
+	frames := 0
+	var hdr [4]byte
+
+	for offset+int64(f.size) <= s.end && (maxFrames < 0 || frames < maxFrames) {
+		seconds += f.duration()
+		frames++
+		if visit != nil {
+			visit(f)
+		}
+
+		offset += int64(f.size)
+		if offset >= s.end {
+			break
+		}
+		if _, err := s.r.ReadAt(hdr[:], offset); err != nil {
+			break
+		}
+		next, ok := parseMP3Frame(hdr[:])
+		if !ok || !next.sameStream(f) {
+			// Corrupt frame or junk, find the next good frame
+			var found bool
+			offset, next, found = s.sync(offset+1, 64<<10, 1)
+			if !found || !next.sameStream(f) {
+				break
+			}
+		}
+		f = next
+	}
+
+	return seconds, frames
+}
+
+// sample estimates the duration of a large file without a Xing header by
+// measuring the average bitrate at several points through the file.
+func (s *mp3Stream) sample(offset int64, first mp3Frame) (mp3DurationResult, error) {
+	var bytesSeen, secondsSeen float64
+	cbr := true
+
+	span := s.end - offset
+	for i := 0; i < mp3SamplePoints; i++ {
+		at := offset + span*int64(i)/mp3SamplePoints
+		frameAt, f, ok := offset, first, i == 0
+		if i > 0 {
+			frameAt, f, ok = s.sync(at, 64<<10, 1)
+		}
+		if !ok || !f.sameStream(first) {
+			continue
+		}
+
+		s.walk(frameAt, f, mp3FramesPerSample, func(fr mp3Frame) {
+			bytesSeen += float64(fr.size)
+			secondsSeen += fr.duration()
+			if fr.bitrate != first.bitrate {
+				cbr = false
+			}
+		})
+	}
+
+	if bytesSeen == 0 {
+		return mp3DurationResult{}, errors.New("no MPEG audio frames found")
+	}
+
+	method := "sampled"
+	if cbr {
+		method = "cbr"
+	}
+	seconds := float64(span) * secondsSeen / bytesSeen
+	return mp3DurationResult{duration: secondsToDuration(seconds), method: method}, nil
+}
+
+// skipID3v2 returns the offset of the first byte after any ID3v2 tags at the
+// start of the file.
+func skipID3v2(r io.ReaderAt, size int64) int64 {
+	var offset int64
+	var hdr [10]byte
+	for {
+		if _, err := r.ReadAt(hdr[:], offset); err != nil || string(hdr[:3]) != "ID3" {
+			return offset
+		}
+		tagSize := int64(hdr[6]&0x7F)<<21 | int64(hdr[7]&0x7F)<<14 | int64(hdr[8]&0x7F)<<7 | int64(hdr[9]&0x7F)
+		next := offset + 10 + tagSize
+		if hdr[5]&0x10 != 0 {
+			next += 10 // footer
+		}
+		if next > size {
+			return offset
+		}
+		offset = next
+	}
+}
+
+// trailingTagsStart returns the offset where ID3v1 and APEv2 tags at the end
+// of the file begin (or size if there are none).
+func trailingTagsStart(r io.ReaderAt, size int64) int64 {
+	end := size
+
+	var id3v1 [3]byte
+	if size >= 128 {
+		if _, err := r.ReadAt(id3v1[:], size-128); err == nil && string(id3v1[:]) == "TAG" {
+			end -= 128
+		}
+	}
+
+	var ape [32]byte
+	if end >= 32 {
+		if _, err := r.ReadAt(ape[:], end-32); err == nil && bytes.Equal(ape[:8], []byte("APETAGEX")) {
+			tagSize := int64(binary.LittleEndian.Uint32(ape[12:]))
+			flags := binary.LittleEndian.Uint32(ape[20:])
+			if flags&(1<<31) != 0 {
+				tagSize += 32 // header
+			}
+			if tagSize <= end {
+				end -= tagSize
+			}
+		}
+	}
+
+	return end
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// mp3Provider is the native MP3 parser exposed as a DurationProvider.
+type mp3Provider struct{}
+
+func (mp3Provider) Name() string { return "native" }
+
+func (mp3Provider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	if strings.ToLower(filepath.Ext(filePath)) != ".mp3" {
+		return DurationEstimate{}, errors.New("not an MP3 file")
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+
+	result, err := mp3Duration(f, info.Size())
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+
+	confidence := map[string]float64{
+		"xing":    0.85,
+		"vbri":    0.85,
+		"frames":  0.85,
+		"cbr":     0.8,
+		"sampled": 0.6,
+	}[result.method]
+
+	return DurationEstimate{Duration: result.duration, Confidence: confidence}, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mp3FrameBytes builds a silent MPEG-1 Layer III 44.1kHz stereo frame.
+func mp3FrameBytes(bitrateIdx byte) []byte {
+	hdr := []byte{0xFF, 0xFB, bitrateIdx << 4, 0x00}
+	f, ok := parseMP3Frame(hdr)
+	if !ok {
+		panic("invalid test frame")
+	}
+	frame := make([]byte, f.size)
+	copy(frame, hdr)
+	return frame
+}
+
+func id3v2Header(size int) []byte {
+	return []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size>>21) & 0x7F, byte(size>>14) & 0x7F, byte(size>>7) & 0x7F, byte(size) & 0x7F}
+}
+
+func framesDuration(n int) time.Duration {
+	return secondsToDuration(float64(n) * 1152 / 44100)
+}
+
+func approxEqual(a, b time.Duration, tolerance time.Duration) bool {
+	return (a - b).Abs() <= tolerance
+}
+
+func TestParseMP3Frame(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     []byte
+		valid      bool
+		bitrate    int
+		sampleRate int
+		size       int
+	}{
+		{"MPEG1 L3 128k 44.1kHz", []byte{0xFF, 0xFB, 0x90, 0x00}, true, 128000, 44100, 417},
+		{"MPEG1 L3 128k padded", []byte{0xFF, 0xFB, 0x92, 0x00}, true, 128000, 44100, 418},
+		{"MPEG2 L3 64k 22.05kHz", []byte{0xFF, 0xF3, 0x80, 0x00}, true, 64000, 22050, 208},
+		{"no sync", []byte{0xFF, 0x00, 0x90, 0x00}, false, 0, 0, 0},
+		{"reserved version", []byte{0xFF, 0xEB, 0x90, 0x00}, false, 0, 0, 0},
+		{"free format bitrate", []byte{0xFF, 0xFB, 0x00, 0x00}, false, 0, 0, 0},
+		{"bad bitrate", []byte{0xFF, 0xFB, 0xF0, 0x00}, false, 0, 0, 0},
+		{"reserved sample rate", []byte{0xFF, 0xFB, 0x9C, 0x00}, false, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := parseMP3Frame(tt.header)
+			if ok != tt.valid {
+				t.Fatalf("parseMP3Frame() ok = %v, want %v", ok, tt.valid)
+			}
+			if !ok {
+				return
+			}
+			if f.bitrate != tt.bitrate || f.sampleRate != tt.sampleRate || f.size != tt.size {
+				t.Errorf("parseMP3Frame() = %d bps %d Hz %d bytes, want %d bps %d Hz %d bytes",
+					f.bitrate, f.sampleRate, f.size, tt.bitrate, tt.sampleRate, tt.size)
+			}
+		})
+	}
+}
+
+func TestMP3Duration(t *testing.T) {
+	cbr := func(n int) []byte {
+		return bytes.Repeat(mp3FrameBytes(9), n)
+	}
+
+	xing := func(frames uint32) []byte {
+		frame := mp3FrameBytes(9)
+		copy(frame[36:], "Xing")
+		binary.BigEndian.PutUint32(frame[40:], 0x1)
+		binary.BigEndian.PutUint32(frame[44:], frames)
+		return frame
+	}
+
+	var vbr []byte
+	for i := 0; i < 200; i++ {
+		vbr = append(vbr, mp3FrameBytes(byte(5+i%6))...)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected time.Duration
+		method   string
+		wantErr  bool
+	}{
+		{
+			name:     "plain CBR",
+			data:     cbr(100),
+			expected: framesDuration(100),
+			method:   "frames",
+		},
+		{
+			name:     "ID3v2 tag before audio",
+			data:     append(append(id3v2Header(50), make([]byte, 50)...), cbr(100)...),
+			expected: framesDuration(100),
+			method:   "frames",
+		},
+		{
+			name:     "ID3v2 tag with wrong size",
+			data:     append(append(id3v2Header(5000), make([]byte, 50)...), cbr(100)...),
+			expected: framesDuration(100),
+			method:   "frames",
+		},
+		{
+			name:     "ID3v1 tag at end",
+			data:     append(cbr(100), append([]byte("TAG"), make([]byte, 125)...)...),
+			expected: framesDuration(100),
+			method:   "frames",
+		},
+		{
+			name:     "garbage between frames",
+			data:     append(append(cbr(50), []byte("\xFF\xFB\x90garbage\xFF\xE0junk")...), cbr(50)...),
+			expected: framesDuration(100),
+			method:   "frames",
+		},
+		{
+			name:     "truncated last frame",
+			data:     cbr(100)[:417*100-200],
+			expected: framesDuration(99),
+			method:   "frames",
+		},
+		{
+			name:     "Xing header",
+			data:     append(xing(5000), cbr(10)...),
+			expected: framesDuration(5000),
+			method:   "xing",
+		},
+		{
+			name:     "VBR without Xing header",
+			data:     vbr,
+			expected: framesDuration(200),
+			method:   "frames",
+		},
+		{
+			name:    "not an mp3",
+			data:    bytes.Repeat([]byte("not audio "), 100),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := mp3Duration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("mp3Duration() = %v, want error", result.duration)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mp3Duration() error = %v", err)
+			}
+			if !approxEqual(result.duration, tt.expected, time.Millisecond) {
+				t.Errorf("duration = %v, want %v", result.duration, tt.expected)
+			}
+			if result.method != tt.method {
+				t.Errorf("method = %q, want %q", result.method, tt.method)
+			}
+		})
+	}
+}
+
+func TestMP3DurationSampling(t *testing.T) {
+	// Alternate bitrates in blocks so every sample point sees a mix
+	var data []byte
+	n := 0
+	for block := 0; block < 64; block++ {
+		for i := 0; i < 40; i++ {
+			data = append(data, mp3FrameBytes(byte(5+(block+i)%6))...)
+			n++
+		}
+	}
+	r := bytes.NewReader(data)
+	s := &mp3Stream{r: r, start: 0, end: int64(len(data))}
+	first, _ := parseMP3Frame(data)
+
+	result, err := s.sample(0, first)
+	if err != nil {
+		t.Fatalf("sample() error = %v", err)
+	}
+	if result.method != "sampled" {
+		t.Errorf("method = %q, want %q", result.method, "sampled")
+	}
+
+	// Sampling is an estimate, allow 5%
+	expected := framesDuration(n)
+	if !approxEqual(result.duration, expected, expected/20) {
+		t.Errorf("duration = %v, want ~%v", result.duration, expected)
+	}
+}
+
+func TestMP3ProviderFixtures(t *testing.T) {
+	tests := []struct {
+		filename string
+		min, max time.Duration
+	}{
+		{"chapter01.mp3", 900 * time.Millisecond, 1200 * time.Millisecond},
+		{"chapter02.mp3", 1900 * time.Millisecond, 2200 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			filePath := filepath.Join("testdata/audiobook1", tt.filename)
+			if _, err := os.Stat(filePath); os.IsNotExist(err) {
+				t.Skipf("Test file %s does not exist", filePath)
+			}
+
+			est, err := mp3Provider{}.Duration(filePath, nil)
+			if err != nil {
+				t.Fatalf("Duration() error = %v", err)
+			}
+			if est.Duration < tt.min || est.Duration > tt.max {
+				t.Errorf("Duration() = %v, want between %v and %v", est.Duration, tt.min, tt.max)
+			}
+		})
+	}
+
+	if _, err := (mp3Provider{}).Duration("testdata/audiobook1/chapter03.m4a", nil); err == nil {
+		t.Error("Duration() on an m4a file error = nil, want error")
+	}
+}
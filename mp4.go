@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// mp4Duration reads the movie header (moov/mvhd) of an MP4/M4A/M4B file,
+// which holds the presentation's timescale and length.
+func mp4Duration(r io.ReaderAt, size int64) (time.Duration, error) {
+	moov, moovSize, err := findMP4Box(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhd, mvhdSize, err := findMP4Box(r, moov, moov+moovSize, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	var hdr [32]byte
+	n := 20 // version 0: 32-bit times
+	if _, err := r.ReadAt(hdr[:1], mvhd); err != nil {
+		return 0, err
+	}
+	if hdr[0] == 1 {
+		n = 32 // version 1: 64-bit times
+	}
+	if int64(n) > mvhdSize {
+		return 0, errors.New("mvhd box too short")
+	}
+	if _, err := r.ReadAt(hdr[:n], mvhd); err != nil {
+		return 0, err
+	}
+
+	var timescale, units uint64
+	if hdr[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(hdr[20:24]))
+		units = binary.BigEndian.Uint64(hdr[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(hdr[12:16]))
+		units = uint64(binary.BigEndian.Uint32(hdr[16:20]))
+	}
+	// All ones means unknown, as in fragmented files still being written
+	if timescale == 0 || units == 0 || units == 0xFFFFFFFF || units == 1<<64-1 {
+		return 0, errors.New("mvhd has no duration")
+	}
+	return secondsToDuration(float64(units) / float64(timescale)), nil
+}
+
+// findMP4Box returns the offset and size of the payload of the first box
+// named name between start and end.
+func findMP4Box(r io.ReaderAt, start int64, end int64, name string) (int64, int64, error) {
+	var hdr [16]byte
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(hdr[:8], offset); err != nil {
+			return 0, 0, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		headerSize := int64(8)
+		switch boxSize {
+		case 0: // runs to the end of its parent
+			boxSize = end - offset
+		case 1: // 64-bit size follows the type
+			if _, err := r.ReadAt(hdr[8:16], offset+8); err != nil {
+				return 0, 0, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize || offset+boxSize > end {
+			return 0, 0, fmt.Errorf("bad %q box size at offset %d", hdr[4:8], offset)
+		}
+		if string(hdr[4:8]) == name {
+			return offset + headerSize, boxSize - headerSize, nil
+		}
+		offset += boxSize
+	}
+	return 0, 0, fmt.Errorf("no %s box", name)
+}
+
+// mp4Provider is the native MP4 parser exposed as a DurationProvider.
+type mp4Provider struct{}
+
+func (mp4Provider) Name() string { return "native" }
+
+func (mp4Provider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".m4a", ".m4b", ".mp4":
+	default:
+		return DurationEstimate{}, errors.New("not an MP4 file")
+	}
+
+	d, err := readNativeDuration(filePath, mp4Duration)
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+	return DurationEstimate{Duration: d, Confidence: 0.9}, nil
+}
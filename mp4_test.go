@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+)
+
+// mp4Box builds a box with a 32-bit size.
+func mp4Box(name string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	box := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(box, uint32(8+len(body)))
+	copy(box[4:], name)
+	return append(box, body...)
+}
+
+func mvhdV0(timescale, duration uint32) []byte {
+	b := make([]byte, 100)
+	binary.BigEndian.PutUint32(b[12:], timescale)
+	binary.BigEndian.PutUint32(b[16:], duration)
+	return mp4Box("mvhd", b)
+}
+
+func mvhdV1(timescale uint32, duration uint64) []byte {
+	b := make([]byte, 112)
+	b[0] = 1
+	binary.BigEndian.PutUint32(b[20:], timescale)
+	binary.BigEndian.PutUint64(b[24:], duration)
+	return mp4Box("mvhd", b)
+}
+
+func TestMP4Duration(t *testing.T) {
+	ftyp := mp4Box("ftyp", []byte("M4B \x00\x00\x00\x00"))
+	mdat := mp4Box("mdat", make([]byte, 64))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"version 0", bytes.Join([][]byte{ftyp, mp4Box("moov", mvhdV0(44100, 44100*90)), mdat}, nil), 90 * time.Second, false},
+		{"version 1", bytes.Join([][]byte{ftyp, mdat, mp4Box("moov", mp4Box("udta"), mvhdV1(1000, 20*3600*1000))}, nil), 20 * time.Hour, false},
+		{"unknown duration", bytes.Join([][]byte{ftyp, mp4Box("moov", mvhdV0(1000, 0xFFFFFFFF))}, nil), 0, true},
+		{"no moov", bytes.Join([][]byte{ftyp, mdat}, nil), 0, true},
+		{"bad box size", append(ftyp, 0, 0, 0, 99, 'm', 'o', 'o', 'v'), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := mp4Duration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("mp4Duration() = %v, want error", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mp4Duration() error = %v", err)
+			}
+			if d != tt.expected {
+				t.Errorf("mp4Duration() = %v, want %v", d, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMP4ProviderFixture(t *testing.T) {
+	filePath := "testdata/audiobook1/chapter03.m4a"
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		t.Skipf("Test file %s does not exist", filePath)
+	}
+
+	est, err := mp4Provider{}.Duration(filePath, nil)
+	if err != nil {
+		t.Fatalf("Duration() error = %v", err)
+	}
+	if est.Duration < 2900*time.Millisecond || est.Duration > 3100*time.Millisecond {
+		t.Errorf("Duration() = %v, want ~3s", est.Duration)
+	}
+
+	if _, err := (mp4Provider{}).Duration("testdata/audiobook1/chapter01.mp3", nil); err == nil {
+		t.Error("Duration() on an mp3 file error = nil, want error")
+	}
+}
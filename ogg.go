@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// oggMaxPage is the largest an Ogg page can be: a 27 byte header, 255
+// segment lengths and 255 segments of 255 bytes.
+const oggMaxPage = 27 + 255 + 255*255
+
+// oggDuration reads the sample rate from the first page's codec header and
+// the total samples from the granule position of the stream's last page.
+// Vorbis and Opus are understood; Opus always counts at 48kHz and its
+// pre-skip samples at the start aren't played.
+func oggDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	first := make([]byte, 27+255+64)
+	n, err := r.ReadAt(first, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	first = first[:n]
+	if len(first) < 28 || string(first[:4]) != "OggS" {
+		return 0, errors.New("no OggS page")
+	}
+	serial := binary.LittleEndian.Uint32(first[14:18])
+	packetStart := 27 + int(first[26])
+	if packetStart >= len(first) {
+		return 0, errors.New("first Ogg page truncated")
+	}
+	packet := first[packetStart:]
+
+	var sampleRate, preSkip uint64
+	switch {
+	case len(packet) >= 16 && string(packet[:7]) == "\x01vorbis":
+		sampleRate = uint64(binary.LittleEndian.Uint32(packet[12:16]))
+	case len(packet) >= 12 && string(packet[:8]) == "OpusHead":
+		sampleRate = 48000
+		preSkip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+	default:
+		return 0, errors.New("unsupported Ogg codec")
+	}
+	if sampleRate == 0 {
+		return 0, errors.New("codec header has no sample rate")
+	}
+
+	granule, err := lastOggGranule(r, size, serial)
+	if err != nil {
+		return 0, err
+	}
+	if granule <= preSkip {
+		return 0, errors.New("no audio samples")
+	}
+	return secondsToDuration(float64(granule-preSkip) / float64(sampleRate)), nil
+}
+
+// lastOggGranule finds the granule position of the last page of the stream
+// with the given serial number that has one.
+func lastOggGranule(r io.ReaderAt, size int64, serial uint32) (uint64, error) {
+	start := size - 2*oggMaxPage
+	if start < 0 {
+		start = 0
+	}
+	tail := make([]byte, size-start)
+	if _, err := r.ReadAt(tail, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	for i := len(tail); ; {
+		i = bytes.LastIndex(tail[:i], []byte("OggS"))
+		if i < 0 {
+			return 0, errors.New("no final Ogg page")
+		}
+		if i+27 > len(tail) || binary.LittleEndian.Uint32(tail[i+14:i+18]) != serial {
+			continue
+		}
+		// -1 marks a page on which no packet ends
+		granule := binary.LittleEndian.Uint64(tail[i+6 : i+14])
+		if granule != 1<<64-1 {
+			return granule, nil
+		}
+	}
+}
+
+// oggProvider is the native Ogg parser exposed as a DurationProvider.
+type oggProvider struct{}
+
+func (oggProvider) Name() string { return "native" }
+
+func (oggProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".ogg", ".oga", ".opus":
+	default:
+		return DurationEstimate{}, errors.New("not an Ogg file")
+	}
+
+	d, err := readNativeDuration(filePath, oggDuration)
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+	return DurationEstimate{Duration: d, Confidence: 0.85}, nil
+}
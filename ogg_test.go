@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// oggPage builds a page holding one packet (under 255 bytes).
+func oggPage(serial uint32, granule uint64, packet []byte) []byte {
+	b := make([]byte, 27, 28+len(packet))
+	copy(b, "OggS")
+	binary.LittleEndian.PutUint64(b[6:], granule)
+	binary.LittleEndian.PutUint32(b[14:], serial)
+	b[26] = 1
+	b = append(b, byte(len(packet)))
+	return append(b, packet...)
+}
+
+func vorbisHeader(sampleRate uint32) []byte {
+	b := make([]byte, 30)
+	copy(b, "\x01vorbis")
+	b[11] = 2
+	binary.LittleEndian.PutUint32(b[12:], sampleRate)
+	return b
+}
+
+func opusHeader(preSkip uint16) []byte {
+	b := make([]byte, 19)
+	copy(b, "OpusHead")
+	b[8] = 1
+	b[9] = 2
+	binary.LittleEndian.PutUint16(b[10:], preSkip)
+	binary.LittleEndian.PutUint32(b[12:], 44100)
+	return b
+}
+
+func TestOggDuration(t *testing.T) {
+	audio := make([]byte, 200)
+	tests := []struct {
+		name     string
+		pages    [][]byte
+		expected time.Duration
+		wantErr  bool
+	}{
+		{
+			"vorbis",
+			[][]byte{oggPage(7, 0, vorbisHeader(44100)), oggPage(7, 44100*60, audio), oggPage(7, 44100*61, audio)},
+			61 * time.Second, false,
+		},
+		{
+			"opus pre-skip",
+			[][]byte{oggPage(1, 0, opusHeader(312)), oggPage(1, 48000*10+312, audio)},
+			10 * time.Second, false,
+		},
+		{
+			"skips other streams and pages without a granule",
+			[][]byte{oggPage(7, 0, vorbisHeader(8000)), oggPage(7, 16000, audio), oggPage(7, 1<<64-1, audio), oggPage(9, 999999, audio)},
+			2 * time.Second, false,
+		},
+		{"unknown codec", [][]byte{oggPage(1, 0, []byte("\x7fFLAC")), oggPage(1, 1000, audio)}, 0, true},
+		{"not ogg", [][]byte{[]byte("fLaC\x00\x00\x00\x22")}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Join(tt.pages, nil)
+			d, err := oggDuration(bytes.NewReader(data), int64(len(data)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("oggDuration() = %v, want error", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("oggDuration() error = %v", err)
+			}
+			if d != tt.expected {
+				t.Errorf("oggDuration() = %v, want %v", d, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// openLibrary looks books up in Open Library (openlibrary.org): a search by
+// ISBN, else title and author, finds the work, whose record has the
+// description.
+type openLibrary struct {
+	BaseURL   string
+	CoversURL string
+}
+
+func (ol *openLibrary) Name() string { return "Open Library" }
+
+func (ol *openLibrary) Lookup(query BookQuery) (*BookMetadata, error) {
+	params := url.Values{"limit": {"1"}, "fields": {"key,title,author_name,cover_i"}}
+	switch {
+	case query.ISBN != "":
+		params.Set("isbn", query.ISBN)
+	case query.Title != "":
+		params.Set("title", query.Title)
+		if len(query.Authors) > 0 {
+			params.Set("author", query.Authors[0])
+		}
+	default:
+		return nil, fmt.Errorf("no title or ISBN to look up")
+	}
+
+	var search struct {
+		Docs []struct {
+			Key     string   `json:"key"`
+			Title   string   `json:"title"`
+			Authors []string `json:"author_name"`
+			CoverID int      `json:"cover_i"`
+		} `json:"docs"`
+	}
+	if err := getJSON(ol.BaseURL+"/search.json?"+params.Encode(), &search); err != nil {
+		return nil, err
+	}
+	if len(search.Docs) == 0 {
+		return nil, errBookNotFound
+	}
+	doc := search.Docs[0]
+
+	metadata := &BookMetadata{
+		Provider: "openlibrary",
+		ID:       doc.Key,
+		Title:    doc.Title,
+		Authors:  doc.Authors,
+	}
+
+	var work struct {
+		Description json.RawMessage `json:"description"`
+		Covers      []int           `json:"covers"`
+	}
+	if err := getJSON(ol.BaseURL+doc.Key+".json", &work); err != nil {
+		return nil, err
+	}
+	metadata.Description = openLibraryText(work.Description)
+
+	coverID := doc.CoverID
+	if coverID <= 0 && len(work.Covers) > 0 {
+		coverID = work.Covers[0]
+	}
+	// Negative IDs are deleted covers
+	if coverID > 0 {
+		metadata.CoverURL = fmt.Sprintf("%s/b/id/%d-L.jpg", ol.CoversURL, coverID)
+	}
+	return metadata, nil
+}
+
+// openLibraryText reads a text field, which is either a string or a typed
+// value: {"type": "/type/text", "value": "..."}.
+func openLibraryText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return strings.TrimSpace(s)
+	}
+	var typed struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(raw, &typed) == nil {
+		return strings.TrimSpace(typed.Value)
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// fakeOpenLibrary serves a search that finds The Hobbit by ISBN or by title
+// and author, and the work's record.
+func fakeOpenLibrary(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search.json", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("isbn") == "9780547928227" || (q.Get("title") == "The Hobbit" && q.Get("author") == "J.R.R. Tolkien") {
+			w.Write([]byte(`{"numFound": 1, "docs": [{"key": "/works/OL262758W", "title": "The Hobbit", "author_name": ["J.R.R. Tolkien"], "cover_i": 14627509}]}`))
+			return
+		}
+		w.Write([]byte(`{"numFound": 0, "docs": []}`))
+	})
+	mux.HandleFunc("/works/OL262758W.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"title": "The Hobbit", "description": {"type": "/type/text", "value": "In a hole in the ground there lived a hobbit.\n"}, "covers": [1]}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenLibraryLookup(t *testing.T) {
+	server := fakeOpenLibrary(t)
+	ol := &openLibrary{BaseURL: server.URL, CoversURL: "https://covers.example"}
+
+	expected := &BookMetadata{
+		Provider:    "openlibrary",
+		ID:          "/works/OL262758W",
+		Title:       "The Hobbit",
+		Authors:     []string{"J.R.R. Tolkien"},
+		Description: "In a hole in the ground there lived a hobbit.",
+		CoverURL:    "https://covers.example/b/id/14627509-L.jpg",
+	}
+
+	for _, query := range []BookQuery{
+		{ISBN: "9780547928227", Title: "Wrong Title"},
+		{Title: "The Hobbit", Authors: []string{"J.R.R. Tolkien"}},
+	} {
+		got, err := ol.Lookup(query)
+		if err != nil {
+			t.Fatalf("Lookup(%+v) error = %v", query, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Lookup(%+v) = %+v, want %+v", query, got, expected)
+		}
+	}
+
+	if _, err := ol.Lookup(BookQuery{Title: "Nothing Like It"}); !errors.Is(err, errBookNotFound) {
+		t.Errorf("Lookup() of an unknown book error = %v, want errBookNotFound", err)
+	}
+}
+
+func TestOpenLibraryText(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{`"Plain"`, "Plain"},
+		{`{"type": "/type/text", "value": " Typed "}`, "Typed"},
+		{`null`, ""},
+		{``, ""},
+	}
+
+	for _, tt := range tests {
+		if got := openLibraryText([]byte(tt.raw)); got != tt.expected {
+			t.Errorf("openLibraryText(%s) = %q, want %q", tt.raw, got, tt.expected)
+		}
+	}
+}
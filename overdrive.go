@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// overDriveMarkersTag is the user text tag OverDrive's MP3 audiobooks keep
+// their chapter list in.
+const overDriveMarkersTag = "OverDrive MediaMarkers"
+
+// overDriveChapters reads the chapters in an OverDrive MediaMarkers tag:
+//
+//	<Markers><Marker><Name>Chapter 1</Name><Time>0:00.000</Time></Marker>...</Markers>
+//
+// Markers only have start times, so each chapter ends where the next one
+// starts and the last one's End is 0 (the end of the file).
+func overDriveChapters(metadata tag.Metadata) ([]Chapter, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	markers := strings.TrimSpace(userTextTag(metadata, overDriveMarkersTag))
+	if markers == "" {
+		return nil, nil
+	}
+
+	var doc struct {
+		Markers []struct {
+			Name string `xml:"Name"`
+			Time string `xml:"Time"`
+		} `xml:"Marker"`
+	}
+	if err := xml.Unmarshal([]byte(markers), &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", overDriveMarkersTag, err)
+	}
+
+	chapters := make([]Chapter, 0, len(doc.Markers))
+	for i, m := range doc.Markers {
+		start, err := parseMarkerTime(m.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: marker %d: %v", overDriveMarkersTag, i+1, err)
+		}
+		if i > 0 {
+			chapters[i-1].End = start
+		}
+		title := strings.TrimSpace(m.Name)
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		chapters = append(chapters, Chapter{Start: start, Title: title})
+	}
+	return chapters, nil
+}
+
+// parseMarkerTime parses a MediaMarkers time: "SS.mmm", "M:SS.mmm" or
+// "H:MM:SS.mmm".
+func parseMarkerTime(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("bad time %q", s)
+	}
+
+	var seconds float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("bad time %q", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return secondsToDuration(seconds), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+func TestOverDriveChapters(t *testing.T) {
+	markers := `<?xml version="1.0" encoding="utf-8"?><Markers>` +
+		`<Marker><Name>Opening Credits</Name><Time>0:00.000</Time></Marker>` +
+		`<Marker><Name>Chapter 1</Name><Time>0:21.500</Time></Marker>` +
+		`<Marker><Name> </Name><Time>1:02:03.250</Time></Marker>` +
+		`</Markers>`
+	txxx := append([]byte{0}, "OverDrive MediaMarkers\x00"+markers...)
+
+	metadata, err := tag.ReadFrom(bytes.NewReader(id3v2Tag(id3Frame("TXXX", txxx))))
+	if err != nil {
+		t.Fatalf("tag.ReadFrom() error = %v", err)
+	}
+
+	chapters, err := readChapters("unused.mp3", metadata)
+	if err != nil {
+		t.Fatalf("readChapters() error = %v", err)
+	}
+	expected := []Chapter{
+		{Start: 0, End: 21500 * time.Millisecond, Title: "Opening Credits"},
+		{Start: 21500 * time.Millisecond, End: time.Hour + 2*time.Minute + 3250*time.Millisecond, Title: "Chapter 1"},
+		{Start: time.Hour + 2*time.Minute + 3250*time.Millisecond, Title: "Chapter 3"},
+	}
+	if !reflect.DeepEqual(chapters, expected) {
+		t.Errorf("readChapters() = %+v, want %+v", chapters, expected)
+	}
+}
+
+func TestOverDriveChaptersErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		markers string
+	}{
+		{"not xml", "<Markers><Marker>"},
+		{"bad time", "<Markers><Marker><Name>One</Name><Time>soon</Time></Marker></Markers>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := fakeMetadata{format: tag.ID3v2_3, raw: map[string]interface{}{
+				"TXXX": &tag.Comm{Description: overDriveMarkersTag, Text: tt.markers},
+			}}
+			if _, err := overDriveChapters(metadata); err == nil {
+				t.Error("overDriveChapters() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestParseMarkerTime(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"12.5", 12500 * time.Millisecond, false},
+		{"3:04.000", 3*time.Minute + 4*time.Second, false},
+		{"75:00.000", 75 * time.Minute, false},
+		{"1:00:00.001", time.Hour + time.Millisecond, false},
+		{"1:2:3:4", 0, true},
+		{"-1:00", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseMarkerTime(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMarkerTime(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !approxEqual(got, tt.expected, time.Microsecond) {
+				t.Errorf("parseMarkerTime(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
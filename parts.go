@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// partsStateFile records where a file was cut, so silence detection (which
+// decodes the whole file) only runs again when the source or the maximum
+// changes.
+const partsStateFile = ".bookast-parts.json"
+
+// minPartDuration is the shortest --max-part-duration accepted. Anything
+// shorter would split at every pause.
+const minPartDuration = 5 * time.Minute
+
+// silenceNoise and silenceMinLength tune ffmpeg's silencedetect: quieter
+// than -35dB for half a second is a pause between sentences or scenes.
+const (
+	silenceNoise     = "-35dB"
+	silenceMinLength = 500 * time.Millisecond
+)
+
+// silence is a quiet stretch of audio found by silencedetect.
+type silence struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// partsState is the contents of partsStateFile.
+type partsState struct {
+	MaxPartDuration string   `json:"maxPartDuration"`
+	Cuts            []string `json:"cuts"`
+}
+
+// partsDirName is the subdirectory the parts of audioFile are written to.
+func partsDirName(audioFile string) string {
+	return strings.TrimSuffix(audioFile, filepath.Ext(audioFile)) + "-parts"
+}
+
+// parseSilences extracts the silences from silencedetect's log output. A
+// silence still running at the end of the file has no silence_end and is
+// dropped, there's no audio after it to start a part.
+func parseSilences(output string) []silence {
+	var silences []silence
+	start := time.Duration(-1)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "silence_start: "); i >= 0 {
+			if t, ok := parseSilenceTime(line[i+len("silence_start: "):]); ok {
+				start = t
+			}
+		} else if i := strings.Index(line, "silence_end: "); i >= 0 && start >= 0 {
+			if t, ok := parseSilenceTime(line[i+len("silence_end: "):]); ok {
+				silences = append(silences, silence{Start: start, End: t})
+			}
+			start = -1
+		}
+	}
+	return silences
+}
+
+func parseSilenceTime(s string) (time.Duration, bool) {
+	if i := strings.IndexAny(s, " |"); i >= 0 {
+		s = s[:i]
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	// Leading silence can come out slightly negative
+	if seconds < 0 {
+		seconds = 0
+	}
+	return secondsToDuration(seconds), true
+}
+
+// pickCuts chooses where to cut a file of length total so no part is longer
+// than max. Each cut is the middle of the last silence in the second half of
+// the part, so parts stay close to max without splitting a word; a part with
+// no silence there is cut at exactly max.
+func pickCuts(silences []silence, total time.Duration, max time.Duration) []time.Duration {
+	var cuts []time.Duration
+	start := time.Duration(0)
+	for total-start > max {
+		limit := start + max
+		cut := limit
+		for _, s := range silences {
+			mid := s.Start + (s.End-s.Start)/2
+			if mid > start+max/2 && mid <= limit {
+				cut = mid
+			}
+		}
+		cuts = append(cuts, cut)
+		start = cut
+	}
+	return cuts
+}
+
+// detectSilences runs ffmpeg's silencedetect over the file at path.
+func detectSilences(path string) ([]silence, error) {
+	filter := fmt.Sprintf("silencedetect=noise=%s:d=%.1f", silenceNoise, silenceMinLength.Seconds())
+	output, err := exec.Command("ffmpeg", "-hide_banner", "-nostats", "-i", path, "-map", "0:a", "-af", filter, "-f", "null", "-").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg silencedetect failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return parseSilences(string(output)), nil
+}
+
+// partCuts returns where to cut source, from the state file in subdir when it
+// was written for this maximum after the source last changed.
+func partCuts(dir string, source string, subdir string, total time.Duration, max time.Duration) ([]time.Duration, error) {
+	srcPath := filepath.Join(dir, source)
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	statePath := filepath.Join(dir, subdir, partsStateFile)
+	if info, err := os.Stat(statePath); err == nil && !info.ModTime().Before(srcInfo.ModTime()) {
+		data, err := os.ReadFile(statePath)
+		if err != nil {
+			return nil, err
+		}
+		var state partsState
+		if err := json.Unmarshal(data, &state); err == nil && state.MaxPartDuration == max.String() {
+			var cuts []time.Duration
+			for _, s := range state.Cuts {
+				cut, err := time.ParseDuration(s)
+				if err != nil {
+					break
+				}
+				cuts = append(cuts, cut)
+			}
+			if len(cuts) == len(state.Cuts) {
+				return cuts, nil
+			}
+		}
+	}
+
+	silences, err := detectSilences(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	cuts := pickCuts(silences, total, max)
+
+	state := partsState{MaxPartDuration: max.String()}
+	for _, cut := range cuts {
+		state.Cuts = append(state.Cuts, cut.String())
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := mkdirAll(filepath.Join(dir, subdir)); err != nil {
+		return nil, err
+	}
+	if err := writeFileIfChanged(statePath, append(data, '\n')); err != nil {
+		return nil, err
+	}
+	return cuts, nil
+}
+
+// splitLongFiles replaces files in audioFiles longer than max with parts cut
+// at silences into a "<name>-parts" subdirectory, titled "<title>, Part N".
+// The returned names are relative to dir.
+func splitLongFiles(dir string, audioFiles []string, max time.Duration) ([]string, error) {
+	var result []string
+	for _, filename := range audioFiles {
+		srcPath := filepath.Join(dir, filename)
+		metadata := readTags(srcPath)
+		duration, _, err := resolveDuration(srcPath, metadata, durationProviders)
+		if err != nil && requireDuration {
+			return nil, fmt.Errorf("failed to get duration of %s: %w", filename, err)
+		}
+		// Files of unknown length can't be split, processAudioFile warns
+		if err != nil || duration.Duration <= max {
+			result = append(result, filename)
+			continue
+		}
+
+		subdir := filepath.Join(filepath.Dir(filename), partsDirName(filepath.Base(filename)))
+		cuts, err := partCuts(dir, filename, subdir, duration.Duration, max)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split %s: %w", filename, err)
+		}
+
+		title := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+		if metadata != nil && strings.TrimSpace(metadata.Title()) != "" {
+			title = strings.TrimSpace(metadata.Title())
+		}
+		var parts []Chapter
+		start := time.Duration(0)
+		for i, cut := range append(cuts, 0) {
+			parts = append(parts, Chapter{Start: start, End: cut, Title: fmt.Sprintf("%s, Part %d", title, i+1)})
+			start = cut
+		}
+
+		segments, err := ensureSegments(dir, filename, subdir, parts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split %s: %w", filename, err)
+		}
+		result = append(result, segments...)
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSilences(t *testing.T) {
+	output := `Input #0, mp3, from 'book.mp3':
+  Duration: 20:00:00.00, start: 0.000000, bitrate: 64 kb/s
+[silencedetect @ 0x7f8] silence_start: -0.00675
+[silencedetect @ 0x7f8] silence_end: 1.2 | silence_duration: 1.20675
+[silencedetect @ 0x7f8] silence_start: 10799.5
+[silencedetect @ 0x7f8] silence_end: 10801.25 | silence_duration: 1.75
+[silencedetect @ 0x7f8] silence_start: 71999
+`
+	expected := []silence{
+		{Start: 0, End: 1200 * time.Millisecond},
+		{Start: 10799500 * time.Millisecond, End: 10801250 * time.Millisecond},
+	}
+	if got := parseSilences(output); !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseSilences() = %v, want %v", got, expected)
+	}
+}
+
+func TestPickCuts(t *testing.T) {
+	h := time.Hour
+	tests := []struct {
+		name     string
+		silences []silence
+		total    time.Duration
+		max      time.Duration
+		expected []time.Duration
+	}{
+		{"short enough", nil, 2 * h, 3 * h, nil},
+		{"no silences cuts at max", nil, 7 * h, 3 * h, []time.Duration{3 * h, 6 * h}},
+		{
+			"last silence before max",
+			[]silence{{2 * h, 2*h + 2*time.Second}, {2*h + 50*time.Minute, 2*h + 50*time.Minute + 2*time.Second}, {3*h + time.Minute, 3*h + time.Minute + 2*time.Second}},
+			5 * h, 3 * h,
+			[]time.Duration{2*h + 50*time.Minute + time.Second},
+		},
+		{
+			"silence in the first half is too early",
+			[]silence{{time.Hour, time.Hour + time.Second}},
+			4 * h, 3 * h,
+			[]time.Duration{3 * h},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickCuts(tt.silences, tt.total, tt.max); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("pickCuts() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPartCutsReusesState(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "book.mp3"), []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	subdir := partsDirName("book.mp3")
+	if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	state := `{"maxPartDuration": "3h0m0s", "cuts": ["2h55m1s", "5h58m0.5s"]}`
+	if err := os.WriteFile(filepath.Join(dir, subdir, partsStateFile), []byte(state), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A matching state file means ffmpeg never runs
+	cuts, err := partCuts(dir, "book.mp3", subdir, 8*time.Hour, 3*time.Hour)
+	if err != nil {
+		t.Fatalf("partCuts() error = %v", err)
+	}
+	expected := []time.Duration{2*time.Hour + 55*time.Minute + time.Second, 5*time.Hour + 58*time.Minute + 500*time.Millisecond}
+	if !reflect.DeepEqual(cuts, expected) {
+		t.Errorf("partCuts() = %v, want %v", cuts, expected)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// podcast:person roles bookast emits.
+const (
+	roleAuthor   = "author"
+	roleNarrator = "narrator"
+)
+
+// Person is a credit for the book, emitted as podcast:person.
+type Person struct {
+	Name string
+	Role string // roleAuthor or roleNarrator
+}
+
+// tagAuthors reads the book's authors from an audio file's tags. Audiobook
+// rippers put the author in the album artist, music-style taggers in the
+// artist.
+func tagAuthors(metadata tag.Metadata) []string {
+	if names := splitNames(metadata.AlbumArtist()); len(names) > 0 {
+		return names
+	}
+	return splitNames(metadata.Artist())
+}
+
+// tagNarrators reads the narrators from a NARRATOR user text tag, falling back
+// to the composer, which is where Audible and most m4b tools store them.
+func tagNarrators(metadata tag.Metadata) []string {
+	if names := splitNames(userTextTag(metadata, "NARRATOR")); len(names) > 0 {
+		return names
+	}
+	return splitNames(metadata.Composer())
+}
+
+// userTextTag returns a free-form tag: an ID3 TXXX frame or an MP4 "----"
+// atom, matched case-insensitively on its description.
+func userTextTag(metadata tag.Metadata, name string) string {
+	for key, value := range metadata.Raw() {
+		switch v := value.(type) {
+		case *tag.Comm:
+			if (strings.HasPrefix(key, "TXXX") || strings.HasPrefix(key, "TXX")) && strings.EqualFold(v.Description, name) {
+				return v.Text
+			}
+		case string:
+			if metadata.Format() == tag.MP4 && strings.EqualFold(key, name) {
+				return strings.TrimLeft(v, "\x00")
+			}
+		}
+	}
+	return ""
+}
+
+// splitNames splits a tag holding several people ("A; B", "A / B").
+// Commas are left alone since "Tolkien, J.R.R." is one person.
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '/' || r == '\x00' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// bookPeople returns the credits for the channel: book.yaml's authors and
+// narrators if it lists them, otherwise every distinct name in the episodes'
+// tags, in order of first appearance. Without either, they're the fallbacks
+// (from the catalog or the directory name).
+func bookPeople(episodes []Episode, book *BookConfig, fallbackAuthors, fallbackNarrators []string) []Person {
+	authors := book.Authors
+	if len(authors) == 0 {
+		for _, ep := range episodes {
+			authors = appendUnique(authors, ep.Authors...)
+		}
+	}
+	if len(authors) == 0 {
+		authors = fallbackAuthors
+	}
+
+	narrators := book.Narrators
+	if len(narrators) == 0 {
+		for _, ep := range episodes {
+			narrators = appendUnique(narrators, ep.Narrators...)
+		}
+	}
+	if len(narrators) == 0 {
+		narrators = fallbackNarrators
+	}
+
+	var people []Person
+	for _, name := range authors {
+		people = append(people, Person{Name: name, Role: roleAuthor})
+	}
+	for _, name := range narrators {
+		people = append(people, Person{Name: name, Role: roleNarrator})
+	}
+	return people
+}
+
+// setItemAuthors credits each episode's artists on its item when they aren't
+// the same for every episode, as in a short-story collection. A book whose
+// files all share an artist is one author's, credited on the channel.
+func setItemAuthors(episodes []Episode) {
+	varies := false
+	for i := 1; i < len(episodes); i++ {
+		if !sameNames(episodes[i].Artists, episodes[0].Artists) {
+			varies = true
+			break
+		}
+	}
+	for i := range episodes {
+		episodes[i].ItemAuthors = nil
+		if varies {
+			episodes[i].ItemAuthors = episodes[i].Artists
+		}
+	}
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if strings.EqualFold(existing, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
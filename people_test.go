@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+// peopleMetadata adds the tags people.go reads to fakeMetadata.
+type peopleMetadata struct {
+	fakeMetadata
+	artist, albumArtist, composer string
+}
+
+func (m peopleMetadata) Artist() string      { return m.artist }
+func (m peopleMetadata) AlbumArtist() string { return m.albumArtist }
+func (m peopleMetadata) Composer() string    { return m.composer }
+
+func TestTagPeople(t *testing.T) {
+	tests := []struct {
+		name      string
+		metadata  peopleMetadata
+		authors   []string
+		narrators []string
+	}{
+		{
+			name:     "no tags",
+			metadata: peopleMetadata{},
+		},
+		{
+			name:      "album artist and composer",
+			metadata:  peopleMetadata{artist: "Narrator Name", albumArtist: "Tolkien, J.R.R.", composer: "Rob Inglis"},
+			authors:   []string{"Tolkien, J.R.R."},
+			narrators: []string{"Rob Inglis"},
+		},
+		{
+			name:     "artist only",
+			metadata: peopleMetadata{artist: "Terry Pratchett / Neil Gaiman"},
+			authors:  []string{"Terry Pratchett", "Neil Gaiman"},
+		},
+		{
+			name: "ID3 narrator frame beats the composer",
+			metadata: peopleMetadata{
+				fakeMetadata: fakeMetadata{format: tag.ID3v2_4, raw: map[string]interface{}{
+					"TXXX":   &tag.Comm{Description: "AUTHOR_SORT", Text: "Pratchett, Terry"},
+					"TXXX_1": &tag.Comm{Description: "Narrator", Text: "Stephen Briggs; Nigel Planer"},
+				}},
+				composer: "Someone Else",
+			},
+			narrators: []string{"Stephen Briggs", "Nigel Planer"},
+		},
+		{
+			name: "MP4 freeform narrator atom",
+			metadata: peopleMetadata{
+				fakeMetadata: fakeMetadata{format: tag.MP4, raw: map[string]interface{}{"NARRATOR": "\x00\x00\x00\x00Andy Serkis"}},
+			},
+			narrators: []string{"Andy Serkis"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tagAuthors(tt.metadata); !reflect.DeepEqual(got, tt.authors) {
+				t.Errorf("tagAuthors() = %q, want %q", got, tt.authors)
+			}
+			if got := tagNarrators(tt.metadata); !reflect.DeepEqual(got, tt.narrators) {
+				t.Errorf("tagNarrators() = %q, want %q", got, tt.narrators)
+			}
+		})
+	}
+}
+
+func TestBookPeople(t *testing.T) {
+	episodes := []Episode{
+		{Authors: []string{"Neil Gaiman"}, Narrators: []string{"Michael Sheen"}},
+		{Authors: []string{"neil gaiman", "Terry Pratchett"}, Narrators: []string{"David Tennant"}},
+	}
+
+	tests := []struct {
+		name     string
+		book     *BookConfig
+		expected []Person
+	}{
+		{
+			name: "from tags",
+			book: &BookConfig{},
+			expected: []Person{
+				{"Neil Gaiman", roleAuthor},
+				{"Terry Pratchett", roleAuthor},
+				{"Michael Sheen", roleNarrator},
+				{"David Tennant", roleNarrator},
+			},
+		},
+		{
+			name: "book.yaml overrides",
+			book: &BookConfig{Narrators: []string{"Full Cast"}},
+			expected: []Person{
+				{"Neil Gaiman", roleAuthor},
+				{"Terry Pratchett", roleAuthor},
+				{"Full Cast", roleNarrator},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bookPeople(episodes, tt.book, []string{"Folder Author"}, []string{"Catalog Narrator"}); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("bookPeople() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+
+	// The catalog's and directory name's credits are the last resort
+	expected := []Person{{"Folder Author", roleAuthor}, {"Catalog Narrator", roleNarrator}}
+	if got := bookPeople(nil, &BookConfig{}, []string{"Folder Author"}, []string{"Catalog Narrator"}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("bookPeople() without tags = %+v, want %+v", got, expected)
+	}
+}
+
+func TestSetItemAuthors(t *testing.T) {
+	book := []Episode{{Artists: []string{"Ursula K. Le Guin"}}, {Artists: []string{"ursula k. le guin"}}}
+	setItemAuthors(book)
+	for i, ep := range book {
+		if ep.ItemAuthors != nil {
+			t.Errorf("one author's book: episode %d credits %q", i, ep.ItemAuthors)
+		}
+	}
+
+	anthology := []Episode{{Artists: []string{"Ted Chiang"}}, {Artists: []string{"N. K. Jemisin"}}, {}}
+	setItemAuthors(anthology)
+	expected := [][]string{{"Ted Chiang"}, {"N. K. Jemisin"}, nil}
+	for i, ep := range anthology {
+		if !reflect.DeepEqual(ep.ItemAuthors, expected[i]) {
+			t.Errorf("anthology: episode %d credits %q, want %q", i, ep.ItemAuthors, expected[i])
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "sync"
+
+// runParallel calls fn for every index in [0, n) on up to jobs goroutines
+// and waits for them all. Callers collect results by index, so output order
+// doesn't depend on scheduling.
+func runParallel(n int, jobs int, fn func(i int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > n {
+		jobs = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
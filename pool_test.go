@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunParallel(t *testing.T) {
+	for _, jobs := range []int{0, 1, 3, 100} {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+		done := make([]bool, 20)
+
+		runParallel(len(done), jobs, func(i int) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+			done[i] = true
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+
+		for i, ok := range done {
+			if !ok {
+				t.Errorf("jobs=%d: index %d not processed", jobs, i)
+			}
+		}
+		limit := jobs
+		if limit < 1 {
+			limit = 1
+		}
+		if maxRunning > limit {
+			t.Errorf("jobs=%d: %d ran at once", jobs, maxRunning)
+		}
+	}
+}
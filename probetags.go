@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// libraryTagExts are the formats the tag library reads. The tags of anything
+// else (WAV, WMA, WebM, Matroska and extensions added in the config file)
+// come from ffprobe instead.
+var libraryTagExts = map[string]bool{
+	".mp3":  true,
+	".m4a":  true,
+	".m4b":  true,
+	".mp4":  true,
+	".aac":  true,
+	".flac": true,
+	".ogg":  true,
+	".oga":  true,
+	".opus": true,
+}
+
+// probedTags are the container tags ffprobe reports for a file, keyed by
+// lowercase name ("title", "artist", "album_artist", "track", ...).
+type probedTags map[string]string
+
+// probeTags asks ffprobe for the tags of the file at path. Without ffprobe,
+// or when it can't read the file, the file just has no tags.
+func probeTags(path string) tag.Metadata {
+	tags := probedTags{}
+	output, err := runProbe(false, ffprobePath, "-v", "quiet", "-show_entries", "format_tags", "-of", "json", path)
+	if err != nil {
+		return tags
+	}
+	var result struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if json.Unmarshal(output, &result) != nil {
+		return tags
+	}
+	for key, value := range result.Format.Tags {
+		tags[strings.ToLower(key)] = value
+	}
+	return tags
+}
+
+// hasProbedTags reports whether path is in a format whose tags come from
+// ffprobe.
+func hasProbedTags(path string) bool {
+	return !libraryTagExts[strings.ToLower(filepath.Ext(path))]
+}
+
+func (t probedTags) Format() tag.Format     { return tag.UnknownFormat }
+func (t probedTags) FileType() tag.FileType { return tag.UnknownFileType }
+func (t probedTags) Title() string          { return t["title"] }
+func (t probedTags) Album() string          { return t["album"] }
+func (t probedTags) Artist() string         { return t["artist"] }
+func (t probedTags) AlbumArtist() string    { return t["album_artist"] }
+func (t probedTags) Composer() string       { return t["composer"] }
+func (t probedTags) Genre() string          { return t["genre"] }
+func (t probedTags) Lyrics() string         { return t["lyrics"] }
+func (t probedTags) Comment() string        { return t["comment"] }
+func (t probedTags) Picture() *tag.Picture  { return nil }
+
+func (t probedTags) Year() int {
+	for _, key := range []string{"date", "year"} {
+		if len(t[key]) >= 4 {
+			if year, err := strconv.Atoi(t[key][:4]); err == nil {
+				return year
+			}
+		}
+	}
+	return 0
+}
+
+func (t probedTags) Track() (int, int) { return parseTagNumber(t["track"]) }
+func (t probedTags) Disc() (int, int)  { return parseTagNumber(t["disc"]) }
+
+func (t probedTags) Raw() map[string]interface{} {
+	raw := make(map[string]interface{}, len(t))
+	for key, value := range t {
+		raw[key] = value
+	}
+	return raw
+}
+
+// parseTagNumber parses "3" or "3/12" into the number and total.
+func parseTagNumber(s string) (int, int) {
+	n, total, _ := strings.Cut(s, "/")
+	x, _ := strconv.Atoi(strings.TrimSpace(n))
+	y, _ := strconv.Atoi(strings.TrimSpace(total))
+	return x, y
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProbedTags(t *testing.T) {
+	tags := probedTags{"title": "Chapter 3", "track": "3/12", "disc": "1", "date": "2019-05-01"}
+
+	if got := tags.Title(); got != "Chapter 3" {
+		t.Errorf("Title() = %q", got)
+	}
+	if n, total := tags.Track(); n != 3 || total != 12 {
+		t.Errorf("Track() = %d, %d, want 3, 12", n, total)
+	}
+	if n, total := tags.Disc(); n != 1 || total != 0 {
+		t.Errorf("Disc() = %d, %d, want 1, 0", n, total)
+	}
+	if got := tags.Year(); got != 2019 {
+		t.Errorf("Year() = %d, want 2019", got)
+	}
+}
+
+func TestProcessAudioFileWithoutTagSupport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "03 - The Shadow.wav")
+	if err := os.WriteFile(path, wavFile(wavFmt(8000), riffChunk("data", make([]byte, 24000))), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No ffprobe, so no tags: the title comes from the filename
+	saved := ffprobePath
+	ffprobePath = filepath.Join(dir, "missing-ffprobe")
+	defer func() { ffprobePath = saved }()
+
+	episode, err := processAudioFile(path, "https://example.com", dir, time.Now(), 3)
+	if err != nil {
+		t.Fatalf("processAudioFile() error = %v", err)
+	}
+	if episode.Title != "03 - The Shadow" {
+		t.Errorf("Title = %q, want the filename", episode.Title)
+	}
+	if episode.Duration != 3*time.Second || episode.DurationSource != "native" {
+		t.Errorf("Duration = %v from %q, want 3s from native", episode.Duration, episode.DurationSource)
+	}
+	if got := getMimeType(path); got != "audio/wav" {
+		t.Errorf("getMimeType() = %q", got)
+	}
+}
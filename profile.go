@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Phases timed by --profile.
+const (
+	phaseTags    = "tag reading"
+	phaseProbe   = "ffprobe"
+	phaseNative  = "native parsing"
+	phaseWriting = "writing files"
+)
+
+// phaseTimer adds up the time spent in each phase of a run. Phases run in
+// parallel (--jobs), so their totals can add up to more than the run took.
+type phaseTimer struct {
+	mu     sync.Mutex
+	start  time.Time
+	totals map[string]time.Duration
+	counts map[string]int
+}
+
+// phases is the active timer, nil unless --profile is set.
+var phases *phaseTimer
+
+// timePhase starts timing phase; call the returned func when it ends.
+//
+//	defer timePhase(phaseTags)()
+func timePhase(phase string) func() {
+	p := phases
+	if p == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.totals[phase] += elapsed
+		p.counts[phase]++
+	}
+}
+
+// Print writes each phase's total, count and share of the run's wall time,
+// slowest first.
+func (p *phaseTimer) Print(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wall := time.Since(p.start)
+	names := make([]string, 0, len(p.totals))
+	for name := range p.totals {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return p.totals[names[i]] > p.totals[names[j]] })
+
+	fmt.Fprintf(w, "Time spent (%s wall clock):\n", wall.Round(time.Millisecond))
+	for _, name := range names {
+		share := 0.0
+		if wall > 0 {
+			share = 100 * float64(p.totals[name]) / float64(wall)
+		}
+		fmt.Fprintf(w, "  %-15s %10s %5.1f%%  %s\n", name, p.totals[name].Round(time.Microsecond), share, plural(p.counts[name], "call"))
+	}
+}
+
+// profileFilenames are where each --profile mode writes its output.
+var profileFilenames = map[string]string{
+	"cpu":   "bookast-cpu.pprof",
+	"mem":   "bookast-mem.pprof",
+	"trace": "bookast.trace",
+}
+
+// startProfile starts the --profile mode and phase timing. The returned func
+// stops it, writes the profile and prints the phase summary to w.
+func startProfile(mode string, w io.Writer) (func(), error) {
+	filename, ok := profileFilenames[mode]
+	if !ok {
+		return nil, fmt.Errorf("--profile must be cpu, mem or trace, not %q", mode)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case "cpu":
+		err = pprof.StartCPUProfile(f)
+	case "trace":
+		err = trace.Start(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	phases = &phaseTimer{start: time.Now(), totals: map[string]time.Duration{}, counts: map[string]int{}}
+	return func() {
+		switch mode {
+		case "cpu":
+			pprof.StopCPUProfile()
+		case "trace":
+			trace.Stop()
+		case "mem":
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fmt.Fprintf(w, "Error writing %s: %v\n", filename, err)
+			}
+		}
+		f.Close()
+
+		phases.Print(w)
+		tool := "pprof"
+		if mode == "trace" {
+			tool = "trace"
+		}
+		fmt.Fprintf(w, "Profile written to %s (go tool %s %s)\n", filename, tool, filename)
+		phases = nil
+	}, nil
+}
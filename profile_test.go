@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimePhase(t *testing.T) {
+	// Without --profile timing is a no-op
+	timePhase(phaseTags)()
+
+	phases = &phaseTimer{start: time.Now(), totals: map[string]time.Duration{}, counts: map[string]int{}}
+	defer func() { phases = nil }()
+
+	for i := 0; i < 3; i++ {
+		done := timePhase(phaseProbe)
+		time.Sleep(2 * time.Millisecond)
+		done()
+	}
+	timePhase(phaseTags)()
+
+	if phases.counts[phaseProbe] != 3 || phases.totals[phaseProbe] < 6*time.Millisecond {
+		t.Errorf("ffprobe phase = %v over %d calls, want >= 6ms over 3", phases.totals[phaseProbe], phases.counts[phaseProbe])
+	}
+
+	var out bytes.Buffer
+	phases.Print(&out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], phaseProbe) || !strings.Contains(lines[1], "3 calls") || !strings.Contains(lines[2], phaseTags) {
+		t.Errorf("Print() =\n%s\nwant the slowest phase first with call counts", out.String())
+	}
+}
+
+func TestStartProfile(t *testing.T) {
+	if _, err := startProfile("flame", os.Stderr); err == nil {
+		t.Error("startProfile(flame) error = nil, want error")
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for mode, filename := range profileFilenames {
+		var out bytes.Buffer
+		stop, err := startProfile(mode, &out)
+		if err != nil {
+			t.Fatalf("startProfile(%s) error = %v", mode, err)
+		}
+		stop()
+		if info, err := os.Stat(filename); err != nil || info.Size() == 0 {
+			t.Errorf("%s profile %s not written: %v", mode, filename, err)
+		}
+		if !strings.Contains(out.String(), filename) {
+			t.Errorf("%s summary %q doesn't name %s", mode, out.String(), filename)
+		}
+	}
+}
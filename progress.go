@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress output modes (--progress).
+const (
+	progressAuto = "auto" // bar when stderr is a terminal, else none
+	progressBar  = "bar"
+	progressJSON = "json"
+	progressNone = "none"
+)
+
+// progressBarWidth is how many characters the bar itself takes.
+const progressBarWidth = 30
+
+// progressMeter reports how far through probing a book's files a run is. A
+// nil meter reports nothing. It's safe for concurrent use.
+type progressMeter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	json    bool
+	total   int
+	done    int
+	started time.Time
+	now     func() time.Time
+}
+
+// progressEvent is one line of --progress=json output.
+type progressEvent struct {
+	Event      string  `json:"event"` // start, file or finish
+	Done       int     `json:"done"`
+	Total      int     `json:"total"`
+	File       string  `json:"file,omitempty"`
+	ETASeconds float64 `json:"etaSeconds,omitempty"`
+}
+
+// newProgressMeter returns the meter for a --progress mode, writing to w
+// (which is checked for a terminal in auto mode).
+func newProgressMeter(mode string, w *os.File) (*progressMeter, error) {
+	switch mode {
+	case progressAuto:
+		if info, err := w.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return nil, nil
+		}
+	case progressBar, progressJSON:
+	case progressNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("--progress must be auto, bar, json or none, not %q", mode)
+	}
+	return &progressMeter{w: w, json: mode == progressJSON, now: time.Now}, nil
+}
+
+// Start begins counting total files.
+func (p *progressMeter) Start(total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+	p.done = 0
+	p.started = p.now()
+	p.report("start", "")
+}
+
+// Begin reports that file is being processed.
+func (p *progressMeter) Begin(file string) {
+	if p == nil || p.json {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.report("file", file)
+}
+
+// Done reports that file has been processed.
+func (p *progressMeter) Done(file string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.report("file", file)
+}
+
+// Finish ends the report, leaving the terminal on a fresh line.
+func (p *progressMeter) Finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.json {
+		p.report("finish", "")
+		return
+	}
+	fmt.Fprint(p.w, "\r\x1b[K")
+}
+
+// eta estimates the time left from the average time per file so far.
+func (p *progressMeter) eta() time.Duration {
+	if p.done == 0 || p.done >= p.total {
+		return 0
+	}
+	elapsed := p.now().Sub(p.started)
+	return elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+}
+
+func (p *progressMeter) report(event string, file string) {
+	if p.json {
+		data, _ := json.Marshal(progressEvent{Event: event, Done: p.done, Total: p.total, File: file, ETASeconds: p.eta().Round(time.Second).Seconds()})
+		fmt.Fprintf(p.w, "%s\n", data)
+		return
+	}
+
+	filled := 0
+	if p.total > 0 {
+		filled = progressBarWidth * p.done / p.total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	line := fmt.Sprintf("[%s] %d/%d", bar, p.done, p.total)
+	if eta := p.eta(); eta > 0 {
+		line += " ETA " + eta.Round(time.Second).String()
+	}
+	if file != "" {
+		line += "  " + file
+	}
+	fmt.Fprintf(p.w, "\r%s\x1b[K", line)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock returns times advancing by step on every call after the first.
+func fakeClock(step time.Duration) func() time.Time {
+	t := time.Unix(0, 0)
+	return func() time.Time {
+		now := t
+		t = t.Add(step)
+		return now
+	}
+}
+
+func TestProgressMeterBar(t *testing.T) {
+	var out bytes.Buffer
+	p := &progressMeter{w: &out, now: fakeClock(10 * time.Second)}
+
+	p.Start(4)
+	p.Begin("chapter01.mp3")
+	p.Done("chapter01.mp3")
+	p.Finish()
+
+	lines := strings.Split(out.String(), "\r")
+	expected := []string{
+		"",
+		"[                              ] 0/4\x1b[K",
+		"[                              ] 0/4  chapter01.mp3\x1b[K",
+		"[=======                       ] 1/4 ETA 30s  chapter01.mp3\x1b[K",
+		"\x1b[K",
+	}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("bar output = %q, want %q", lines, expected)
+	}
+}
+
+func TestProgressMeterJSON(t *testing.T) {
+	var out bytes.Buffer
+	p := &progressMeter{w: &out, json: true, now: fakeClock(time.Second)}
+
+	p.Start(2)
+	p.Begin("a.mp3")
+	p.Done("a.mp3")
+	p.Done("b.mp3")
+	p.Finish()
+
+	var events []progressEvent
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var e progressEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("bad event %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+
+	expected := []progressEvent{
+		{Event: "start", Total: 2},
+		{Event: "file", Done: 1, Total: 2, File: "a.mp3", ETASeconds: 1},
+		{Event: "file", Done: 2, Total: 2, File: "b.mp3"},
+		{Event: "finish", Done: 2, Total: 2},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("got %d events, want %d: %s", len(events), len(expected), out.String())
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], expected[i])
+		}
+	}
+}
+
+func TestNewProgressMeter(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A file isn't a terminal
+	if p, err := newProgressMeter(progressAuto, f); err != nil || p != nil {
+		t.Errorf("newProgressMeter(auto) = %v, %v, want nil for a non-terminal", p, err)
+	}
+	if p, err := newProgressMeter(progressJSON, f); err != nil || p == nil || !p.json {
+		t.Errorf("newProgressMeter(json) = %v, %v", p, err)
+	}
+	if _, err := newProgressMeter("fancy", f); err == nil {
+		t.Error("newProgressMeter(fancy) error = nil, want error")
+	}
+
+	// A nil meter is silent
+	var p *progressMeter
+	p.Start(1)
+	p.Done("a.mp3")
+	p.Finish()
+}
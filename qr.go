@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// QR codes of feed URLs, at error correction level M, so subscribing on a
+// phone is pointing its camera at them.
+
+// writeQRTerminal draws q with half block characters, two rows of modules
+// to a line, in black on white whatever the terminal's colors.
+func writeQRTerminal(w io.Writer, q *qrcode.QRCode) error {
+	// Quiet zone included
+	modules := q.Bitmap()
+	dark := func(x, y int) bool {
+		return y < len(modules) && modules[y][x]
+	}
+	bw := bufio.NewWriter(w)
+	for y := 0; y < len(modules); y += 2 {
+		bw.WriteString("\x1b[30;107m")
+		for x := range modules[y] {
+			switch top, bottom := dark(x, y), dark(x, y+1); {
+			case top && bottom:
+				bw.WriteString("█")
+			case top:
+				bw.WriteString("▀")
+			case bottom:
+				bw.WriteString("▄")
+			default:
+				bw.WriteString(" ")
+			}
+		}
+		bw.WriteString("\x1b[0m\n")
+	}
+	return bw.Flush()
+}
+
+// qrPNGScale is the pixels per module of --qr-png images, sharp enough to
+// print.
+const qrPNGScale = 8
+
+// qrFileName returns the --qr-png file for the feed at feedPath, in a
+// library at root: the book's path in it, "Author - Book.png".
+func qrFileName(root string, feedPath string) string {
+	dir := filepath.Dir(feedPath)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(dir)
+	}
+	return strings.Join(strings.Split(filepath.ToSlash(rel), "/"), " - ") + ".png"
+}
+
+// writeFeedQRCodes prints each feed's URL and a QR code of it to w, and
+// with pngDir set also writes them to PNG files there.
+func writeFeedQRCodes(w io.Writer, feeds []FeedResult, root string, pngDir string) error {
+	if pngDir != "" {
+		if err := mkdirAll(pngDir); err != nil {
+			return err
+		}
+	}
+	for _, feed := range feeds {
+		if feed.URL == "" {
+			continue
+		}
+		q, err := qrcode.New(feed.URL, qrcode.Medium)
+		if err != nil {
+			return fmt.Errorf("%s: %v", feed.URL, err)
+		}
+		if w != nil {
+			fmt.Fprintf(w, "\n%s\n", feed.URL)
+			if err := writeQRTerminal(w, q); err != nil {
+				return err
+			}
+		}
+		if pngDir == "" {
+			continue
+		}
+		// A negative size is pixels per module
+		image, err := q.PNG(-qrPNGScale)
+		if err != nil {
+			return err
+		}
+		if err := writeFileIfChanged(filepath.Join(pngDir, qrFileName(root, feed.Path)), image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
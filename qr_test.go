@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestWriteQRTerminal(t *testing.T) {
+	q, err := qrcode.New("https://example.com/", qrcode.Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var terminal bytes.Buffer
+	if err := writeQRTerminal(&terminal, q); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(terminal.String(), "\n"), "\n")
+	if want := (len(q.Bitmap()) + 1) / 2; len(lines) != want {
+		t.Errorf("terminal output is %d lines, want %d", len(lines), want)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "\x1b[30;107m") || !strings.HasSuffix(line, "\x1b[0m") {
+			t.Fatalf("line %q isn't black on white", line)
+		}
+	}
+	// The top left finder pattern's first two rows, under the quiet zone
+	if want := strings.Repeat(" ", 4) + "█▀▀▀▀▀█"; !strings.Contains(lines[2], want) {
+		t.Errorf("line 3 is %q, want the finder pattern's top", lines[2])
+	}
+}
+
+func TestWriteFeedQRCodes(t *testing.T) {
+	root := t.TempDir()
+	feeds := []FeedResult{
+		{Path: filepath.Join(root, "Ursula K. Le Guin", "Earthsea", "podcast.rss"), URL: "https://example.com/Ursula%20K.%20Le%20Guin/Earthsea/podcast.rss"},
+		{Path: filepath.Join(root, "Other", "podcast.rss")},
+	}
+	pngDir := filepath.Join(t.TempDir(), "qr")
+	var out bytes.Buffer
+	if err := writeFeedQRCodes(&out, feeds, root, pngDir); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "\n"+feeds[0].URL+"\n") || strings.Count(out.String(), "https://") != 1 {
+		t.Errorf("output doesn't start with the one URL:\n%s", out.String())
+	}
+	entries, err := os.ReadDir(pngDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "Ursula K. Le Guin - Earthsea.png" {
+		t.Fatalf("PNGs written: %v, want Ursula K. Le Guin - Earthsea.png", entries)
+	}
+	f, err := os.Open(filepath.Join(pngDir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := qrcode.New(feeds[0].URL, qrcode.Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := q.Bitmap()
+	if side := len(modules) * qrPNGScale; img.Bounds().Dx() != side || img.Bounds().Dy() != side {
+		t.Errorf("PNG is %v, want %dx%d", img.Bounds(), side, side)
+	}
+	// The quiet zone, then the top left finder pattern
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("quiet zone pixel is dark")
+	}
+	if r, _, _, _ := img.At(4*qrPNGScale, 4*qrPNGScale).RGBA(); r != 0 {
+		t.Error("finder pattern pixel is light")
+	}
+
+	if got := qrFileName(filepath.Join(root, "Earthsea"), filepath.Join(root, "Earthsea", "podcast.rss")); got != "Earthsea.png" {
+		t.Errorf("qrFileName of a single book = %q, want Earthsea.png", got)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// bookastNS is the namespace of bookast's own feed elements, for metadata
+// neither the iTunes nor the podcast namespace has a place for.
+const bookastNS = "https://github.com/cjlucas/bookast/namespace"
+
+// BookastSeries is <bookast:series index="1">Mistborn</bookast:series>.
+type BookastSeries struct {
+	Index string `xml:"index,attr,omitempty"`
+	Name  string `xml:",chardata"`
+}
+
+// JSONFeedBookast is the "_bookast" extension object of a JSON Feed.
+type JSONFeedBookast struct {
+	About       string  `json:"about"`
+	Series      string  `json:"series,omitempty"`
+	SeriesIndex string  `json:"series_index,omitempty"`
+	Rating      float64 `json:"rating,omitempty"`
+}
+
+// applySeries puts the series into the channel title and description, so a
+// shelf of feeds sorted by title keeps the books in order:
+// "Mistborn 01: The Final Empire".
+func applySeries(podcast *Podcast) {
+	if podcast.Series == "" {
+		return
+	}
+
+	var intro string
+	if podcast.SeriesIndex != "" {
+		podcast.Title = fmt.Sprintf("%s %s: %s", podcast.Series, padSeriesIndex(podcast.SeriesIndex), podcast.Title)
+		intro = fmt.Sprintf("Book %s of the %s series.", podcast.SeriesIndex, podcast.Series)
+	} else {
+		podcast.Title = fmt.Sprintf("%s: %s", podcast.Series, podcast.Title)
+		intro = fmt.Sprintf("Part of the %s series.", podcast.Series)
+	}
+	if podcast.DescriptionHTML {
+		podcast.Description = "<p>" + html.EscapeString(intro) + "</p>\n" + podcast.Description
+	} else {
+		podcast.Description = intro + "\n\n" + podcast.Description
+	}
+}
+
+// padSeriesIndex zero-pads the whole part of a series index to two digits,
+// so "Mistborn 02" sorts before "Mistborn 10".
+func padSeriesIndex(index string) string {
+	whole, _, _ := strings.Cut(index, ".")
+	if len(whole) < 2 {
+		return strings.Repeat("0", 2-len(whole)) + index
+	}
+	return index
+}
+
+// bookastSeries returns the series element for a feed, nil without a series.
+func bookastSeries(podcast *Podcast) *BookastSeries {
+	if podcast.Series == "" {
+		return nil
+	}
+	return &BookastSeries{Index: podcast.SeriesIndex, Name: podcast.Series}
+}
+
+// bookastRating returns the <bookast:rating> value, stars out of 5, "" for
+// an unrated book.
+func bookastRating(podcast *Podcast) string {
+	if podcast.Rating <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(podcast.Rating, 'f', -1, 64)
+}
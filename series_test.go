@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestApplySeries(t *testing.T) {
+	tests := []struct {
+		name        string
+		podcast     Podcast
+		title       string
+		description string
+	}{
+		{
+			name:        "no series",
+			podcast:     Podcast{Title: "The Hobbit", Description: "There and back again."},
+			title:       "The Hobbit",
+			description: "There and back again.",
+		},
+		{
+			name:        "series and index",
+			podcast:     Podcast{Title: "The Final Empire", Description: "Ash falls.", Series: "Mistborn", SeriesIndex: "1"},
+			title:       "Mistborn 01: The Final Empire",
+			description: "Book 1 of the Mistborn series.\n\nAsh falls.",
+		},
+		{
+			name:        "fractional index",
+			podcast:     Podcast{Title: "The Eleventh Metal", Description: "Ash falls.", Series: "Mistborn", SeriesIndex: "2.5"},
+			title:       "Mistborn 02.5: The Eleventh Metal",
+			description: "Book 2.5 of the Mistborn series.\n\nAsh falls.",
+		},
+		{
+			name:        "series without index",
+			podcast:     Podcast{Title: "A Wizard of Earthsea", Description: "Ged.", Series: "Earthsea"},
+			title:       "Earthsea: A Wizard of Earthsea",
+			description: "Part of the Earthsea series.\n\nGed.",
+		},
+		{
+			name:        "README.md description",
+			podcast:     Podcast{Title: "Dune", Description: "<p>Spice.</p>", DescriptionHTML: true, Series: "Dune & Sequels", SeriesIndex: "1"},
+			title:       "Dune & Sequels 01: Dune",
+			description: "<p>Book 1 of the Dune &amp; Sequels series.</p>\n<p>Spice.</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podcast := tt.podcast
+			applySeries(&podcast)
+			if podcast.Title != tt.title {
+				t.Errorf("title = %q, want %q", podcast.Title, tt.title)
+			}
+			if podcast.Description != tt.description {
+				t.Errorf("description = %q, want %q", podcast.Description, tt.description)
+			}
+		})
+	}
+}
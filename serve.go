@@ -0,0 +1,942 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// feedServer serves books' feeds, generated on every request, and the files
+// they link to. URLs follow buildURL, /<book directory>/<file>, under the
+// library's Author/[Series/] directories with --layout, or under
+// /f/<token> for private feeds. Nothing outside the books' directories is
+// served, nor dotfiles or directory listings.
+type feedServer struct {
+	books    []servedBook
+	root     string // The directory served, where tokensFile is
+	baseURL  string // Fixed base URL, else it's taken from each request
+	opts     Options
+	output   feedFormat
+	private  bool         // Books are only served under tokens, there's no index
+	editable bool         // The web page can edit books' book.yaml
+	api      http.Handler // The JSON API under apiPathPrefix, with --api
+	metrics  *serveMetrics
+
+	// Set while the library is first being found, when only the health
+	// checks answer
+	starting atomic.Bool
+
+	// Scans write sidecars and the cache, one at a time is plenty for a
+	// few listeners
+	mu sync.Mutex
+
+	// Held for writing while a reload swaps books and audioMIMETypes, for
+	// reading while requests use them (not while files are sent)
+	reloadMu sync.RWMutex
+
+	// Each book's feedVersion when the --hub last heard of it
+	hubMu       sync.Mutex
+	hubVersions map[string]string
+}
+
+// servedBook is a book and the URL path its files are under.
+type servedBook struct {
+	libraryBook
+	BasePath string // Escaped, what buildURL puts the directory under: "/Author", "/f/<token>"
+	Prefix   string // Unescaped, "/Author/Book/"
+	Token    string // The book's own private feed token, with --private
+}
+
+// baseURL returns the base URL for the book's files on the server at
+// origin.
+func (b servedBook) baseURL(origin string) string {
+	return origin + b.BasePath
+}
+
+// newFeedServer returns a server for books, found in root, with feeds in
+// output's format. Private books get a feed token, made the first time and
+// kept in their state file.
+func newFeedServer(root string, books []libraryBook, baseURL string, opts Options, output feedFormat, private bool) (*feedServer, error) {
+	s := &feedServer{root: root, baseURL: baseURL, opts: opts, output: output, private: private}
+	s.metrics = newServeMetrics(func() int { return len(s.servedBooks()) })
+	s.opts.FeedFilename = output.Filename
+	served, err := serveBooks(books, private)
+	if err != nil {
+		return nil, err
+	}
+	s.books = served
+	return s, nil
+}
+
+// serveBooks returns the paths books are served under.
+func serveBooks(books []libraryBook, private bool) ([]servedBook, error) {
+	var served []servedBook
+	for _, book := range books {
+		name := filepath.Base(filepath.Clean(book.Dir))
+		b := servedBook{libraryBook: book, BasePath: book.baseURL("")}
+		b.Prefix = "/" + strings.Join(append(append([]string{}, book.Parent...), name), "/") + "/"
+		if private {
+			token, err := feedToken(book.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", book.Dir, err)
+			}
+			b.Token = token
+		}
+		served = append(served, b)
+	}
+	return served, nil
+}
+
+// reload swaps in a rescanned library and the config's MIME types. It waits
+// for scans in progress, not for downloads.
+func (s *feedServer) reload(books []libraryBook, mimeTypes map[string]string) error {
+	s.mu.Lock()
+	served, err := serveBooks(books, s.private)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	maps.Copy(audioMIMETypes, mimeTypes)
+	s.books = served
+	return nil
+}
+
+// servedBooks returns the books being served. The slice is never changed
+// in place, so callers can range over it without the lock.
+func (s *feedServer) servedBooks() []servedBook {
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+	return s.books
+}
+
+// feedToken returns the secret in the URLs of the private feed of the book
+// in dir, made the first time.
+func feedToken(dir string) (string, error) {
+	state, err := loadBookState(dir)
+	if err != nil {
+		return "", err
+	}
+	if state.FeedToken == "" {
+		state.FeedToken, err = newToken()
+		if err != nil {
+			return "", err
+		}
+		if err := saveBookState(dir, state); err != nil {
+			return "", fmt.Errorf("failed to save %s: %v", stateFile, err)
+		}
+	}
+	return state.FeedToken, nil
+}
+
+// handleSignals reloads on SIGHUP, and on SIGTERM or SIGINT shuts server
+// down, letting downloads in progress finish for up to drain. The returned
+// channel is closed once it's down.
+func handleSignals(signals <-chan os.Signal, server *http.Server, reload func() error, drain time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				if err := reload(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: reloading: %v\n", err)
+				}
+				continue
+			}
+
+			fmt.Println("Shutting down, waiting for downloads in progress")
+			ctx, cancel := context.WithTimeout(context.Background(), drain)
+			err := server.Shutdown(ctx)
+			cancel()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: downloads still in progress after %s, stopping them\n", drain)
+				server.Close()
+			}
+			return
+		}
+	}()
+	return done
+}
+
+// listen opens --addr: host:port, or unix:<path> for a unix socket. A
+// socket an earlier run left behind is replaced, one still being served
+// isn't.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// systemdFirstFD is the first file descriptor systemd passes sockets at.
+const systemdFirstFD = 3
+
+// systemdListener returns the socket systemd passed when it started bookast
+// by socket activation (LISTEN_PID and LISTEN_FDS), or nil when it didn't.
+// The socket's address is systemd's, --addr is ignored.
+func systemdListener(firstFD int) (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, bookast serve takes one", n)
+	}
+	// Not for any children
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(uintptr(firstFD), "systemd socket")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("the socket systemd passed: %v", err)
+	}
+	return listener, nil
+}
+
+// loadTLSConfig loads --tls-cert and --tls-key. Without them there's no
+// TLS, nil.
+func loadTLSConfig(certFile string, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("--tls-cert and --tls-key go together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("--tls-cert/--tls-key: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// requestBaseURL is the URL the server was reached at: --base-url, else
+// the request's host. Behind a reverse proxy on this machine (fromProxy),
+// X-Forwarded-Proto, -Host and -Prefix say what the subscriber reached
+// instead; from anywhere else they're ignored.
+func (s *feedServer) requestBaseURL(r *http.Request) string {
+	if s.baseURL != "" {
+		return s.baseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if !fromProxy(r) {
+		return scheme + "://" + r.Host
+	}
+	if proto := forwardedHeader(r, "X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	host := r.Host
+	if forwarded := forwardedHeader(r, "X-Forwarded-Host"); forwarded != "" && !strings.ContainsAny(forwarded, "/\\@?# ") {
+		host = forwarded
+	}
+	prefix := ""
+	if forwarded := forwardedHeader(r, "X-Forwarded-Prefix"); strings.HasPrefix(forwarded, "/") && !strings.ContainsAny(forwarded, "\\?#\" <>") {
+		prefix = strings.TrimRight(forwarded, "/")
+	}
+	return scheme + "://" + host + prefix
+}
+
+// forwardedHeader returns the value of an X-Forwarded header set by the
+// proxy nearest the subscriber: the first of a chain of proxies'
+// comma-separated values.
+func forwardedHeader(r *http.Request, name string) string {
+	value, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(value)
+}
+
+func (s *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if editPath, ok := strings.CutPrefix(r.URL.Path, editPathPrefix); ok && s.editable && !s.private && strings.HasPrefix(editPath, "/") {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// A page elsewhere mustn't be able to post the form
+		if err := new(http.CrossOriginProtection).Check(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		s.serveEdit(w, r, editPath)
+		return
+	}
+	if s.api != nil && strings.HasPrefix(r.URL.Path, apiPathPrefix) {
+		// A page elsewhere mustn't be able to change anything
+		if err := new(http.CrossOriginProtection).Check(r); err != nil {
+			writeAPIError(w, http.StatusForbidden, err)
+			return
+		}
+		s.api.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path == "/" && !s.private {
+		s.serveIndex(w, r)
+		return
+	}
+	// Public on purpose even with --private: only counts, no paths or
+	// tokens. --auth and --htpasswd cover it like everything else.
+	if r.URL.Path == "/metrics" {
+		s.metrics.handler.ServeHTTP(w, r)
+		return
+	}
+	if r.URL.Path == "/downloads.json" && !s.private {
+		s.serveDownloads(w, r)
+		return
+	}
+	book, rel, ok := s.route(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if rel == s.output.Filename {
+		s.serveFeed(w, r, book)
+	} else {
+		s.serveBookFile(w, r, book.Dir, rel)
+	}
+}
+
+// route finds the book a URL path is in, and the path within it. Private
+// books are under /f/<token>/: their own token then the directory name, or
+// a subscriber's token then the book's public path.
+func (s *feedServer) route(urlPath string) (servedBook, string, bool) {
+	books := s.servedBooks()
+	if !s.private {
+		for _, book := range books {
+			if rel, ok := strings.CutPrefix(urlPath, book.Prefix); ok {
+				return book, rel, true
+			}
+		}
+		return servedBook{}, "", false
+	}
+
+	rest, ok := strings.CutPrefix(urlPath, "/f/")
+	if !ok {
+		return servedBook{}, "", false
+	}
+	token, rest, ok := strings.Cut(rest, "/")
+	if !ok || token == "" {
+		return servedBook{}, "", false
+	}
+	rest = "/" + rest
+	for _, book := range books {
+		name := "/" + filepath.Base(filepath.Clean(book.Dir)) + "/"
+		if rel, ok := strings.CutPrefix(rest, name); ok && sameToken(book.Token, token) {
+			book.BasePath = "/f/" + token
+			return book, rel, true
+		}
+	}
+	if !s.isSubscriber(token) {
+		return servedBook{}, "", false
+	}
+	for _, book := range books {
+		if rel, ok := strings.CutPrefix(rest, book.Prefix); ok {
+			book.BasePath = "/f/" + token + book.BasePath
+			return book, rel, true
+		}
+	}
+	return servedBook{}, "", false
+}
+
+// isSubscriber reports whether token is a subscriber's. The tokens file is
+// read every time, so revoking a token takes effect without a restart.
+func (s *feedServer) isSubscriber(token string) bool {
+	subscribers, err := loadSubscribers(s.root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
+	}
+	return slices.ContainsFunc(subscribers, func(sub subscriber) bool { return sameToken(sub.Token, token) })
+}
+
+// sameToken compares feed tokens in constant time, so response times
+// don't give away how much of one a guess got right.
+func sameToken(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// withHealthChecks answers /healthz (the server is up) and /readyz (it's
+// found the library and is serving it) ahead of h, so orchestrators and
+// uptime monitors needn't authenticate. Until it's ready every other
+// request gets 503 too.
+func (s *feedServer) withHealthChecks(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		starting := s.starting.Load()
+		switch {
+		case r.URL.Path == "/healthz":
+			w.Header().Set("Cache-Control", "no-store")
+			io.WriteString(w, "ok\n")
+		case r.URL.Path == "/readyz" && !starting:
+			w.Header().Set("Cache-Control", "no-store")
+			io.WriteString(w, "ready\n")
+		case r.URL.Path == "/readyz" || starting:
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "finding the library's books", http.StatusServiceUnavailable)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// feedURL returns the URL of book's feed, as buildURL would.
+func (s *feedServer) feedURL(r *http.Request, book servedBook) string {
+	return buildURL(book.baseURL(s.requestBaseURL(r)), book.Dir, s.output.Filename)
+}
+
+// serveFeed scans book and serves its feed. Enclosure URLs point back at
+// this server. A client that has the current version gets 304 Not
+// Modified without the book being scanned.
+func (s *feedServer) serveFeed(w http.ResponseWriter, r *http.Request, book servedBook) {
+	opts := s.opts
+	opts.BaseURL = book.baseURL(s.requestBaseURL(r))
+	opts.Folder = book.Folder
+
+	feedURL := opts.BaseURL + "/" + s.output.Filename
+	etag, modTime, err := feedVersion(book.Dir, feedURL)
+	if err == nil && notModified(r, etag, modTime) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	s.mu.Lock()
+	s.reloadMu.RLock()
+	start := time.Now()
+	podcast, err := scanDirectory(book.Dir, opts)
+	s.metrics.observeScan(time.Since(start))
+	s.reloadMu.RUnlock()
+	s.mu.Unlock()
+	if err == nil {
+		// Taken again, the scan may have written sidecars
+		etag, modTime, err = feedVersion(book.Dir, feedURL)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", book.Dir, err)
+		http.Error(w, "failed to generate the feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", feedContentTypes[s.output.Filename])
+	w.Header().Set("ETag", etag)
+	serveCompressible(w, r, s.output.Filename, modTime, []byte(s.output.Generate(podcast)))
+}
+
+// serveCompressible serves content through http.ServeContent, which answers
+// Range and conditional requests, gzip or deflate compressed when the client
+// accepts either. Large library feeds are hundreds of KB of repetitive XML.
+// Range requests get it uncompressed, since ranges would count compressed
+// bytes.
+func serveCompressible(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, content []byte) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if encoding := acceptedEncoding(r.Header.Get("Accept-Encoding")); encoding != "" && r.Header.Get("Range") == "" {
+		var buf bytes.Buffer
+		var zw io.WriteCloser
+		if encoding == "gzip" {
+			zw = gzip.NewWriter(&buf)
+		} else {
+			zw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		}
+		zw.Write(content)
+		zw.Close()
+		w.Header().Set("Content-Encoding", encoding)
+		content = buf.Bytes()
+	}
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(content))
+}
+
+// acceptedEncoding returns gzip or deflate when an Accept-Encoding header
+// allows it, preferring gzip, else "".
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[coding] = q > 0
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[encoding]; ok || !listed && accepted["*"] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// feedVersion returns an ETag and modification time for the feed of the
+// book in dir at feedURL, from the names, sizes and modification times of
+// the files in dir rather than the feed, whose dates change on every
+// generation. Replacing, adding or removing a file changes both. The ETag
+// is weak, the same version isn't byte for byte the same feed.
+func feedVersion(dir string, feedURL string) (string, time.Time, error) {
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", generatorName(), feedURL)
+	modTime := dirInfo.ModTime()
+	for _, entry := range entries {
+		if entry.Name() == stateFile {
+			continue // Download counts change it, not the feed
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:12]), modTime, nil
+}
+
+// notModified reports whether r's If-None-Match, else its
+// If-Modified-Since, says the client has the version with etag and modTime.
+// ETags are compared weakly, as If-None-Match calls for.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modTime.Truncate(time.Second).After(since)
+}
+
+// fileETag is a strong ETag for a file, which changes whenever the file is
+// replaced or modified, as nginx makes them.
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// feedContentTypes are the Content-Types feeds are served with.
+var feedContentTypes = map[string]string{
+	"podcast.rss":  "application/rss+xml; charset=utf-8",
+	"podcast.atom": "application/atom+xml; charset=utf-8",
+	"podcast.json": "application/feed+json; charset=utf-8",
+}
+
+// serveBookFile serves the file at rel, a slash-separated path inside dir.
+// Dotfiles (bookast's state, the cache) and directories are not found.
+// Range requests get 206 Partial Content, so apps can seek within a 10 hour
+// file without downloading all of it and resume an interrupted download.
+// With an ETag and Last-Modified, conditional requests get 304 Not Modified.
+func (s *feedServer) serveBookFile(w http.ResponseWriter, r *http.Request, dir string, rel string) {
+	clean := path.Clean("/" + rel)
+	for _, segment := range strings.Split(clean, "/") {
+		if strings.HasPrefix(segment, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	file, err := os.Open(filepath.Join(dir, filepath.FromSlash(clean)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	s.reloadMu.RLock()
+	mimeType := audioMIMETypes[strings.ToLower(filepath.Ext(info.Name()))]
+	s.reloadMu.RUnlock()
+	if mimeType != "" {
+		w.Header().Set("Content-Type", mimeType)
+	}
+	w.Header().Set("ETag", fileETag(info))
+	sent := &loggedResponse{ResponseWriter: w}
+	if mimeType != "" {
+		s.metrics.streams.Inc()
+		defer s.metrics.streams.Dec()
+	}
+	http.ServeContent(sent, r, info.Name(), info.ModTime(), file)
+
+	if mimeType != "" && (sent.status == http.StatusOK || sent.status == http.StatusPartialContent) && countsAsDownload(r) {
+		s.mu.Lock()
+		err := recordDownload(dir, clean[1:], time.Now())
+		s.mu.Unlock()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: counting a download: %v\n", dir, err)
+		}
+	}
+}
+
+// serveDownloads serves the books' download counts as JSON.
+func (s *feedServer) serveDownloads(w http.ResponseWriter, r *http.Request) {
+	var books []libraryBook
+	for _, book := range s.servedBooks() {
+		books = append(books, book.libraryBook)
+	}
+	s.mu.Lock()
+	downloads, err := libraryDownloads(books)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if downloads == nil {
+		downloads = []bookDownloads{}
+	}
+	data, err := json.MarshalIndent(downloads, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	serveCompressible(w, r, "downloads.json", time.Time{}, append(data, '\n'))
+}
+
+// runServe implements "bookast serve", which serves a book or library and
+// its feeds over HTTP, without a web server to set up.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on, host:port or unix:<socket path>")
+	fs.StringVar(addr, "listen", ":8080", "Same as --addr")
+	baseURL := fs.String("base-url", "", "Public URL of the server, when it's behind a proxy under a path (default: the host each request was made to)")
+	layout := fs.String("layout", "", "Serve every book in a library laid out like audiobookshelf (Author/[Series/]Book)")
+	format := fs.String("format", "rss", "Feed format: rss, atom or jsonfeed")
+	auth := fs.String("auth", "", "Require HTTP Basic auth with this user:password")
+	private := fs.Bool("private", false, "Only serve each book under a secret URL, /f/<token>/<book>/podcast.rss, and list none of them")
+	tlsCert := fs.String("tls-cert", "", "Serve HTTPS with this certificate (PEM, the full chain), needs --tls-key")
+	tlsKey := fs.String("tls-key", "", "Private key (PEM) of --tls-cert")
+	autoTLS := fs.String("auto-tls", "", "Serve HTTPS with a certificate from Let's Encrypt for these comma-separated domains, renewed automatically (default --addr :443, which must be reachable from the internet)")
+	acmeEmail := fs.String("acme-email", "", "Email address Let's Encrypt sends certificate expiry notices to")
+	acmeDirectory := fs.String("acme-directory", acme.LetsEncryptURL, "ACME directory of the CA for --auto-tls, e.g. Let's Encrypt's staging one while trying it out")
+	htpasswd := fs.String("htpasswd", "", "Require HTTP Basic auth as one of the users in this htpasswd file (htpasswd -m, -s or -p entries)")
+	accessLog := fs.String("access-log", "", "Log every request to stdout: common, combined (with referer and user agent) or json")
+	drainTimeout := fs.Duration("drain-timeout", time.Minute, "On SIGTERM, how long to let downloads in progress finish before exiting")
+	rateLimit := fs.Int("rate-limit", 0, "Answer clients making more than this many requests a minute with 429 Too Many Requests (default no limit)")
+	allow := fs.String("allow", "", "Only answer clients in these comma-separated CIDR ranges or addresses, e.g. 192.168.1.0/24,10.8.0.0/24")
+	deny := fs.String("deny", "", "Refuse clients in these comma-separated CIDR ranges or addresses, even ones --allow lets in")
+	edit := fs.Bool("edit", false, "Let the web page edit each book's authors, narrators, keywords, language, ISBN and ASIN in its book.yaml (needs --auth or --htpasswd)")
+	api := fs.Bool("api", false, "Serve a JSON API under /api/ to list, rescan and edit books, rotate feed tokens, manage subscriber tokens and read stats (needs --auth or --htpasswd)")
+	hub := fs.String("hub", "", "WebSub hub to announce in feeds and ping when a book's feed changes, e.g. https://pubsubhubbub.appspot.com/ (needs --base-url)")
+	maxBandwidth := fs.String("max-bandwidth", "", "Send all responses together no faster than this, e.g. 20MBps or 500KB/s (default no limit)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [flags] <directory>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	output, ok := feedFormats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: --format must be rss, atom or jsonfeed, not %q\n", *format)
+		return 1
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for ext, mimeType := range config.MIMETypes {
+		audioMIMETypes[ext] = mimeType
+	}
+
+	// The directory's name is part of the URLs, "." doesn't make one
+	dir, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s isn't a directory\n", fs.Arg(0))
+		return 1
+	}
+
+	if *rateLimit < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --rate-limit can't be negative\n")
+		return 1
+	}
+	var bandwidth int64
+	if *maxBandwidth != "" {
+		bandwidth, err = parseBandwidth(*maxBandwidth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --max-bandwidth: %v\n", err)
+			return 1
+		}
+	}
+
+	var clients ipFilter
+	if clients.allow, err = parseCIDRs(*allow); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --allow: %v\n", err)
+		return 1
+	}
+	if clients.deny, err = parseCIDRs(*deny); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --deny: %v\n", err)
+		return 1
+	}
+
+	users := passwords{}
+	if *auth != "" {
+		users, err = parseAuth(*auth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if *htpasswd != "" {
+		fileUsers, err := loadHtpasswd(*htpasswd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --htpasswd: %v\n", err)
+			return 1
+		}
+		for user, hash := range fileUsers {
+			users[user] = hash
+		}
+	}
+
+	if *hub != "" {
+		if u, err := url.Parse(*hub); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: --hub %q is not an http(s) URL\n", *hub)
+			return 1
+		}
+		// The hub fetches the feed from its public URL, and mustn't learn
+		// private ones
+		if *baseURL == "" || *private {
+			fmt.Fprintf(os.Stderr, "Error: --hub needs --base-url and can't be used with --private\n")
+			return 1
+		}
+	}
+
+	if *edit && len(users) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: --edit needs --auth or --htpasswd, anyone who can reach the server could rewrite every book.yaml\n")
+		return 1
+	}
+	if *api && len(users) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: --api needs --auth or --htpasswd, it can change the library and hand out private URLs\n")
+		return 1
+	}
+
+	tlsConfig, err := loadTLSConfig(*tlsCert, *tlsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var autoTLSDomains []string
+	if *autoTLS != "" {
+		if tlsConfig != nil {
+			fmt.Fprintf(os.Stderr, "Error: --auto-tls can't be used with --tls-cert\n")
+			return 1
+		}
+		var certManager *autocert.Manager
+		certManager, autoTLSDomains, err = newCertManager(*autoTLS, *acmeEmail, *acmeDirectory)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --auto-tls: %v\n", err)
+			return 1
+		}
+		tlsConfig = certManager.TLSConfig()
+		explicitAddr := false
+		fs.Visit(func(f *flag.Flag) { explicitAddr = explicitAddr || f.Name == "addr" || f.Name == "listen" })
+		if !explicitAddr {
+			*addr = ":443"
+		}
+	}
+
+	// The books are found once it's listening
+	server, err := newFeedServer(dir, nil, strings.TrimSuffix(*baseURL, "/"), Options{Jobs: runtime.NumCPU()}, output, *private)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	server.starting.Store(true)
+	server.editable = *edit
+	server.opts.Hub = *hub
+	// Only a fixed, shared URL is the feed's real one
+	server.opts.KeepGUID = *baseURL != "" && !*private
+	if *api {
+		server.api = server.newAPI()
+	}
+	var handler http.Handler = server
+	if len(users) > 0 {
+		handler = requireAuth(handler, users)
+	}
+	// Outside auth, so failed logins count too, and inside the health
+	// checks, so probes are never limited or refused
+	if bandwidth > 0 {
+		handler = limitBandwidth(handler, bandwidth)
+	}
+	if *rateLimit > 0 {
+		handler = limitRequests(handler, newClientLimiter(*rateLimit))
+	}
+	if len(clients.allow) > 0 || len(clients.deny) > 0 {
+		handler = filterClients(handler, clients)
+	}
+	handler = server.withHealthChecks(handler)
+	handler = server.metrics.instrument(handler)
+	if *accessLog != "" {
+		requests, err := newAccessLogger(os.Stdout, *accessLog)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		handler = logRequests(handler, requests)
+	}
+	listener, err := systemdListener(systemdFirstFD)
+	if err == nil && listener == nil {
+		listener, err = listen(*addr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer listener.Close()
+	fmt.Printf("Listening on %s\n", listener.Addr())
+
+	// The only place the private URLs are shown. Behind a proxy on a unix
+	// socket only the paths are known.
+	printPrivateFeeds := func() {
+		origin := server.baseURL
+		if origin == "" && !strings.HasPrefix(*addr, "unix:") {
+			host := *addr
+			if strings.HasPrefix(host, ":") {
+				host = "localhost" + host
+			}
+			origin = "http://" + host
+			if tlsConfig != nil {
+				origin = "https://" + host
+			}
+			if autoTLSDomains != nil {
+				origin = "https://" + autoTLSDomains[0]
+				if _, port, _ := net.SplitHostPort(*addr); port != "443" {
+					origin += ":" + port
+				}
+			}
+		}
+		fmt.Println("Private feeds:")
+		for _, book := range server.servedBooks() {
+			fmt.Printf("  %s\n", buildURL(origin+"/f/"+book.Token, book.Dir, output.Filename))
+		}
+	}
+
+	// load finds the books and serves them, with the config's MIME types
+	load := func(verb string) error {
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		books, err := findBooks(dir, *layout)
+		if err != nil {
+			return err
+		}
+		if err := server.reload(books, config.MIMETypes); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", verb, plural(len(books), "book"))
+		server.notifyHub(server.servedBooks())
+		if *private {
+			printPrivateFeeds()
+		}
+		return nil
+	}
+	reload := func() error { return load("Reloaded, serving") }
+
+	httpServer := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	done := handleSignals(signals, httpServer, reload, *drainTimeout)
+	startErr := make(chan error, 1)
+	go func() {
+		if err := load("Serving"); err != nil {
+			startErr <- err
+			httpServer.Close()
+			return
+		}
+		server.starting.Store(false)
+	}()
+	if tlsConfig != nil {
+		err = httpServer.ServeTLS(listener, "", "")
+	} else {
+		err = httpServer.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		select {
+		case err := <-startErr:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		case <-done:
+			return 0
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,944 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newTestFeedServer serves a copy of the audiobook1 fixture, in a
+// directory named Book.
+func newTestFeedServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "Book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"chapter01.mp3", "chapter02.mp3", "cover.jpg"} {
+		copyFixture(t, dir, name)
+	}
+	s, err := newFeedServer(filepath.Dir(dir), []libraryBook{{Dir: dir}}, "", Options{NoCache: true}, feedFormats["rss"], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server, dir
+}
+
+func serveGet(t *testing.T, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestFeedServerFeed(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+
+	resp, body := serveGet(t, server.URL+"/Book/podcast.rss")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET podcast.rss = %s", resp.Status)
+	}
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "application/rss+xml") {
+		t.Errorf("Content-Type = %q, want application/rss+xml", got)
+	}
+	for _, want := range []string{
+		`<enclosure url="` + server.URL + `/Book/chapter01.mp3"`,
+		server.URL + "/Book/cover.jpg",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("feed doesn't contain %q:\n%s", want, body)
+		}
+	}
+
+	// The enclosures it links to are served
+	resp, body = serveGet(t, server.URL+"/Book/chapter01.mp3")
+	fixture, _ := os.ReadFile("testdata/audiobook1/chapter01.mp3")
+	if resp.StatusCode != http.StatusOK || body != string(fixture) {
+		t.Errorf("GET chapter01.mp3 = %s, %d bytes, want the file", resp.Status, len(body))
+	}
+	if got := resp.Header.Get("Content-Type"); got != "audio/mpeg" {
+		t.Errorf("Content-Type = %q, want audio/mpeg", got)
+	}
+}
+
+func TestFeedServerIndex(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+
+	_, body := serveGet(t, server.URL+"/")
+	if want := `<a href="` + server.URL + `/Book/podcast.rss">Book</a>`; !strings.Contains(body, want) {
+		t.Errorf("index doesn't contain %q:\n%s", want, body)
+	}
+}
+
+func TestFeedServerNotFound(t *testing.T) {
+	server, dir := newTestFeedServer(t)
+	if err := os.WriteFile(filepath.Join(dir, ".bookast-state.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(dir), "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"/Book/.bookast-state.json",
+		"/Book/sub",
+		"/Book/",
+		"/Book/missing.mp3",
+		"/Book/../secret.txt",
+		"/Book/%2e%2e/secret.txt",
+		"/secret.txt",
+	} {
+		if resp, _ := serveGet(t, server.URL+path); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %s, want 404", path, resp.Status)
+		}
+	}
+}
+
+func TestFeedServerRange(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+	fixture, err := os.ReadFile("testdata/audiobook1/chapter01.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(fixture)
+
+	tests := []struct {
+		rangeHeader  string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{"bytes=0-99", http.StatusPartialContent, "bytes 0-99/" + strconv.Itoa(size), string(fixture[:100])},
+		{"bytes=1000-", http.StatusPartialContent, "bytes 1000-" + strconv.Itoa(size-1) + "/" + strconv.Itoa(size), string(fixture[1000:])},
+		{"bytes=-50", http.StatusPartialContent, "bytes " + strconv.Itoa(size-50) + "-" + strconv.Itoa(size-1) + "/" + strconv.Itoa(size), string(fixture[size-50:])},
+		{"bytes=" + strconv.Itoa(size) + "-", http.StatusRequestedRangeNotSatisfiable, "bytes */" + strconv.Itoa(size), ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/Book/chapter01.mp3", nil)
+		req.Header.Set("Range", tt.rangeHeader)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("Range %s: status = %d, want %d", tt.rangeHeader, resp.StatusCode, tt.status)
+		}
+		if got := resp.Header.Get("Content-Range"); got != tt.contentRange {
+			t.Errorf("Range %s: Content-Range = %q, want %q", tt.rangeHeader, got, tt.contentRange)
+		}
+		if tt.status == http.StatusPartialContent && string(body) != tt.body {
+			t.Errorf("Range %s: got %d bytes, not the range", tt.rangeHeader, len(body))
+		}
+	}
+
+	resp, _ := serveGet(t, server.URL+"/Book/chapter01.mp3")
+	if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", got)
+	}
+}
+
+func TestFeedServerRangeFeed(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+	_, feed := serveGet(t, server.URL+"/Book/podcast.rss")
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/Book/podcast.rss", nil)
+	req.Header.Set("Range", "bytes=0-4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != feed[:5] {
+		t.Errorf("Range bytes=0-4 = %d %q, want 206 %q", resp.StatusCode, body, feed[:5])
+	}
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "application/rss+xml") {
+		t.Errorf("Content-Type = %q, want application/rss+xml", got)
+	}
+}
+
+// serveConditional makes a GET with header set to value.
+func serveConditional(t *testing.T, url string, header string, value string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set(header, value)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestFeedServerConditionalFeed(t *testing.T) {
+	server, dir := newTestFeedServer(t)
+	feedURL := server.URL + "/Book/podcast.rss"
+
+	resp, _ := serveGet(t, feedURL)
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if !strings.HasPrefix(etag, `W/"`) || lastModified == "" {
+		t.Fatalf("ETag = %q, Last-Modified = %q, want a weak ETag and a date", etag, lastModified)
+	}
+
+	// The feed's dates change with every generation, its version doesn't
+	if resp, _ := serveGet(t, feedURL); resp.Header.Get("ETag") != etag {
+		t.Errorf("ETag changed to %q with nothing changed, was %q", resp.Header.Get("ETag"), etag)
+	}
+	if resp := serveConditional(t, feedURL, "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match current = %d, want 304", resp.StatusCode)
+	}
+	if resp := serveConditional(t, feedURL, "If-Modified-Since", lastModified); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-Modified-Since current = %d, want 304", resp.StatusCode)
+	}
+
+	// A new chapter is a new version
+	copyFixture(t, dir, "chapter03.m4a")
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "chapter03.m4a"), later, later)
+	resp = serveConditional(t, feedURL, "If-None-Match", etag)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("If-None-Match after adding a file = %d, ETag %q, want 200 and a new ETag", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp := serveConditional(t, feedURL, "If-Modified-Since", lastModified); resp.StatusCode != http.StatusOK {
+		t.Errorf("If-Modified-Since after adding a file = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestFeedServerConditionalFile(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+	fileURL := server.URL + "/Book/chapter01.mp3"
+
+	resp, _ := serveGet(t, fileURL)
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("ETag = %q, Last-Modified = %q, want both", etag, lastModified)
+	}
+	if resp := serveConditional(t, fileURL, "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match = %d, want 304", resp.StatusCode)
+	}
+	if resp := serveConditional(t, fileURL, "If-Modified-Since", lastModified); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-Modified-Since = %d, want 304", resp.StatusCode)
+	}
+	if resp := serveConditional(t, fileURL, "If-None-Match", `"stale"`); resp.StatusCode != http.StatusOK {
+		t.Errorf("If-None-Match stale = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                       "",
+		"gzip":                   "gzip",
+		"deflate, gzip;q=1.0, *": "gzip",
+		"deflate":                "deflate",
+		"gzip;q=0, deflate":      "deflate",
+		"br, *":                  "gzip",
+		"*, gzip;q=0":            "deflate",
+		"br":                     "",
+		"identity":               "",
+	}
+	for header, want := range tests {
+		if got := acceptedEncoding(header); got != want {
+			t.Errorf("acceptedEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestFeedServerCompression(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+	feedURL := server.URL + "/Book/podcast.rss"
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil },
+	}
+	for encoding, decode := range decoders {
+		// Setting Accept-Encoding keeps the client from decompressing
+		req, _ := http.NewRequest(http.MethodGet, feedURL, nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := decode(resp.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		feed, err := io.ReadAll(body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+
+		if got := resp.Header.Get("Content-Encoding"); got != encoding {
+			t.Errorf("Content-Encoding = %q, want %s", got, encoding)
+		}
+		if got := resp.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q, want Accept-Encoding", encoding, got)
+		}
+		if !strings.Contains(string(feed), server.URL+"/Book/chapter01.mp3") {
+			t.Errorf("%s: decompressed feed isn't the feed:\n%s", encoding, feed)
+		}
+	}
+
+	// Ranges and audio files are sent as they are
+	for url, header := range map[string]string{feedURL: "bytes=0-9", server.URL + "/Book/chapter01.mp3": ""} {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if header != "" {
+			req.Header.Set("Range", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("GET %s (Range %q): Content-Encoding = %q, want none", url, header, got)
+		}
+	}
+}
+
+func TestFeedServerPrivate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	s, err := newFeedServer(dir, []libraryBook{{Dir: dir}}, "", Options{NoCache: true}, feedFormats["rss"], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	state, err := loadBookState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := state.FeedToken
+	if len(token) < 20 {
+		t.Fatalf("FeedToken = %q, want a secret", token)
+	}
+
+	resp, body := serveGet(t, server.URL+"/f/"+token+"/Book/podcast.rss")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET private feed = %s", resp.Status)
+	}
+	enclosure := server.URL + "/f/" + token + "/Book/chapter01.mp3"
+	if !strings.Contains(body, `<enclosure url="`+enclosure+`"`) {
+		t.Errorf("feed doesn't link to %s:\n%s", enclosure, body)
+	}
+	if resp, _ := serveGet(t, enclosure); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET private enclosure = %s", resp.Status)
+	}
+
+	for _, path := range []string{
+		"/",
+		"/Book/podcast.rss",
+		"/Book/chapter01.mp3",
+		"/f/wrong/Book/podcast.rss",
+		"/f/" + token + "/Book/.bookast-state.json",
+	} {
+		if resp, _ := serveGet(t, server.URL+path); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %s, want 404", path, resp.Status)
+		}
+	}
+
+	// The token outlives the server
+	again, err := newFeedServer(dir, []libraryBook{{Dir: dir}}, "", Options{}, feedFormats["rss"], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := again.books[0].Token; got != token {
+		t.Errorf("Token after a restart = %q, want %s", got, token)
+	}
+}
+
+func TestFeedServerSubscribers(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "Book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	alice, err := createSubscriber(root, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := createSubscriber(root, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newFeedServer(root, []libraryBook{{Dir: dir}}, "", Options{NoCache: true}, feedFormats["rss"], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	for _, token := range []string{alice.Token, bob.Token} {
+		resp, body := serveGet(t, server.URL+"/f/"+token+"/Book/podcast.rss")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET feed with a subscriber token = %s", resp.Status)
+		}
+		enclosure := server.URL + "/f/" + token + "/Book/chapter01.mp3"
+		if !strings.Contains(body, `<enclosure url="`+enclosure+`"`) {
+			t.Errorf("feed doesn't link to %s:\n%s", enclosure, body)
+		}
+	}
+
+	// Revoking alice leaves bob and the book's own token working
+	if err := revokeSubscriber(root, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		token string
+		want  int
+	}{
+		{alice.Token, http.StatusNotFound},
+		{bob.Token, http.StatusOK},
+		{s.books[0].Token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		for _, file := range []string{"podcast.rss", "chapter01.mp3"} {
+			if resp, _ := serveGet(t, server.URL+"/f/"+tt.token+"/Book/"+file); resp.StatusCode != tt.want {
+				t.Errorf("GET /f/%s/Book/%s = %s, want %d", tt.token, file, resp.Status, tt.want)
+			}
+		}
+	}
+	if resp, _ := serveGet(t, server.URL+"/f/"+bob.Token+"/"+tokensFile); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET the tokens file = %s, want 404", resp.Status)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key
+// to dir.
+func writeTestCert(t *testing.T, dir string) (certFile string, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bookast test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	if config, err := loadTLSConfig("", ""); config != nil || err != nil {
+		t.Errorf("loadTLSConfig() without files = %v, %v, want no TLS", config, err)
+	}
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+	if _, err := loadTLSConfig(certFile, ""); err == nil {
+		t.Error("loadTLSConfig() without --tls-key error = nil, want error")
+	}
+	if _, err := loadTLSConfig(keyFile, keyFile); err == nil {
+		t.Error("loadTLSConfig() with a key for a cert error = nil, want error")
+	}
+}
+
+func TestFeedServerTLS(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+	config, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newFeedServer(filepath.Dir(dir), []libraryBook{{Dir: dir}}, "", Options{NoCache: true}, feedFormats["rss"], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(s)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/Book/podcast.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(server.URL, "https://") {
+		t.Fatalf("server URL = %s, want https", server.URL)
+	}
+	enclosure := server.URL + "/Book/chapter01.mp3"
+	if !strings.Contains(string(body), `<enclosure url="`+enclosure+`"`) {
+		t.Errorf("feed doesn't link to %s:\n%s", enclosure, body)
+	}
+}
+
+func TestRequestBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", nil, "http://localhost:8080"},
+		{"proto", map[string]string{"X-Forwarded-Proto": "https"}, "https://localhost:8080"},
+		{"host", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "books.example.com"}, "https://books.example.com"},
+		{"prefix", map[string]string{"X-Forwarded-Host": "example.com", "X-Forwarded-Prefix": "/audiobooks/"}, "http://example.com/audiobooks"},
+		{"chain", map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "example.com, proxy.internal"}, "https://example.com"},
+		{"bad proto", map[string]string{"X-Forwarded-Proto": "gopher"}, "http://localhost:8080"},
+		{"bad host", map[string]string{"X-Forwarded-Host": "evil.example/path"}, "http://localhost:8080"},
+		{"bad prefix", map[string]string{"X-Forwarded-Prefix": "audiobooks"}, "http://localhost:8080"},
+	}
+	s := &feedServer{}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/Book/podcast.rss", nil)
+		r.RemoteAddr = "127.0.0.1:41234" // A reverse proxy on this machine
+		for name, value := range tt.headers {
+			r.Header.Set(name, value)
+		}
+		if got := s.requestBaseURL(r); got != tt.want {
+			t.Errorf("%s: requestBaseURL() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Anyone else's X-Forwarded headers are made up
+	for _, remote := range []string{"192.0.2.1:1234", "[2001:db8::1]:1234"} {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/Book/podcast.rss", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "evil.example")
+		r.Header.Set("X-Forwarded-Prefix", "/phish")
+		if got := s.requestBaseURL(r); got != "http://localhost:8080" {
+			t.Errorf("requestBaseURL() from %s = %q, want the forged headers ignored", remote, got)
+		}
+	}
+	// A proxy on a unix socket
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	r.RemoteAddr = "@"
+	r.Header.Set("X-Forwarded-Host", "books.example.com")
+	if got := s.requestBaseURL(r); got != "http://books.example.com" {
+		t.Errorf("requestBaseURL() over a unix socket = %q, want the proxy's host", got)
+	}
+
+	fixed := &feedServer{baseURL: "https://fixed.example"}
+	r = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	r.Header.Set("X-Forwarded-Host", "example.com")
+	if got := fixed.requestBaseURL(r); got != "https://fixed.example" {
+		t.Errorf("requestBaseURL() with --base-url = %q, want it to win", got)
+	}
+}
+
+func TestFeedServerBehindProxy(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/Book/podcast.rss", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "books.example.com")
+	req.Header.Set("X-Forwarded-Prefix", "/audiobooks")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<enclosure url="https://books.example.com/audiobooks/Book/chapter01.mp3"`,
+		`href="https://books.example.com/audiobooks/Book/podcast.rss"`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("feed behind a proxy doesn't contain %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestFeedServerHost(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+
+	// One server, reached by different names, links each back to itself
+	for _, host := range []string{"localhost:8080", "books.lan", "192.168.1.10:8080"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/Book/podcast.rss", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `<enclosure url="http://` + host + `/Book/chapter01.mp3"`
+		if !strings.Contains(string(body), want) {
+			t.Errorf("feed requested from %s doesn't contain %s:\n%s", host, want, body)
+		}
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	// Socket paths are short, t.TempDir() can be too long for them
+	dir, err := os.MkdirTemp("", "bookast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "serve.sock")
+
+	listener, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://bookast/Book/podcast.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "/Book/podcast.rss" {
+		t.Errorf("over the socket got %q, want /Book/podcast.rss", body)
+	}
+
+	if _, err := listen("unix:" + path); err == nil {
+		t.Error("listen() on a socket being served error = nil, want in use")
+	}
+	listener.Close()
+
+	// A stale socket, as a killed server leaves, is replaced
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+	listener, err = listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("listen() on a stale socket error = %v", err)
+	}
+	listener.Close()
+}
+
+func TestSystemdListener(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	if listener, err := systemdListener(systemdFirstFD); listener != nil || err != nil {
+		t.Fatalf("systemdListener() without activation = %v, %v, want nil", listener, err)
+	}
+
+	socket, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	file, err := socket.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// For another process
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	if listener, err := systemdListener(int(file.Fd())); listener != nil || err != nil {
+		t.Fatalf("systemdListener() for another PID = %v, %v, want nil", listener, err)
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	listener, err := systemdListener(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if listener.Addr().String() != socket.Addr().String() {
+		t.Errorf("systemdListener() address = %s, want %s", listener.Addr(), socket.Addr())
+	}
+	if os.Getenv("LISTEN_PID") != "" || os.Getenv("LISTEN_FDS") != "" {
+		t.Error("LISTEN_PID and LISTEN_FDS are still set, want them cleared")
+	}
+
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if resp, _ := serveGet(t, "http://"+socket.Addr().String()+"/"); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET over the inherited socket = %s", resp.Status)
+	}
+}
+
+func TestFeedServerReload(t *testing.T) {
+	server, dir := newTestFeedServer(t)
+	s := server.Config.Handler.(*feedServer)
+
+	other := filepath.Join(filepath.Dir(dir), "Other")
+	if err := os.Mkdir(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, other, "chapter01.mp3")
+	if err := os.WriteFile(filepath.Join(other, "bonus.xyz"), []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := serveGet(t, server.URL+"/Other/podcast.rss"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET a book before it's added = %s, want 404", resp.Status)
+	}
+
+	defer delete(audioMIMETypes, ".xyz")
+	if err := s.reload([]libraryBook{{Dir: dir}, {Dir: other}}, map[string]string{".xyz": "audio/x-xyz"}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := serveGet(t, server.URL+"/Other/podcast.rss"); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET the added book's feed = %s", resp.Status)
+	}
+	if resp, _ := serveGet(t, server.URL+"/Book/podcast.rss"); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET the first book's feed after a reload = %s", resp.Status)
+	}
+	resp, _ := serveGet(t, server.URL+"/Other/bonus.xyz")
+	if got := resp.Header.Get("Content-Type"); got != "audio/x-xyz" {
+		t.Errorf("Content-Type of a type added by the config = %q, want audio/x-xyz", got)
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "all of it")
+	})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- httpServer.Serve(listener) }()
+
+	signals := make(chan os.Signal)
+	reloaded := make(chan struct{}, 1)
+	done := handleSignals(signals, httpServer, func() error {
+		reloaded <- struct{}{}
+		return nil
+	}, time.Minute)
+
+	signals <- syscall.SIGHUP
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP didn't reload")
+	}
+
+	// A download in progress when SIGTERM comes is finished
+	body := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		body <- string(data)
+	}()
+	<-started
+	signals <- syscall.SIGTERM
+	select {
+	case <-done:
+		t.Fatal("shut down with a download in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if got := <-body; got != "all of it" {
+		t.Errorf("download during shutdown = %q, want all of it", got)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("didn't shut down after the download finished")
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Serve() error = %v, want ErrServerClosed", err)
+	}
+}
+
+func TestHandleSignalsDrainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	stuck := make(chan struct{})
+	defer close(stuck)
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		w.(http.Flusher).Flush()
+		<-stuck
+	})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go httpServer.Serve(listener)
+	go http.Get("http://" + listener.Addr().String() + "/")
+	<-started
+
+	signals := make(chan os.Signal)
+	done := handleSignals(signals, httpServer, nil, 10*time.Millisecond)
+	signals <- syscall.SIGTERM
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("didn't give up on a stuck download after --drain-timeout")
+	}
+}
+
+func TestFeedServerDownloads(t *testing.T) {
+	server, dir := newTestFeedServer(t)
+
+	etag := func() string {
+		resp, _ := serveGet(t, server.URL+"/Book/podcast.rss")
+		return resp.Header.Get("ETag")
+	}
+	before := etag()
+
+	serveGet(t, server.URL+"/Book/chapter01.mp3")
+	serveGet(t, server.URL+"/Book/chapter01.mp3")
+	serveGet(t, server.URL+"/Book/chapter02.mp3")
+	serveGet(t, server.URL+"/Book/cover.jpg") // Not an episode
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/Book/chapter02.mp3", nil)
+	req.Header.Set("Range", "bytes=1000-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() // Seeking, not another download
+
+	state, err := loadBookState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Downloads) != 2 || state.Downloads["chapter01.mp3"].Count != 2 || state.Downloads["chapter02.mp3"].Count != 1 {
+		t.Errorf("Downloads = %v, want chapter01.mp3 twice and chapter02.mp3 once", state.Downloads)
+	}
+	if after := etag(); after != before {
+		t.Errorf("feed ETag changed from %s to %s by downloads", before, after)
+	}
+
+	resp, body := serveGet(t, server.URL+"/downloads.json")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET downloads.json = %s, %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	var downloads []bookDownloads
+	if err := json.Unmarshal([]byte(body), &downloads); err != nil {
+		t.Fatal(err)
+	}
+	if len(downloads) != 1 || downloads[0].Book != "Book" || downloads[0].Downloads != 3 {
+		t.Errorf("downloads.json = %s, want Book with 3", body)
+	}
+}
+
+func TestFeedServerHealthChecks(t *testing.T) {
+	feeds, _ := newTestFeedServer(t)
+	s := feeds.Config.Handler.(*feedServer)
+	server := httptest.NewServer(s.withHealthChecks(requireAuth(s, passwords{"alice": "secret"})))
+	defer server.Close()
+
+	s.starting.Store(true)
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/readyz", http.StatusServiceUnavailable},
+		{"/Book/podcast.rss", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		resp, _ := serveGet(t, server.URL+tt.path)
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s while starting = %s, want %d", tt.path, resp.Status, tt.want)
+		}
+	}
+
+	// Ready, and the health checks need no password unlike the rest
+	s.starting.Store(false)
+	tests = []struct {
+		path string
+		want int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/readyz", http.StatusOK},
+		{"/Book/podcast.rss", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		resp, _ := serveGet(t, server.URL+tt.path)
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s when ready = %s, want %d", tt.path, resp.Status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ShelfBook is a book in a reading-tracker export.
+type ShelfBook struct {
+	Title       string
+	Authors     []string
+	ISBNs       []string // Normalized by normalizeISBN
+	Series      string
+	SeriesIndex string
+	Year        int
+	Rating      float64 // The user's stars out of 5, 0 if unrated
+	Review      string
+}
+
+// Shelf is the user's library from a Goodreads or StoryGraph CSV export
+// (--shelf, or shelf in the config file), matched to books by ISBN or title.
+type Shelf struct {
+	Books []ShelfBook
+}
+
+// goodreadsSeriesRe matches the series Goodreads appends to titles:
+// "The Final Empire (Mistborn, #1)".
+var goodreadsSeriesRe = regexp.MustCompile(`^(.+?)\s*\(([^()]+?),?\s*#(\d+(?:\.\d+)?)\)$`)
+
+// loadShelf reads a Goodreads or StoryGraph export, telling them apart by
+// their columns.
+func loadShelf(path string) (*Shelf, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: empty file", path)
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	shelf := &Shelf{}
+	switch {
+	case hasColumns(columns, "Book Id", "Title", "Author", "My Rating"):
+		for _, record := range records[1:] {
+			book := ShelfBook{Title: field(record, "Title"), Review: field(record, "My Review")}
+			if m := goodreadsSeriesRe.FindStringSubmatch(book.Title); m != nil {
+				book.Title, book.Series = m[1], strings.TrimSpace(m[2])
+				_, book.SeriesIndex, _ = splitSeriesIndex(m[3])
+			}
+			book.Authors = appendUnique(splitNames(field(record, "Author")), splitList(field(record, "Additional Authors"))...)
+			for _, isbn := range []string{field(record, "ISBN13"), field(record, "ISBN")} {
+				if isbn = normalizeISBN(isbn); isbn != "" {
+					book.ISBNs = append(book.ISBNs, isbn)
+				}
+			}
+			book.Year, _ = strconv.Atoi(field(record, "Original Publication Year"))
+			if book.Year == 0 {
+				book.Year, _ = strconv.Atoi(field(record, "Year Published"))
+			}
+			book.Rating, _ = strconv.ParseFloat(field(record, "My Rating"), 64)
+			shelf.Books = append(shelf.Books, book)
+		}
+	case hasColumns(columns, "Title", "Authors", "ISBN/UID", "Star Rating"):
+		for _, record := range records[1:] {
+			book := ShelfBook{
+				Title:   field(record, "Title"),
+				Authors: splitList(field(record, "Authors")),
+				Review:  field(record, "Review"),
+			}
+			if isbn := normalizeISBN(field(record, "ISBN/UID")); len(isbn) == 10 || len(isbn) == 13 {
+				book.ISBNs = []string{isbn}
+			}
+			book.Rating, _ = strconv.ParseFloat(field(record, "Star Rating"), 64)
+			shelf.Books = append(shelf.Books, book)
+		}
+	default:
+		return nil, fmt.Errorf("%s: not a Goodreads or StoryGraph export", path)
+	}
+	return shelf, nil
+}
+
+func hasColumns(columns map[string]int, names ...string) bool {
+	for _, name := range names {
+		if _, ok := columns[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitList splits a comma-separated list of names. Exports use commas
+// between people, unlike tags.
+func splitList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// find returns the book with the ISBN, else the one with the title (ignoring
+// case and punctuation) by one of the authors, or nil. Authors are only
+// compared when both sides have them. A nil shelf has no books.
+func (s *Shelf) find(title string, authors []string, isbn string) *ShelfBook {
+	if s == nil {
+		return nil
+	}
+	if isbn != "" {
+		for i, book := range s.Books {
+			for _, bookISBN := range book.ISBNs {
+				if bookISBN == isbn {
+					return &s.Books[i]
+				}
+			}
+		}
+	}
+
+	key := titleKey(title)
+	if key == "" {
+		return nil
+	}
+	for i, book := range s.Books {
+		if titleKey(book.Title) != key {
+			continue
+		}
+		if len(authors) == 0 || len(book.Authors) == 0 || sharesName(book.Authors, authors) {
+			return &s.Books[i]
+		}
+	}
+	return nil
+}
+
+func sharesName(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// titleKey reduces a title to lowercase letters and digits.
+func titleKey(title string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, title)
+}
+
+// overFolder returns folder with the shelf's series and year where the
+// directory name has none. A nil b changes nothing.
+func (b *ShelfBook) overFolder(folder FolderName) FolderName {
+	if b == nil {
+		return folder
+	}
+	if folder.Series == "" && b.Series != "" {
+		folder.Series = b.Series
+		folder.SeriesIndex = b.SeriesIndex
+	}
+	if folder.Year == 0 {
+		folder.Year = b.Year
+	}
+	return folder
+}
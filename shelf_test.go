@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const goodreadsExport = "\ufeffBook Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Bookshelves,Bookshelves with positions,Exclusive Shelf,My Review,Spoiler,Private Notes,Read Count,Owned Copies\n" +
+	`68428,"The Final Empire (Mistborn, #1)",Brandon Sanderson,"Sanderson, Brandon",,"=""0765311781""","=""9780765311788""",5,4.47,Tor Fantasy,Hardcover,541,2006,2006,2020/01/02,2019/12/01,,,read,Ash everywhere.<br/>Loved it.,,,1,0` + "\n" +
+	`5907,The Hobbit,J.R.R. Tolkien,"Tolkien, J.R.R.",,"=""""","=""""",0,4.29,Houghton Mifflin,Paperback,366,2002,1937,,2019/12/01,to-read,to-read (#1),to-read,,,,0,0` + "\n"
+
+const storyGraphExport = "Title,Authors,Contributors,ISBN/UID,Format,Read Status,Date Added,Last Date Read,Dates Read,Read Count,Moods,Pace,Character- or Plot-Driven?,Strong Character Development?,Loveable Characters?,Diverse Characters?,Flawed Characters?,Star Rating,Review,Content Warnings,Content Warning Description,Tags,Owned?\n" +
+	`Good Omens,"Neil Gaiman, Terry Pratchett",,9780060853983,audio,read,2023/01/01,2023/02/01,,1,funny,fast,Plot,Yes,Yes,No,Yes,4.25,Very silly.,,,,No` + "\n"
+
+func writeShelf(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.csv")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadShelf(t *testing.T) {
+	shelf, err := loadShelf(writeShelf(t, goodreadsExport))
+	if err != nil {
+		t.Fatalf("loadShelf() Goodreads error = %v", err)
+	}
+	expected := []ShelfBook{
+		{
+			Title:       "The Final Empire",
+			Authors:     []string{"Brandon Sanderson"},
+			ISBNs:       []string{"9780765311788", "0765311781"},
+			Series:      "Mistborn",
+			SeriesIndex: "1",
+			Year:        2006,
+			Rating:      5,
+			Review:      "Ash everywhere.<br/>Loved it.",
+		},
+		{Title: "The Hobbit", Authors: []string{"J.R.R. Tolkien"}, Year: 1937},
+	}
+	if !reflect.DeepEqual(shelf.Books, expected) {
+		t.Errorf("Goodreads books = %+v, want %+v", shelf.Books, expected)
+	}
+
+	shelf, err = loadShelf(writeShelf(t, storyGraphExport))
+	if err != nil {
+		t.Fatalf("loadShelf() StoryGraph error = %v", err)
+	}
+	expected = []ShelfBook{{
+		Title:   "Good Omens",
+		Authors: []string{"Neil Gaiman", "Terry Pratchett"},
+		ISBNs:   []string{"9780060853983"},
+		Rating:  4.25,
+		Review:  "Very silly.",
+	}}
+	if !reflect.DeepEqual(shelf.Books, expected) {
+		t.Errorf("StoryGraph books = %+v, want %+v", shelf.Books, expected)
+	}
+
+	if _, err := loadShelf(writeShelf(t, "Name,Price\nbook,1\n")); err == nil {
+		t.Error("loadShelf() of another CSV error = nil, want error")
+	}
+}
+
+func TestShelfFind(t *testing.T) {
+	shelf, err := loadShelf(writeShelf(t, goodreadsExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		title   string
+		authors []string
+		isbn    string
+		found   string
+	}{
+		{"by isbn", "Wrong Title", nil, "0765311781", "The Final Empire"},
+		{"by title", "the final empire", nil, "", "The Final Empire"},
+		{"by title and author", "The Hobbit", []string{"j.r.r. tolkien"}, "", "The Hobbit"},
+		{"other author", "The Hobbit", []string{"Someone Else"}, "", ""},
+		{"unknown", "Dune", nil, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := shelf.find(tt.title, tt.authors, tt.isbn)
+			found := ""
+			if book != nil {
+				found = book.Title
+			}
+			if found != tt.found {
+				t.Errorf("find() = %q, want %q", found, tt.found)
+			}
+		})
+	}
+
+	var none *Shelf
+	if none.find("The Hobbit", nil, "") != nil {
+		t.Error("nil shelf find() found a book")
+	}
+}
+
+func TestScanDirectoryShelf(t *testing.T) {
+	shelf, err := loadShelf(writeShelf(t, goodreadsExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "Brandon Sanderson - The Final Empire")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+
+	podcast, err := scanDirectory(dir, Options{BaseURL: "https://example.com", NoCache: true, Shelf: shelf})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+	if podcast.Title != "Mistborn 01: The Final Empire" {
+		t.Errorf("Title = %q, want the shelf's series in it", podcast.Title)
+	}
+	if podcast.Rating != 5 {
+		t.Errorf("Rating = %v, want 5", podcast.Rating)
+	}
+	if podcast.Description != "Book 1 of the Mistborn series.\n\nAsh everywhere.<br/>Loved it." {
+		t.Errorf("Description = %q, want the review", podcast.Description)
+	}
+}
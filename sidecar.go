@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// absMetadataFile is the sidecar Audiobookshelf writes into each book's
+// directory.
+const absMetadataFile = "metadata.json"
+
+// Sidecar is book metadata a library manager keeps next to the audio: an
+// Audiobookshelf metadata.json or a Kodi-style .nfo. It's curated, so it's
+// preferred over anything bookast guesses; only book.yaml overrides it.
+type Sidecar struct {
+	File        string // Name of the file it was read from
+	Title       string
+	Authors     []string
+	Narrators   []string
+	Series      string
+	SeriesIndex string
+	Year        int
+	Description string
+	Genres      []string
+	Language    string
+	ISBN        string
+	ASIN        string
+}
+
+// loadSidecar reads metadata.json from dir, else the first .nfo. It returns
+// nil if there's neither.
+func loadSidecar(dir string) (*Sidecar, error) {
+	content, err := os.ReadFile(filepath.Join(dir, absMetadataFile))
+	if err == nil {
+		sidecar, err := parseABSMetadata(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", absMetadataFile, err)
+		}
+		sidecar.File = absMetadataFile
+		return sidecar, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var nfos []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".nfo") {
+			nfos = append(nfos, entry.Name())
+		}
+	}
+	if len(nfos) == 0 {
+		return nil, nil
+	}
+	sort.Strings(nfos)
+
+	content, err = os.ReadFile(filepath.Join(dir, nfos[0]))
+	if err != nil {
+		return nil, err
+	}
+	sidecar, err := parseNFO(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", nfos[0], err)
+	}
+	sidecar.File = nfos[0]
+	return sidecar, nil
+}
+
+// parseABSMetadata reads an Audiobookshelf metadata.json. Its series are
+// "Name #1" strings and its year is a string.
+func parseABSMetadata(content []byte) (*Sidecar, error) {
+	var abs struct {
+		Title         string   `json:"title"`
+		Authors       []string `json:"authors"`
+		Narrators     []string `json:"narrators"`
+		Series        []string `json:"series"`
+		Genres        []string `json:"genres"`
+		PublishedYear string   `json:"publishedYear"`
+		Description   string   `json:"description"`
+		ISBN          string   `json:"isbn"`
+		ASIN          string   `json:"asin"`
+		Language      string   `json:"language"`
+	}
+	if err := json.Unmarshal(content, &abs); err != nil {
+		return nil, err
+	}
+
+	sidecar := &Sidecar{
+		Title:       strings.TrimSpace(abs.Title),
+		Authors:     trimNames(abs.Authors),
+		Narrators:   trimNames(abs.Narrators),
+		Description: strings.TrimSpace(abs.Description),
+		Genres:      trimNames(abs.Genres),
+		Language:    strings.TrimSpace(abs.Language),
+		ISBN:        strings.TrimSpace(abs.ISBN),
+		ASIN:        strings.TrimSpace(abs.ASIN),
+	}
+	sidecar.Year, _ = strconv.Atoi(strings.TrimSpace(abs.PublishedYear))
+	if len(abs.Series) > 0 {
+		sidecar.Series, sidecar.SeriesIndex = splitHashIndex(abs.Series[0])
+	}
+	return sidecar, nil
+}
+
+// parseNFO reads a Kodi-style .nfo, whatever its root element (<album>,
+// <book>, <movie>). People may be repeated elements; a Kodi <set> is the
+// series.
+func parseNFO(content []byte) (*Sidecar, error) {
+	var nfo struct {
+		Title     string   `xml:"title"`
+		Authors   []string `xml:"author"`
+		Artists   []string `xml:"artist"`
+		Narrators []string `xml:"narrator"`
+		Series    string   `xml:"series"`
+		Set       struct {
+			Name string `xml:"name"`
+			Text string `xml:",chardata"`
+		} `xml:"set"`
+		Year        string   `xml:"year"`
+		Plot        string   `xml:"plot"`
+		Description string   `xml:"description"`
+		Genres      []string `xml:"genre"`
+		Language    string   `xml:"language"`
+		ISBN        string   `xml:"isbn"`
+		ASIN        string   `xml:"asin"`
+	}
+	if err := xml.Unmarshal(content, &nfo); err != nil {
+		return nil, err
+	}
+
+	sidecar := &Sidecar{
+		Title:       strings.TrimSpace(nfo.Title),
+		Authors:     trimNames(nfo.Authors),
+		Narrators:   trimNames(nfo.Narrators),
+		Description: strings.TrimSpace(nfo.Plot),
+		Genres:      trimNames(nfo.Genres),
+		Language:    strings.TrimSpace(nfo.Language),
+		ISBN:        strings.TrimSpace(nfo.ISBN),
+		ASIN:        strings.TrimSpace(nfo.ASIN),
+	}
+	if len(sidecar.Authors) == 0 {
+		sidecar.Authors = trimNames(nfo.Artists)
+	}
+	if sidecar.Description == "" {
+		sidecar.Description = strings.TrimSpace(nfo.Description)
+	}
+	series := nfo.Series
+	for _, s := range []string{nfo.Set.Name, nfo.Set.Text} {
+		if strings.TrimSpace(series) == "" {
+			series = s
+		}
+	}
+	sidecar.Series, sidecar.SeriesIndex = splitHashIndex(series)
+	// <year>2006</year>, or a full date
+	if year := strings.TrimSpace(nfo.Year); len(year) >= 4 {
+		sidecar.Year, _ = strconv.Atoi(year[:4])
+	}
+	return sidecar, nil
+}
+
+// splitHashIndex splits "Mistborn #1" into "Mistborn" and "1". A series
+// without "#" has no index.
+func splitHashIndex(s string) (series, index string) {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "#"); i > 0 {
+		if _, index, ok := splitSeriesIndex(s[i:]); ok {
+			return strings.TrimSpace(s[:i]), index
+		}
+	}
+	return s, ""
+}
+
+func trimNames(names []string) []string {
+	var trimmed []string
+	for _, name := range names {
+		trimmed = appendUnique(trimmed, splitNames(name)...)
+	}
+	return trimmed
+}
+
+// fillBook sets whatever book.yaml leaves out from the sidecar. A nil s
+// changes nothing.
+func (s *Sidecar) fillBook(book *BookConfig) {
+	if s == nil {
+		return
+	}
+	if len(book.Authors) == 0 {
+		book.Authors = s.Authors
+	}
+	if len(book.Narrators) == 0 {
+		book.Narrators = s.Narrators
+	}
+	book.Keywords = appendUnique(book.Keywords, s.Genres...)
+	// A language book.yaml would reject is left to the tags
+	if _, ok := normalizeLanguage(s.Language); ok && book.Language == "" {
+		book.Language = s.Language
+	}
+	if book.ISBN == "" {
+		book.ISBN = s.ISBN
+	}
+	if book.ASIN == "" {
+		book.ASIN = s.ASIN
+	}
+}
+
+// overFolder returns folder with the sidecar's title, series and year
+// instead. A nil s changes nothing.
+func (s *Sidecar) overFolder(folder FolderName) FolderName {
+	if s == nil {
+		return folder
+	}
+	if s.Title != "" {
+		folder.Title = s.Title
+	}
+	if len(s.Authors) > 0 {
+		folder.Author = strings.Join(s.Authors, "; ")
+	}
+	if s.Series != "" {
+		folder.Series = s.Series
+		folder.SeriesIndex = s.SeriesIndex
+	}
+	if s.Year > 0 {
+		folder.Year = s.Year
+	}
+	return folder
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadSidecar(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected *Sidecar
+	}{
+		{
+			name:     "none",
+			files:    map[string]string{},
+			expected: nil,
+		},
+		{
+			name: "audiobookshelf",
+			files: map[string]string{"metadata.json": `{
+				"tags": [], "chapters": [],
+				"title": "The Final Empire", "subtitle": null,
+				"authors": ["Brandon Sanderson"], "narrators": ["Michael Kramer"],
+				"series": ["Mistborn #1"], "genres": ["Fantasy"],
+				"publishedYear": "2006", "publishedDate": null,
+				"description": "Ash falls.", "isbn": null, "asin": "B002UZMLXM",
+				"language": "English", "explicit": false
+			}`},
+			expected: &Sidecar{
+				File:        "metadata.json",
+				Title:       "The Final Empire",
+				Authors:     []string{"Brandon Sanderson"},
+				Narrators:   []string{"Michael Kramer"},
+				Series:      "Mistborn",
+				SeriesIndex: "1",
+				Year:        2006,
+				Description: "Ash falls.",
+				Genres:      []string{"Fantasy"},
+				Language:    "English",
+				ASIN:        "B002UZMLXM",
+			},
+		},
+		{
+			name: "kodi nfo",
+			files: map[string]string{"book.nfo": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<album>
+  <title>Good Omens</title>
+  <artist>Neil Gaiman</artist>
+  <artist>Terry Pratchett</artist>
+  <narrator>Stephen Fry</narrator>
+  <set><name>Standalone</name></set>
+  <year>1990-05-01</year>
+  <genre>Comedy</genre>
+  <plot>The world ends on Saturday.</plot>
+</album>`},
+			expected: &Sidecar{
+				File:        "book.nfo",
+				Title:       "Good Omens",
+				Authors:     []string{"Neil Gaiman", "Terry Pratchett"},
+				Narrators:   []string{"Stephen Fry"},
+				Series:      "Standalone",
+				Year:        1990,
+				Description: "The world ends on Saturday.",
+				Genres:      []string{"Comedy"},
+			},
+		},
+		{
+			name: "metadata.json before nfo",
+			files: map[string]string{
+				"metadata.json": `{"title": "From JSON"}`,
+				"a.nfo":         `<book><title>From NFO</title></book>`,
+			},
+			expected: &Sidecar{File: "metadata.json", Title: "From JSON"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sidecar, err := loadSidecar(dir)
+			if err != nil {
+				t.Fatalf("loadSidecar() error = %v", err)
+			}
+			if !reflect.DeepEqual(sidecar, tt.expected) {
+				t.Errorf("loadSidecar() = %+v, want %+v", sidecar, tt.expected)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "metadata.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSidecar(dir); err == nil {
+		t.Error("loadSidecar() of broken JSON error = nil, want error")
+	}
+}
+
+func TestSidecarFillBook(t *testing.T) {
+	sidecar := &Sidecar{Authors: []string{"Sidecar Author"}, Narrators: []string{"Sidecar Narrator"}, Genres: []string{"Fantasy"}, Language: "Klingonese", ISBN: "123"}
+	book := &BookConfig{Narrators: []string{"Yaml Narrator"}, Keywords: []string{"epic"}}
+	sidecar.fillBook(book)
+
+	expected := &BookConfig{
+		Authors:   []string{"Sidecar Author"},
+		Narrators: []string{"Yaml Narrator"},
+		Keywords:  []string{"epic", "Fantasy"},
+		ISBN:      "123",
+	}
+	if !reflect.DeepEqual(book, expected) {
+		t.Errorf("fillBook() = %+v, want %+v", book, expected)
+	}
+}
+
+func TestScanDirectorySidecar(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "final_empire_rip")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	metadata := `{"title": "The Final Empire", "authors": ["Brandon Sanderson"], "series": ["Mistborn #1"], "description": "Ash falls."}`
+	if err := os.WriteFile(filepath.Join(dir, "metadata.json"), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	podcast, err := scanDirectory(dir, Options{BaseURL: "https://example.com", NoCache: true})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+	if podcast.Title != "Mistborn 01: The Final Empire" {
+		t.Errorf("Title = %q", podcast.Title)
+	}
+	if podcast.Description != "Book 1 of the Mistborn series.\n\nAsh falls." {
+		t.Errorf("Description = %q", podcast.Description)
+	}
+	if len(podcast.People) == 0 || podcast.People[0] != (Person{"Brandon Sanderson", roleAuthor}) {
+		t.Errorf("People = %+v, want the sidecar's author first", podcast.People)
+	}
+}
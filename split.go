@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// minSplitChapters is how many chapters a file needs before --split-chapters
+// splits it. A single chapter spanning the file is just the file.
+const minSplitChapters = 2
+
+// splitDirName is the subdirectory the segments of audioFile are written to.
+func splitDirName(audioFile string) string {
+	return strings.TrimSuffix(audioFile, filepath.Ext(audioFile)) + "-chapters"
+}
+
+// segmentFilename names the segment for chapter number n ("003 - The
+// Shadow.m4b"), keeping the source's extension.
+func segmentFilename(n int, title string, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, title)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return fmt.Sprintf("%03d%s", n, ext)
+	}
+	// Most filesystems limit names to 255 bytes
+	if len(name) > 200 {
+		name = strings.ToValidUTF8(name[:200], "")
+	}
+	return fmt.Sprintf("%03d - %s%s", n, name, ext)
+}
+
+// splitChapters replaces files in audioFiles with one segment per chapter,
+// cut losslessly with ffmpeg into a "<name>-chapters" subdirectory. Files
+// described by a cue sheet (cues, keyed by filename) are always split by its
+// tracks; with all set, so is every file that has chapter markers. Segments
+// newer than their source are reused. The returned names are relative to dir.
+func splitChapters(dir string, audioFiles []string, cues map[string][]Chapter, all bool) ([]string, error) {
+	var result []string
+	for _, filename := range audioFiles {
+		chapters, ok := cues[filename]
+		if !ok && all {
+			srcPath := filepath.Join(dir, filename)
+			chapters, _ = readChapters(srcPath, readTags(srcPath))
+		}
+		if len(chapters) < minSplitChapters {
+			result = append(result, filename)
+			continue
+		}
+
+		segments, err := ensureSegments(dir, filename, splitDirName(filename), chapters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split %s: %w", filename, err)
+		}
+		result = append(result, segments...)
+	}
+	return result, nil
+}
+
+// ensureSegments cuts source into one file per chapter in subdir, returning
+// their paths relative to dir. A dry run returns only the ones that exist.
+func ensureSegments(dir string, source string, subdir string, chapters []Chapter) ([]string, error) {
+	srcPath := filepath.Join(dir, source)
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mkdirAll(filepath.Join(dir, subdir)); err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(source))
+	var segments []string
+	for i, chapter := range chapters {
+		segment := filepath.Join(subdir, segmentFilename(i+1, chapter.Title, ext))
+		dstPath := filepath.Join(dir, segment)
+
+		dstInfo, err := os.Stat(dstPath)
+		if err == nil && !dstInfo.ModTime().Before(srcInfo.ModTime()) {
+			segments = append(segments, segment)
+			continue
+		}
+		if planFFmpeg(dstPath) {
+			if err == nil {
+				segments = append(segments, segment)
+			}
+			continue
+		}
+
+		args := []string{"-v", "error", "-y", "-ss", fmt.Sprintf("%.3f", chapter.Start.Seconds()), "-i", srcPath}
+		// A chapter without an end runs to the end of the file
+		if chapter.End > chapter.Start {
+			args = append(args, "-t", fmt.Sprintf("%.3f", (chapter.End-chapter.Start).Seconds()))
+		}
+		args = append(args, "-map", "0:a", "-c", "copy", "-map_chapters", "-1",
+			"-metadata", "title="+chapter.Title,
+			"-metadata", fmt.Sprintf("track=%d/%d", i+1, len(chapters)),
+			dstPath)
+		if err := runFFmpeg(args...); err != nil {
+			os.Remove(dstPath)
+			return nil, fmt.Errorf("chapter %d: %w", i+1, err)
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSegmentFilename(t *testing.T) {
+	tests := []struct {
+		n        int
+		title    string
+		expected string
+	}{
+		{1, "Opening Credits", "001 - Opening Credits.m4b"},
+		{12, "Part 1: The Shadow", "012 - Part 1_ The Shadow.m4b"},
+		{3, "AC/DC?", "003 - AC_DC_.m4b"},
+		{4, "  ...  ", "004.m4b"},
+		{5, "", "005.m4b"},
+		{250, strings.Repeat("x", 300), "250 - " + strings.Repeat("x", 200) + ".m4b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := segmentFilename(tt.n, tt.title, ".m4b"); got != tt.expected {
+				t.Errorf("segmentFilename(%d, %q) = %q, want %q", tt.n, tt.title, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSplitChapters(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	dir := t.TempDir()
+	metadata := filepath.Join(dir, "chapters.txt")
+	err := os.WriteFile(metadata, []byte(`;FFMETADATA1
+title=The Book
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=1000
+title=Prologue
+[CHAPTER]
+TIMEBASE=1/1000
+START=1000
+END=3000
+title=Part 1: Arrival
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book := filepath.Join(dir, "book.m4b")
+	output, err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "sine=frequency=440:duration=3",
+		"-i", metadata, "-map_metadata", "1", "-map_chapters", "1", "-c:a", "aac", "-f", "mp4", book).CombinedOutput()
+	if err != nil {
+		t.Fatalf("creating fixture: %v: %s", err, output)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bonus.mp3"), []byte("no chapters"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := splitChapters(dir, []string{"bonus.mp3", "book.m4b"}, nil, true)
+	if err != nil {
+		t.Fatalf("splitChapters() error = %v", err)
+	}
+	expected := []string{
+		"bonus.mp3",
+		filepath.Join("book-chapters", "001 - Prologue.m4b"),
+		filepath.Join("book-chapters", "002 - Part 1_ Arrival.m4b"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("splitChapters() = %q, want %q", files, expected)
+	}
+
+	episode, err := processAudioFile(filepath.Join(dir, files[2]), "https://x.com", dir, time.Now(), 2)
+	if err != nil {
+		t.Fatalf("processAudioFile() error = %v", err)
+	}
+	if episode.Title != "Part 1: Arrival" {
+		t.Errorf("Title = %q, want %q", episode.Title, "Part 1: Arrival")
+	}
+	if episode.Duration < 1500*time.Millisecond || episode.Duration > 2500*time.Millisecond {
+		t.Errorf("Duration = %v, want about 2s", episode.Duration)
+	}
+	if len(episode.Chapters) != 0 {
+		t.Errorf("Chapters = %v, segments shouldn't carry the book's chapters", episode.Chapters)
+	}
+	if want := "https://x.com/" + filepath.Base(dir) + "/book-chapters/002%20-%20Part%201_%20Arrival.m4b"; episode.URL != want {
+		t.Errorf("URL = %q, want %q", episode.URL, want)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stateFile holds what bookast must remember about a book between runs.
+// Unlike book.yaml it's written by bookast, not by hand.
+const stateFile = ".bookast-state.json"
+
+// BookState is the contents of stateFile.
+type BookState struct {
+	// PodcastGUID is the channel's podcast:guid. It's derived from the feed
+	// URL the first time and kept when the feed moves.
+	PodcastGUID string `json:"podcastGuid,omitempty"`
+
+	// FeedToken is the secret in the URLs of the book's private feed in
+	// serve --private.
+	FeedToken string `json:"feedToken,omitempty"`
+
+	// Downloads counts serve mode's downloads of the book's files, by path
+	// in the book.
+	Downloads map[string]*DownloadCount `json:"downloads,omitempty"`
+
+	// TrailerLength is the --trailer length the trailer was clipped to,
+	// like "1m30s", so a different one makes a new trailer.
+	TrailerLength string `json:"trailerLength,omitempty"`
+
+	// HubDigest is podcastDigest of the feed the WebSub hub was last
+	// pinged about.
+	HubDigest string `json:"hubDigest,omitempty"`
+}
+
+// loadBookState reads the state file from dir. A missing file is an empty
+// state.
+func loadBookState(dir string) (*BookState, error) {
+	state := &BookState{}
+
+	content, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("%s: %v", stateFile, err)
+	}
+	return state, nil
+}
+
+// saveBookState writes the state file to dir.
+func saveBookState(dir string, state *BookState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSecretFileIfChanged(filepath.Join(dir, stateFile), append(data, '\n'))
+}
+
+// podcastGUIDNamespace is the UUIDv5 namespace Podcasting 2.0 defines for
+// podcast:guid.
+var podcastGUIDNamespace = [16]byte{0xea, 0xd4, 0xc2, 0x36, 0xbf, 0x58, 0x58, 0xc6, 0xa2, 0xc6, 0xa6, 0xb2, 0x8d, 0x12, 0x8c, 0xb6}
+
+// podcastGUID derives a podcast:guid from a feed URL as the spec describes:
+// a UUIDv5 of the URL without its scheme and trailing slashes.
+func podcastGUID(feedURL string) string {
+	name := feedURL
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.TrimRight(name, "/")
+
+	h := sha1.New()
+	h.Write(podcastGUIDNamespace[:])
+	h.Write([]byte(name))
+	sum := h.Sum(nil)
+
+	sum[6] = sum[6]&0x0f | 0x50 // version 5
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
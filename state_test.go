@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPodcastGUID(t *testing.T) {
+	tests := []struct {
+		feedURL  string
+		expected string
+	}{
+		// The example from the podcast namespace documentation
+		{"https://mp3s.nashownotes.com/pc20rss.xml", "917393e3-1b1e-5cef-ace4-edaa54e1f810"},
+		{"http://mp3s.nashownotes.com/pc20rss.xml/", "917393e3-1b1e-5cef-ace4-edaa54e1f810"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.feedURL, func(t *testing.T) {
+			if got := podcastGUID(tt.feedURL); got != tt.expected {
+				t.Errorf("podcastGUID(%q) = %q, want %q", tt.feedURL, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBookState(t *testing.T) {
+	dir := t.TempDir()
+
+	state, err := loadBookState(dir)
+	if err != nil {
+		t.Fatalf("loadBookState() without a state file error = %v", err)
+	}
+	if state.PodcastGUID != "" {
+		t.Errorf("PodcastGUID = %q, want empty", state.PodcastGUID)
+	}
+
+	state.PodcastGUID = "917393e3-1b1e-5cef-ace4-edaa54e1f810"
+	if err := saveBookState(dir, state); err != nil {
+		t.Fatalf("saveBookState() error = %v", err)
+	}
+	state, err = loadBookState(dir)
+	if err != nil {
+		t.Fatalf("loadBookState() error = %v", err)
+	}
+	if state.PodcastGUID != "917393e3-1b1e-5cef-ace4-edaa54e1f810" {
+		t.Errorf("PodcastGUID = %q after saving", state.PodcastGUID)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, stateFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBookState(dir); err == nil {
+		t.Error("loadBookState() with a corrupt state file error = nil, want error")
+	}
+}
+
+func TestSaveBookStateIsPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, stateFile)
+	// Saved world-readable by an older version
+	if err := os.WriteFile(path, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []*BookState{{}, {FeedToken: "AbCdEfGhIjKlMnOpQrStUv"}} {
+		if err := saveBookState(dir, state); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("state file mode = %o, want 600", perm)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %v, want only the state file", entries)
+	}
+}
+
+func TestScanDirectoryKeepsPodcastGUID(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	audio, err := os.ReadFile("testdata/audiobook1/chapter01.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "chapter01.mp3"), audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A scan that isn't publishing, like bookast list's, doesn't fix it
+	listed, err := scanDirectory(dir, Options{})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+	if expected := podcastGUID("/book/podcast.rss"); listed.GUID != expected {
+		t.Errorf("GUID = %q, want %q", listed.GUID, expected)
+	}
+	if _, err := os.Stat(filepath.Join(dir, stateFile)); !os.IsNotExist(err) {
+		t.Errorf("%s written by a scan without KeepGUID", stateFile)
+	}
+
+	podcast, err := scanDirectory(dir, Options{BaseURL: "https://old.example.com", KeepGUID: true})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+	if expected := podcastGUID("https://old.example.com/book/podcast.rss"); podcast.GUID != expected {
+		t.Errorf("GUID = %q, want %q", podcast.GUID, expected)
+	}
+
+	// Moving the feed keeps its identity
+	moved, err := scanDirectory(dir, Options{BaseURL: "https://new.example.com", KeepGUID: true})
+	if err != nil {
+		t.Fatalf("scanDirectory() error = %v", err)
+	}
+	if moved.GUID != podcast.GUID {
+		t.Errorf("GUID after moving = %q, want %q", moved.GUID, podcast.GUID)
+	}
+}
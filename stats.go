@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runStats implements "bookast stats", which totals up the runtime and size
+// of a book or library and counts what's missing from its metadata, without
+// writing any feeds.
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	layout := fs.String("layout", "", "Total up every book in a library laid out like audiobookshelf (Author/[Series/]Book)")
+	downloads := fs.Bool("downloads", false, "Instead, list how often bookast serve sent each book and episode")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s stats [flags] <directory>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for ext, mimeType := range config.MIMETypes {
+		audioMIMETypes[ext] = mimeType
+	}
+
+	books, err := findBooks(fs.Arg(0), *layout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *downloads {
+		counts, err := libraryDownloads(books)
+		if err == nil {
+			err = writeDownloads(os.Stdout, counts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	var podcasts []*Podcast
+	failed := 0
+	for _, book := range books {
+		podcast, err := scanDirectory(book.Dir, Options{Folder: book.Folder})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", book.Dir, err)
+			failed++
+			continue
+		}
+		podcasts = append(podcasts, podcast)
+	}
+
+	if err := writeStats(os.Stdout, podcasts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// writeStats prints a table of the books with their episode counts, runtimes
+// and sizes, the totals, and how many books and episodes lack each kind of
+// metadata.
+func writeStats(w io.Writer, podcasts []*Podcast) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EPISODES\tRUNTIME\tSIZE\tBOOK")
+	var episodes int
+	var runtime time.Duration
+	var size int64
+	missing := map[string]int{}
+	for _, podcast := range podcasts {
+		var bookRuntime time.Duration
+		var bookSize int64
+		for _, episode := range podcast.Episodes {
+			bookRuntime += episode.Duration
+			bookSize += episode.FileSize
+			if episode.Duration <= 0 {
+				missing["episodes without a duration"]++
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", len(podcast.Episodes), formatDuration(bookRuntime), formatByteSize(bookSize), podcast.Title)
+		episodes += len(podcast.Episodes)
+		runtime += bookRuntime
+		size += bookSize
+
+		var authors, narrators int
+		for _, p := range podcast.People {
+			if p.Role == roleAuthor {
+				authors++
+			} else {
+				narrators++
+			}
+		}
+		if authors == 0 {
+			missing["books without an author"]++
+		}
+		if narrators == 0 {
+			missing["books without a narrator"]++
+		}
+		if podcast.CoverArtURL == "" {
+			missing["books without a cover"]++
+		}
+		for _, warning := range podcast.Warnings {
+			switch warning.Category {
+			case warnGenericDescription:
+				missing["books without a description"]++
+			case warnMissingTitle:
+				missing["episodes without a title"]++
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\n%s, %s, %s, %s\n", plural(len(podcasts), "book"), plural(episodes, "episode"), formatDuration(runtime), formatByteSize(size))
+
+	kinds := []string{
+		"books without an author",
+		"books without a narrator",
+		"books without a cover",
+		"books without a description",
+		"episodes without a title",
+		"episodes without a duration",
+	}
+	header := false
+	for _, kind := range kinds {
+		if missing[kind] == 0 {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(w, "\nMissing metadata:\n")
+			header = true
+		}
+		fmt.Fprintf(w, "  %s: %d\n", kind, missing[kind])
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteStats(t *testing.T) {
+	podcasts := []*Podcast{
+		{
+			Title:       "Mistborn 01: The Final Empire",
+			CoverArtURL: "https://example.com/cover.jpg",
+			People:      []Person{{"Brandon Sanderson", roleAuthor}, {"Michael Kramer", roleNarrator}},
+			Episodes: []Episode{
+				{Duration: 2 * time.Hour, FileSize: 100 << 20},
+				{Duration: 90 * time.Minute, FileSize: 80 << 20},
+			},
+		},
+		{
+			Title:    "Dune",
+			People:   []Person{{"Frank Herbert", roleAuthor}},
+			Episodes: []Episode{{FileSize: 1 << 30}},
+			Warnings: []Warning{{warnGenericDescription, "Dune", ""}, {warnMissingTitle, "Dune/01.mp3", ""}},
+		},
+	}
+
+	var b strings.Builder
+	if err := writeStats(&b, podcasts); err != nil {
+		t.Fatal(err)
+	}
+	expected := `EPISODES  RUNTIME  SIZE    BOOK
+2         3:30:00  180.0M  Mistborn 01: The Final Empire
+1         0:00     1.0G    Dune
+
+2 books, 3 episodes, 3:30:00, 1.2G
+
+Missing metadata:
+  books without a narrator: 1
+  books without a cover: 1
+  books without a description: 1
+  episodes without a title: 1
+  episodes without a duration: 1
+`
+	if b.String() != expected {
+		t.Errorf("writeStats() =\n%s\nwant\n%s", b.String(), expected)
+	}
+}
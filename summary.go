@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Warning categories. Each one has a suggested fix in warningFixes.
+const (
+	warnMissingTitle       = "missing-title"
+	warnMissingCover       = "missing-cover"
+	warnGenericDescription = "generic-description"
+	warnDurationMismatch   = "duration-mismatch"
+	warnMissingDuration    = "missing-duration"
+	warnDuplicateFile      = "duplicate-file"
+	warnDuplicateTitle     = "duplicate-title"
+	warnRuntimeMismatch    = "runtime-mismatch"
+)
+
+// Warning is a non-fatal problem found while building a feed.
+type Warning struct {
+	Category string
+	File     string // File or directory the warning is about
+	Message  string
+}
+
+// warningFix describes how to fix a category of warning. Command is a
+// template for a shell command, with %s replaced by the quoted file.
+type warningFix struct {
+	Title   string
+	Command string
+}
+
+var warningFixes = map[string]warningFix{
+	warnMissingTitle:       {"Tag episode titles (MP3)", "id3v2 --song 'Chapter title' %s"},
+	warnMissingCover:       {"Add cover art", "cp /path/to/cover.jpg %s/cover.jpg"},
+	warnGenericDescription: {"Describe the book", "echo 'What the book is about' > %s/description.txt"},
+	warnMissingDuration:    {"Install ffprobe (part of ffmpeg) so the duration of every file can be read", "ffprobe -v error -show_entries format=duration %s"},
+	warnDurationMismatch:   {"Inspect files whose duration sources disagree (remuxing with ffmpeg -c copy usually fixes bad headers)", "mediainfo %s"},
+	warnDuplicateFile:      {"Delete duplicate copies of chapters", "rm %s"},
+	warnDuplicateTitle:     {"Give episodes distinct titles (MP3)", "id3v2 --song 'Chapter title' %s"},
+	warnRuntimeMismatch:    {"Check for missing chapter files, or look up the edition you have", "bookast enrich --force %s"},
+}
+
+// Skipped is a file left out of its feed, because it couldn't be read
+// (--skip-errors) or was filtered out (--min-size, --min-duration).
+type Skipped struct {
+	File       string
+	Reason     string
+	Unreadable bool // Left out by --skip-errors rather than a filter
+}
+
+// FeedResult records a feed written during the run.
+type FeedResult struct {
+	Path     string
+	URL      string
+	Episodes int
+}
+
+// Summary is printed at the end of a run.
+type Summary struct {
+	Books    int
+	Episodes int
+	Feeds    []FeedResult
+	Warnings []Warning
+	Skipped  []Skipped
+}
+
+// Add records a generated podcast in the summary.
+func (s *Summary) Add(podcast *Podcast, path string) {
+	s.Books++
+	s.Episodes += len(podcast.Episodes)
+	s.Feeds = append(s.Feeds, FeedResult{Path: path, URL: podcast.FeedURL, Episodes: len(podcast.Episodes)})
+	s.Warnings = append(s.Warnings, podcast.Warnings...)
+	s.Skipped = append(s.Skipped, podcast.Skipped...)
+}
+
+// Unreadable returns how many files were left out because they couldn't be
+// read.
+func (s *Summary) Unreadable() int {
+	n := 0
+	for _, skipped := range s.Skipped {
+		if skipped.Unreadable {
+			n++
+		}
+	}
+	return n
+}
+
+// Print writes the summary, warnings grouped by category and suggested
+// commands for fixing them.
+func (s *Summary) Print(w io.Writer) {
+	fmt.Fprintf(w, "%s, %s, %s", plural(s.Books, "book"), plural(s.Episodes, "episode"), plural(len(s.Warnings), "warning"))
+	if len(s.Skipped) > 0 {
+		fmt.Fprintf(w, ", %d skipped", len(s.Skipped))
+	}
+	fmt.Fprintln(w)
+
+	if len(s.Feeds) > 0 {
+		fmt.Fprintf(w, "\nFeeds:\n")
+		for _, feed := range s.Feeds {
+			fmt.Fprintf(w, "  %s (%s)\n", feed.Path, plural(feed.Episodes, "episode"))
+			if feed.URL != "" {
+				fmt.Fprintf(w, "    %s\n", feed.URL)
+			}
+		}
+	}
+
+	if len(s.Skipped) > 0 {
+		fmt.Fprintf(w, "\nSkipped:\n")
+		for _, skipped := range s.Skipped {
+			fmt.Fprintf(w, "  %s: %s\n", skipped.File, skipped.Reason)
+		}
+	}
+
+	if len(s.Warnings) == 0 {
+		return
+	}
+
+	byCategory := map[string][]Warning{}
+	var categories []string
+	for _, warning := range s.Warnings {
+		if _, ok := byCategory[warning.Category]; !ok {
+			categories = append(categories, warning.Category)
+		}
+		byCategory[warning.Category] = append(byCategory[warning.Category], warning)
+	}
+	sort.Strings(categories)
+
+	fmt.Fprintf(w, "\nWarnings:\n")
+	for _, category := range categories {
+		warnings := byCategory[category]
+		fmt.Fprintf(w, "  %s (%d)\n", category, len(warnings))
+		for _, warning := range warnings {
+			fmt.Fprintf(w, "    %s: %s\n", warning.File, warning.Message)
+		}
+	}
+
+	fmt.Fprintf(w, "\nNext steps:\n")
+	for _, category := range categories {
+		fix, ok := warningFixes[category]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "  # %s\n", fix.Title)
+		for _, warning := range byCategory[category] {
+			fmt.Fprintf(w, "  "+fix.Command+"\n", shellQuote(warning.File))
+		}
+	}
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// shellQuote quotes s for pasting into a POSIX shell.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummaryPrint(t *testing.T) {
+	summary := &Summary{}
+	summary.Add(&Podcast{
+		FeedURL:  "https://example.com/audiobooks/book/podcast.rss",
+		Episodes: make([]Episode, 2),
+		Warnings: []Warning{
+			{warnMissingTitle, "book/02 track.mp3", "no title tag, using the filename"},
+			{warnMissingCover, "book", "no cover image found"},
+			{warnMissingTitle, "book/01.mp3", "no title tag, using the filename"},
+		},
+	}, "book/podcast.rss")
+
+	var out strings.Builder
+	summary.Print(&out)
+
+	expected := `1 book, 2 episodes, 3 warnings
+
+Feeds:
+  book/podcast.rss (2 episodes)
+    https://example.com/audiobooks/book/podcast.rss
+
+Warnings:
+  missing-cover (1)
+    book: no cover image found
+  missing-title (2)
+    book/02 track.mp3: no title tag, using the filename
+    book/01.mp3: no title tag, using the filename
+
+Next steps:
+  # Add cover art
+  cp /path/to/cover.jpg book/cover.jpg
+  # Tag episode titles (MP3)
+  id3v2 --song 'Chapter title' 'book/02 track.mp3'
+  id3v2 --song 'Chapter title' book/01.mp3
+`
+	if out.String() != expected {
+		t.Errorf("Print() =\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+func TestSummaryPrintNoWarnings(t *testing.T) {
+	summary := &Summary{}
+	summary.Add(&Podcast{Episodes: make([]Episode, 1)}, "book/podcast.rss")
+
+	var out strings.Builder
+	summary.Print(&out)
+
+	if strings.Contains(out.String(), "Next steps") {
+		t.Errorf("Print() without warnings printed next steps:\n%s", out.String())
+	}
+	if !strings.HasPrefix(out.String(), "1 book, 1 episode, 0 warnings\n") {
+		t.Errorf("Print() header = %q", strings.SplitN(out.String(), "\n", 2)[0])
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"book/01.mp3", "book/01.mp3"},
+		{"my book/01.mp3", "'my book/01.mp3'"},
+		{"it's.mp3", `'it'\''s.mp3'`},
+		{"", "''"},
+	}
+
+	for _, tt := range tests {
+		if result := shellQuote(tt.input); result != tt.expected {
+			t.Errorf("shellQuote(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestSummaryPrintSkipped(t *testing.T) {
+	summary := &Summary{}
+	summary.Add(&Podcast{
+		Episodes: make([]Episode, 1),
+		Skipped:  []Skipped{{File: "book/02.mp3", Reason: "failed to get duration: truncated"}},
+	}, "book/podcast.rss")
+
+	var out strings.Builder
+	summary.Print(&out)
+
+	expected := `1 book, 1 episode, 0 warnings, 1 skipped
+
+Feeds:
+  book/podcast.rss (1 episode)
+
+Skipped:
+  book/02.mp3: failed to get duration: truncated
+`
+	if out.String() != expected {
+		t.Errorf("Print() =\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+func TestSummaryUnreadable(t *testing.T) {
+	s := &Summary{Skipped: []Skipped{
+		{File: "book/00.mp3", Reason: "0 bytes, smaller than --min-size 1.0K"},
+		{File: "book/02.mp3", Reason: "corrupt or truncated", Unreadable: true},
+	}}
+	if got := s.Unreadable(); got != 1 {
+		t.Errorf("Unreadable() = %d, want 1", got)
+	}
+}
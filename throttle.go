@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate events a second on average, in bursts of up to
+// burst. It's safe for concurrent use.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// refill adds the tokens earned since the last call. b.mu must be held.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// allow takes one token if there is one, else returns how long until there
+// will be.
+func (b *tokenBucket) allow(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// reserve takes n tokens, going into debt if need be, and returns how long
+// to wait before using them.
+func (b *tokenBucket) reserve(n float64, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled completely, so forgetting it
+// changes nothing.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// parseBandwidth parses --max-bandwidth: a parseByteSize size a second,
+// e.g. 20MBps, 20MB/s or 500K.
+func parseBandwidth(s string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	lower = strings.TrimSuffix(strings.TrimSuffix(lower, "/s"), "ps")
+	n, err := parseByteSize(lower)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q, want e.g. 20MBps", s)
+	}
+	return n, nil
+}
+
+// throttleChunk is the most written in one go under a bandwidth cap, so
+// concurrent downloads take turns.
+const throttleChunk = 32 << 10
+
+// throttledResponse writes no faster than its bucket allows. It doesn't
+// have ReadFrom, so file copies come through Write in chunks instead of
+// going to sendfile unthrottled.
+type throttledResponse struct {
+	http.ResponseWriter
+	bucket *tokenBucket
+}
+
+func (w *throttledResponse) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), throttleChunk)]
+		time.Sleep(w.bucket.reserve(float64(len(chunk)), time.Now()))
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (w *throttledResponse) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// limitBandwidth wraps h so all its responses together are sent at no more
+// than bytesPerSecond.
+func limitBandwidth(h http.Handler, bytesPerSecond int64) http.Handler {
+	// A second's worth of burst keeps small responses, like feeds, quick
+	bucket := newTokenBucket(float64(bytesPerSecond), float64(bytesPerSecond), time.Now())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&throttledResponse{ResponseWriter: w, bucket: bucket}, r)
+	})
+}
+
+// clientLimiter limits each client to perMinute requests a minute, in
+// bursts of up to as many.
+type clientLimiter struct {
+	perMinute int
+
+	mu      sync.Mutex
+	clients map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newClientLimiter(perMinute int) *clientLimiter {
+	return &clientLimiter{perMinute: perMinute, clients: map[string]*tokenBucket{}}
+}
+
+// allow reports whether client may make a request now, else how long until
+// it may.
+func (l *clientLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	// Clients whose buckets are full again are forgotten now and then, or
+	// the map grows with every address ever seen
+	if now.Sub(l.swept) > time.Minute {
+		for addr, bucket := range l.clients {
+			if bucket.full(now) {
+				delete(l.clients, addr)
+			}
+		}
+		l.swept = now
+	}
+	bucket := l.clients[client]
+	if bucket == nil {
+		bucket = newTokenBucket(float64(l.perMinute)/60, float64(l.perMinute), now)
+		l.clients[client] = bucket
+	}
+	l.mu.Unlock()
+	return bucket.allow(now)
+}
+
+// limitRequests wraps h so clients making more than l allows get 429 Too
+// Many Requests. Clients are told apart by filteredAddr, so a remote one
+// can't make up an X-Forwarded-For for every request to get a fresh bucket.
+func limitRequests(h http.Handler, l *clientLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			client = host
+		}
+		if addr, ok := filteredAddr(r); ok {
+			client = addr.String()
+		}
+		if ok, wait := l.allow(client, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
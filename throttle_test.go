@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	b := newTokenBucket(2, 3, start)
+	for i := range 3 {
+		if ok, _ := b.allow(start); !ok {
+			t.Fatalf("allow #%d = false within the burst", i+1)
+		}
+	}
+	if ok, wait := b.allow(start); ok || wait != 500*time.Millisecond {
+		t.Errorf("allow past the burst = %v, %v; want false, 500ms", ok, wait)
+	}
+	if ok, _ := b.allow(start.Add(500 * time.Millisecond)); !ok {
+		t.Error("allow after refilling one token = false")
+	}
+	if b.full(start.Add(time.Second)) {
+		t.Error("full after 1s = true, want false")
+	}
+	if !b.full(start.Add(10 * time.Second)) {
+		t.Error("full after 10s = false, want true")
+	}
+
+	b = newTokenBucket(100, 100, start)
+	if wait := b.reserve(100, start); wait != 0 {
+		t.Errorf("reserve(burst) wait = %v, want 0", wait)
+	}
+	if wait := b.reserve(50, start); wait != 500*time.Millisecond {
+		t.Errorf("reserve past the burst wait = %v, want 500ms", wait)
+	}
+	if wait := b.reserve(50, start); wait != time.Second {
+		t.Errorf("reserve deeper in debt wait = %v, want 1s", wait)
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"20MBps", 20 << 20},
+		{"20MB/s", 20 << 20},
+		{"500k", 500 << 10},
+		{"1.5Mps", 3 << 19},
+		{"4096", 4096},
+	}
+	for _, tt := range tests {
+		got, err := parseBandwidth(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseBandwidth(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "fast", "0", "-1MBps"} {
+		if _, err := parseBandwidth(bad); err == nil {
+			t.Errorf("parseBandwidth(%q) error = nil, want error", bad)
+		}
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	h := limitRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), newClientLimiter(2))
+	get := func(remote, forwardedFor string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/Book/podcast.rss", nil)
+		r.RemoteAddr = remote
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := range 2 {
+		if w := get("192.168.1.20:5000", ""); w.Code != http.StatusOK {
+			t.Fatalf("request #%d status = %d, want 200", i+1, w.Code)
+		}
+	}
+	w := get("192.168.1.20:5001", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("third request = %d, Retry-After %q; want 429, 30", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := get("192.168.1.21:5000", ""); w.Code != http.StatusOK {
+		t.Errorf("other client's status = %d, want 200", w.Code)
+	}
+
+	// A remote client can't pass for others with X-Forwarded-For
+	if w := get("192.168.1.20:5002", "10.9.9.9"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request with a made-up X-Forwarded-For = %d, want 429", w.Code)
+	}
+
+	// Behind a proxy every request comes from it, clients are told apart
+	// by X-Forwarded-For
+	for _, client := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if w := get("127.0.0.1:9000", client); w.Code != http.StatusOK {
+			t.Errorf("proxied request for %s status = %d, want 200", client, w.Code)
+		}
+	}
+}
+
+func TestClientLimiterForgetsIdleClients(t *testing.T) {
+	l := newClientLimiter(60)
+	start := time.Now()
+	l.allow("192.168.1.20", start)
+	l.allow("192.168.1.21", start.Add(90*time.Second))
+	if _, ok := l.clients["192.168.1.20"]; ok {
+		t.Error("client idle for 90s still remembered")
+	}
+	if _, ok := l.clients["192.168.1.21"]; !ok {
+		t.Error("client that just made a request forgotten")
+	}
+}
+
+func TestLimitBandwidth(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 3*throttleChunk)
+	h := limitBandwidth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}), 2*throttleChunk)
+
+	// The first second's worth goes at once, the rest at the cap
+	start := time.Now()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/Book/chapter01.mp3", nil))
+	if !bytes.Equal(w.Body.Bytes(), body) {
+		t.Fatalf("body is %d bytes, want %d", w.Body.Len(), len(body))
+	}
+	if took := time.Since(start); took < 400*time.Millisecond {
+		t.Errorf("1.5s worth of bytes sent in %v, want about 500ms", took)
+	}
+}
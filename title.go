@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// TitleData is the data passed to --title-template for each episode.
+type TitleData struct {
+	Title    string // Cleaned title (or raw title with --raw-titles)
+	RawTitle string // Title exactly as read from tags or filename
+	Number   int    // Episode number in feed order
+	Track    int    // Track number from tags, 0 if not tagged
+	Book     string // Book (podcast) title
+	Filename string // Filename without extension
+}
+
+var (
+	// "07 - ", "07.", "(07) ", "[07] ", "07_"
+	leadingTrackNumRe = regexp.MustCompile(`^\s*(?:[\(\[]\d{1,4}[\)\]]\s*[-–—._:]*|\d{1,4}\s*[-–—._:)\]]+)\s*`)
+	// "07 Chapter 7" (zero-padded numbers followed by a space)
+	leadingPaddedNumRe = regexp.MustCompile(`^\s*0\d{0,3}\s+`)
+	// "Track 07", "Track07 - "
+	trackJunkRe = regexp.MustCompile(`(?i)^\s*(audio\s*)?track\s*\d+\s*([-–—._:]+\s*|$)`)
+	separatorRe = regexp.MustCompile(`^\s*[-–—._:]+\s*`)
+)
+
+// cleanTitle strips common junk from episode titles: leading track numbers,
+// a leading book title, and "Track 07" style prefixes. If nothing meaningful
+// remains, it falls back to "Chapter N" (or "Trailer" for unnumbered
+// episodes).
+func cleanTitle(title string, bookTitles []string, number int) string {
+	cleaned := strings.TrimSpace(title)
+
+	// Prefixes can be stacked ("07 - MyBook - Chapter 7"), so strip until
+	// nothing changes.
+	for {
+		before := cleaned
+		cleaned = trackJunkRe.ReplaceAllString(cleaned, "")
+		cleaned = leadingTrackNumRe.ReplaceAllString(cleaned, "")
+		cleaned = leadingPaddedNumRe.ReplaceAllString(cleaned, "")
+		for _, book := range bookTitles {
+			cleaned = stripPrefixFold(cleaned, book)
+		}
+		cleaned = strings.TrimSpace(cleaned)
+		if cleaned == before {
+			break
+		}
+	}
+
+	if cleaned == "" || isDigits(cleaned) {
+		if number == 0 {
+			return "Trailer"
+		}
+		return fmt.Sprintf("Chapter %d", number)
+	}
+	return cleaned
+}
+
+// stripPrefixFold removes prefix (case-insensitively) from s when it is
+// followed by a separator, so "MyBook - Chapter 7" loses "MyBook" but
+// "MyBookish" is left alone.
+func stripPrefixFold(s, prefix string) string {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || len(s) <= len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s
+	}
+	rest := s[len(prefix):]
+	if loc := separatorRe.FindStringIndex(rest); loc != nil {
+		return rest[loc[1]:]
+	}
+	return s
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// applyTitles rewrites episode titles using the built-in cleanup and the
+// optional title template.
+func applyTitles(podcast *Podcast, opts Options) error {
+	for i := range podcast.Episodes {
+		ep := &podcast.Episodes[i]
+
+		bookTitles := []string{podcast.Title}
+		if ep.Album != "" {
+			bookTitles = append(bookTitles, ep.Album)
+		}
+
+		title := ep.Title
+		if !opts.RawTitles {
+			title = cleanTitle(title, bookTitles, ep.EpisodeNum)
+		}
+
+		if opts.TitleTemplate != nil {
+			filename := filepath.Base(ep.FilePath)
+			data := TitleData{
+				Title:    title,
+				RawTitle: ep.Title,
+				Number:   ep.EpisodeNum,
+				Track:    ep.Track,
+				Book:     podcast.Title,
+				Filename: strings.TrimSuffix(filename, filepath.Ext(filename)),
+			}
+			var buf bytes.Buffer
+			if err := opts.TitleTemplate.Execute(&buf, data); err != nil {
+				return fmt.Errorf("title template failed for %s: %v", filename, err)
+			}
+			title = strings.TrimSpace(buf.String())
+		}
+
+		setTitle(ep, title)
+	}
+
+	podcast.Warnings = append(podcast.Warnings, disambiguateTitles(podcast, opts.RawTitles)...)
+	return nil
+}
+
+// setTitle changes an episode's title.
+func setTitle(ep *Episode, title string) {
+	// The description falls back to the title, keep them in sync
+	if ep.Description == ep.Title {
+		ep.Description = title
+	}
+	ep.Title = title
+}
+
+// disambiguateTitles renames episodes that share a title, which many rips
+// give every file ("Unknown Track"). Titles made from the filenames are used
+// when they tell the episodes apart; otherwise the episode number is
+// appended. It returns a warning for each renamed episode.
+func disambiguateTitles(podcast *Podcast, raw bool) []Warning {
+	groups := map[string][]int{}
+	var keys []string
+	for i, ep := range podcast.Episodes {
+		key := strings.ToLower(ep.Title)
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	var warnings []Warning
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+
+		shared := podcast.Episodes[group[0]].Title
+		titles := make([]string, len(group))
+		seen := map[string]bool{}
+		fromFilenames := true
+		for j, i := range group {
+			ep := &podcast.Episodes[i]
+			filename := filepath.Base(ep.FilePath)
+			title := strings.TrimSuffix(filename, filepath.Ext(filename))
+			if !raw {
+				title = cleanTitle(title, []string{podcast.Title, ep.Album}, ep.EpisodeNum)
+			}
+			lower := strings.ToLower(title)
+			// Taking another episode's title would just move the collision
+			if title == "" || lower == key || seen[lower] || (groups[lower] != nil && lower != key) {
+				fromFilenames = false
+				break
+			}
+			seen[lower] = true
+			titles[j] = title
+		}
+		if !fromFilenames {
+			for j, i := range group {
+				n := podcast.Episodes[i].EpisodeNum
+				if n == 0 {
+					n = j + 1
+				}
+				titles[j] = fmt.Sprintf("%s (%d)", shared, n)
+			}
+		}
+
+		for j, i := range group {
+			ep := &podcast.Episodes[i]
+			warnings = append(warnings, Warning{warnDuplicateTitle, ep.FilePath, fmt.Sprintf("%d episodes are titled %q, published as %q", len(group), shared, titles[j])})
+			setTitle(ep, titles[j])
+		}
+	}
+	return warnings
+}
+
+// parseTitleTemplate parses a --title-template value.
+func parseTitleTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("title").Option("missingkey=error").Parse(text)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		name       string
+		title      string
+		bookTitles []string
+		number     int
+		expected   string
+	}{
+		{
+			name:     "already clean",
+			title:    "Chapter Seven: The Storm",
+			number:   7,
+			expected: "Chapter Seven: The Storm",
+		},
+		{
+			name:       "track number and book prefix",
+			title:      "07 - MyBook - Chapter 7",
+			bookTitles: []string{"MyBook"},
+			number:     7,
+			expected:   "Chapter 7",
+		},
+		{
+			name:     "dotted track number",
+			title:    "03. The Long Road",
+			number:   3,
+			expected: "The Long Road",
+		},
+		{
+			name:     "bracketed track number",
+			title:    "[12] Epilogue",
+			number:   12,
+			expected: "Epilogue",
+		},
+		{
+			name:     "zero padded number without separator",
+			title:    "007 Chapter Seven",
+			number:   7,
+			expected: "Chapter Seven",
+		},
+		{
+			name:       "book prefix is case insensitive",
+			title:      "mybook - Prologue",
+			bookTitles: []string{"MyBook"},
+			number:     1,
+			expected:   "Prologue",
+		},
+		{
+			name:       "book prefix without separator is kept",
+			title:      "MyBookish Tales",
+			bookTitles: []string{"MyBook"},
+			number:     1,
+			expected:   "MyBookish Tales",
+		},
+		{
+			name:     "track junk prefix",
+			title:    "Track 07 - The Storm",
+			number:   7,
+			expected: "The Storm",
+		},
+		{
+			name:     "track junk only",
+			title:    "Track 07",
+			number:   7,
+			expected: "Chapter 7",
+		},
+		{
+			name:     "number only",
+			title:    "07",
+			number:   7,
+			expected: "Chapter 7",
+		},
+		{
+			name:     "unpadded number without separator is kept",
+			title:    "7 Habits",
+			number:   1,
+			expected: "7 Habits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := cleanTitle(tt.title, tt.bookTitles, tt.number)
+			if result != tt.expected {
+				t.Errorf("cleanTitle(%q) = %q, want %q", tt.title, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyTitles(t *testing.T) {
+	tmpl, err := parseTitleTemplate("{{.Number}}. {{.Title}} ({{.Book}})")
+	if err != nil {
+		t.Fatalf("parseTitleTemplate() error = %v", err)
+	}
+
+	podcast := &Podcast{
+		Title: "MyBook",
+		Episodes: []Episode{
+			{Title: "01 - MyBook - Prologue", Description: "01 - MyBook - Prologue", FilePath: "01.mp3", EpisodeNum: 1},
+			{Title: "Track 02", Description: "A dark night", FilePath: "02.mp3", EpisodeNum: 2},
+		},
+	}
+
+	if err := applyTitles(podcast, Options{TitleTemplate: tmpl}); err != nil {
+		t.Fatalf("applyTitles() error = %v", err)
+	}
+
+	expected := []struct{ title, desc string }{
+		{"1. Prologue (MyBook)", "1. Prologue (MyBook)"},
+		{"2. Chapter 2 (MyBook)", "A dark night"},
+	}
+	for i, ep := range podcast.Episodes {
+		if ep.Title != expected[i].title {
+			t.Errorf("Episode[%d].Title = %q, want %q", i, ep.Title, expected[i].title)
+		}
+		if ep.Description != expected[i].desc {
+			t.Errorf("Episode[%d].Description = %q, want %q", i, ep.Description, expected[i].desc)
+		}
+	}
+}
+
+func TestDisambiguateTitles(t *testing.T) {
+	episode := func(title, file string, num int) Episode {
+		return Episode{Title: title, Description: title, FilePath: file, EpisodeNum: num}
+	}
+
+	tests := []struct {
+		name     string
+		episodes []Episode
+		expected []string
+	}{
+		{
+			name:     "distinct titles untouched",
+			episodes: []Episode{episode("Prologue", "01.mp3", 1), episode("The Road", "02.mp3", 2)},
+			expected: []string{"Prologue", "The Road"},
+		},
+		{
+			name:     "filenames tell them apart",
+			episodes: []Episode{episode("Unknown Track", "01 - Prologue.mp3", 1), episode("Unknown Track", "02 - The Road.mp3", 2), episode("Epilogue", "03.mp3", 3)},
+			expected: []string{"Prologue", "The Road", "Epilogue"},
+		},
+		{
+			name:     "number-only filenames become chapters",
+			episodes: []Episode{episode("unknown track", "01.mp3", 1), episode("Unknown Track", "02.mp3", 2)},
+			expected: []string{"Chapter 1", "Chapter 2"},
+		},
+		{
+			name:     "filename that is another episode's title",
+			episodes: []Episode{episode("Side A", "Epilogue.mp3", 1), episode("Side A", "Side B.mp3", 2), episode("Epilogue", "03.mp3", 3)},
+			expected: []string{"Side A (1)", "Side A (2)", "Epilogue"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := make([]string, len(tt.episodes))
+			for i, ep := range tt.episodes {
+				before[i] = ep.Title
+			}
+			podcast := &Podcast{Title: "MyBook", Episodes: tt.episodes}
+			warnings := disambiguateTitles(podcast, false)
+
+			renamed := 0
+			for i, ep := range podcast.Episodes {
+				if ep.Title != tt.expected[i] {
+					t.Errorf("Episode[%d].Title = %q, want %q", i, ep.Title, tt.expected[i])
+				}
+				if ep.Description != ep.Title {
+					t.Errorf("Episode[%d].Description = %q, want it to follow the title", i, ep.Description)
+				}
+				if before[i] != tt.expected[i] {
+					renamed++
+				}
+			}
+			if len(warnings) != renamed {
+				t.Errorf("got %d warnings, want %d", len(warnings), renamed)
+			}
+		})
+	}
+}
+
+func TestParseTitleTemplateInvalid(t *testing.T) {
+	if _, err := parseTitleTemplate("{{.Title"); err == nil {
+		t.Error("parseTitleTemplate() error = nil, want error for unterminated action")
+	}
+}
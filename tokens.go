@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// tokensFile holds a library's subscriber tokens, in the directory given to
+// bookast serve.
+const tokensFile = ".bookast-tokens.json"
+
+// subscriber is someone given their own private URLs. Their token opens
+// every book in the library under /f/<token>/.
+type subscriber struct {
+	Name    string    `json:"name"`
+	Token   string    `json:"token"`
+	Created time.Time `json:"created"`
+}
+
+// newToken returns a new secret for private feed URLs.
+func newToken() (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// loadSubscribers reads the tokens file from dir. A missing file is no
+// subscribers.
+func loadSubscribers(dir string) ([]subscriber, error) {
+	content, err := os.ReadFile(filepath.Join(dir, tokensFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var subscribers []subscriber
+	if err := json.Unmarshal(content, &subscribers); err != nil {
+		return nil, fmt.Errorf("%s: %v", tokensFile, err)
+	}
+	return subscribers, nil
+}
+
+// saveSubscribers writes the tokens file to dir.
+func saveSubscribers(dir string, subscribers []subscriber) error {
+	if subscribers == nil {
+		subscribers = []subscriber{}
+	}
+	data, err := json.MarshalIndent(subscribers, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSecretFileIfChanged(filepath.Join(dir, tokensFile), append(data, '\n'))
+}
+
+// createSubscriber gives name a token in the library in dir.
+func createSubscriber(dir string, name string) (subscriber, error) {
+	subscribers, err := loadSubscribers(dir)
+	if err != nil {
+		return subscriber{}, err
+	}
+	for _, s := range subscribers {
+		if s.Name == name {
+			return subscriber{}, fmt.Errorf("%s already has a token, revoke it first to make a new one", name)
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return subscriber{}, err
+	}
+	s := subscriber{Name: name, Token: token, Created: time.Now().UTC().Truncate(time.Second)}
+	if err := saveSubscribers(dir, append(subscribers, s)); err != nil {
+		return subscriber{}, fmt.Errorf("failed to save %s: %v", tokensFile, err)
+	}
+	return s, nil
+}
+
+// revokeSubscriber removes name's token from the library in dir.
+func revokeSubscriber(dir string, name string) error {
+	subscribers, err := loadSubscribers(dir)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(subscribers, func(s subscriber) bool { return s.Name == name })
+	if i < 0 {
+		return fmt.Errorf("%s has no token", name)
+	}
+	if err := saveSubscribers(dir, slices.Delete(subscribers, i, i+1)); err != nil {
+		return fmt.Errorf("failed to save %s: %v", tokensFile, err)
+	}
+	return nil
+}
+
+// printSubscribers writes a table of subscribers to w.
+func printSubscribers(w io.Writer, subscribers []subscriber) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCREATED\tTOKEN")
+	for _, s := range subscribers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, s.Created.Local().Format("2006-01-02 15:04"), s.Token)
+	}
+	tw.Flush()
+}
+
+// runToken implements "bookast token create|list|revoke", which manages the
+// subscriber tokens bookast serve --private accepts.
+func runToken(args []string) int {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	baseURL := fs.String("base-url", "", "URL of the server, to print whole feed URLs (default: print their paths)")
+	layout := fs.String("layout", "", "The library is laid out like audiobookshelf (Author/[Series/]Book), as served")
+	format := fs.String("format", "rss", "Feed format served: rss, atom or jsonfeed")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s token create [flags] <name> <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s token list <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s token revoke <name> <directory>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return 1
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 1
+	}
+
+	want := map[string]int{"create": 2, "list": 1, "revoke": 2}[action]
+	if want == 0 || fs.NArg() != want {
+		fs.Usage()
+		return 1
+	}
+	dir, err := filepath.Abs(fs.Arg(want - 1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch action {
+	case "create":
+		output, ok := feedFormats[*format]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: --format must be rss, atom or jsonfeed, not %q\n", *format)
+			return 1
+		}
+		books, err := findBooks(dir, *layout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		s, err := createSubscriber(dir, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Feeds for %s:\n", s.Name)
+		origin := strings.TrimSuffix(*baseURL, "/") + "/f/" + s.Token
+		for _, book := range books {
+			fmt.Printf("  %s\n", buildURL(book.baseURL(origin), book.Dir, output.Filename))
+		}
+	case "list":
+		subscribers, err := loadSubscribers(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		printSubscribers(os.Stdout, subscribers)
+	case "revoke":
+		if err := revokeSubscriber(dir, fs.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Revoked %s's token\n", fs.Arg(0))
+	}
+	return 0
+}
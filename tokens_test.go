@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSubscribers(t *testing.T) {
+	dir := t.TempDir()
+
+	if subscribers, err := loadSubscribers(dir); err != nil || len(subscribers) != 0 {
+		t.Fatalf("loadSubscribers() without a file = %v, %v, want none", subscribers, err)
+	}
+
+	alice, err := createSubscriber(dir, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := createSubscriber(dir, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alice.Token) < 20 || alice.Token == bob.Token {
+		t.Errorf("tokens %q and %q, want distinct secrets", alice.Token, bob.Token)
+	}
+	if _, err := createSubscriber(dir, "alice"); err == nil {
+		t.Error("createSubscriber(alice) twice error = nil, want error")
+	}
+
+	if err := revokeSubscriber(dir, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := revokeSubscriber(dir, "alice"); err == nil {
+		t.Error("revokeSubscriber(alice) twice error = nil, want error")
+	}
+	subscribers, err := loadSubscribers(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subscribers) != 1 || subscribers[0] != bob {
+		t.Errorf("subscribers after revoking alice = %v, want only %v", subscribers, bob)
+	}
+
+	var buf bytes.Buffer
+	printSubscribers(&buf, subscribers)
+	if out := buf.String(); !strings.Contains(out, "bob") || !strings.Contains(out, bob.Token) || strings.Contains(out, "alice") {
+		t.Errorf("printSubscribers() =\n%s\nwant bob and their token only", out)
+	}
+}
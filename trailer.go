@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// trailerBaseName is the name of the generated trailer, without extension.
+// It matches the trailer filename pattern, so the file is still published as
+// a trailer on later runs without --trailer.
+const trailerBaseName = "bookast-trailer"
+
+// ensureTrailer clips the first length of source into a trailer file next to
+// it, reusing an existing trailer that is newer than the source and was
+// clipped to length, which the state file remembers. It returns the
+// trailer's filename, "" in a dry run when there's no trailer yet.
+func ensureTrailer(dir string, source string, length time.Duration, bookTitle string) (string, error) {
+	srcPath := filepath.Join(dir, source)
+	filename := trailerBaseName + strings.ToLower(filepath.Ext(source))
+	dstPath := filepath.Join(dir, filename)
+
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return "", err
+	}
+	state, err := loadBookState(dir)
+	if err != nil {
+		return "", err
+	}
+	dstInfo, err := os.Stat(dstPath)
+	if err == nil && !dstInfo.ModTime().Before(srcInfo.ModTime()) && state.TrailerLength == length.String() {
+		return filename, nil
+	}
+	if planFFmpeg(dstPath) {
+		if err != nil {
+			return "", nil
+		}
+		return filename, nil
+	}
+
+	err = clipAudio(srcPath, dstPath, length,
+		"title=Trailer",
+		fmt.Sprintf("comment=The first %s of %s", formatDuration(length), bookTitle))
+	if err != nil {
+		os.Remove(dstPath)
+		return "", fmt.Errorf("failed to create trailer from %s: %w", source, err)
+	}
+	state.TrailerLength = length.String()
+	if err := saveBookState(dir, state); err != nil {
+		return "", fmt.Errorf("failed to save %s: %v", stateFile, err)
+	}
+	return filename, nil
+}
+
+// clipAudio copies the first length of src's audio into dst without
+// re-encoding, replacing its tags with metadata ("key=value").
+func clipAudio(src string, dst string, length time.Duration, metadata ...string) error {
+	args := []string{"-v", "error", "-y", "-i", src, "-t", fmt.Sprintf("%.3f", length.Seconds()),
+		"-map", "0:a", "-c", "copy", "-map_metadata", "-1"}
+	for _, m := range metadata {
+		args = append(args, "-metadata", m)
+	}
+	args = append(args, dst)
+	return runFFmpeg(args...)
+}
+
+// runFFmpeg runs ffmpeg, including its error output in the error. Callers
+// on the scan path check planFFmpeg first, it never runs in a dry run.
+func runFFmpeg(args ...string) error {
+	if dryRun != nil {
+		return fmt.Errorf("ffmpeg would write %s, which --dry-run can't do; run without --dry-run first", args[len(args)-1])
+	}
+	output, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddTrailerReusesExistingTrailer(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"00-intro.mp3", "01.mp3", "02.mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A trailer newer than its source, of the same length, is reused, so
+	// ffmpeg never runs
+	if err := saveBookState(dir, &BookState{TrailerLength: "1m30s"}); err != nil {
+		t.Fatal(err)
+	}
+	trailerPath := filepath.Join(dir, trailerBaseName+".mp3")
+	if err := os.WriteFile(trailerPath, []byte("trailer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(trailerPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	audioFiles := []string{"00-intro.mp3", "01.mp3", "02.mp3", trailerBaseName + ".mp3"}
+	result, err := addTrailer(dir, audioFiles, 90*time.Second, "Book", &BookConfig{})
+	if err != nil {
+		t.Fatalf("addTrailer() error = %v", err)
+	}
+
+	expected := []string{trailerBaseName + ".mp3", "00-intro.mp3", "01.mp3", "02.mp3"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("addTrailer() = %v, want %v", result, expected)
+	}
+
+	if got := episodeType(result[0], &BookConfig{}); got != "trailer" {
+		t.Errorf("episodeType(%q) = %q, want trailer", result[0], got)
+	}
+}
+
+func TestEnsureTrailerLengthChanged(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"01.mp3": "audio", trailerBaseName + ".mp3": "90s trailer"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, trailerBaseName+".mp3"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveBookState(dir, &BookState{TrailerLength: "1m30s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Newer than its source, but --trailer asks for a longer one now
+	dryRun = &dryRunPlan{}
+	defer func() { dryRun = nil }()
+	if _, err := ensureTrailer(dir, "01.mp3", 3*time.Minute, "Book"); err != nil {
+		t.Fatalf("ensureTrailer() error = %v", err)
+	}
+	if len(dryRun.writes) != 1 || !dryRun.writes[0].FFmpeg || filepath.Base(dryRun.writes[0].Path) != trailerBaseName+".mp3" {
+		t.Errorf("planned writes = %+v, want the trailer clipped again", dryRun.writes)
+	}
+}
+
+func TestAddTrailerWithoutFullEpisode(t *testing.T) {
+	if _, err := addTrailer(t.TempDir(), []string{"00-intro.mp3"}, time.Minute, "Book", &BookConfig{}); err == nil {
+		t.Error("addTrailer() error = nil, want error when there's nothing to clip")
+	}
+}
+
+func TestEnsureTrailer(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	dir := t.TempDir()
+	src, err := os.ReadFile("testdata/audiobook1/chapter02.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "chapter02.mp3"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filename, err := ensureTrailer(dir, "chapter02.mp3", time.Second, "Book")
+	if err != nil {
+		t.Fatalf("ensureTrailer() error = %v", err)
+	}
+
+	episode, err := processAudioFile(filepath.Join(dir, filename), "https://example.com", dir, time.Now(), 0)
+	if err != nil {
+		t.Fatalf("processAudioFile() error = %v", err)
+	}
+	if episode.Title != "Trailer" {
+		t.Errorf("Title = %q, want %q", episode.Title, "Trailer")
+	}
+	if episode.Duration > 1500*time.Millisecond {
+		t.Errorf("Duration = %v, want about 1s", episode.Duration)
+	}
+}
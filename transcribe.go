@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Whisper implementations bookast knows how to drive.
+const (
+	engineWhisperCpp = "whisper.cpp"
+	engineOpenAI     = "openai"
+)
+
+// transcriber runs a Whisper implementation over audio files.
+type transcriber struct {
+	Engine   string // engineWhisperCpp or engineOpenAI
+	Binary   string
+	Model    string // ggml model path for whisper.cpp, model name for openai
+	Language string // Empty for the engine's default
+}
+
+// Transcribe writes a WebVTT transcript of audioPath to vttPath. Whisper
+// writes into a scratch directory next to vttPath first, so an interrupted
+// run never leaves a partial transcript that the feed would publish.
+func (t transcriber) Transcribe(audioPath string, vttPath string) error {
+	scratch, err := os.MkdirTemp(filepath.Dir(vttPath), ".bookast-transcribe-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+
+	var output string
+	switch t.Engine {
+	case engineWhisperCpp:
+		// whisper.cpp only reads 16kHz WAV
+		wav := filepath.Join(scratch, "audio.wav")
+		out, err := exec.Command("ffmpeg", "-v", "error", "-y", "-i", audioPath, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wav).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		output = filepath.Join(scratch, "transcript.vtt")
+		if err := t.run(t.args(wav, strings.TrimSuffix(output, ".vtt"))); err != nil {
+			return err
+		}
+	case engineOpenAI:
+		base := filepath.Base(audioPath)
+		output = filepath.Join(scratch, strings.TrimSuffix(base, filepath.Ext(base))+".vtt")
+		if err := t.run(t.args(audioPath, scratch)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown engine %q", t.Engine)
+	}
+
+	if _, err := os.Stat(output); err != nil {
+		return fmt.Errorf("%s wrote no transcript", t.Binary)
+	}
+	return os.Rename(output, vttPath)
+}
+
+// args builds the command line for transcribing input. output is the output
+// path without extension for whisper.cpp and the output directory for openai.
+func (t transcriber) args(input string, output string) []string {
+	if t.Engine == engineWhisperCpp {
+		args := []string{"-m", t.Model, "-f", input, "-ovtt", "-of", output, "-np"}
+		if t.Language != "" {
+			args = append(args, "-l", t.Language)
+		}
+		return args
+	}
+
+	args := []string{input, "--output_format", "vtt", "--output_dir", output, "--verbose", "False"}
+	if t.Model != "" {
+		args = append(args, "--model", t.Model)
+	}
+	if t.Language != "" {
+		args = append(args, "--language", t.Language)
+	}
+	return args
+}
+
+func (t transcriber) run(args []string) error {
+	output, err := exec.Command(t.Binary, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %v: %s", t.Binary, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// runTranscribe implements "bookast transcribe", which writes a .vtt next to
+// every episode so the next feed generation publishes it as a transcript.
+func runTranscribe(args []string) int {
+	fs := flag.NewFlagSet("transcribe", flag.ContinueOnError)
+	var t transcriber
+	var force bool
+	fs.StringVar(&t.Engine, "engine", engineWhisperCpp, "Whisper implementation: whisper.cpp or openai")
+	fs.StringVar(&t.Binary, "whisper", "", "Whisper binary (default: whisper-cli for whisper.cpp, whisper for openai)")
+	fs.StringVar(&t.Model, "model", "", "Model: path to a ggml model for whisper.cpp (required), model name for openai (default: the engine's)")
+	fs.StringVar(&t.Language, "language", "", "Spoken language, e.g. en or auto (default: the engine's)")
+	fs.BoolVar(&force, "force", false, "Transcribe episodes that already have a .vtt transcript")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s transcribe [flags] <directory>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	switch t.Engine {
+	case engineWhisperCpp:
+		if t.Binary == "" {
+			t.Binary = "whisper-cli"
+		}
+		if t.Model == "" {
+			fmt.Fprintf(os.Stderr, "Error: --model is required for whisper.cpp (path to a ggml model file)\n")
+			return 1
+		}
+	case engineOpenAI:
+		if t.Binary == "" {
+			t.Binary = "whisper"
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --engine must be whisper.cpp or openai, not %q\n", t.Engine)
+		return 1
+	}
+
+	if _, err := exec.LookPath(t.Binary); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s not found, install it or point --whisper at it\n", t.Binary)
+		return 1
+	}
+
+	directory := fs.Arg(0)
+	audioFiles, err := listAudioFiles(directory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		return 1
+	}
+	if len(audioFiles) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No audio files found in directory '%s'\n", directory)
+		return 1
+	}
+
+	transcribed, skipped := 0, 0
+	for i, filename := range audioFiles {
+		vttPath := filepath.Join(directory, strings.TrimSuffix(filename, filepath.Ext(filename))+".vtt")
+		if _, err := os.Stat(vttPath); err == nil && !force {
+			skipped++
+			continue
+		}
+
+		fmt.Printf("Transcribing %s (%d/%d)\n", filename, i+1, len(audioFiles))
+		if err := t.Transcribe(filepath.Join(directory, filename), vttPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error transcribing %s: %v\n", filename, err)
+			return 1
+		}
+		transcribed++
+	}
+
+	fmt.Printf("%s transcribed, %d already had transcripts\n", plural(transcribed, "episode"), skipped)
+	return 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTranscriberArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        transcriber
+		expected []string
+	}{
+		{
+			name:     "whisper.cpp",
+			t:        transcriber{Engine: engineWhisperCpp, Model: "ggml-base.en.bin"},
+			expected: []string{"-m", "ggml-base.en.bin", "-f", "in.wav", "-ovtt", "-of", "out", "-np"},
+		},
+		{
+			name:     "whisper.cpp with language",
+			t:        transcriber{Engine: engineWhisperCpp, Model: "ggml-base.bin", Language: "auto"},
+			expected: []string{"-m", "ggml-base.bin", "-f", "in.wav", "-ovtt", "-of", "out", "-np", "-l", "auto"},
+		},
+		{
+			name:     "openai defaults",
+			t:        transcriber{Engine: engineOpenAI},
+			expected: []string{"in.wav", "--output_format", "vtt", "--output_dir", "out", "--verbose", "False"},
+		},
+		{
+			name:     "openai model and language",
+			t:        transcriber{Engine: engineOpenAI, Model: "small", Language: "de"},
+			expected: []string{"in.wav", "--output_format", "vtt", "--output_dir", "out", "--verbose", "False", "--model", "small", "--language", "de"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.t.args("in.wav", "out"); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("args() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunTranscribe(t *testing.T) {
+	// A stand-in for openai-whisper that writes the input's name as the
+	// transcript into --output_dir
+	bin := t.TempDir()
+	script := `#!/bin/sh
+input="$1"
+while [ $# -gt 0 ]; do
+	if [ "$1" = "--output_dir" ]; then dir="$2"; fi
+	shift
+done
+name=$(basename "$input")
+printf 'WEBVTT\n\n%s\n' "$name" > "$dir/${name%.*}.vtt"
+`
+	if err := os.WriteFile(filepath.Join(bin, "fake-whisper"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"01.mp3", "02.m4a", "cover.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Existing transcripts are kept without --force
+	if err := os.WriteFile(filepath.Join(dir, "02.vtt"), []byte("WEBVTT\n\nmine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runTranscribe([]string{"--engine", "openai", "--whisper", filepath.Join(bin, "fake-whisper"), dir}); code != 0 {
+		t.Fatalf("runTranscribe() = %d, want 0", code)
+	}
+
+	for name, expected := range map[string]string{
+		"01.vtt": "WEBVTT\n\n01.mp3\n",
+		"02.vtt": "WEBVTT\n\nmine\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s = %q, want %q", name, data, expected)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Errorf("directory has %d entries after transcribing, want 5 (scratch directory left behind?)", len(entries))
+	}
+}
+
+func TestRunTranscribeRequiresModelForWhisperCpp(t *testing.T) {
+	if code := runTranscribe([]string{t.TempDir()}); code != 1 {
+		t.Errorf("runTranscribe() without --model = %d, want 1", code)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// transcriptTypes maps transcript sidecar extensions to their MIME types, in
+// the order they're listed in the feed.
+var transcriptTypes = []struct {
+	Ext  string
+	Type string
+}{
+	{".vtt", "text/vtt"},
+	{".srt", "application/x-subrip"},
+	{".txt", "text/plain"},
+}
+
+// Transcript is a transcript file published alongside an episode.
+type Transcript struct {
+	URL  string
+	Type string
+	Rel  string // "captions" for time-coded formats
+}
+
+// findTranscripts returns the transcript sidecars next to audioFile in dir,
+// e.g. chapter01.vtt for chapter01.mp3.
+func findTranscripts(baseURL string, dir string, audioFile string) []Transcript {
+	var transcripts []Transcript
+	base := strings.TrimSuffix(audioFile, filepath.Ext(audioFile))
+	for _, t := range transcriptTypes {
+		filename := base + t.Ext
+		info, err := os.Stat(filepath.Join(dir, filename))
+		if err != nil || info.IsDir() {
+			continue
+		}
+		transcripts = append(transcripts, Transcript{
+			URL:  buildURL(baseURL, dir, filename),
+			Type: t.Type,
+			Rel:  transcriptRel(t.Type),
+		})
+	}
+	return transcripts
+}
+
+// transcriptRel is the podcast:transcript rel attribute for a MIME type.
+func transcriptRel(mimeType string) string {
+	if mimeType == "text/vtt" || mimeType == "application/x-subrip" {
+		return "captions"
+	}
+	return ""
+}
+
+// hasTranscriptType reports whether transcripts include one of mimeType.
+func hasTranscriptType(transcripts []Transcript, mimeType string) bool {
+	for _, t := range transcripts {
+		if t.Type == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// lyricsFilename is the transcript written from an audio file's embedded
+// lyrics. It's named differently from a hand-made .txt sidecar, which takes
+// precedence, so bookast never mistakes its own output for the user's.
+func lyricsFilename(audioFile string) string {
+	return strings.TrimSuffix(audioFile, filepath.Ext(audioFile)) + ".lyrics.txt"
+}
+
+// writeLyricsTranscript writes lyrics as a plain text transcript next to the
+// audio file at path and returns its filename.
+func writeLyricsTranscript(path string, lyrics string) (string, error) {
+	filename := lyricsFilename(filepath.Base(path))
+	text := strings.ReplaceAll(lyrics, "\r\n", "\n") + "\n"
+	if err := writeFileIfChanged(filepath.Join(filepath.Dir(path), filename), []byte(text)); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
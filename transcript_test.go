@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindTranscripts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "My Book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"01 One.mp3", "01 One.srt", "01 One.vtt", "01 One.txt", "02.mp3", "03.mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A directory that happens to share the name isn't a transcript
+	if err := os.Mkdir(filepath.Join(dir, "03.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Transcript{
+		{URL: "https://x.com/My%20Book/01%20One.vtt", Type: "text/vtt", Rel: "captions"},
+		{URL: "https://x.com/My%20Book/01%20One.srt", Type: "application/x-subrip", Rel: "captions"},
+		{URL: "https://x.com/My%20Book/01%20One.txt", Type: "text/plain"},
+	}
+	if got := findTranscripts("https://x.com", dir, "01 One.mp3"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("findTranscripts(01 One.mp3) = %+v, want %+v", got, expected)
+	}
+
+	for _, audio := range []string{"02.mp3", "03.mp3"} {
+		if got := findTranscripts("https://x.com", dir, audio); got != nil {
+			t.Errorf("findTranscripts(%s) = %+v, want none", audio, got)
+		}
+	}
+}
+
+func TestWriteLyricsTranscript(t *testing.T) {
+	dir := t.TempDir()
+	filename, err := writeLyricsTranscript(filepath.Join(dir, "01 Prologue.mp3"), "It was a dark\r\nand stormy night.")
+	if err != nil {
+		t.Fatalf("writeLyricsTranscript() error = %v", err)
+	}
+	if filename != "01 Prologue.lyrics.txt" {
+		t.Errorf("writeLyricsTranscript() = %q, want %q", filename, "01 Prologue.lyrics.txt")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "It was a dark\nand stormy night.\n"; string(data) != expected {
+		t.Errorf("transcript = %q, want %q", data, expected)
+	}
+
+	// The generated file isn't mistaken for a hand-made sidecar
+	if got := findTranscripts("https://x.com", dir, "01 Prologue.mp3"); got != nil {
+		t.Errorf("findTranscripts() = %+v, want none", got)
+	}
+}
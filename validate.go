@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const itunesNS = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+// Issue severities. A feed with errors is broken or will be rejected by
+// Apple Podcasts; warnings are worth fixing but apps cope.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// Apple Podcasts' artwork limits, in pixels, for square images.
+const (
+	minArtworkSize = 1400
+	maxArtworkSize = 3000
+)
+
+// maxTitleLength is where titles start getting cut off in podcast apps.
+const maxTitleLength = 255
+
+// appleEnclosureTypes are the enclosure types Apple Podcasts plays.
+var appleEnclosureTypes = map[string]bool{
+	"audio/mpeg":      true,
+	"audio/mp4":       true,
+	"audio/x-m4a":     true,
+	"video/mp4":       true,
+	"video/quicktime": true,
+	"video/x-m4v":     true,
+}
+
+// Issue is a problem "bookast validate" found in a feed.
+type Issue struct {
+	Severity string
+	Where    string // "channel", or the item's title or number
+	Message  string
+}
+
+// rssText is an element that may come both plain and namespaced, like
+// <link> and <atom:link> or <title> and <itunes:title>.
+type rssText struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// plain returns the value of the element without a namespace.
+func plain(elements []rssText) string {
+	for _, e := range elements {
+		if e.XMLName.Space == "" {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+// validatedFeed is the part of an RSS feed the validator looks at, whoever
+// generated it.
+type validatedFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel *struct {
+		Title       []rssText `xml:"title"`
+		Link        []rssText `xml:"link"`
+		Description string    `xml:"description"`
+		Language    string    `xml:"language"`
+		Image       *struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		Explicit   *string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+		Categories []struct{} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+		Items      []struct {
+			Title       []rssText `xml:"title"`
+			Description string    `xml:"description"`
+			PubDate     string    `xml:"pubDate"`
+			GUID        string    `xml:"guid"`
+			Explicit    *string   `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+			Enclosure   *struct {
+				URL    string `xml:"url,attr"`
+				Length string `xml:"length,attr"`
+				Type   string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// runValidate implements "bookast validate", which checks a feed against
+// RSS 2.0 and Apple Podcasts' requirements.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	offline := fs.Bool("offline", false, "Don't download the artwork to check its dimensions when it isn't next to the feed")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s validate [flags] <feed file or URL>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	source := fs.Arg(0)
+	content, err := readFeedSource(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	artwork := func(href string) (image.Config, error) {
+		// A feed bookast wrote has its cover right next to it
+		if !isURL(source) {
+			file, err := os.Open(filepath.Join(filepath.Dir(source), path.Base(href)))
+			if err == nil {
+				defer file.Close()
+				config, _, err := image.DecodeConfig(file)
+				return config, err
+			}
+		}
+		if *offline {
+			return image.Config{}, fmt.Errorf("not next to the feed, and --offline")
+		}
+		resp, err := httpGet(href)
+		if err == errBookNotFound {
+			return image.Config{}, fmt.Errorf("GET %s: 404 Not Found", href)
+		}
+		if err != nil {
+			return image.Config{}, err
+		}
+		defer resp.Body.Close()
+		config, _, err := image.DecodeConfig(resp.Body)
+		return config, err
+	}
+
+	issues := validateFeed(content, artwork)
+	printIssues(os.Stdout, issues)
+	for _, issue := range issues {
+		if issue.Severity == severityError {
+			return 1
+		}
+	}
+	return 0
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// readFeedSource reads a feed from a file, or downloads it.
+func readFeedSource(source string) ([]byte, error) {
+	if !isURL(source) {
+		return os.ReadFile(source)
+	}
+	resp, err := httpGet(source)
+	if err == errBookNotFound {
+		return nil, fmt.Errorf("GET %s: 404 Not Found", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// validateFeed checks an RSS feed, in document order. artwork reads the
+// dimensions of the image at a URL.
+func validateFeed(content []byte, artwork func(href string) (image.Config, error)) []Issue {
+	var issues []Issue
+	add := func(severity, where, format string, args ...any) {
+		issues = append(issues, Issue{severity, where, fmt.Sprintf(format, args...)})
+	}
+
+	var feed validatedFeed
+	if err := xml.Unmarshal(content, &feed); err != nil {
+		add(severityError, "feed", "not an RSS feed: %v", err)
+		return issues
+	}
+	if feed.Version != "2.0" {
+		add(severityError, "feed", "<rss> version is %q, not 2.0", feed.Version)
+	}
+	channel := feed.Channel
+	if channel == nil {
+		add(severityError, "feed", "no <channel>")
+		return issues
+	}
+
+	for _, required := range []struct{ name, value string }{
+		{"title", plain(channel.Title)},
+		{"link", plain(channel.Link)},
+		{"description", channel.Description},
+	} {
+		if strings.TrimSpace(required.value) == "" {
+			add(severityError, "channel", "<%s> is missing; RSS 2.0 requires it", required.name)
+		}
+	}
+	if n := utf8.RuneCountInString(plain(channel.Title)); n > maxTitleLength {
+		add(severityWarning, "channel", "title is %d characters, apps cut it off after about %d", n, maxTitleLength)
+	}
+	if channel.Language == "" {
+		add(severityWarning, "channel", "<language> is missing; Apple Podcasts requires it")
+	}
+	if len(channel.Categories) == 0 {
+		add(severityWarning, "channel", "<itunes:category> is missing; Apple Podcasts requires it")
+	}
+	if channel.Explicit == nil {
+		add(severityWarning, "channel", "<itunes:explicit> is missing; Apple Podcasts requires it")
+	} else if !validExplicit(*channel.Explicit) {
+		add(severityError, "channel", "<itunes:explicit> is %q, not true or false", *channel.Explicit)
+	}
+
+	if channel.Image == nil || channel.Image.Href == "" {
+		add(severityError, "channel", "<itunes:image> is missing; Apple Podcasts requires artwork")
+	} else {
+		href := channel.Image.Href
+		if ext := strings.ToLower(path.Ext(href)); ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+			add(severityError, "channel", "<itunes:image> %s isn't a .jpg or .png", href)
+		}
+		config, err := artwork(href)
+		switch {
+		case err != nil:
+			add(severityWarning, "channel", "couldn't check the artwork dimensions: %v", err)
+		case config.Width != config.Height:
+			add(severityError, "channel", "artwork is %dx%d, Apple Podcasts requires it square", config.Width, config.Height)
+		case config.Width < minArtworkSize || config.Width > maxArtworkSize:
+			add(severityError, "channel", "artwork is %dx%d, Apple Podcasts requires %d to %d pixels square", config.Width, config.Height, minArtworkSize, maxArtworkSize)
+		}
+	}
+
+	if len(channel.Items) == 0 {
+		add(severityWarning, "channel", "no <item>s")
+	}
+	guids := map[string]string{}
+	for i, item := range channel.Items {
+		title := plain(item.Title)
+		where := fmt.Sprintf("item %d", i+1)
+		if title != "" {
+			where = fmt.Sprintf("item %d (%s)", i+1, title)
+		}
+
+		if title == "" {
+			if item.Description == "" {
+				add(severityError, where, "has neither <title> nor <description>; RSS 2.0 requires one")
+			} else {
+				add(severityError, where, "<title> is missing; Apple Podcasts requires it")
+			}
+		} else if n := utf8.RuneCountInString(title); n > maxTitleLength {
+			add(severityWarning, where, "title is %d characters, apps cut it off after about %d", n, maxTitleLength)
+		}
+		if item.Explicit != nil && !validExplicit(*item.Explicit) {
+			add(severityError, where, "<itunes:explicit> is %q, not true or false", *item.Explicit)
+		}
+		if item.PubDate != "" {
+			if _, err := parseRFC822(item.PubDate); err != nil {
+				add(severityError, where, "<pubDate> %q isn't an RFC 822 date", item.PubDate)
+			}
+		}
+		if item.GUID == "" {
+			add(severityWarning, where, "<guid> is missing; apps tell episodes apart by it")
+		} else if other, ok := guids[item.GUID]; ok {
+			add(severityError, where, "<guid> %s is also %s's", item.GUID, other)
+		} else {
+			guids[item.GUID] = where
+		}
+
+		enclosure := item.Enclosure
+		if enclosure == nil {
+			add(severityError, where, "<enclosure> is missing")
+			continue
+		}
+		if enclosure.URL == "" {
+			add(severityError, where, "<enclosure> has no url")
+		}
+		if enclosure.Length == "" {
+			add(severityError, where, "<enclosure> has no length; RSS 2.0 requires it")
+		} else if enclosure.Length == "0" {
+			add(severityWarning, where, "<enclosure> length is 0")
+		}
+		kind, _, _ := strings.Cut(enclosure.Type, "/")
+		switch {
+		case enclosure.Type == "":
+			add(severityError, where, "<enclosure> has no type; RSS 2.0 requires it")
+		case kind != "audio" && kind != "video":
+			add(severityError, where, "<enclosure> type %s isn't audio or video", enclosure.Type)
+		case !appleEnclosureTypes[enclosure.Type]:
+			add(severityWarning, where, "<enclosure> type %s won't play in Apple Podcasts", enclosure.Type)
+		}
+		if expected, ok := audioMIMETypes[strings.ToLower(path.Ext(enclosure.URL))]; ok && enclosure.Type != "" && expected != enclosure.Type && kind == "audio" {
+			add(severityWarning, where, "<enclosure> type %s doesn't match its %s extension (%s)", enclosure.Type, path.Ext(enclosure.URL), expected)
+		}
+	}
+	return issues
+}
+
+// validExplicit reports whether an <itunes:explicit> value is one Apple
+// understands. "yes", "no" and "clean" are the older spellings.
+func validExplicit(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "false", "yes", "no", "clean":
+		return true
+	}
+	return false
+}
+
+// parseRFC822 parses an RSS date, with or without seconds and a numeric
+// zone.
+func parseRFC822(s string) (time.Time, error) {
+	var err error
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700", time.RFC822Z, time.RFC822} {
+		var t time.Time
+		if t, err = time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// printIssues lists the issues, then how many of each severity there were.
+func printIssues(w io.Writer, issues []Issue) {
+	var errors, warnings int
+	for _, issue := range issues {
+		fmt.Fprintf(w, "%-7s  %s: %s\n", issue.Severity, issue.Where, issue.Message)
+		if issue.Severity == severityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	if len(issues) > 0 {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s, %s\n", plural(errors, "error"), plural(warnings, "warning"))
+}
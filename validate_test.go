@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"os"
+	"strings"
+	"testing"
+)
+
+func artworkOf(width, height int) func(string) (image.Config, error) {
+	return func(string) (image.Config, error) {
+		return image.Config{Width: width, Height: height}, nil
+	}
+}
+
+func TestValidateFeedGolden(t *testing.T) {
+	content, err := os.ReadFile("testdata/audiobook1/golden.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues := validateFeed(content, artworkOf(1400, 1400))
+	expected := []Issue{
+		{severityWarning, "channel", "<itunes:category> is missing; Apple Podcasts requires it"},
+		{severityWarning, "channel", "<itunes:explicit> is missing; Apple Podcasts requires it"},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("validateFeed() = %+v, want %+v", issues, expected)
+	}
+	for i := range expected {
+		if issues[i] != expected[i] {
+			t.Errorf("issues[%d] = %+v, want %+v", i, issues[i], expected[i])
+		}
+	}
+}
+
+func TestValidateFeedProblems(t *testing.T) {
+	feed := `<?xml version="1.0"?>
+<rss version="0.91" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>` + strings.Repeat("x", 300) + `</title>
+    <atom:link href="https://example.com/feed.rss" rel="self"/>
+    <description>A book</description>
+    <itunes:explicit>maybe</itunes:explicit>
+    <itunes:category text="Arts"/>
+    <itunes:image href="https://example.com/cover.gif"/>
+    <item>
+      <description>No title</description>
+      <pubDate>yesterday</pubDate>
+      <guid>a</guid>
+      <enclosure url="https://example.com/01.flac" length="0" type="audio/flac"/>
+    </item>
+    <item>
+      <title>Chapter 2</title>
+      <guid>a</guid>
+      <enclosure url="https://example.com/02.pdf" length="10" type="application/pdf"/>
+    </item>
+    <item>
+      <title>Chapter 3</title>
+    </item>
+  </channel>
+</rss>`
+
+	issues := validateFeed([]byte(feed), artworkOf(1400, 1000))
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.Severity+" "+issue.Where+": "+issue.Message)
+	}
+	expected := []string{
+		`error feed: <rss> version is "0.91", not 2.0`,
+		"error channel: <link> is missing; RSS 2.0 requires it",
+		"warning channel: title is 300 characters, apps cut it off after about 255",
+		"warning channel: <language> is missing; Apple Podcasts requires it",
+		`error channel: <itunes:explicit> is "maybe", not true or false`,
+		"error channel: <itunes:image> https://example.com/cover.gif isn't a .jpg or .png",
+		"error channel: artwork is 1400x1000, Apple Podcasts requires it square",
+		"error item 1: <title> is missing; Apple Podcasts requires it",
+		`error item 1: <pubDate> "yesterday" isn't an RFC 822 date`,
+		"warning item 1: <enclosure> length is 0",
+		"warning item 1: <enclosure> type audio/flac won't play in Apple Podcasts",
+		"error item 2 (Chapter 2): <guid> a is also item 1's",
+		"error item 2 (Chapter 2): <enclosure> type application/pdf isn't audio or video",
+		"warning item 3 (Chapter 3): <guid> is missing; apps tell episodes apart by it",
+		"error item 3 (Chapter 3): <enclosure> is missing",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("validateFeed() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestValidateFeedArtwork(t *testing.T) {
+	content, err := os.ReadFile("testdata/audiobook1/golden.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		artwork  func(string) (image.Config, error)
+		expected string
+	}{
+		{"too small", artworkOf(300, 300), "artwork is 300x300, Apple Podcasts requires 1400 to 3000 pixels square"},
+		{"too big", artworkOf(4000, 4000), "artwork is 4000x4000, Apple Podcasts requires 1400 to 3000 pixels square"},
+		{"unreadable", func(string) (image.Config, error) { return image.Config{}, errors.New("offline") }, "couldn't check the artwork dimensions: offline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := false
+			for _, issue := range validateFeed(content, tt.artwork) {
+				found = found || issue.Message == tt.expected
+			}
+			if !found {
+				t.Errorf("validateFeed() didn't report %q", tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseRFC822(t *testing.T) {
+	for _, s := range []string{"Wed, 14 Oct 2026 19:07:26 +0000", "Wed, 14 Oct 2026 19:07:26 GMT", "Wed, 4 Oct 2026 19:07:26 +0000", "14 Oct 2026 19:07:26 +0000"} {
+		if _, err := parseRFC822(s); err != nil {
+			t.Errorf("parseRFC822(%q) error = %v", s, err)
+		}
+	}
+	if _, err := parseRFC822("2026-10-14"); err == nil {
+		t.Error("parseRFC822() accepted an ISO 8601 date")
+	}
+}
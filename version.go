@@ -0,0 +1,50 @@
+package main
+
+import (
+	"runtime/debug"
+)
+
+// version can be set at build time with -ldflags "-X main.version=v1.2.3".
+// When it isn't, it's taken from the module or VCS build info.
+var version = ""
+
+// buildVersion returns the version of this bookast binary.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+
+	// Built from a checkout: use the commit
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return "devel-" + revision
+}
+
+// generatorName is emitted in the feed's <generator> element.
+func generatorName() string {
+	return "bookast " + buildVersion()
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle is how long --watch waits for a directory's files to stop
+// changing before regenerating the feed of the book it's in, so copying in
+// a whole folder is one regeneration, and not of half-copied files.
+var watchSettle = 2 * time.Second
+
+// watchTree adds dir and the directories under it to w, leaving out hidden
+// ones. fsnotify only watches the directories it's given, not below them.
+func watchTree(w *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.Add(path)
+	})
+}
+
+// generatedDirSuffixes end the names of the directories ffmpeg's output is
+// written to, next to the file it's made from.
+var generatedDirSuffixes = []string{splitDirName(""), partsDirName(""), decryptedDirName("")}
+
+// ignoredChange reports whether a change to the file at path can't change
+// a feed, because bookast writes it itself (regenerating would change it
+// again) or it's hidden.
+func ignoredChange(path string) bool {
+	name := filepath.Base(path)
+	if name == metadataFile {
+		return false
+	}
+	if strings.HasPrefix(name, ".") || name == bookPageFile || strings.HasSuffix(name, ".chapters.json") || strings.HasSuffix(name, ".lyrics.txt") || strings.HasSuffix(name, ".partial") {
+		return true
+	}
+	if strings.HasPrefix(name, trailerBaseName+".") {
+		return true
+	}
+	for _, output := range feedFormats {
+		if name == output.Filename || name == output.Filename+".lock" {
+			return true
+		}
+	}
+	// A generated directory, or what's written into it
+	for _, dir := range []string{name, filepath.Base(filepath.Dir(path))} {
+		for _, suffix := range generatedDirSuffixes {
+			if strings.HasSuffix(dir, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isWithin reports whether path is dir or under it.
+func isWithin(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// changedBooks returns the books that paths changed: the one each path is
+// in (the deepest, for a book inside another), and those inside a path,
+// like a new book's folder.
+func changedBooks(books []libraryBook, paths []string) []libraryBook {
+	changed := map[string]bool{}
+	for _, path := range paths {
+		deepest := ""
+		for _, book := range books {
+			switch {
+			case isWithin(path, book.Dir):
+				if len(book.Dir) > len(deepest) {
+					deepest = book.Dir
+				}
+			case isWithin(book.Dir, path):
+				changed[book.Dir] = true
+			}
+		}
+		if deepest != "" {
+			changed[deepest] = true
+		}
+	}
+	var result []libraryBook
+	for _, book := range books {
+		if changed[book.Dir] {
+			result = append(result, book)
+		}
+	}
+	return result
+}
+
+// pendingDir is a directory with changes --watch hasn't published yet.
+type pendingDir struct {
+	paths   map[string]bool       // What changed in it
+	listing map[string]listedFile // Its files' sizes and times at the last look
+	due     time.Time             // When to look again
+	settled bool                  // Waiting for its book's other directories
+}
+
+// pendingDirs are the directories with changes --watch hasn't published,
+// by path.
+type pendingDirs map[string]*pendingDir
+
+// note records a change to path in dir, putting dir off for watchSettle.
+func (pending pendingDirs) note(dir string, path string) {
+	p := pending[dir]
+	if p == nil {
+		p = &pendingDir{paths: map[string]bool{}}
+		pending[dir] = p
+	}
+	p.paths[path] = true
+	p.listing, _ = listDir(dir)
+	p.due = time.Now().Add(watchSettle)
+	p.settled = false
+}
+
+// next returns when the first unsettled directory is due, zero for none.
+func (pending pendingDirs) next() time.Time {
+	var first time.Time
+	for _, p := range pending {
+		if !p.settled && (first.IsZero() || p.due.Before(first)) {
+			first = p.due
+		}
+	}
+	return first
+}
+
+// settledBooks returns the books whose pending changes have settled,
+// taking those out of pending, and all the books under root. A directory
+// has settled when nothing's changed in it for watchSettle and its files'
+// sizes and times are still what they were, so a file still being copied
+// in holds it back even with no events. A book is only published when all
+// the directories changing it have settled.
+func (pending pendingDirs) settledBooks(root string, layout string) ([]libraryBook, []libraryBook, error) {
+	now := time.Now()
+	someSettled := false
+	for dir, p := range pending {
+		if now.Before(p.due) {
+			continue
+		}
+		// A directory that's gone has settled, its removal is the change
+		listing, _ := listDir(dir)
+		if !maps.Equal(listing, p.listing) {
+			p.listing = listing
+			p.due = now.Add(watchSettle)
+			p.settled = false
+			continue
+		}
+		p.settled = true
+		someSettled = true
+	}
+	if !someSettled {
+		return nil, nil, nil
+	}
+
+	books, err := findBooks(root, layout)
+	if err != nil {
+		for dir, p := range pending {
+			if p.settled {
+				delete(pending, dir)
+			}
+		}
+		return nil, nil, err
+	}
+	affects := map[string][]libraryBook{}
+	held := map[string]bool{}
+	for dir, p := range pending {
+		affects[dir] = changedBooks(books, slices.Collect(maps.Keys(p.paths)))
+		if !p.settled {
+			for _, book := range affects[dir] {
+				held[book.Dir] = true
+			}
+		}
+	}
+	ready := map[string]bool{}
+	for dir, p := range pending {
+		if !p.settled {
+			continue
+		}
+		waiting := false
+		for _, book := range affects[dir] {
+			if held[book.Dir] {
+				waiting = true
+			} else {
+				ready[book.Dir] = true
+			}
+		}
+		// Kept, settled, for the book's other directories
+		if !waiting {
+			delete(pending, dir)
+		}
+	}
+	var changed []libraryBook
+	for _, book := range books {
+		if ready[book.Dir] {
+			changed = append(changed, book)
+		}
+	}
+	return changed, books, nil
+}
+
+// watchLibrary watches the books under root, found by layout, until stop
+// is closed. Changes are collected per directory until it has settled
+// (see settledBooks), then it finds the books again, so new ones are
+// seen, and calls publish with those changed and all of them.
+func watchLibrary(w *fsnotify.Watcher, root string, layout string, stop <-chan struct{}, publish func(changed []libraryBook, books []libraryBook)) error {
+	if err := watchTree(w, root); err != nil {
+		return err
+	}
+	pending := pendingDirs{}
+	timer := time.NewTimer(watchSettle)
+	timer.Stop()
+	defer timer.Stop()
+	// schedule sets the timer for the first directory due
+	schedule := func() {
+		if first := pending.next(); !first.IsZero() {
+			timer.Reset(max(time.Until(first), 0))
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case err, ok := <-w.Errors:
+			if !ok {
+				return errors.New("file watcher stopped")
+			}
+			logger.Error("watching failed", "dir", root, "error", err)
+			// Changes were lost, any directory may have some
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				for _, dir := range w.WatchList() {
+					pending.note(dir, dir)
+				}
+				schedule()
+			}
+		case event, ok := <-w.Events:
+			if !ok {
+				return errors.New("file watcher stopped")
+			}
+			path := event.Name
+			if event.Op == fsnotify.Chmod || ignoredChange(path) {
+				continue
+			}
+			// A new directory: what's copied into it before it's watched
+			// is only seen by looking
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				if err := watchTree(w, path); err != nil {
+					logger.Error("watching failed", "dir", path, "error", err)
+				}
+				pending.note(path, path)
+			}
+			pending.note(filepath.Dir(path), path)
+			schedule()
+		case <-timer.C:
+			changed, books, err := pending.settledBooks(root, layout)
+			if err != nil {
+				logger.Error("finding books failed", "dir", root, "error", err)
+			}
+			if len(changed) > 0 {
+				publish(changed, books)
+			}
+			schedule()
+		}
+	}
+}
+
+// watchAndPublish is --watch, after the first run: it publishes the books
+// that change, and the library's page, until SIGINT or SIGTERM, and
+// returns the exit code. Failing books are logged, the next change to
+// them is another try.
+func watchAndPublish(root string, layout string, publish func(libraryBook, *Summary) error, writeLibraryPage func([]libraryBook) error, quiet bool, logFormat string) int {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --watch: %v\n", err)
+		return exitError
+	}
+	defer w.Close()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	logger.Info("watching", "dir", root)
+	if !quiet && logFormat == logFormatText {
+		fmt.Printf("Watching %s for changes\n", root)
+	}
+	err = watchLibrary(w, root, layout, stop, func(changed []libraryBook, books []libraryBook) {
+		summary := &Summary{}
+		for _, book := range changed {
+			if err := publish(book, summary); err != nil {
+				logger.Error("publishing failed", "dir", book.Dir, "error", err)
+			}
+		}
+		if err := writeLibraryPage(books); err != nil {
+			logger.Error("writing the library page failed", "error", err)
+		}
+		switch {
+		case logFormat == logFormatJSON:
+			logSummary(summary)
+		case !quiet && len(summary.Feeds) > 0:
+			summary.Print(os.Stdout)
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --watch: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// listedFile is what settledBooks compares of a file between looks.
+type listedFile struct {
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// listDir returns what's in dir.
+func listDir(dir string) (map[string]listedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	listing := map[string]listedFile{}
+	for _, entry := range entries {
+		// A directory's own time changes with what's in it, which is
+		// watched separately, or as bookast writes its feed
+		if entry.IsDir() {
+			listing[entry.Name()] = listedFile{dir: true}
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		listing[entry.Name()] = listedFile{size: info.Size(), modTime: info.ModTime()}
+	}
+	return listing, nil
+}
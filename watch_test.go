@@ -0,0 +1,209 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestIgnoredChange(t *testing.T) {
+	for name, want := range map[string]bool{
+		"chapter01.mp3":           false,
+		"cover.jpg":               false,
+		bookConfigFile:            false,
+		metadataFile:              false,
+		"podcast.rss":             true,
+		"podcast.json.lock":       true,
+		stateFile:                 true,
+		bookPageFile:              true,
+		"chapter01.chapters.json": true,
+		"chapter01.lyrics.txt":    true,
+		"cover.jpg.partial":       true,
+		".DS_Store":               true,
+		"bookast-trailer.m4a":     true,
+		"Dune-chapters":           true,
+		filepath.Join("Dune", "Dune-chapters", "02 - The Desert.m4a"): true,
+		filepath.Join("Dune", "Dune-parts", "Dune, Part 1.mp3"):       true,
+		filepath.Join("Dune", "Dune-decrypted", "Dune.m4b"):           true,
+		filepath.Join("Dune", "chapter01.mp3"):                        false,
+		filepath.Join("Dune", "Extras", "interview.mp3"):              false,
+	} {
+		if got := ignoredChange(name); got != want {
+			t.Errorf("ignoredChange(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestChangedBooks(t *testing.T) {
+	root := filepath.Join("library")
+	books := []libraryBook{
+		{Dir: filepath.Join(root, "Le Guin", "Earthsea", "A Wizard of Earthsea")},
+		{Dir: filepath.Join(root, "Le Guin", "Earthsea", "The Tombs of Atuan")},
+		{Dir: filepath.Join(root, "Tolkien", "The Hobbit")},
+		{Dir: filepath.Join(root, "Tolkien", "The Hobbit", "Extras")},
+	}
+	tests := []struct {
+		paths []string
+		want  []int
+	}{
+		{[]string{filepath.Join(books[1].Dir, "01.mp3")}, []int{1}},
+		{[]string{filepath.Join(root, "Le Guin", "Earthsea")}, []int{0, 1}},
+		{[]string{filepath.Join(books[3].Dir, "map.jpg"), filepath.Join(books[2].Dir, "01.mp3")}, []int{2, 3}},
+		{[]string{filepath.Join(root, "Le Guin", "Earthsea", "A Wizard of Earthsea 2")}, nil},
+		{[]string{filepath.Join(root, "notes.txt")}, nil},
+	}
+	for _, tt := range tests {
+		var got []int
+		for _, book := range changedBooks(books, tt.paths) {
+			got = append(got, slices.IndexFunc(books, func(b libraryBook) bool { return b.Dir == book.Dir }))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("changedBooks(%q) = books %v, want %v", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestWatchLibrary(t *testing.T) {
+	defer func(settle time.Duration) { watchSettle = settle }(watchSettle)
+	watchSettle = 50 * time.Millisecond
+
+	root := t.TempDir()
+	book := filepath.Join(root, "Author", "Book")
+	if err := os.MkdirAll(book, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, book, "chapter01.mp3")
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	stop := make(chan struct{})
+	published := make(chan []string)
+	done := make(chan error)
+	go func() {
+		done <- watchLibrary(w, root, layoutAudiobookshelf, stop, func(changed []libraryBook, books []libraryBook) {
+			var dirs []string
+			for _, book := range changed {
+				dirs = append(dirs, book.Dir)
+			}
+			published <- dirs
+		})
+	}()
+	waitPublished := func(want ...string) {
+		t.Helper()
+		select {
+		case got := <-published:
+			if !slices.Equal(got, want) {
+				t.Errorf("published %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("nothing published, want %q", want)
+		}
+	}
+
+	// Let it watch the library, then change the book
+	time.Sleep(30 * time.Millisecond)
+	copyFixture(t, book, "chapter02.mp3")
+	waitPublished(book)
+
+	// Its own output isn't a change
+	if err := os.WriteFile(filepath.Join(book, "podcast.rss"), []byte("<rss/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A new book in a new author's folder
+	other := filepath.Join(root, "Other Author", "Other Book")
+	if err := os.MkdirAll(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, other, "chapter01.mp3")
+	waitPublished(other)
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("watchLibrary = %v", err)
+	}
+}
+
+func TestPendingDirsSettledBooks(t *testing.T) {
+	defer func(settle time.Duration) { watchSettle = settle }(watchSettle)
+	watchSettle = 0
+
+	root := t.TempDir()
+	copying := filepath.Join(root, "Author", "Copying")
+	other := filepath.Join(root, "Author", "Other")
+	for _, dir := range []string{copying, other} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		copyFixture(t, dir, "chapter01.mp3")
+	}
+
+	// A file still growing holds its directory back, with no more events
+	pending := pendingDirs{}
+	partial := filepath.Join(copying, "chapter02.mp3")
+	if err := os.WriteFile(partial, []byte("ID3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pending.note(copying, filepath.Join(copying, "chapter01.mp3"))
+	if err := os.WriteFile(partial, []byte("ID3 and more"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed := settledDirs(t, pending, root, layoutAudiobookshelf); len(changed) != 0 {
+		t.Errorf("settled %q with a file growing", changed)
+	}
+	if changed := settledDirs(t, pending, root, layoutAudiobookshelf); !slices.Equal(changed, []string{copying}) {
+		t.Errorf("settled %q, want %q once it stopped growing", changed, copying)
+	}
+	if len(pending) != 0 {
+		t.Errorf("%d directories still pending after publishing", len(pending))
+	}
+
+	// A book is held until every directory changing it has settled, the
+	// settled ones waiting for it without being put off again
+	watchSettle = time.Hour
+	book := t.TempDir()
+	for _, disc := range []string{"CD1", "CD2"} {
+		if err := os.Mkdir(filepath.Join(book, disc), 0755); err != nil {
+			t.Fatal(err)
+		}
+		copyFixture(t, filepath.Join(book, disc), "chapter01.mp3")
+		pending.note(filepath.Join(book, disc), filepath.Join(book, disc, "chapter01.mp3"))
+	}
+	pending[filepath.Join(book, "CD1")].due = time.Now()
+	if changed := settledDirs(t, pending, book, ""); len(changed) != 0 {
+		t.Errorf("settled %q with CD2 still changing", changed)
+	}
+	if p, ok := pending[filepath.Join(book, "CD1")]; !ok || !p.settled {
+		t.Error("CD1 not kept settled while its book was held")
+	}
+	if first := pending.next(); !first.Equal(pending[filepath.Join(book, "CD2")].due) {
+		t.Errorf("next = %v, want CD2's due time", first)
+	}
+	pending[filepath.Join(book, "CD2")].due = time.Now()
+	if changed := settledDirs(t, pending, book, ""); !slices.Equal(changed, []string{book}) {
+		t.Errorf("settled %q, want %q once", changed, book)
+	}
+	if first := pending.next(); !first.IsZero() || len(pending) != 0 {
+		t.Errorf("%d directories pending after publishing, next at %v", len(pending), first)
+	}
+}
+
+// settledDirs returns the directories of pending's settled books.
+func settledDirs(t *testing.T, pending pendingDirs, root string, layout string) []string {
+	t.Helper()
+	changed, _, err := pending.settledBooks(root, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dirs []string
+	for _, book := range changed {
+		dirs = append(dirs, book.Dir)
+	}
+	return dirs
+}
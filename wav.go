@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// wavDuration walks the chunks of a RIFF WAVE file for the byte rate in
+// "fmt " and the length of "data". Only uncompressed PCM has a byte rate
+// that divides evenly, which is what WAV audiobooks are in practice.
+func wavDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	var hdr [12]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return 0, err
+	}
+	if string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WAVE" {
+		return 0, errors.New("not a RIFF WAVE file")
+	}
+
+	var byteRate uint32
+	var chunk [16]byte
+	for offset := int64(12); offset+8 <= size; {
+		if _, err := r.ReadAt(chunk[:8], offset); err != nil {
+			return 0, err
+		}
+		id := string(chunk[0:4])
+		length := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if length < 16 {
+				return 0, errors.New("fmt chunk too short")
+			}
+			if _, err := r.ReadAt(chunk[:16], offset+8); err != nil {
+				return 0, err
+			}
+			byteRate = binary.LittleEndian.Uint32(chunk[8:12])
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("data chunk before fmt chunk")
+			}
+			// Streamed files leave the length unset; take the rest of the file
+			if length == 0 || length == 0xFFFFFFFF || offset+8+length > size {
+				length = size - offset - 8
+			}
+			return secondsToDuration(float64(length) / float64(byteRate)), nil
+		}
+		// Chunks are padded to an even length
+		offset += 8 + length + length&1
+	}
+	return 0, errors.New("no data chunk")
+}
+
+// wavProvider is the native WAV parser exposed as a DurationProvider.
+type wavProvider struct{}
+
+func (wavProvider) Name() string { return "native" }
+
+func (wavProvider) Duration(filePath string, metadata tag.Metadata) (DurationEstimate, error) {
+	if strings.ToLower(filepath.Ext(filePath)) != ".wav" {
+		return DurationEstimate{}, errors.New("not a WAV file")
+	}
+
+	d, err := readNativeDuration(filePath, wavDuration)
+	if err != nil {
+		return DurationEstimate{}, err
+	}
+	return DurationEstimate{Duration: d, Confidence: 0.9}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// riffChunk builds a RIFF chunk, padded to an even length.
+func riffChunk(id string, payload []byte) []byte {
+	chunk := make([]byte, 8, 8+len(payload)+1)
+	copy(chunk, id)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// wavFile builds a WAVE file with the given chunks after the RIFF header.
+func wavFile(chunks ...[]byte) []byte {
+	body := append([]byte("WAVE"), bytes.Join(chunks, nil)...)
+	return append(riffChunk("RIFF", body)[:8], body...)
+}
+
+// wavFmt is a PCM fmt chunk at the given byte rate.
+func wavFmt(byteRate uint32) []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint16(b[0:], 1)
+	binary.LittleEndian.PutUint16(b[2:], 1)
+	binary.LittleEndian.PutUint32(b[4:], byteRate/2)
+	binary.LittleEndian.PutUint32(b[8:], byteRate)
+	binary.LittleEndian.PutUint16(b[12:], 2)
+	binary.LittleEndian.PutUint16(b[14:], 16)
+	return riffChunk("fmt ", b)
+}
+
+func TestWAVDuration(t *testing.T) {
+	streamed := riffChunk("data", make([]byte, 16000))
+	binary.LittleEndian.PutUint32(streamed[4:], 0)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"pcm", wavFile(wavFmt(8000), riffChunk("data", make([]byte, 24000))), 3 * time.Second, false},
+		{"odd LIST chunk first", wavFile(riffChunk("LIST", []byte("INFOx")), wavFmt(8000), riffChunk("data", make([]byte, 4000))), 500 * time.Millisecond, false},
+		{"streamed without data length", wavFile(wavFmt(8000), streamed), 2 * time.Second, false},
+		{"no fmt", wavFile(riffChunk("data", make([]byte, 100))), 0, true},
+		{"not wave", []byte("RIFF\x04\x00\x00\x00AVI "), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := wavDuration(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("wavDuration() = %v, want error", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("wavDuration() error = %v", err)
+			}
+			if d != tt.expected {
+				t.Errorf("wavDuration() = %v, want %v", d, tt.expected)
+			}
+		})
+	}
+}
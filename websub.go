@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// podcastDigest identifies what podcast's feed says, but not when it was
+// generated, so publishing an unchanged book again doesn't ping the hub.
+// Episodes' dates are left out: scanDirectory dates them by the scan.
+func podcastDigest(podcast *Podcast) (string, error) {
+	content := *podcast
+	content.Warnings, content.Skipped = nil, nil
+	content.Episodes = slices.Clone(podcast.Episodes)
+	for i := range content.Episodes {
+		content.Episodes[i].PubDate = time.Time{}
+		content.Episodes[i].Warnings = nil
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:12]), nil
+}
+
+// pingHub tells the WebSub hub that the feed at feedURL changed, with the
+// "publish" ping hubs take from publishers, so it fetches the feed and
+// pushes it to the apps subscribed.
+func pingHub(hub string, feedURL string) error {
+	form := url.Values{"hub.mode": {"publish"}, "hub.url": {feedURL}}
+	req, err := http.NewRequest(http.MethodPost, hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", generatorName())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// Hubs answer 202 Accepted or 204 No Content
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", hub, resp.Status)
+	}
+	return nil
+}
+
+// notifyHub pings podcast.Hub about the feed of the book in dir unless
+// it's unchanged since the last ping, which the state file remembers. It
+// reports whether it pinged.
+func notifyHub(dir string, podcast *Podcast) (bool, error) {
+	digest, err := podcastDigest(podcast)
+	if err != nil {
+		return false, err
+	}
+	state, err := loadBookState(dir)
+	if err != nil {
+		return false, err
+	}
+	if state.HubDigest == digest {
+		return false, nil
+	}
+	if err := pingHub(podcast.Hub, podcast.FeedURL); err != nil {
+		return false, err
+	}
+	state.HubDigest = digest
+	if err := saveBookState(dir, state); err != nil {
+		return true, fmt.Errorf("failed to save %s: %v", stateFile, err)
+	}
+	return true, nil
+}
+
+// notifyHub pings the --hub about the books whose feed changed since it
+// last looked at them, by feedVersion, as files are added, retagged or
+// edited. The first look at a book only takes note: its feed is new.
+// Failed pings are tried again next time.
+func (s *feedServer) notifyHub(books []servedBook) {
+	if s.opts.Hub == "" {
+		return
+	}
+	s.hubMu.Lock()
+	defer s.hubMu.Unlock()
+	if s.hubVersions == nil {
+		s.hubVersions = map[string]string{}
+	}
+	for _, book := range books {
+		feedURL := buildURL(book.baseURL(s.baseURL), book.Dir, s.output.Filename)
+		version, _, err := feedVersion(book.Dir, feedURL)
+		if err != nil {
+			continue
+		}
+		last, seen := s.hubVersions[book.Dir]
+		if seen && last != version {
+			if err := pingHub(s.opts.Hub, feedURL); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: WebSub hub: %v\n", err)
+				continue
+			}
+		}
+		s.hubVersions[book.Dir] = version
+	}
+}
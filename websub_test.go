@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testHub is a WebSub hub recording the feeds it's pinged about.
+type testHub struct {
+	mu     sync.Mutex
+	pinged []string
+	status int
+}
+
+func (h *testHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.PostFormValue("hub.mode") != "publish" {
+		http.Error(w, "bad ping", http.StatusBadRequest)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+		return
+	}
+	h.pinged = append(h.pinged, r.PostFormValue("hub.url"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *testHub) setStatus(status int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+}
+
+func (h *testHub) pings() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.pinged...)
+}
+
+func TestFeedHubLinks(t *testing.T) {
+	podcast := &Podcast{Title: "Book", FeedURL: "https://example.com/Book/podcast.rss", Hub: "https://hub.example.com/"}
+	for format, want := range map[string]string{
+		"rss":      `<atom:link href="https://hub.example.com/" rel="hub"></atom:link>`,
+		"atom":     `<link href="https://hub.example.com/" rel="hub"></link>`,
+		"jsonfeed": `"hubs": [`,
+	} {
+		feed := feedFormats[format].Generate(podcast)
+		if !strings.Contains(feed, want) {
+			t.Errorf("%s feed doesn't contain %q:\n%s", format, want, feed)
+		}
+	}
+	if feed := generateJSONFeed(podcast); !strings.Contains(feed, `"type": "WebSub"`) {
+		t.Errorf("JSON Feed hub isn't a WebSub one:\n%s", feed)
+	}
+	podcast.Hub = ""
+	if feed := generateRSS(podcast); strings.Contains(feed, `rel="hub"`) {
+		t.Errorf("feed has a hub without --hub:\n%s", feed)
+	}
+}
+
+func TestPodcastDigest(t *testing.T) {
+	podcast := &Podcast{Title: "Book", Episodes: []Episode{{Title: "One", FileSize: 100}}}
+	digest, err := podcastDigest(podcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podcast.Warnings = []Warning{{warnMissingCover, "", "no cover image found"}}
+	if again, _ := podcastDigest(podcast); again != digest {
+		t.Errorf("digest changed with the warnings: %s, was %s", again, digest)
+	}
+	podcast.Episodes = append(podcast.Episodes, Episode{Title: "Two"})
+	if changed, _ := podcastDigest(podcast); changed == digest {
+		t.Error("digest unchanged by a new episode")
+	}
+}
+
+func TestNotifyHub(t *testing.T) {
+	hub := &testHub{}
+	hubServer := httptest.NewServer(hub)
+	defer hubServer.Close()
+	dir := t.TempDir()
+	podcast := &Podcast{Title: "Book", FeedURL: "https://example.com/Book/podcast.rss", Hub: hubServer.URL}
+
+	for i, want := range []bool{true, false} {
+		pinged, err := notifyHub(dir, podcast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pinged != want {
+			t.Errorf("notifyHub #%d pinged = %v, want %v", i+1, pinged, want)
+		}
+	}
+	if got := hub.pings(); len(got) != 1 || got[0] != podcast.FeedURL {
+		t.Errorf("hub pinged about %v, want [%s]", got, podcast.FeedURL)
+	}
+
+	// A failed ping is tried again on the next run
+	podcast.Title = "Book, Retitled"
+	hub.setStatus(http.StatusInternalServerError)
+	if _, err := notifyHub(dir, podcast); err == nil {
+		t.Error("notifyHub error = nil with the hub failing")
+	}
+	hub.setStatus(0)
+	if pinged, err := notifyHub(dir, podcast); err != nil || !pinged {
+		t.Errorf("notifyHub after a failure = %v, %v, want a ping", pinged, err)
+	}
+}
+
+func TestNotifyHubRescan(t *testing.T) {
+	hub := &testHub{}
+	hubServer := httptest.NewServer(hub)
+	defer hubServer.Close()
+	dir := t.TempDir()
+	copyFixture(t, dir, "chapter01.mp3")
+	copyFixture(t, dir, "chapter02.mp3")
+
+	// Each scan dates the episodes by when it ran
+	for i := range 2 {
+		podcast, err := scanDirectory(dir, Options{BaseURL: "https://example.com/Book", NoCache: true, Hub: hubServer.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := notifyHub(dir, podcast); err != nil {
+			t.Fatalf("notifyHub #%d error = %v", i+1, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := hub.pings(); len(got) != 1 {
+		t.Errorf("hub pinged %d times about an unchanged book, want 1", len(got))
+	}
+}
+
+func TestFeedServerNotifyHub(t *testing.T) {
+	hub := &testHub{}
+	hubServer := httptest.NewServer(hub)
+	defer hubServer.Close()
+
+	dir := filepath.Join(t.TempDir(), "Book")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	s, err := newFeedServer(filepath.Dir(dir), []libraryBook{{Dir: dir}}, "https://books.example.com", Options{NoCache: true, Hub: hubServer.URL}, feedFormats["rss"], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.notifyHub(s.servedBooks())
+	s.notifyHub(s.servedBooks())
+	if got := hub.pings(); len(got) != 0 {
+		t.Errorf("hub pinged about %v for an unchanged library", got)
+	}
+	copyFixture(t, dir, "chapter02.mp3")
+	s.notifyHub(s.servedBooks())
+	if got, want := hub.pings(), "https://books.example.com/Book/podcast.rss"; len(got) != 1 || got[0] != want {
+		t.Errorf("hub pinged about %v, want [%s]", got, want)
+	}
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+	if _, body := serveGet(t, server.URL+"/Book/podcast.rss"); !strings.Contains(body, `<atom:link href="`+hubServer.URL+`" rel="hub">`) {
+		t.Errorf("served feed doesn't announce the hub:\n%s", body)
+	}
+}
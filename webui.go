@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// editPathPrefix is where the web page's metadata forms are, followed by
+// a book's Prefix.
+const editPathPrefix = "/edit"
+
+const webUIStyle = `<style>
+body { font-family: system-ui, sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #222; }
+ul.books { list-style: none; padding: 0; display: grid; grid-template-columns: repeat(auto-fill, minmax(16em, 1fr)); gap: 1.5em; }
+.books img, .books .nocover { width: 100%; aspect-ratio: 1; object-fit: cover; border-radius: 4px; background: #ddd; }
+.books h2 { font-size: 1.1em; margin: 0.5em 0 0.2em; }
+.books p { margin: 0.2em 0; color: #555; font-size: 0.9em; }
+.feed { display: flex; gap: 0.3em; margin-top: 0.5em; }
+.feed input { flex: 1; min-width: 0; }
+form label { display: block; margin: 1em 0 0.2em; font-weight: bold; }
+form input[type=text] { width: 100%; box-sizing: border-box; }
+form small { color: #555; }
+</style>`
+
+var serveIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>bookast</title>
+` + webUIStyle + `
+<script>
+function copyFeed(button) {
+	const input = button.previousElementSibling;
+	input.select();
+	// The clipboard API is only there over HTTPS and on localhost
+	if (navigator.clipboard) {
+		navigator.clipboard.writeText(input.value);
+	} else {
+		document.execCommand("copy");
+	}
+	button.textContent = "Copied";
+	setTimeout(() => button.textContent = "Copy", 2000);
+}
+</script>
+</head>
+<body>
+<h1>Feeds</h1>
+<ul class="books">
+{{range .}}<li>
+{{if .Cover}}<img src="{{.Cover}}" alt="" loading="lazy">{{else}}<div class="nocover"></div>{{end}}
+<h2><a href="{{.URL}}">{{.Name}}</a></h2>
+{{with .Parent}}<p>{{.}}</p>{{end}}
+{{with .Authors}}<p>By {{.}}</p>{{end}}
+{{with .Narrators}}<p>Read by {{.}}</p>{{end}}
+{{with .Error}}<p>{{.}}</p>{{end}}
+<div class="feed"><input type="text" value="{{.URL}}" readonly aria-label="Feed URL"><button type="button" onclick="copyFeed(this)">Copy</button></div>
+{{with .Edit}}<p><a href="{{.}}">Edit</a></p>{{end}}
+</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// indexEntry is a book on the web page.
+type indexEntry struct {
+	Name      string
+	Parent    string // "Author/Series", with --layout
+	URL       string // Of the feed
+	Cover     string
+	Authors   string
+	Narrators string
+	Error     string // Why book.yaml couldn't be read
+	Edit      string // Of the metadata form, with --edit
+}
+
+// serveIndex is the web page listing the books with their covers and
+// feeds, to copy into a podcast app.
+func (s *feedServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	var entries []indexEntry
+	for _, book := range s.servedBooks() {
+		entry := indexEntry{
+			Name:   filepath.Base(filepath.Clean(book.Dir)),
+			Parent: strings.Join(book.Parent, "/"),
+			URL:    s.feedURL(r, book),
+		}
+		if cover := findCover(book.Dir); cover != "" {
+			entry.Cover = buildURL(book.baseURL(s.requestBaseURL(r)), book.Dir, cover)
+		}
+		if config, err := loadBookConfig(book.Dir); err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Authors = strings.Join(config.Authors, ", ")
+			entry.Narrators = strings.Join(config.Narrators, ", ")
+		}
+		if s.editable {
+			entry.Edit = s.editURL(r, book)
+		}
+		entries = append(entries, entry)
+	}
+	var page bytes.Buffer
+	if err := serveIndexTemplate.Execute(&page, entries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveCompressible(w, r, "index.html", time.Time{}, page.Bytes())
+}
+
+// findCover returns the name of the image in dir the feed uses as cover
+// art, "" if there's none.
+func findCover(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	cover := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !coverImageExts[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		if cover == "" || !isCoverName(cover) && isCoverName(name) {
+			cover = name
+		}
+	}
+	return cover
+}
+
+// editURL returns the URL of book's metadata form.
+func (s *feedServer) editURL(r *http.Request, book servedBook) string {
+	segments := strings.Split(strings.Trim(book.Prefix, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return s.requestBaseURL(r) + editPathPrefix + "/" + strings.Join(segments, "/") + "/"
+}
+
+var editTemplate = template.Must(template.New("edit").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Name}} - bookast</title>
+` + webUIStyle + `
+</head>
+<body>
+<p><a href="{{.Index}}">All books</a></p>
+<h1>{{.Name}}</h1>
+{{with .Error}}<p><strong>{{.}}</strong></p>{{end}}
+<form method="post">
+<label for="authors">Authors</label>
+<input type="text" id="authors" name="authors" value="{{.Authors}}">
+<label for="narrators">Narrators</label>
+<input type="text" id="narrators" name="narrators" value="{{.Narrators}}">
+<label for="keywords">Keywords</label>
+<input type="text" id="keywords" name="keywords" value="{{.Keywords}}">
+<small>Separated by commas. Left empty, the tags are used.</small>
+<label for="language">Language</label>
+<input type="text" id="language" name="language" value="{{.Language}}">
+<small>A code such as en or en-gb.</small>
+<label for="isbn">ISBN</label>
+<input type="text" id="isbn" name="isbn" value="{{.ISBN}}">
+<label for="asin">ASIN</label>
+<input type="text" id="asin" name="asin" value="{{.ASIN}}">
+<p><button type="submit">Save to {{.File}}</button></p>
+</form>
+</body>
+</html>
+`))
+
+// editForm is the metadata form's fields, as shown and as submitted.
+type editForm struct {
+	Name      string
+	Index     string
+	File      string
+	Error     string
+	Authors   string
+	Narrators string
+	Keywords  string
+	Language  string
+	ISBN      string
+	ASIN      string
+}
+
+// patch returns the change the submitted form makes to book.yaml.
+func (f editForm) patch() bookConfigPatch {
+	authors, narrators, keywords := splitList(f.Authors), splitList(f.Narrators), splitList(f.Keywords)
+	return bookConfigPatch{
+		Authors:   &authors,
+		Narrators: &narrators,
+		Keywords:  &keywords,
+		Language:  &f.Language,
+		ISBN:      &f.ISBN,
+		ASIN:      &f.ASIN,
+	}
+}
+
+// serveEdit shows the form editing the book.yaml of the book at urlPath,
+// under editPathPrefix, and saves it when it's submitted. Only the fields
+// on the form change, the rest of book.yaml is kept.
+func (s *feedServer) serveEdit(w http.ResponseWriter, r *http.Request, urlPath string) {
+	var book servedBook
+	found := false
+	for _, b := range s.servedBooks() {
+		if b.Prefix == urlPath {
+			book, found = b, true
+		}
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	form := editForm{
+		Name:  filepath.Base(filepath.Clean(book.Dir)),
+		Index: s.requestBaseURL(r) + "/",
+		File:  bookConfigFile,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Scans read book.yaml under s.mu, they see it before or after
+	s.mu.Lock()
+	config, err := loadBookConfig(book.Dir)
+	if err == nil && r.Method == http.MethodPost {
+		form.Authors = r.PostFormValue("authors")
+		form.Narrators = r.PostFormValue("narrators")
+		form.Keywords = r.PostFormValue("keywords")
+		form.Language = r.PostFormValue("language")
+		form.ISBN = r.PostFormValue("isbn")
+		form.ASIN = r.PostFormValue("asin")
+		if err = form.patch().apply(config); err == nil {
+			err = saveBookConfig(book.Dir, config)
+		}
+		s.mu.Unlock()
+		if err == nil {
+			s.notifyHub([]servedBook{book})
+			http.Redirect(w, r, form.Index, http.StatusSeeOther)
+			return
+		}
+		form.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		s.mu.Unlock()
+		if err != nil {
+			form.Error = err.Error()
+		} else {
+			form.Authors = strings.Join(config.Authors, ", ")
+			form.Narrators = strings.Join(config.Narrators, ", ")
+			form.Keywords = strings.Join(config.Keywords, ", ")
+			form.Language = config.Language
+			form.ISBN = config.ISBN
+			form.ASIN = config.ASIN
+		}
+	}
+	if err := editTemplate.Execute(w, form); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
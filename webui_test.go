@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFeedServerWebUI(t *testing.T) {
+	server, dir := newTestFeedServer(t)
+	if err := os.WriteFile(filepath.Join(dir, bookConfigFile), []byte("authors: [Ursula K. Le Guin]\nnarrators: [Kobna Holdbrook-Smith]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, body := serveGet(t, server.URL+"/")
+	for _, want := range []string{
+		`<img src="` + server.URL + `/Book/cover.jpg"`,
+		`<p>By Ursula K. Le Guin</p>`,
+		`<p>Read by Kobna Holdbrook-Smith</p>`,
+		`<input type="text" value="` + server.URL + `/Book/podcast.rss" readonly`,
+		`onclick="copyFeed(this)"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("index doesn't contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "/edit/") {
+		t.Errorf("index links to the metadata form without --edit:\n%s", body)
+	}
+	if resp, _ := serveGet(t, server.URL+"/edit/Book/"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /edit/Book/ without --edit = %s, want 404", resp.Status)
+	}
+	resp, err := http.PostForm(server.URL+"/edit/Book/", url.Values{"authors": {"Someone Else"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /edit/Book/ without --edit = %s, want 405", resp.Status)
+	}
+}
+
+func TestFindCover(t *testing.T) {
+	dir := t.TempDir()
+	if got := findCover(dir); got != "" {
+		t.Errorf("findCover(empty) = %q, want none", got)
+	}
+	for _, name := range []string{"back.jpg", "Cover.PNG", "notes.txt", ".hidden.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := findCover(dir); got != "Cover.PNG" {
+		t.Errorf("findCover = %q, want Cover.PNG", got)
+	}
+}
+
+func TestFeedServerEdit(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Author", "Book One")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, dir, "chapter01.mp3")
+	config := "# Checked against the paperback\nauthors: [Ursula K. Le Guin]\nepisodes:\n  chapter01.mp3:\n    type: bonus\n"
+	if err := os.WriteFile(filepath.Join(dir, bookConfigFile), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newFeedServer(filepath.Dir(filepath.Dir(dir)), []libraryBook{{Dir: dir, Parent: []string{"Author"}}}, "", Options{NoCache: true}, feedFormats["rss"], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.editable = true
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	_, body := serveGet(t, server.URL+"/")
+	editURL := server.URL + "/edit/Author/Book%20One/"
+	if want := `<a href="` + editURL + `">Edit</a>`; !strings.Contains(body, want) {
+		t.Errorf("index doesn't contain %q:\n%s", want, body)
+	}
+	resp, body := serveGet(t, editURL)
+	if want := `name="authors" value="Ursula K. Le Guin"`; resp.StatusCode != http.StatusOK || !strings.Contains(body, want) {
+		t.Errorf("GET %s = %s, want the form with %q:\n%s", editURL, resp.Status, want, body)
+	}
+	if resp, _ := serveGet(t, server.URL+"/edit/Author/Other/"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET the form of no book = %s, want 404", resp.Status)
+	}
+
+	post := func(form url.Values, header http.Header) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, editURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = header
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		// Not following the redirect back to the index
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp = post(url.Values{"authors": {"Ursula K. Le Guin"}, "narrators": {"Kobna Holdbrook-Smith, Jenny Sterlin"}, "language": {"en-gb"}}, http.Header{})
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != server.URL+"/" {
+		t.Errorf("POST = %s to %q, want 303 to the index", resp.Status, resp.Header.Get("Location"))
+	}
+	book, err := loadBookConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(book.Narrators, "|") != "Kobna Holdbrook-Smith|Jenny Sterlin" || book.Language != "en-gb" {
+		t.Errorf("book.yaml narrators %q, language %q after POST", book.Narrators, book.Language)
+	}
+	if book.Episodes["chapter01.mp3"].Type != "bonus" {
+		t.Errorf("POST lost the episode types: %v", book.Episodes)
+	}
+
+	saved, _ := os.ReadFile(filepath.Join(dir, bookConfigFile))
+	if resp := post(url.Values{"language": {"klingon"}}, http.Header{}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST with a bad language = %s, want 400", resp.Status)
+	}
+	if resp := post(url.Values{"authors": {"Mallory"}}, http.Header{"Sec-Fetch-Site": {"cross-site"}}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-site POST = %s, want 403", resp.Status)
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, bookConfigFile)); string(after) != string(saved) {
+		t.Errorf("rejected POSTs changed book.yaml to:\n%s", after)
+	}
+}
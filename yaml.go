@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeYAML parses src into out, which must be a pointer to a struct.
+// Fields are matched by their `yaml:"name"` tag; unknown keys are an error
+// so typos don't go unnoticed, and a single value where a list goes is a
+// one-item list.
+func decodeYAML(src string, out any) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	if err := checkYAMLNode(doc.Content[0], reflect.TypeOf(out).Elem()); err != nil {
+		return err
+	}
+	return doc.Content[0].Decode(out)
+}
+
+// checkYAMLNode rejects keys node has that t doesn't, which yaml.v3 only
+// does through its Decoder, and makes single values where t has lists
+// into one-item lists. Anything else that doesn't fit is left to Decode.
+func checkYAMLNode(node *yaml.Node, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := yamlField(t, key.Value)
+			if !ok {
+				return fmt.Errorf("line %d: unknown key %q", key.Line, key.Value)
+			}
+			if err := checkYAMLNode(value, field.Type); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := checkYAMLNode(node.Content[i], t.Elem()); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		if node.Kind == yaml.ScalarNode && node.ShortTag() != "!!null" {
+			item := *node
+			*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: item.Line, Column: item.Column, Content: []*yaml.Node{&item}}
+		}
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for _, item := range node.Content {
+			if err := checkYAMLNode(item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlField returns the field of struct type t that key decodes into.
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if name == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	type inner struct {
+		Type string `yaml:"type"`
+	}
+	type doc struct {
+		Title    string           `yaml:"title"`
+		Year     int              `yaml:"year"`
+		Rating   float64          `yaml:"rating"`
+		Explicit bool             `yaml:"explicit"`
+		Keywords []string         `yaml:"keywords"`
+		Timeout  time.Duration    `yaml:"timeout"`
+		Episodes map[string]inner `yaml:"episodes"`
+		Owner    *inner           `yaml:"owner"`
+	}
+
+	input := `# Frank Herbert
+title: Dune
+year: 1965
+rating: 4.5
+explicit: yes
+keywords: sci-fi
+timeout: 90s
+episodes:
+  01.mp3:
+    type: trailer
+owner:
+  type: person
+`
+	var result doc
+	if err := decodeYAML(input, &result); err != nil {
+		t.Fatalf("decodeYAML() error = %v", err)
+	}
+
+	expected := doc{
+		Title:    "Dune",
+		Year:     1965,
+		Rating:   4.5,
+		Explicit: true,
+		Keywords: []string{"sci-fi"},
+		Timeout:  90 * time.Second,
+		Episodes: map[string]inner{"01.mp3": {Type: "trailer"}},
+		Owner:    &inner{Type: "person"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("decodeYAML() = %+v, want %+v", result, expected)
+	}
+}
+
+func TestDecodeYAMLErrors(t *testing.T) {
+	type doc struct {
+		Year int `yaml:"year"`
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown key", "yeer: 1965\n"},
+		{"wrong type", "year: soon\n"},
+		{"mapping for scalar", "year:\n  a: b\n"},
+		{"bad syntax", "year: [1965\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result doc
+			err := decodeYAML(tt.input, &result)
+			if err == nil {
+				t.Errorf("decodeYAML() = %+v, want error", result)
+			} else if !strings.Contains(err.Error(), "line ") {
+				t.Errorf("decodeYAML() error = %v, want its line", err)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLEmpty(t *testing.T) {
+	type doc struct {
+		Year int `yaml:"year"`
+	}
+	for _, input := range []string{"", "# nothing yet\n", "---\n"} {
+		var result doc
+		if err := decodeYAML(input, &result); err != nil || result.Year != 0 {
+			t.Errorf("decodeYAML(%q) = %+v, %v, want nothing", input, result, err)
+		}
+	}
+}